@@ -2,20 +2,16 @@ package main
 
 import (
 	"bytes"
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
-	"crypto/rsa"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 
 	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
 	"github.com/lestrrat-go/jwx/v2/jwk"
-	"github.com/lestrrat-go/jwx/v2/x25519"
 	"github.com/urfave/cli/v2"
-	"golang.org/x/crypto/ed25519"
 )
 
 func init() {
@@ -54,6 +50,8 @@ func makeJwkCmd() *cli.Command {
 	cmd.Subcommands = []*cli.Command{
 		makeJwkGenerateCmd(),
 		makeJwkFormatCmd(),
+		makeJwkEncryptCmd(),
+		makeJwkDecryptCmd(),
 	}
 	return &cmd
 }
@@ -110,7 +108,7 @@ func makeJwkGenerateCmd() *cli.Command {
 		&cli.StringFlag{
 			Name:    "curve",
 			Aliases: []string{"c"},
-			Usage:   "Elliptic curve name `CURVE` (" + crvnames.String() + ") for ECDSA and OKP keys",
+			Usage:   "Elliptic curve name `CURVE` (" + crvnames.String() + ") for ECDSA keys, or (Ed25519/X25519/Ed448/X448) for OKP keys",
 		},
 		&cli.StringFlag{
 			Name:  "template",
@@ -119,8 +117,7 @@ func makeJwkGenerateCmd() *cli.Command {
 		&cli.IntFlag{
 			Name:    "keysize",
 			Aliases: []string{"s"},
-			Usage:   "Integer `SIZE` for RSA and oct key sizes",
-			Value:   2048,
+			Usage:   "Integer `SIZE` for RSA (in bits, default 2048) and oct (in bytes, default 32) key sizes",
 		},
 		publicKeyFlag(),
 		outputFlag(),
@@ -129,73 +126,29 @@ func makeJwkGenerateCmd() *cli.Command {
 	}
 
 	cmd.Action = func(c *cli.Context) error {
-		var rawkey interface{}
-		switch typ := jwa.KeyType(c.String("type")); typ {
-		case jwa.RSA:
-			v, err := rsa.GenerateKey(rand.Reader, c.Int("keysize"))
-			if err != nil {
-				return fmt.Errorf(`failed to generate rsa private key: %w`, err)
-			}
-			rawkey = v
-		case jwa.EC:
-			var crv elliptic.Curve
-
-			var crvalg jwa.EllipticCurveAlgorithm
-			if err := crvalg.Accept(c.String("curve")); err != nil {
-				return fmt.Errorf(`invalid elliptic curve name %s: %w`, c.String("curve"), err)
-			}
-
-			crv, ok := jwk.CurveForAlgorithm(crvalg)
-			if !ok {
-				return fmt.Errorf(`invalid elliptic curve for ECDSA: %s (expected %s)`, crvalg, crvnames.String())
-			}
-
-			v, err := ecdsa.GenerateKey(crv, rand.Reader)
-			if err != nil {
-				return fmt.Errorf(`failed to generate ECDSA private key: %w`, err)
-			}
-			rawkey = v
-		case jwa.OctetSeq:
-			octets := make([]byte, c.Int("keysize"))
-			rand.Reader.Read(octets)
-
-			rawkey = octets
-		case jwa.OKP:
+		var options []jwk.GenerateOption
+		if v := c.String("curve"); v != "" {
 			var crvalg jwa.EllipticCurveAlgorithm
-			if err := crvalg.Accept(c.String("curve")); err != nil {
-				return fmt.Errorf(`invalid elliptic curve name: %w`, err)
+			if err := crvalg.Accept(v); err != nil {
+				return fmt.Errorf(`invalid elliptic curve name %s: %w`, v, err)
 			}
+			options = append(options, jwk.WithCurve(crvalg))
+		}
+		if c.IsSet("keysize") {
+			options = append(options, jwk.WithRSAKeySize(c.Int("keysize")), jwk.WithSymmetricKeyLength(c.Int("keysize")))
+		}
 
-			switch crvalg {
-			case jwa.Ed25519:
-				_, priv, err := ed25519.GenerateKey(rand.Reader)
-				if err != nil {
-					return fmt.Errorf(`failed to generate ed25519 private key: %w`, err)
-				}
-				rawkey = priv
-			case jwa.X25519:
-				_, priv, err := x25519.GenerateKey(rand.Reader)
-				if err != nil {
-					return fmt.Errorf(`failed to generate x25519 private key: %w`, err)
-				}
-				rawkey = priv
-			default:
-				return fmt.Errorf(`invalid elliptic curve for OKP: %s (expected %s/%s)`, crvalg, jwa.Ed25519, jwa.X25519)
-			}
-		default:
-			return fmt.Errorf(`invalid key type %s`, typ)
+		key, err := jwk.Generate(jwa.KeyType(c.String("type")), options...)
+		if err != nil {
+			return fmt.Errorf(`failed to generate new JWK: %w`, err)
 		}
+
 		var attrs map[string]interface{}
 		if tmpl := c.String("template"); tmpl != "" {
 			if err := json.Unmarshal([]byte(tmpl), &attrs); err != nil {
 				return fmt.Errorf(`failed to unmarshal template: %w`, err)
 			}
 		}
-		key, err := jwk.FromRaw(rawkey)
-		if err != nil {
-			return fmt.Errorf(`failed to create new JWK from raw key: %w`, err)
-		}
-
 		for k, v := range attrs {
 			if err := key.Set(k, v); err != nil {
 				return fmt.Errorf(`failed to set field %s: %w`, k, err)
@@ -291,3 +244,167 @@ func makeJwkFormatCmd() *cli.Command {
 	}
 	return &cmd
 }
+
+const passwordEnvVar = `JWX_PASSWORD`
+
+func passwordFileFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "password-file",
+		Aliases: []string{"P"},
+		Usage:   "Read password from `FILE` (if unspecified, the " + passwordEnvVar + " environment variable is used)",
+	}
+}
+
+func getPassword(c *cli.Context) ([]byte, error) {
+	if filename := c.String("password-file"); filename != "" {
+		buf, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to read password file: %w`, err)
+		}
+		buf = bytes.TrimRight(buf, "\r\n")
+		if len(buf) == 0 {
+			return nil, fmt.Errorf(`password file %s is empty`, filename)
+		}
+		return buf, nil
+	}
+
+	if v, ok := os.LookupEnv(passwordEnvVar); ok && v != "" {
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf(`password must be specified via --password-file or the %s environment variable`, passwordEnvVar)
+}
+
+func makeJwkEncryptCmd() *cli.Command {
+	var cmd cli.Command
+	cmd.Name = "encrypt"
+	cmd.Usage = "Encrypt JWK or JWK set using a password"
+	cmd.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "input-format",
+			Aliases: []string{"I"},
+			Value:   "json",
+			Usage:   "Input format `INPUT` (json/pem)",
+		},
+		&cli.StringFlag{
+			Name:    "content-encryption",
+			Aliases: []string{"C"},
+			Value:   jwa.A256GCM.String(),
+			Usage:   "Content encryption algorithm name `NAME` (e.g. A128CBC-HS256, A192GCM, A256GCM, etc)",
+		},
+		passwordFileFlag(),
+		jwkSetFlag(),
+		outputFlag(),
+	}
+
+	// jwx jwk encrypt <file>
+	cmd.Action = func(c *cli.Context) error {
+		if c.Args().Get(0) == "" {
+			cli.ShowCommandHelpAndExit(c, "encrypt", 1)
+		}
+
+		password, err := getPassword(c)
+		if err != nil {
+			return err
+		}
+
+		var cntenc jwa.ContentEncryptionAlgorithm
+		if err := cntenc.Accept(c.String("content-encryption")); err != nil {
+			return fmt.Errorf(`invalid content encryption algorithm: %w`, err)
+		}
+
+		src, err := getSource(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		buf, err := ioutil.ReadAll(src)
+		if err != nil {
+			return fmt.Errorf(`failed to read data from source: %w`, err)
+		}
+
+		var options []jwk.ParseOption
+		switch format := c.String("input-format"); format {
+		case "json":
+		case "pem":
+			options = append(options, jwk.WithPEM(true))
+		default:
+			return fmt.Errorf(`invalid input format %s`, format)
+		}
+
+		keyset, err := jwk.Parse(buf, options...)
+		if err != nil {
+			return fmt.Errorf(`failed to parse keyset: %w`, err)
+		}
+
+		var encrypted []byte
+		if !c.Bool("set") && keyset.Len() == 1 {
+			key, _ := keyset.Get(0)
+			encrypted, err = jwe.EncryptKey(key, password, jwe.WithContentEncryption(cntenc))
+		} else {
+			encrypted, err = jwe.EncryptSet(keyset, password, jwe.WithContentEncryption(cntenc))
+		}
+		if err != nil {
+			return fmt.Errorf(`failed to encrypt keyset: %w`, err)
+		}
+
+		output, err := getOutput(c.String("output"))
+		if err != nil {
+			return err
+		}
+		defer output.Close()
+
+		fmt.Fprintf(output, "%s", encrypted)
+		return nil
+	}
+	return &cmd
+}
+
+func makeJwkDecryptCmd() *cli.Command {
+	var cmd cli.Command
+	cmd.Name = "decrypt"
+	cmd.Usage = "Decrypt JWK or JWK set encrypted using a password"
+	cmd.Flags = []cli.Flag{
+		passwordFileFlag(),
+		jwkOutputFormatFlag(),
+		jwkSetFlag(),
+		outputFlag(),
+	}
+
+	// jwx jwk decrypt <file>
+	cmd.Action = func(c *cli.Context) error {
+		if c.Args().Get(0) == "" {
+			cli.ShowCommandHelpAndExit(c, "decrypt", 1)
+		}
+
+		password, err := getPassword(c)
+		if err != nil {
+			return err
+		}
+
+		src, err := getSource(c.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		buf, err := ioutil.ReadAll(src)
+		if err != nil {
+			return fmt.Errorf(`failed to read data from source: %w`, err)
+		}
+
+		keyset, err := jwe.DecryptSet(bytes.TrimSpace(buf), password)
+		if err != nil {
+			return fmt.Errorf(`failed to decrypt keyset: %w`, err)
+		}
+
+		output, err := getOutput(c.String("output"))
+		if err != nil {
+			return err
+		}
+		defer output.Close()
+
+		return dumpJWKSet(output, keyset, c.String("output-format"), c.Bool("set"))
+	}
+	return &cmd
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// XC20P is the XChaCha20-Poly1305 content encryption algorithm, as
+// described in draft-amringer-jose-chacha. It is not implemented by the
+// jwe package, so the command registers its own implementation.
+const XC20P = jwa.ContentEncryptionAlgorithm("XC20P")
+
+func init() {
+	jwe.RegisterContentCipher(XC20P, jwe.ContentCipherFactoryFn(func() (jwe.ContentCipher, error) {
+		return xc20pCipher{}, nil
+	}))
+}
+
+type xc20pCipher struct{}
+
+func (xc20pCipher) KeySize() int {
+	return chacha20poly1305.KeySize
+}
+
+func (xc20pCipher) Encrypt(cek, plaintext, aad []byte) ([]byte, []byte, []byte, error) {
+	aead, err := chacha20poly1305.NewX(cek)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf(`failed to create XChaCha20-Poly1305 cipher: %w`, err)
+	}
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, fmt.Errorf(`failed to generate nonce: %w`, err)
+	}
+
+	sealed := aead.Seal(nil, iv, plaintext, aad)
+	tagoffset := len(sealed) - aead.Overhead()
+	return iv, sealed[:tagoffset], sealed[tagoffset:], nil
+}
+
+func (xc20pCipher) Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(cek)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to create XChaCha20-Poly1305 cipher: %w`, err)
+	}
+
+	combined := make([]byte, 0, len(ciphertext)+len(tag))
+	combined = append(combined, ciphertext...)
+	combined = append(combined, tag...)
+
+	plaintext, err := aead.Open(nil, iv, combined, aad)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decrypt: %w`, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,93 @@
+package ed448_test
+
+import (
+	"crypto"
+	"encoding/hex"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/ed448"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateKey(t *testing.T) {
+	t.Run("ed448.GenerateKey(nil)", func(t *testing.T) {
+		_, _, err := ed448.GenerateKey(nil)
+		if !assert.NoError(t, err, `ed448.GenerateKey should work even if argument is nil`) {
+			return
+		}
+	})
+	t.Run("ed448.NewKeyFromSeed(wrongSeedLength)", func(t *testing.T) {
+		dummy := make([]byte, ed448.SeedSize-1)
+		_, err := ed448.NewKeyFromSeed(dummy)
+		if !assert.Error(t, err, `wrong seed size should result in error`) {
+			return
+		}
+	})
+}
+
+func TestSignVerify(t *testing.T) {
+	// These test vectors are from RFC8032 Section 7.4
+	testcases := []struct {
+		Name      string
+		Seed      string
+		Public    string
+		Message   string
+		Signature string
+	}{
+		{
+			Name:      "Blank",
+			Seed:      `6c82a562cb808d10d632be89c8513ebf6c929f34ddfa8c9f63c9960ef6e348a3528c8a3fcc2f044e39a3fc5b94492f8f032e7549a20098f95b`,
+			Public:    `5fd7449b59b461fd2ce787ec616ad46a1da1342485a70e1f8a0ea75d80e96778edf124769b46c7061bd6783df1e50f6cd1fa1abeafe8256180`,
+			Message:   ``,
+			Signature: `533a37f6bbe457251f023c0d88f976ae2dfb504a843e34d2074fd823d41a591f2b233f034f628281f2fd7a22ddd47d7828c59bd0a21bfd3980ff0d2028d4b18a9df63e006c5d1c2d345b925d8dc00b4104852db99ac5c7cdda8530a113a0f4dbb61149f05a7363268c71d95808ff2e652600`,
+		},
+		{
+			Name:      "1 octet",
+			Seed:      `c4eab05d357007c632f3dbb48489924d552b08fe0c353a0d4a1f00acda2c463afbea67c5e8d2877c5e3bc397a659949ef8021e954e0a12274e`,
+			Public:    `43ba28f430cdff456ae531545f7ecd0ac834a55d9358c0372bfa0c6c6798c0866aea01eb00742802b8438ea4cb82169c235160627b4c3a9480`,
+			Message:   `03`,
+			Signature: `26b8f91727bd62897af15e41eb43c377efb9c610d48f2335cb0bd0087810f4352541b143c4b981b7e18f62de8ccdf633fc1bf037ab7cd779805e0dbcc0aae1cbcee1afb2e027df36bc04dcecbf154336c19f0af7e0a6472905e799f1953d2a0ff3348ab21aa4adafd1d234441cf807c03a00`,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			seed, err := hex.DecodeString(tc.Seed)
+			if !assert.NoError(t, err, `seed decoded`) {
+				return
+			}
+			message, err := hex.DecodeString(tc.Message)
+			if !assert.NoError(t, err, `message decoded`) {
+				return
+			}
+
+			priv, err := ed448.NewKeyFromSeed(seed)
+			if !assert.NoError(t, err, `ed448.NewKeyFromSeed should succeed`) {
+				return
+			}
+
+			pub := priv.Public().(ed448.PublicKey)
+			if !assert.Equal(t, tc.Public, hex.EncodeToString(pub), `public key should match`) {
+				return
+			}
+
+			signature, err := priv.Sign(nil, message, crypto.Hash(0))
+			if !assert.NoError(t, err, `priv.Sign should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.Signature, hex.EncodeToString(signature), `signature should match`) {
+				return
+			}
+
+			if !assert.True(t, ed448.Verify(pub, message, signature), `ed448.Verify should succeed`) {
+				return
+			}
+
+			signature[0] ^= 0x01
+			if !assert.False(t, ed448.Verify(pub, message, signature), `ed448.Verify should fail`) {
+				return
+			}
+		})
+	}
+}
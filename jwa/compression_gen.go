@@ -22,20 +22,40 @@ var allCompressionAlgorithms = map[CompressionAlgorithm]struct{}{
 	NoCompress: {},
 }
 
-var listCompressionAlgorithmOnce sync.Once
+var muCompressionAlgorithms sync.RWMutex
 var listCompressionAlgorithm []CompressionAlgorithm
 
+func init() {
+	muCompressionAlgorithms.Lock()
+	defer muCompressionAlgorithms.Unlock()
+	rebuildCompressionAlgorithm()
+}
+
+// RegisterCompressionAlgorithm registers a new CompressionAlgorithm so that the jwx can properly handle the new value.
+// Duplicates will silently be ignored
+func RegisterCompressionAlgorithm(v CompressionAlgorithm) {
+	muCompressionAlgorithms.Lock()
+	defer muCompressionAlgorithms.Unlock()
+	if _, ok := allCompressionAlgorithms[v]; !ok {
+		allCompressionAlgorithms[v] = struct{}{}
+		rebuildCompressionAlgorithm()
+	}
+}
+
+func rebuildCompressionAlgorithm() {
+	listCompressionAlgorithm = make([]CompressionAlgorithm, 0, len(allCompressionAlgorithms))
+	for v := range allCompressionAlgorithms {
+		listCompressionAlgorithm = append(listCompressionAlgorithm, v)
+	}
+	sort.Slice(listCompressionAlgorithm, func(i, j int) bool {
+		return string(listCompressionAlgorithm[i]) < string(listCompressionAlgorithm[j])
+	})
+}
+
 // CompressionAlgorithms returns a list of all available values for CompressionAlgorithm
 func CompressionAlgorithms() []CompressionAlgorithm {
-	listCompressionAlgorithmOnce.Do(func() {
-		listCompressionAlgorithm = make([]CompressionAlgorithm, 0, len(allCompressionAlgorithms))
-		for v := range allCompressionAlgorithms {
-			listCompressionAlgorithm = append(listCompressionAlgorithm, v)
-		}
-		sort.Slice(listCompressionAlgorithm, func(i, j int) bool {
-			return string(listCompressionAlgorithm[i]) < string(listCompressionAlgorithm[j])
-		})
-	})
+	muCompressionAlgorithms.RLock()
+	defer muCompressionAlgorithms.RUnlock()
 	return listCompressionAlgorithm
 }
 
@@ -57,7 +77,10 @@ func (v *CompressionAlgorithm) Accept(value interface{}) error {
 		}
 		tmp = CompressionAlgorithm(s)
 	}
-	if _, ok := allCompressionAlgorithms[tmp]; !ok {
+	muCompressionAlgorithms.RLock()
+	_, ok := allCompressionAlgorithms[tmp]
+	muCompressionAlgorithms.RUnlock()
+	if !ok {
 		return fmt.Errorf(`invalid jwa.CompressionAlgorithm value`)
 	}
 
@@ -112,5 +112,20 @@ func TestCompressionAlgorithm(t *testing.T) {
 		if !assert.Len(t, expected, 0) {
 			return
 		}
+
+		// Registering a new value must be done after the list of
+		// elements has been checked, or else it would show up in the list
+		const value = `custom-CompressionAlgorithm-value`
+		var dst jwa.CompressionAlgorithm
+		if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {
+			return
+		}
+		jwa.RegisterCompressionAlgorithm(jwa.CompressionAlgorithm(value))
+		if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {
+			return
+		}
+		if !assert.Contains(t, jwa.CompressionAlgorithms(), jwa.CompressionAlgorithm(value), `registered value should be listed`) {
+			return
+		}
 	})
 }
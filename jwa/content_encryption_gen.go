@@ -30,20 +30,40 @@ var allContentEncryptionAlgorithms = map[ContentEncryptionAlgorithm]struct{}{
 	A256GCM:       {},
 }
 
-var listContentEncryptionAlgorithmOnce sync.Once
+var muContentEncryptionAlgorithms sync.RWMutex
 var listContentEncryptionAlgorithm []ContentEncryptionAlgorithm
 
+func init() {
+	muContentEncryptionAlgorithms.Lock()
+	defer muContentEncryptionAlgorithms.Unlock()
+	rebuildContentEncryptionAlgorithm()
+}
+
+// RegisterContentEncryptionAlgorithm registers a new ContentEncryptionAlgorithm so that the jwx can properly handle the new value.
+// Duplicates will silently be ignored
+func RegisterContentEncryptionAlgorithm(v ContentEncryptionAlgorithm) {
+	muContentEncryptionAlgorithms.Lock()
+	defer muContentEncryptionAlgorithms.Unlock()
+	if _, ok := allContentEncryptionAlgorithms[v]; !ok {
+		allContentEncryptionAlgorithms[v] = struct{}{}
+		rebuildContentEncryptionAlgorithm()
+	}
+}
+
+func rebuildContentEncryptionAlgorithm() {
+	listContentEncryptionAlgorithm = make([]ContentEncryptionAlgorithm, 0, len(allContentEncryptionAlgorithms))
+	for v := range allContentEncryptionAlgorithms {
+		listContentEncryptionAlgorithm = append(listContentEncryptionAlgorithm, v)
+	}
+	sort.Slice(listContentEncryptionAlgorithm, func(i, j int) bool {
+		return string(listContentEncryptionAlgorithm[i]) < string(listContentEncryptionAlgorithm[j])
+	})
+}
+
 // ContentEncryptionAlgorithms returns a list of all available values for ContentEncryptionAlgorithm
 func ContentEncryptionAlgorithms() []ContentEncryptionAlgorithm {
-	listContentEncryptionAlgorithmOnce.Do(func() {
-		listContentEncryptionAlgorithm = make([]ContentEncryptionAlgorithm, 0, len(allContentEncryptionAlgorithms))
-		for v := range allContentEncryptionAlgorithms {
-			listContentEncryptionAlgorithm = append(listContentEncryptionAlgorithm, v)
-		}
-		sort.Slice(listContentEncryptionAlgorithm, func(i, j int) bool {
-			return string(listContentEncryptionAlgorithm[i]) < string(listContentEncryptionAlgorithm[j])
-		})
-	})
+	muContentEncryptionAlgorithms.RLock()
+	defer muContentEncryptionAlgorithms.RUnlock()
 	return listContentEncryptionAlgorithm
 }
 
@@ -65,7 +85,10 @@ func (v *ContentEncryptionAlgorithm) Accept(value interface{}) error {
 		}
 		tmp = ContentEncryptionAlgorithm(s)
 	}
-	if _, ok := allContentEncryptionAlgorithms[tmp]; !ok {
+	muContentEncryptionAlgorithms.RLock()
+	_, ok := allContentEncryptionAlgorithms[tmp]
+	muContentEncryptionAlgorithms.RUnlock()
+	if !ok {
 		return fmt.Errorf(`invalid jwa.ContentEncryptionAlgorithm value`)
 	}
 
@@ -260,5 +260,20 @@ func TestContentEncryptionAlgorithm(t *testing.T) {
 		if !assert.Len(t, expected, 0) {
 			return
 		}
+
+		// Registering a new value must be done after the list of
+		// elements has been checked, or else it would show up in the list
+		const value = `custom-ContentEncryptionAlgorithm-value`
+		var dst jwa.ContentEncryptionAlgorithm
+		if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {
+			return
+		}
+		jwa.RegisterContentEncryptionAlgorithm(jwa.ContentEncryptionAlgorithm(value))
+		if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {
+			return
+		}
+		if !assert.Contains(t, jwa.ContentEncryptionAlgorithms(), jwa.ContentEncryptionAlgorithm(value), `registered value should be listed`) {
+			return
+		}
 	})
 }
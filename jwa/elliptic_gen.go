@@ -33,20 +33,40 @@ var allEllipticCurveAlgorithms = map[EllipticCurveAlgorithm]struct{}{
 	X448:    {},
 }
 
-var listEllipticCurveAlgorithmOnce sync.Once
+var muEllipticCurveAlgorithms sync.RWMutex
 var listEllipticCurveAlgorithm []EllipticCurveAlgorithm
 
+func init() {
+	muEllipticCurveAlgorithms.Lock()
+	defer muEllipticCurveAlgorithms.Unlock()
+	rebuildEllipticCurveAlgorithm()
+}
+
+// RegisterEllipticCurveAlgorithm registers a new EllipticCurveAlgorithm so that the jwx can properly handle the new value.
+// Duplicates will silently be ignored
+func RegisterEllipticCurveAlgorithm(v EllipticCurveAlgorithm) {
+	muEllipticCurveAlgorithms.Lock()
+	defer muEllipticCurveAlgorithms.Unlock()
+	if _, ok := allEllipticCurveAlgorithms[v]; !ok {
+		allEllipticCurveAlgorithms[v] = struct{}{}
+		rebuildEllipticCurveAlgorithm()
+	}
+}
+
+func rebuildEllipticCurveAlgorithm() {
+	listEllipticCurveAlgorithm = make([]EllipticCurveAlgorithm, 0, len(allEllipticCurveAlgorithms))
+	for v := range allEllipticCurveAlgorithms {
+		listEllipticCurveAlgorithm = append(listEllipticCurveAlgorithm, v)
+	}
+	sort.Slice(listEllipticCurveAlgorithm, func(i, j int) bool {
+		return string(listEllipticCurveAlgorithm[i]) < string(listEllipticCurveAlgorithm[j])
+	})
+}
+
 // EllipticCurveAlgorithms returns a list of all available values for EllipticCurveAlgorithm
 func EllipticCurveAlgorithms() []EllipticCurveAlgorithm {
-	listEllipticCurveAlgorithmOnce.Do(func() {
-		listEllipticCurveAlgorithm = make([]EllipticCurveAlgorithm, 0, len(allEllipticCurveAlgorithms))
-		for v := range allEllipticCurveAlgorithms {
-			listEllipticCurveAlgorithm = append(listEllipticCurveAlgorithm, v)
-		}
-		sort.Slice(listEllipticCurveAlgorithm, func(i, j int) bool {
-			return string(listEllipticCurveAlgorithm[i]) < string(listEllipticCurveAlgorithm[j])
-		})
-	})
+	muEllipticCurveAlgorithms.RLock()
+	defer muEllipticCurveAlgorithms.RUnlock()
 	return listEllipticCurveAlgorithm
 }
 
@@ -68,7 +88,10 @@ func (v *EllipticCurveAlgorithm) Accept(value interface{}) error {
 		}
 		tmp = EllipticCurveAlgorithm(s)
 	}
-	if _, ok := allEllipticCurveAlgorithms[tmp]; !ok {
+	muEllipticCurveAlgorithms.RLock()
+	_, ok := allEllipticCurveAlgorithms[tmp]
+	muEllipticCurveAlgorithms.RUnlock()
+	if !ok {
 		return fmt.Errorf(`invalid jwa.EllipticCurveAlgorithm value`)
 	}
 
@@ -309,5 +309,20 @@ func TestEllipticCurveAlgorithm(t *testing.T) {
 		if !assert.Len(t, expected, 0) {
 			return
 		}
+
+		// Registering a new value must be done after the list of
+		// elements has been checked, or else it would show up in the list
+		const value = `custom-EllipticCurveAlgorithm-value`
+		var dst jwa.EllipticCurveAlgorithm
+		if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {
+			return
+		}
+		jwa.RegisterEllipticCurveAlgorithm(jwa.EllipticCurveAlgorithm(value))
+		if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {
+			return
+		}
+		if !assert.Contains(t, jwa.EllipticCurveAlgorithms(), jwa.EllipticCurveAlgorithm(value), `registered value should be listed`) {
+			return
+		}
 	})
 }
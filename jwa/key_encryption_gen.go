@@ -52,20 +52,40 @@ var allKeyEncryptionAlgorithms = map[KeyEncryptionAlgorithm]struct{}{
 	RSA_OAEP_256:       {},
 }
 
-var listKeyEncryptionAlgorithmOnce sync.Once
+var muKeyEncryptionAlgorithms sync.RWMutex
 var listKeyEncryptionAlgorithm []KeyEncryptionAlgorithm
 
+func init() {
+	muKeyEncryptionAlgorithms.Lock()
+	defer muKeyEncryptionAlgorithms.Unlock()
+	rebuildKeyEncryptionAlgorithm()
+}
+
+// RegisterKeyEncryptionAlgorithm registers a new KeyEncryptionAlgorithm so that the jwx can properly handle the new value.
+// Duplicates will silently be ignored
+func RegisterKeyEncryptionAlgorithm(v KeyEncryptionAlgorithm) {
+	muKeyEncryptionAlgorithms.Lock()
+	defer muKeyEncryptionAlgorithms.Unlock()
+	if _, ok := allKeyEncryptionAlgorithms[v]; !ok {
+		allKeyEncryptionAlgorithms[v] = struct{}{}
+		rebuildKeyEncryptionAlgorithm()
+	}
+}
+
+func rebuildKeyEncryptionAlgorithm() {
+	listKeyEncryptionAlgorithm = make([]KeyEncryptionAlgorithm, 0, len(allKeyEncryptionAlgorithms))
+	for v := range allKeyEncryptionAlgorithms {
+		listKeyEncryptionAlgorithm = append(listKeyEncryptionAlgorithm, v)
+	}
+	sort.Slice(listKeyEncryptionAlgorithm, func(i, j int) bool {
+		return string(listKeyEncryptionAlgorithm[i]) < string(listKeyEncryptionAlgorithm[j])
+	})
+}
+
 // KeyEncryptionAlgorithms returns a list of all available values for KeyEncryptionAlgorithm
 func KeyEncryptionAlgorithms() []KeyEncryptionAlgorithm {
-	listKeyEncryptionAlgorithmOnce.Do(func() {
-		listKeyEncryptionAlgorithm = make([]KeyEncryptionAlgorithm, 0, len(allKeyEncryptionAlgorithms))
-		for v := range allKeyEncryptionAlgorithms {
-			listKeyEncryptionAlgorithm = append(listKeyEncryptionAlgorithm, v)
-		}
-		sort.Slice(listKeyEncryptionAlgorithm, func(i, j int) bool {
-			return string(listKeyEncryptionAlgorithm[i]) < string(listKeyEncryptionAlgorithm[j])
-		})
-	})
+	muKeyEncryptionAlgorithms.RLock()
+	defer muKeyEncryptionAlgorithms.RUnlock()
 	return listKeyEncryptionAlgorithm
 }
 
@@ -87,7 +107,10 @@ func (v *KeyEncryptionAlgorithm) Accept(value interface{}) error {
 		}
 		tmp = KeyEncryptionAlgorithm(s)
 	}
-	if _, ok := allKeyEncryptionAlgorithms[tmp]; !ok {
+	muKeyEncryptionAlgorithms.RLock()
+	_, ok := allKeyEncryptionAlgorithms[tmp]
+	muKeyEncryptionAlgorithms.RUnlock()
+	if !ok {
 		return fmt.Errorf(`invalid jwa.KeyEncryptionAlgorithm value`)
 	}
 
@@ -721,5 +721,20 @@ func TestKeyEncryptionAlgorithm(t *testing.T) {
 		if !assert.Len(t, expected, 0) {
 			return
 		}
+
+		// Registering a new value must be done after the list of
+		// elements has been checked, or else it would show up in the list
+		const value = `custom-KeyEncryptionAlgorithm-value`
+		var dst jwa.KeyEncryptionAlgorithm
+		if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {
+			return
+		}
+		jwa.RegisterKeyEncryptionAlgorithm(jwa.KeyEncryptionAlgorithm(value))
+		if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {
+			return
+		}
+		if !assert.Contains(t, jwa.KeyEncryptionAlgorithms(), jwa.KeyEncryptionAlgorithm(value), `registered value should be listed`) {
+			return
+		}
 	})
 }
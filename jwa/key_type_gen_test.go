@@ -193,5 +193,20 @@ func TestKeyType(t *testing.T) {
 		if !assert.Len(t, expected, 0) {
 			return
 		}
+
+		// Registering a new value must be done after the list of
+		// elements has been checked, or else it would show up in the list
+		const value = `custom-KeyType-value`
+		var dst jwa.KeyType
+		if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {
+			return
+		}
+		jwa.RegisterKeyType(jwa.KeyType(value))
+		if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {
+			return
+		}
+		if !assert.Contains(t, jwa.KeyTypes(), jwa.KeyType(value), `registered value should be listed`) {
+			return
+		}
 	})
 }
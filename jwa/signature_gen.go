@@ -48,20 +48,40 @@ var allSignatureAlgorithms = map[SignatureAlgorithm]struct{}{
 	RS512:       {},
 }
 
-var listSignatureAlgorithmOnce sync.Once
+var muSignatureAlgorithms sync.RWMutex
 var listSignatureAlgorithm []SignatureAlgorithm
 
+func init() {
+	muSignatureAlgorithms.Lock()
+	defer muSignatureAlgorithms.Unlock()
+	rebuildSignatureAlgorithm()
+}
+
+// RegisterSignatureAlgorithm registers a new SignatureAlgorithm so that the jwx can properly handle the new value.
+// Duplicates will silently be ignored
+func RegisterSignatureAlgorithm(v SignatureAlgorithm) {
+	muSignatureAlgorithms.Lock()
+	defer muSignatureAlgorithms.Unlock()
+	if _, ok := allSignatureAlgorithms[v]; !ok {
+		allSignatureAlgorithms[v] = struct{}{}
+		rebuildSignatureAlgorithm()
+	}
+}
+
+func rebuildSignatureAlgorithm() {
+	listSignatureAlgorithm = make([]SignatureAlgorithm, 0, len(allSignatureAlgorithms))
+	for v := range allSignatureAlgorithms {
+		listSignatureAlgorithm = append(listSignatureAlgorithm, v)
+	}
+	sort.Slice(listSignatureAlgorithm, func(i, j int) bool {
+		return string(listSignatureAlgorithm[i]) < string(listSignatureAlgorithm[j])
+	})
+}
+
 // SignatureAlgorithms returns a list of all available values for SignatureAlgorithm
 func SignatureAlgorithms() []SignatureAlgorithm {
-	listSignatureAlgorithmOnce.Do(func() {
-		listSignatureAlgorithm = make([]SignatureAlgorithm, 0, len(allSignatureAlgorithms))
-		for v := range allSignatureAlgorithms {
-			listSignatureAlgorithm = append(listSignatureAlgorithm, v)
-		}
-		sort.Slice(listSignatureAlgorithm, func(i, j int) bool {
-			return string(listSignatureAlgorithm[i]) < string(listSignatureAlgorithm[j])
-		})
-	})
+	muSignatureAlgorithms.RLock()
+	defer muSignatureAlgorithms.RUnlock()
 	return listSignatureAlgorithm
 }
 
@@ -83,7 +103,10 @@ func (v *SignatureAlgorithm) Accept(value interface{}) error {
 		}
 		tmp = SignatureAlgorithm(s)
 	}
-	if _, ok := allSignatureAlgorithms[tmp]; !ok {
+	muSignatureAlgorithms.RLock()
+	_, ok := allSignatureAlgorithms[tmp]
+	muSignatureAlgorithms.RUnlock()
+	if !ok {
 		return fmt.Errorf(`invalid jwa.SignatureAlgorithm value`)
 	}
 
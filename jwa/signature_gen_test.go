@@ -593,5 +593,20 @@ func TestSignatureAlgorithm(t *testing.T) {
 		if !assert.Len(t, expected, 0) {
 			return
 		}
+
+		// Registering a new value must be done after the list of
+		// elements has been checked, or else it would show up in the list
+		const value = `custom-SignatureAlgorithm-value`
+		var dst jwa.SignatureAlgorithm
+		if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {
+			return
+		}
+		jwa.RegisterSignatureAlgorithm(jwa.SignatureAlgorithm(value))
+		if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {
+			return
+		}
+		if !assert.Contains(t, jwa.SignatureAlgorithms(), jwa.SignatureAlgorithm(value), `registered value should be listed`) {
+			return
+		}
 	})
 }
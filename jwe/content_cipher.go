@@ -0,0 +1,40 @@
+package jwe
+
+import (
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe/internal/cipher"
+)
+
+type ContentCipherFactory interface {
+	Create() (ContentCipher, error)
+}
+type ContentCipherFactoryFn func() (ContentCipher, error)
+
+func (fn ContentCipherFactoryFn) Create() (ContentCipher, error) {
+	return fn()
+}
+
+// RegisterContentCipher is used to register a factory object that creates
+// ContentCipher objects based on the given algorithm.
+//
+// For example, if you would like to use content encryption algorithms
+// that this library does not implement, such as XChaCha20-Poly1305
+// ("XC20P"), use this function to register a `ContentCipherFactory`
+// (probably in your `init()`). Once registered, the algorithm can be
+// specified using `jwe.WithContentEncryption()`, and messages that use
+// the algorithm can be decrypted using `jwe.Decrypt()`
+//
+// A ContentCipher registered for an algorithm that is supported natively
+// takes precedence over the built-in implementation. If the algorithm is
+// not known to the `jwa` package, it is registered using
+// `jwa.RegisterContentEncryptionAlgorithm()`.
+func RegisterContentCipher(alg jwa.ContentEncryptionAlgorithm, f ContentCipherFactory) {
+	jwa.RegisterContentEncryptionAlgorithm(alg)
+	cipher.Register(alg, func() (cipher.ContentCipher, error) {
+		c, err := f.Create()
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	})
+}
@@ -1,6 +1,7 @@
 package jwe
 
 import (
+	"crypto"
 	"crypto/aes"
 	cryptocipher "crypto/cipher"
 	"crypto/ecdsa"
@@ -18,6 +19,7 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/content_crypt"
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/keyenc"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 )
 
 // decrypter is responsible for taking various components to decrypt a message.
@@ -38,6 +40,7 @@ type decrypter struct {
 	ctalg       jwa.ContentEncryptionAlgorithm
 	keyalg      jwa.KeyEncryptionAlgorithm
 	cipher      content_crypt.Cipher
+	keydec      keyenc.Decrypter
 	keycount    int
 }
 
@@ -92,6 +95,13 @@ func (d *decrypter) KeyCount(keycount int) *decrypter {
 	return d
 }
 
+// KeyDecrypter sets the key decrypter to be used instead of the
+// one that would be built from the key encryption algorithm
+func (d *decrypter) KeyDecrypter(keydec keyenc.Decrypter) *decrypter {
+	d.keydec = keydec
+	return d
+}
+
 func (d *decrypter) KeyInitializationVector(keyiv []byte) *decrypter {
 	d.keyiv = keyiv
 	return d
@@ -121,16 +131,11 @@ func (d *decrypter) Tag(tag []byte) *decrypter {
 
 func (d *decrypter) ContentCipher() (content_crypt.Cipher, error) {
 	if d.cipher == nil {
-		switch d.ctalg {
-		case jwa.A128GCM, jwa.A192GCM, jwa.A256GCM, jwa.A128CBC_HS256, jwa.A192CBC_HS384, jwa.A256CBC_HS512:
-			cipher, err := cipher.NewAES(d.ctalg)
-			if err != nil {
-				return nil, fmt.Errorf(`failed to build content cipher for %s: %w`, d.ctalg, err)
-			}
-			d.cipher = cipher
-		default:
-			return nil, fmt.Errorf(`invalid content cipher algorithm (%s)`, d.ctalg)
+		cipher, err := cipher.New(d.ctalg)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to build content cipher for %s: %w`, d.ctalg, err)
 		}
+		d.cipher = cipher
 	}
 
 	return d.cipher, nil
@@ -149,12 +154,7 @@ func (d *decrypter) Decrypt(recipientKey, ciphertext []byte) (plaintext []byte,
 		return
 	}
 
-	computedAad := d.computedAad
-	if d.aad != nil {
-		computedAad = append(append(computedAad, '.'), d.aad...)
-	}
-
-	plaintext, err = cipher.Decrypt(cek, d.iv, ciphertext, d.tag, computedAad)
+	plaintext, err = cipher.Decrypt(cek, d.iv, ciphertext, d.tag, d.additionalData())
 	if err != nil {
 		err = fmt.Errorf(`failed to decrypt payload: %w`, err)
 		return
@@ -163,6 +163,16 @@ func (d *decrypter) Decrypt(recipientKey, ciphertext []byte) (plaintext []byte,
 	return plaintext, nil
 }
 
+// additionalData returns the additional authenticated data that
+// is used to verify the content
+func (d *decrypter) additionalData() []byte {
+	computedAad := d.computedAad
+	if d.aad != nil {
+		computedAad = append(append(computedAad, '.'), d.aad...)
+	}
+	return computedAad
+}
+
 func (d *decrypter) decryptSymmetricKey(recipientKey, cek []byte) ([]byte, error) {
 	switch d.keyalg {
 	case jwa.DIRECT:
@@ -226,6 +236,14 @@ func (d *decrypter) decryptSymmetricKey(recipientKey, cek []byte) ([]byte, error
 }
 
 func (d *decrypter) DecryptKey(recipientKey []byte) (cek []byte, err error) {
+	if d.keydec != nil {
+		cek, err = d.keydec.Decrypt(recipientKey)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to decrypt key: %w`, err)
+		}
+		return cek, nil
+	}
+
 	if d.keyalg.IsSymmetric() {
 		var ok bool
 		cek, ok = d.privkey.([]byte)
@@ -257,19 +275,19 @@ func (d *decrypter) BuildKeyDecrypter() (keyenc.Decrypter, error) {
 
 	switch alg := d.keyalg; alg {
 	case jwa.RSA1_5:
-		var privkey rsa.PrivateKey
-		if err := keyconv.RSAPrivateKey(&privkey, d.privkey); err != nil {
-			return nil, fmt.Errorf(`*rsa.PrivateKey is required as the key to build %s key decrypter: %w`, alg, err)
+		privkey, err := rsaDecrypter(d.privkey)
+		if err != nil {
+			return nil, fmt.Errorf(`*rsa.PrivateKey or crypto.Decrypter is required as the key to build %s key decrypter: %w`, alg, err)
 		}
 
-		return keyenc.NewRSAPKCS15Decrypt(alg, &privkey, cipher.KeySize()/2), nil
+		return keyenc.NewRSAPKCS15Decrypt(alg, privkey, cipher.KeySize()/2), nil
 	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
-		var privkey rsa.PrivateKey
-		if err := keyconv.RSAPrivateKey(&privkey, d.privkey); err != nil {
-			return nil, fmt.Errorf(`*rsa.PrivateKey is required as the key to build %s key decrypter: %w`, alg, err)
+		privkey, err := rsaDecrypter(d.privkey)
+		if err != nil {
+			return nil, fmt.Errorf(`*rsa.PrivateKey or crypto.Decrypter is required as the key to build %s key decrypter: %w`, alg, err)
 		}
 
-		return keyenc.NewRSAOAEPDecrypt(alg, &privkey)
+		return keyenc.NewRSAOAEPDecrypt(alg, privkey)
 	case jwa.A128KW, jwa.A192KW, jwa.A256KW:
 		sharedkey, ok := d.privkey.([]byte)
 		if !ok {
@@ -279,7 +297,7 @@ func (d *decrypter) BuildKeyDecrypter() (keyenc.Decrypter, error) {
 		return keyenc.NewAES(alg, sharedkey)
 	case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
 		switch d.pubkey.(type) {
-		case x25519.PublicKey:
+		case x25519.PublicKey, x448.PublicKey:
 			return keyenc.NewECDHESDecrypt(alg, d.ctalg, d.pubkey, d.apu, d.apv, d.privkey), nil
 		default:
 			var pubkey ecdsa.PublicKey
@@ -298,3 +316,22 @@ func (d *decrypter) BuildKeyDecrypter() (keyenc.Decrypter, error) {
 		return nil, fmt.Errorf(`unsupported algorithm for key decryption (%s)`, alg)
 	}
 }
+
+// rsaDecrypter returns a crypto.Decrypter that can decrypt keys using
+// RSA based algorithms. Keys that are not available in their raw form
+// (e.g. keys stored in a KMS) can be used by passing a crypto.Decrypter,
+// as long as its public key is a *rsa.PublicKey
+func rsaDecrypter(key interface{}) (crypto.Decrypter, error) {
+	if decrypter, ok := key.(crypto.Decrypter); ok {
+		if _, ok := decrypter.Public().(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf(`expected crypto.Decrypter.Public() to return *rsa.PublicKey, but got %T`, decrypter.Public())
+		}
+		return decrypter, nil
+	}
+
+	var privkey rsa.PrivateKey
+	if err := keyconv.RSAPrivateKey(&privkey, key); err != nil {
+		return nil, err
+	}
+	return &privkey, nil
+}
@@ -3,6 +3,7 @@ package jwe
 import (
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/v2/internal/iter"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/keygen"
 )
 
@@ -52,12 +53,12 @@ type stdRecipient struct {
 //    {"a dummy":
 //      "protected header"}
 //
-// Once parsed, though, we can only serialize the protected header as:
-//
-//    {"a dummy":"protected header"}
-//
-// which would obviously result in a contradicting integrity value
-// if we tried to re-calculate it from a parsed message.
+// To avoid producing a contradicting integrity value, a parsed message
+// keeps the original base64url encoded protected header, and uses it
+// verbatim when it is serialized via `json.Marshal()` or `jwe.Compact()`.
+// The original header is only used as long as it still represents the
+// contents of `ProtectedHeaders()`: once the protected headers are
+// modified, they are serialized from their parsed form.
 //nolint:govet
 type Message struct {
 	// Comments on each field are taken from https://datatracker.ietf.org/doc/html/rfc7516
@@ -138,13 +139,9 @@ type Message struct {
 	// MUST be ignored.
 	// privateParams map[string]interface{}
 
-	// These two fields below are not available for the public consumers of this object.
-	// rawProtectedHeaders stores the original protected header buffer
+	// rawProtectedHeaders stores the original base64url encoded protected
+	// header buffer. It is not available for the public consumers of this object.
 	rawProtectedHeaders []byte
-	// storeProtectedHeaders is a hint to be used in UnmarshalJSON().
-	// When this flag is true, UnmarshalJSON() will populate the
-	// rawProtectedHeaders field
-	storeProtectedHeaders bool
 }
 
 // populater is an interface for things that may modify the
@@ -157,3 +154,59 @@ type Visitor = iter.MapVisitor
 type VisitorFunc = iter.MapVisitorFunc
 type HeaderPair = mapiter.Pair
 type Iterator = mapiter.Iterator
+
+// KeyEncrypter encrypts the content encryption key (CEK) for a recipient.
+// Use `jwe.RegisterKeyEncrypter()` to make `jwe.Encrypt()` use a
+// KeyEncrypter for a given key encryption algorithm.
+type KeyEncrypter interface {
+	// Algorithm returns the key encryption algorithm that this
+	// KeyEncrypter implements.
+	Algorithm() jwa.KeyEncryptionAlgorithm
+
+	// EncryptKey encrypts the content encryption key `cek`.
+	// The second argument is the key exactly as it was passed to
+	// `jwe.WithKey()`, which may be a jwk.Key, a raw key, or any other
+	// object that the implementation understands (e.g. a handle to
+	// a key stored in an HSM).
+	//
+	// The third argument can be used to populate additional parameters
+	// in the recipient's header. Values set in this object are copied
+	// to the recipient's header after the key has been encrypted.
+	EncryptKey(cek []byte, key interface{}, hdrs Headers) ([]byte, error)
+}
+
+// KeyDecrypter decrypts the content encryption key (CEK) for a recipient.
+// Use `jwe.RegisterKeyDecrypter()` to make `jwe.Decrypt()` use a
+// KeyDecrypter for a given key encryption algorithm.
+type KeyDecrypter interface {
+	// Algorithm returns the key encryption algorithm that this
+	// KeyDecrypter implements.
+	Algorithm() jwa.KeyEncryptionAlgorithm
+
+	// DecryptKey decrypts the encrypted key, and returns the content
+	// encryption key. The second argument is the key exactly as it was
+	// passed to `jwe.WithKey()` or returned by a KeyProvider.
+	//
+	// The third argument contains the union of the protected,
+	// unprotected, and per-recipient headers associated with the
+	// encrypted key.
+	DecryptKey(encryptedKey []byte, key interface{}, hdrs Headers) ([]byte, error)
+}
+
+// ContentCipher encrypts and decrypts the payload of a JWE message.
+// Use `jwe.RegisterContentCipher()` to make `jwe.Encrypt()` and
+// `jwe.Decrypt()` use a ContentCipher for a given content encryption
+// algorithm.
+type ContentCipher interface {
+	// KeySize returns the size of the content encryption key, in bytes.
+	KeySize() int
+
+	// Encrypt encrypts the plaintext using the content encryption key
+	// `cek`, and integrity protects it along with `aad`. It returns
+	// the initialization vector, the ciphertext, and the authentication tag.
+	Encrypt(cek, plaintext, aad []byte) (iv, ciphertext, tag []byte, err error)
+
+	// Decrypt verifies the authentication tag and decrypts the ciphertext
+	// using the content encryption key `cek`.
+	Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error)
+}
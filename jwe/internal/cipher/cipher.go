@@ -13,6 +13,27 @@ import (
 var gcm = &gcmFetcher{}
 var cbc = &cbcFetcher{}
 
+var registry = make(map[jwa.ContentEncryptionAlgorithm]func() (ContentCipher, error))
+
+// Register registers a function that creates a ContentCipher for the given
+// algorithm. Ciphers registered via this function take precedence over the
+// built-in AES based ciphers.
+func Register(alg jwa.ContentEncryptionAlgorithm, fn func() (ContentCipher, error)) {
+	registry[alg] = fn
+}
+
+// New creates a ContentCipher for the given algorithm.
+func New(alg jwa.ContentEncryptionAlgorithm) (ContentCipher, error) {
+	if fn, ok := registry[alg]; ok {
+		c, err := fn()
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create content cipher for %s: %w`, alg, err)
+		}
+		return c, nil
+	}
+	return NewAES(alg)
+}
+
 func (f gcmFetcher) Fetch(key []byte) (cipher.AEAD, error) {
 	aescipher, err := aes.NewCipher(key)
 	if err != nil {
@@ -14,7 +14,7 @@ const (
 // encryption key and other data
 type ContentCipher interface {
 	KeySize() int
-	Encrypt(cek, aad, plaintext []byte) ([]byte, []byte, []byte, error)
+	Encrypt(cek, plaintext, aad []byte) ([]byte, []byte, []byte, error)
 	Decrypt(cek, iv, aad, ciphertext, tag []byte) ([]byte, error)
 }
 
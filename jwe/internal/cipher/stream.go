@@ -0,0 +1,331 @@
+package cipher
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe/internal/keygen"
+)
+
+// StreamEncrypter encrypts content incrementally. The ciphertext is
+// written to the underlying io.Writer as data is written to it.
+// The authentication tag is available after Close() has been called
+type StreamEncrypter interface {
+	io.WriteCloser
+	IV() []byte
+	Tag() []byte
+}
+
+// StreamAuthenticator computes the authentication tag over the ciphertext
+// written to it, and compares it against the expected tag
+type StreamAuthenticator interface {
+	io.Writer
+	Verify(tag []byte) error
+}
+
+// streamCipher returns the AesContentCipher for the given algorithm, if it
+// can be used for streaming. Only the built-in AES-CBC-HMAC-SHA2 ciphers
+// are supported: crypto/cipher does not provide a way to compute the GCM
+// tag incrementally, and content ciphers registered via Register() must
+// be used through the non-streaming API
+func streamCipher(alg jwa.ContentEncryptionAlgorithm, cek []byte) (*AesContentCipher, error) {
+	if _, ok := registry[alg]; ok {
+		return nil, fmt.Errorf(`streaming is not supported for content encryption algorithm %s`, alg)
+	}
+
+	c, err := NewAES(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := c.fetch.(*gcmFetcher); ok {
+		return nil, fmt.Errorf(`streaming is not supported for content encryption algorithm %s (use one of the AES-CBC-HMAC-SHA2 algorithms)`, alg)
+	}
+
+	if len(cek) != c.keysize {
+		return nil, fmt.Errorf(`invalid content encryption key size for %s: expected %d bytes, got %d`, alg, c.keysize, len(cek))
+	}
+	return c, nil
+}
+
+// NewStreamEncrypter creates a StreamEncrypter for the given algorithm.
+// A random initialization vector is generated, and is available via
+// the IV() method before any data is written
+func NewStreamEncrypter(alg jwa.ContentEncryptionAlgorithm, cek, aad []byte, dst io.Writer) (StreamEncrypter, error) {
+	c, err := streamCipher(alg, cek)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := generateIV(aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newCBCStream(cek, iv, aad, c.tagsize)
+	if err != nil {
+		return nil, err
+	}
+	return &cbcEncrypter{
+		cbcStream: s,
+		dst:       dst,
+		iv:        iv,
+		mode:      cipher.NewCBCEncrypter(s.block, iv),
+	}, nil
+}
+
+// NewStreamAuthenticator creates a StreamAuthenticator for the given algorithm
+func NewStreamAuthenticator(alg jwa.ContentEncryptionAlgorithm, cek, iv, aad []byte) (StreamAuthenticator, error) {
+	c, err := streamCipher(alg, cek)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newCBCStream(cek, iv, aad, c.tagsize)
+	if err != nil {
+		return nil, err
+	}
+	return &cbcAuthenticator{cbcStream: s}, nil
+}
+
+// NewStreamDecrypter creates an io.Reader that decrypts the ciphertext read
+// from src. It does NOT verify the authentication tag: the ciphertext must
+// be verified using a StreamAuthenticator before the plaintext is used
+func NewStreamDecrypter(alg jwa.ContentEncryptionAlgorithm, cek, iv []byte, src io.Reader) (io.Reader, error) {
+	c, err := streamCipher(alg, cek)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newCBCStream(cek, iv, nil, c.tagsize)
+	if err != nil {
+		return nil, err
+	}
+	return &cbcDecrypter{
+		src:  src,
+		mode: cipher.NewCBCDecrypter(s.block, iv),
+	}, nil
+}
+
+func generateIV(n int) ([]byte, error) {
+	bs, err := keygen.NewRandom(n).Generate()
+	if err != nil {
+		return nil, fmt.Errorf(`failed to generate nonce: %w`, err)
+	}
+	return bs.Bytes(), nil
+}
+
+type cbcStream struct {
+	block   cipher.Block
+	mac     hash.Hash
+	tagsize int
+	aadlen  uint64
+	ctlen   uint64
+}
+
+func newCBCStream(cek, iv, aad []byte, tagsize int) (*cbcStream, error) {
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf(`CBC requires %d-bit iv, got %d`, aes.BlockSize*8, len(iv)*8)
+	}
+
+	keysize := len(cek) / 2
+	var hfunc func() hash.Hash
+	switch keysize {
+	case 16:
+		hfunc = sha256.New
+	case 24:
+		hfunc = sha512.New384
+	case 32:
+		hfunc = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported key size %d", keysize)
+	}
+
+	block, err := aes.NewCipher(cek[keysize:])
+	if err != nil {
+		return nil, fmt.Errorf(`cipher: failed to create AES cipher for CBC: %w`, err)
+	}
+
+	mac := hmac.New(hfunc, cek[:keysize])
+	mac.Write(aad)
+	mac.Write(iv)
+	return &cbcStream{
+		block:   block,
+		mac:     mac,
+		tagsize: tagsize,
+		aadlen:  uint64(len(aad)),
+	}, nil
+}
+
+func (s *cbcStream) authenticate(ciphertext []byte) {
+	s.mac.Write(ciphertext)
+	s.ctlen += uint64(len(ciphertext))
+}
+
+func (s *cbcStream) tag() []byte {
+	var al [8]byte
+	binary.BigEndian.PutUint64(al[:], s.aadlen*8)
+	s.mac.Write(al[:])
+	return s.mac.Sum(nil)[:s.tagsize]
+}
+
+type cbcEncrypter struct {
+	*cbcStream
+	dst     io.Writer
+	iv      []byte
+	mode    cipher.BlockMode
+	pending []byte
+	buf     []byte
+	result  []byte
+}
+
+func (e *cbcEncrypter) IV() []byte {
+	return e.iv
+}
+
+func (e *cbcEncrypter) Tag() []byte {
+	return e.result
+}
+
+// flush encrypts and writes all complete blocks in e.pending
+func (e *cbcEncrypter) flush() error {
+	n := len(e.pending) - len(e.pending)%aes.BlockSize
+	if n == 0 {
+		return nil
+	}
+
+	if cap(e.buf) < n {
+		e.buf = make([]byte, n)
+	}
+	buf := e.buf[:n]
+	e.mode.CryptBlocks(buf, e.pending[:n])
+	e.authenticate(buf)
+	e.pending = e.pending[:copy(e.pending, e.pending[n:])]
+	if _, err := e.dst.Write(buf); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *cbcEncrypter) Write(p []byte) (int, error) {
+	if e.result != nil {
+		return 0, fmt.Errorf(`write to closed encrypter`)
+	}
+
+	e.pending = append(e.pending, p...)
+	if err := e.flush(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (e *cbcEncrypter) Close() error {
+	if e.result != nil {
+		return nil
+	}
+
+	// PKCS#7 padding. There's always at least one byte of padding
+	padlen := aes.BlockSize - len(e.pending)
+	for i := 0; i < padlen; i++ {
+		e.pending = append(e.pending, byte(padlen))
+	}
+	if err := e.flush(); err != nil {
+		return err
+	}
+	e.result = e.tag()
+	return nil
+}
+
+type cbcAuthenticator struct {
+	*cbcStream
+}
+
+func (a *cbcAuthenticator) Write(p []byte) (int, error) {
+	a.authenticate(p)
+	return len(p), nil
+}
+
+func (a *cbcAuthenticator) Verify(tag []byte) error {
+	if a.ctlen == 0 || a.ctlen%aes.BlockSize != 0 {
+		return fmt.Errorf(`invalid ciphertext (invalid length: %d)`, a.ctlen)
+	}
+	if subtle.ConstantTimeCompare(a.tag(), tag) != 1 {
+		return fmt.Errorf(`invalid ciphertext (tag mismatch)`)
+	}
+	return nil
+}
+
+// cbcDecrypter decrypts the ciphertext read from src. The last block
+// is held back until src is exhausted, so that the padding can be removed
+type cbcDecrypter struct {
+	src   io.Reader
+	mode  cipher.BlockMode
+	chunk []byte
+	in    []byte
+	out   []byte
+	held  []byte
+	eof   bool
+}
+
+func (d *cbcDecrypter) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.eof {
+			return 0, io.EOF
+		}
+		if err := d.fill(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+func (d *cbcDecrypter) fill() error {
+	if d.chunk == nil {
+		d.chunk = make([]byte, 32*1024)
+	}
+
+	n, err := d.src.Read(d.chunk)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	d.in = append(d.in, d.chunk[:n]...)
+
+	if l := len(d.in) - len(d.in)%aes.BlockSize; l > 0 {
+		buf := make([]byte, l)
+		d.mode.CryptBlocks(buf, d.in[:l])
+		d.in = d.in[:copy(d.in, d.in[l:])]
+		d.out = append(d.held, buf[:l-aes.BlockSize]...)
+		d.held = buf[l-aes.BlockSize:]
+	}
+
+	if err == io.EOF {
+		d.eof = true
+		if len(d.in) > 0 || len(d.held) == 0 {
+			return fmt.Errorf(`invalid ciphertext (invalid length)`)
+		}
+
+		padlen := int(d.held[aes.BlockSize-1])
+		if padlen == 0 || padlen > aes.BlockSize {
+			return fmt.Errorf(`invalid padding`)
+		}
+		for _, v := range d.held[aes.BlockSize-padlen:] {
+			if int(v) != padlen {
+				return fmt.Errorf(`invalid padding`)
+			}
+		}
+		d.out = append(d.out, d.held[:aes.BlockSize-padlen]...)
+		d.held = nil
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package cipher_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe/internal/cipher"
+	"github.com/lestrrat-go/jwx/v2/jwe/internal/keygen"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStream(t *testing.T) {
+	algs := []jwa.ContentEncryptionAlgorithm{
+		jwa.A128CBC_HS256,
+		jwa.A192CBC_HS384,
+		jwa.A256CBC_HS512,
+	}
+	sizes := []int{0, 1, 15, 16, 17, 100, 4096, 100003}
+	aad := []byte("eyJhbGciOiJkaXIiLCJlbmMiOiJBMjU2Q0JDLUhTNTEyIn0")
+
+	t.Run("AES-GCM is not supported", func(t *testing.T) {
+		cek := make([]byte, 32)
+		_, err := cipher.NewStreamEncrypter(jwa.A256GCM, cek, aad, ioutil.Discard)
+		if !assert.Error(t, err, `cipher.NewStreamEncrypter should fail`) {
+			return
+		}
+		_, err = cipher.NewStreamAuthenticator(jwa.A256GCM, cek, make([]byte, 12), aad)
+		if !assert.Error(t, err, `cipher.NewStreamAuthenticator should fail`) {
+			return
+		}
+	})
+
+	for _, alg := range algs {
+		alg := alg
+		c, err := cipher.NewAES(alg)
+		if !assert.NoError(t, err, `cipher.NewAES should succeed`) {
+			return
+		}
+		for _, size := range sizes {
+			size := size
+			plaintext := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz0123456789"), size/36+1)[:size]
+			bs, err := keygen.NewRandom(c.KeySize()).Generate()
+			if !assert.NoError(t, err, `generating key should succeed`) {
+				return
+			}
+			cek := bs.Bytes()
+
+			t.Run(fmt.Sprintf("%s (%d bytes)", alg, size), func(t *testing.T) {
+				t.Run("Streaming encryption", func(t *testing.T) {
+					var ciphertext bytes.Buffer
+					enc, err := cipher.NewStreamEncrypter(alg, cek, aad, &ciphertext)
+					if !assert.NoError(t, err, `cipher.NewStreamEncrypter should succeed`) {
+						return
+					}
+
+					// write in irregular chunks
+					for in, n := plaintext, 1; len(in) > 0; n = n*3 + 1 {
+						if n > len(in) {
+							n = len(in)
+						}
+						if _, err := enc.Write(in[:n]); !assert.NoError(t, err, `enc.Write should succeed`) {
+							return
+						}
+						in = in[n:]
+					}
+					if !assert.NoError(t, enc.Close(), `enc.Close should succeed`) {
+						return
+					}
+
+					decrypted, err := c.Decrypt(cek, enc.IV(), ciphertext.Bytes(), enc.Tag(), aad)
+					if !assert.NoError(t, err, `c.Decrypt should succeed`) {
+						return
+					}
+					if !assert.True(t, bytes.Equal(plaintext, decrypted), `payloads should match`) {
+						return
+					}
+				})
+				t.Run("Streaming decryption", func(t *testing.T) {
+					iv, ciphertext, tag, err := c.Encrypt(cek, plaintext, aad)
+					if !assert.NoError(t, err, `c.Encrypt should succeed`) {
+						return
+					}
+
+					auth, err := cipher.NewStreamAuthenticator(alg, cek, iv, aad)
+					if !assert.NoError(t, err, `cipher.NewStreamAuthenticator should succeed`) {
+						return
+					}
+					if _, err := auth.Write(ciphertext); !assert.NoError(t, err, `auth.Write should succeed`) {
+						return
+					}
+					if !assert.NoError(t, auth.Verify(tag), `auth.Verify should succeed`) {
+						return
+					}
+
+					dec, err := cipher.NewStreamDecrypter(alg, cek, iv, bytes.NewReader(ciphertext))
+					if !assert.NoError(t, err, `cipher.NewStreamDecrypter should succeed`) {
+						return
+					}
+					decrypted, err := ioutil.ReadAll(dec)
+					if !assert.NoError(t, err, `reading from decrypter should succeed`) {
+						return
+					}
+					if !assert.True(t, bytes.Equal(plaintext, decrypted), `payloads should match`) {
+						return
+					}
+
+					// tamper with the ciphertext
+					if len(ciphertext) > 0 {
+						ciphertext[0] ^= 0x1
+						auth, err := cipher.NewStreamAuthenticator(alg, cek, iv, aad)
+						if !assert.NoError(t, err, `cipher.NewStreamAuthenticator should succeed`) {
+							return
+						}
+						_, _ = auth.Write(ciphertext)
+						if !assert.Error(t, auth.Verify(tag), `auth.Verify should fail`) {
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
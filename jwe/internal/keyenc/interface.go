@@ -1,6 +1,7 @@
 package keyenc
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"hash"
 
@@ -74,13 +75,13 @@ type RSAOAEPEncrypt struct {
 // RSAOAEPDecrypt decrypts keys using RSA OAEP algorithm
 type RSAOAEPDecrypt struct {
 	alg     jwa.KeyEncryptionAlgorithm
-	privkey *rsa.PrivateKey
+	privkey crypto.Decrypter
 }
 
 // RSAPKCS15Decrypt decrypts keys using RSA PKCS1v15 algorithm
 type RSAPKCS15Decrypt struct {
 	alg       jwa.KeyEncryptionAlgorithm
-	privkey   *rsa.PrivateKey
+	privkey   crypto.Decrypter
 	generator keygen.Generator
 }
 
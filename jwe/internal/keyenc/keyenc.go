@@ -25,6 +25,7 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/concatkdf"
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/keygen"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 )
 
 func NewNoop(alg jwa.KeyEncryptionAlgorithm, sharedkey []byte) (*Noop, error) {
@@ -218,6 +219,8 @@ func NewECDHESEncrypt(alg jwa.KeyEncryptionAlgorithm, enc jwa.ContentEncryptionA
 		generator, err = keygen.NewEcdhes(alg, enc, keysize, key)
 	case x25519.PublicKey:
 		generator, err = keygen.NewX25519(alg, enc, keysize, key)
+	case x448.PublicKey:
+		generator, err = keygen.NewX448(alg, enc, keysize, key)
 	default:
 		return nil, fmt.Errorf("unexpected key type %T", keyif)
 	}
@@ -304,6 +307,16 @@ func DeriveZ(privkeyif interface{}, pubkeyif interface{}) ([]byte, error) {
 			return nil, fmt.Errorf(`public key must be x25519.PublicKey, was: %T`, pubkeyif)
 		}
 		return curve25519.X25519(privkey.Seed(), pubkey)
+	case x448.PrivateKey:
+		privkey, ok := privkeyif.(x448.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf(`private key must be x448.PrivateKey, was: %T`, privkeyif)
+		}
+		pubkey, ok := pubkeyif.(x448.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf(`public key must be x448.PublicKey, was: %T`, pubkeyif)
+		}
+		return x448.X448(privkey.Seed(), pubkey)
 	default:
 		privkey, ok := privkeyif.(*ecdsa.PrivateKey)
 		if !ok {
@@ -353,7 +366,7 @@ func (kw ECDHESDecrypt) Decrypt(enckey []byte) ([]byte, error) {
 	switch kw.keyalg {
 	case jwa.ECDH_ES:
 		// Create a content cipher from the content encryption algorithm
-		c, err := contentcipher.NewAES(kw.contentalg)
+		c, err := contentcipher.New(kw.contentalg)
 		if err != nil {
 			return nil, fmt.Errorf(`failed to create content cipher for %s: %w`, kw.contentalg, err)
 		}
@@ -472,8 +485,10 @@ func (e RSAOAEPEncrypt) Encrypt(cek []byte) (keygen.ByteSource, error) {
 	return keygen.ByteKey(encrypted), nil
 }
 
-// NewRSAPKCS15Decrypt creates a new decrypter using RSA PKCS1v15
-func NewRSAPKCS15Decrypt(alg jwa.KeyEncryptionAlgorithm, privkey *rsa.PrivateKey, keysize int) *RSAPKCS15Decrypt {
+// NewRSAPKCS15Decrypt creates a new decrypter using RSA PKCS1v15.
+// privkey is usually a *rsa.PrivateKey, but can be any crypto.Decrypter
+// whose public key is a *rsa.PublicKey
+func NewRSAPKCS15Decrypt(alg jwa.KeyEncryptionAlgorithm, privkey crypto.Decrypter, keysize int) *RSAPKCS15Decrypt {
 	generator := keygen.NewRandom(keysize * 2)
 	return &RSAPKCS15Decrypt{
 		alg:       alg,
@@ -500,8 +515,13 @@ func (d RSAPKCS15Decrypt) Decrypt(enckey []byte) ([]byte, error) {
 		_ = recover()
 	}()
 
+	pubkey, ok := d.privkey.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf(`expected *rsa.PublicKey, got %T`, d.privkey.Public())
+	}
+
 	// Perform some input validation.
-	expectedlen := d.privkey.PublicKey.N.BitLen() / 8
+	expectedlen := pubkey.N.BitLen() / 8
 	if expectedlen != len(enckey) {
 		// Input size is incorrect, the encrypted payload should always match
 		// the size of the public modulus (e.g. using a 2048 bit key will
@@ -525,7 +545,17 @@ func (d RSAPKCS15Decrypt) Decrypt(enckey []byte) ([]byte, error) {
 	// prevent chosen-ciphertext attacks as described in RFC 3218, "Preventing
 	// the Million Message Attack on Cryptographic Message Syntax". We are
 	// therefore deliberately ignoring errors here.
-	err = rsa.DecryptPKCS1v15SessionKey(rand.Reader, d.privkey, enckey, cek)
+	if privkey, ok := d.privkey.(*rsa.PrivateKey); ok {
+		err = rsa.DecryptPKCS1v15SessionKey(rand.Reader, privkey, enckey, cek)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to decrypt via PKCS1v15: %w`, err)
+		}
+		return cek, nil
+	}
+
+	// For opaque keys (e.g. keys stored in a KMS) we can only ask the
+	// decrypter to apply the same precautions using SessionKeyLen
+	cek, err = d.privkey.Decrypt(rand.Reader, enckey, &rsa.PKCS1v15DecryptOptions{SessionKeyLen: len(cek)})
 	if err != nil {
 		return nil, fmt.Errorf(`failed to decrypt via PKCS1v15: %w`, err)
 	}
@@ -533,8 +563,10 @@ func (d RSAPKCS15Decrypt) Decrypt(enckey []byte) ([]byte, error) {
 	return cek, nil
 }
 
-// NewRSAOAEPDecrypt creates a new key decrypter using RSA OAEP
-func NewRSAOAEPDecrypt(alg jwa.KeyEncryptionAlgorithm, privkey *rsa.PrivateKey) (*RSAOAEPDecrypt, error) {
+// NewRSAOAEPDecrypt creates a new key decrypter using RSA OAEP.
+// privkey is usually a *rsa.PrivateKey, but can be any crypto.Decrypter
+// whose public key is a *rsa.PublicKey
+func NewRSAOAEPDecrypt(alg jwa.KeyEncryptionAlgorithm, privkey crypto.Decrypter) (*RSAOAEPDecrypt, error) {
 	switch alg {
 	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
 	default:
@@ -554,16 +586,16 @@ func (d RSAOAEPDecrypt) Algorithm() jwa.KeyEncryptionAlgorithm {
 
 // Decrypt decrypts the encrypted key using RSA OAEP
 func (d RSAOAEPDecrypt) Decrypt(enckey []byte) ([]byte, error) {
-	var hash hash.Hash
+	var hash crypto.Hash
 	switch d.alg {
 	case jwa.RSA_OAEP:
-		hash = sha1.New()
+		hash = crypto.SHA1
 	case jwa.RSA_OAEP_256:
-		hash = sha256.New()
+		hash = crypto.SHA256
 	default:
 		return nil, fmt.Errorf(`failed to generate key encrypter for RSA-OAEP: RSA_OAEP/RSA_OAEP_256 required`)
 	}
-	return rsa.DecryptOAEP(hash, rand.Reader, d.privkey, enckey, []byte{})
+	return d.privkey.Decrypt(rand.Reader, enckey, &rsa.OAEPOptions{Hash: hash})
 }
 
 // Decrypt for DirectDecrypt does not do anything other than
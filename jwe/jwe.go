@@ -11,6 +11,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"sync"
+	"sync/atomic"
 
 	"github.com/lestrrat-go/blackmagic"
 	"github.com/lestrrat-go/jwx/v2/internal/base64"
@@ -23,6 +25,7 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/keyenc"
 	"github.com/lestrrat-go/jwx/v2/jwe/internal/keygen"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 )
 
 const (
@@ -38,6 +41,89 @@ var _ = fmtMax
 
 var registry = json.NewRegistry()
 
+var keyUsageCheck uint32
+
+var muAllowedAlgorithms sync.RWMutex
+var allowedKeyEncryptionAlgorithms []jwa.KeyEncryptionAlgorithm
+var allowedContentEncryptionAlgorithms []jwa.ContentEncryptionAlgorithm
+
+// Settings controls global settings that are specific to JWE.
+// Only the settings that are specified are changed.
+func Settings(options ...GlobalOption) {
+	//nolint:forcetypeassert
+	for _, option := range options {
+		switch option.Ident() {
+		case identKeyUsageCheck{}:
+			var v uint32
+			if option.Value().(bool) {
+				v = 1
+			}
+			atomic.StoreUint32(&keyUsageCheck, v)
+		case identAllowedKeyEncryptionAlgorithms{}:
+			algs := option.Value().([]jwa.KeyEncryptionAlgorithm)
+			muAllowedAlgorithms.Lock()
+			allowedKeyEncryptionAlgorithms = append([]jwa.KeyEncryptionAlgorithm(nil), algs...)
+			muAllowedAlgorithms.Unlock()
+		case identAllowedContentEncryptionAlgorithms{}:
+			algs := option.Value().([]jwa.ContentEncryptionAlgorithm)
+			muAllowedAlgorithms.Lock()
+			allowedContentEncryptionAlgorithms = append([]jwa.ContentEncryptionAlgorithm(nil), algs...)
+			muAllowedAlgorithms.Unlock()
+		}
+	}
+}
+
+func globalAllowedAlgorithms() ([]jwa.KeyEncryptionAlgorithm, []jwa.ContentEncryptionAlgorithm) {
+	muAllowedAlgorithms.RLock()
+	defer muAllowedAlgorithms.RUnlock()
+	return allowedKeyEncryptionAlgorithms, allowedContentEncryptionAlgorithms
+}
+
+// isAllowedKeyEncryptionAlgorithm returns true if `alg` is listed in `allowed`.
+// An empty list allows all algorithms
+func isAllowedKeyEncryptionAlgorithm(allowed []jwa.KeyEncryptionAlgorithm, alg jwa.KeyEncryptionAlgorithm) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, v := range allowed {
+		if v == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllowedContentEncryptionAlgorithm returns true if `alg` is listed in `allowed`.
+// An empty list allows all algorithms
+func isAllowedContentEncryptionAlgorithm(allowed []jwa.ContentEncryptionAlgorithm, alg jwa.ContentEncryptionAlgorithm) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, v := range allowed {
+		if v == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeyUsage checks that `key` may be used with `alg` for any of
+// `ops`, if it is a jwk.Key. Raw keys are always accepted
+func checkKeyUsage(key interface{}, alg jwa.KeyEncryptionAlgorithm, ops ...jwk.KeyOperation) error {
+	jwkKey, ok := key.(jwk.Key)
+	if !ok {
+		return nil
+	}
+
+	// Keys used for ECDH-ES key agreement may also be described
+	// by the "deriveKey" operation
+	switch alg {
+	case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
+		ops = append(ops, jwk.KeyOpDeriveKey)
+	}
+	return jwk.CheckKeyUsage(jwkKey, alg, ops...)
+}
+
 type recipientBuilder struct {
 	alg     jwa.KeyEncryptionAlgorithm
 	key     interface{}
@@ -63,95 +149,104 @@ func (b *recipientBuilder) Build(cek []byte, calg jwa.ContentEncryptionAlgorithm
 
 	// First, create a key encryptor
 	var enc keyenc.Encrypter
-	switch b.alg {
-	case jwa.RSA1_5:
-		var pubkey rsa.PublicKey
-		if err := keyconv.RSAPublicKey(&pubkey, rawKey); err != nil {
-			return nil, nil, fmt.Errorf(`failed to generate public key from key (%T): %w`, rawKey, err)
-		}
-
-		v, err := keyenc.NewRSAPKCSEncrypt(b.alg, &pubkey)
-		if err != nil {
-			return nil, nil, fmt.Errorf(`failed to create RSA PKCS encrypter: %w`, err)
-		}
-		enc = v
-	case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
-		var pubkey rsa.PublicKey
-		if err := keyconv.RSAPublicKey(&pubkey, rawKey); err != nil {
-			return nil, nil, fmt.Errorf(`failed to generate public key from key (%T): %w`, rawKey, err)
-		}
-
-		v, err := keyenc.NewRSAOAEPEncrypt(b.alg, &pubkey)
+	if f, ok := keyEncrypterDB[b.alg]; ok {
+		// User-supplied key encrypters receive the key as-is
+		v, err := f.Create()
 		if err != nil {
-			return nil, nil, fmt.Errorf(`failed to create RSA OAEP encrypter: %w`, err)
-		}
-		enc = v
-	case jwa.A128KW, jwa.A192KW, jwa.A256KW,
-		jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW,
-		jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
-		sharedkey, ok := rawKey.([]byte)
-		if !ok {
-			return nil, nil, fmt.Errorf(`invalid key: []byte required (%T)`, rawKey)
-		}
-
-		var err error
-		switch b.alg {
-		case jwa.A128KW, jwa.A192KW, jwa.A256KW:
-			enc, err = keyenc.NewAES(b.alg, sharedkey)
-		case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
-			enc, err = keyenc.NewPBES2Encrypt(b.alg, sharedkey)
-		default:
-			enc, err = keyenc.NewAESGCMEncrypt(b.alg, sharedkey)
+			return nil, nil, fmt.Errorf(`failed to create key encrypter for %s: %w`, b.alg, err)
 		}
-		if err != nil {
-			return nil, nil, fmt.Errorf(`failed to create key wrap encrypter: %w`, err)
-		}
-		// NOTE: there was formerly a restriction, introduced
-		// in PR #26, which disallowed certain key/content
-		// algorithm combinations. This seemed bogus, and
-		// interop with the jose tool demonstrates it.
-	case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
-		var keysize int
+		enc = &keyEncrypterAdapter{encrypter: v, key: b.key}
+	} else {
 		switch b.alg {
-		case jwa.ECDH_ES:
-			// https://tools.ietf.org/html/rfc7518#page-15
-			// In Direct Key Agreement mode, the output of the Concat KDF MUST be a
-			// key of the same length as that used by the "enc" algorithm.
-			keysize = cc.KeySize()
-		case jwa.ECDH_ES_A128KW:
-			keysize = 16
-		case jwa.ECDH_ES_A192KW:
-			keysize = 24
-		case jwa.ECDH_ES_A256KW:
-			keysize = 32
-		}
-
-		switch key := rawKey.(type) {
-		case x25519.PublicKey:
-			v, err := keyenc.NewECDHESEncrypt(b.alg, calg, keysize, rawKey)
+		case jwa.RSA1_5:
+			var pubkey rsa.PublicKey
+			if err := keyconv.RSAPublicKey(&pubkey, rawKey); err != nil {
+				return nil, nil, fmt.Errorf(`failed to generate public key from key (%T): %w`, rawKey, err)
+			}
+
+			v, err := keyenc.NewRSAPKCSEncrypt(b.alg, &pubkey)
 			if err != nil {
-				return nil, nil, fmt.Errorf(`failed to create ECDHS key wrap encrypter: %w`, err)
+				return nil, nil, fmt.Errorf(`failed to create RSA PKCS encrypter: %w`, err)
 			}
 			enc = v
-		default:
-			var pubkey ecdsa.PublicKey
-			if err := keyconv.ECDSAPublicKey(&pubkey, rawKey); err != nil {
-				return nil, nil, fmt.Errorf(`failed to generate public key from key (%T): %w`, key, err)
+		case jwa.RSA_OAEP, jwa.RSA_OAEP_256:
+			var pubkey rsa.PublicKey
+			if err := keyconv.RSAPublicKey(&pubkey, rawKey); err != nil {
+				return nil, nil, fmt.Errorf(`failed to generate public key from key (%T): %w`, rawKey, err)
 			}
-			v, err := keyenc.NewECDHESEncrypt(b.alg, calg, keysize, &pubkey)
+
+			v, err := keyenc.NewRSAOAEPEncrypt(b.alg, &pubkey)
 			if err != nil {
-				return nil, nil, fmt.Errorf(`failed to create ECDHS key wrap encrypter: %w`, err)
+				return nil, nil, fmt.Errorf(`failed to create RSA OAEP encrypter: %w`, err)
 			}
 			enc = v
+		case jwa.A128KW, jwa.A192KW, jwa.A256KW,
+			jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW,
+			jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+			sharedkey, ok := rawKey.([]byte)
+			if !ok {
+				return nil, nil, fmt.Errorf(`invalid key: []byte required (%T)`, rawKey)
+			}
+
+			var err error
+			switch b.alg {
+			case jwa.A128KW, jwa.A192KW, jwa.A256KW:
+				enc, err = keyenc.NewAES(b.alg, sharedkey)
+			case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+				enc, err = keyenc.NewPBES2Encrypt(b.alg, sharedkey)
+			default:
+				enc, err = keyenc.NewAESGCMEncrypt(b.alg, sharedkey)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf(`failed to create key wrap encrypter: %w`, err)
+			}
+			// NOTE: there was formerly a restriction, introduced
+			// in PR #26, which disallowed certain key/content
+			// algorithm combinations. This seemed bogus, and
+			// interop with the jose tool demonstrates it.
+		case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
+			var keysize int
+			switch b.alg {
+			case jwa.ECDH_ES:
+				// https://tools.ietf.org/html/rfc7518#page-15
+				// In Direct Key Agreement mode, the output of the Concat KDF MUST be a
+				// key of the same length as that used by the "enc" algorithm.
+				keysize = cc.KeySize()
+			case jwa.ECDH_ES_A128KW:
+				keysize = 16
+			case jwa.ECDH_ES_A192KW:
+				keysize = 24
+			case jwa.ECDH_ES_A256KW:
+				keysize = 32
+			}
+
+			switch key := rawKey.(type) {
+			case x25519.PublicKey, x448.PublicKey:
+				v, err := keyenc.NewECDHESEncrypt(b.alg, calg, keysize, rawKey)
+				if err != nil {
+					return nil, nil, fmt.Errorf(`failed to create ECDHS key wrap encrypter: %w`, err)
+				}
+				enc = v
+			default:
+				var pubkey ecdsa.PublicKey
+				if err := keyconv.ECDSAPublicKey(&pubkey, rawKey); err != nil {
+					return nil, nil, fmt.Errorf(`failed to generate public key from key (%T): %w`, key, err)
+				}
+				v, err := keyenc.NewECDHESEncrypt(b.alg, calg, keysize, &pubkey)
+				if err != nil {
+					return nil, nil, fmt.Errorf(`failed to create ECDHS key wrap encrypter: %w`, err)
+				}
+				enc = v
+			}
+		case jwa.DIRECT:
+			sharedkey, ok := rawKey.([]byte)
+			if !ok {
+				return nil, nil, fmt.Errorf("invalid key: []byte required")
+			}
+			enc, _ = keyenc.NewNoop(b.alg, sharedkey)
+		default:
+			return nil, nil, fmt.Errorf(`invalid key encryption algorithm (%s)`, b.alg)
 		}
-	case jwa.DIRECT:
-		sharedkey, ok := rawKey.([]byte)
-		if !ok {
-			return nil, nil, fmt.Errorf("invalid key: []byte required")
-		}
-		enc, _ = keyenc.NewNoop(b.alg, sharedkey)
-	default:
-		return nil, nil, fmt.Errorf(`invalid key encryption algorithm (%s)`, b.alg)
 	}
 
 	if keyID != "" {
@@ -215,6 +310,58 @@ func (b *recipientBuilder) Build(cek []byte, calg jwa.ContentEncryptionAlgorithm
 // Look for options that return `jwe.EncryptOption` or `jws.EncryptDecryptOption`
 // for a complete list of options that can be passed to this function.
 func Encrypt(payload []byte, options ...EncryptOption) ([]byte, error) {
+	ec, err := newEncryptCtx(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if ec.compression != jwa.NoCompress {
+		payload, err = compress(payload)
+		if err != nil {
+			return nil, fmt.Errorf(`jwe.Encrypt: failed to compress payload before encryption: %w`, err)
+		}
+	}
+
+	iv, ciphertext, tag, err := ec.contentcrypt.Encrypt(ec.cek, payload, ec.aad)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to encrypt payload: %w`, err)
+	}
+
+	msg, err := ec.message(iv, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := msg.Set(CipherTextKey, ciphertext); err != nil {
+		return nil, fmt.Errorf(`failed to set %s: %w`, CipherTextKey, err)
+	}
+
+	switch ec.format {
+	case fmtCompact:
+		return Compact(msg)
+	case fmtJSON:
+		return json.Marshal(msg)
+	case fmtJSONPretty:
+		return json.MarshalIndent(msg, "", "  ")
+	default:
+		return nil, fmt.Errorf(`jwe.Encrypt: invalid serialization`)
+	}
+}
+
+// encryptCtx holds everything that is computed before the payload
+// is encrypted. It is shared between Encrypt() and NewEncryptWriter()
+type encryptCtx struct {
+	calg         jwa.ContentEncryptionAlgorithm
+	compression  jwa.CompressionAlgorithm
+	format       int
+	contentcrypt *content_crypt.Generic
+	cek          []byte
+	recipients   []Recipient
+	protected    Headers
+	aad          []byte
+}
+
+func newEncryptCtx(options []EncryptOption) (*encryptCtx, error) {
 	// default content encryption algorithm
 	calg := jwa.A256GCM
 
@@ -229,9 +376,12 @@ func Encrypt(payload []byte, options ...EncryptOption) ([]byte, error) {
 	var protected Headers
 	var mergeProtected bool
 	var useRawCEK bool
+	checkUsage := atomic.LoadUint32(&keyUsageCheck) == 1
 	for _, option := range options {
 		//nolint:forcetypeassert
 		switch option.Ident() {
+		case identKeyUsageCheck{}:
+			checkUsage = option.Value().(bool)
 		case identKey{}:
 			data := option.Value().(*withKey)
 			v, ok := data.alg.(jwa.KeyEncryptionAlgorithm)
@@ -288,6 +438,14 @@ func Encrypt(payload []byte, options ...EncryptOption) ([]byte, error) {
 		}
 	}
 
+	if checkUsage {
+		for i, builder := range builders {
+			if err := checkKeyUsage(builder.key, builder.alg, jwk.KeyOpEncrypt, jwk.KeyOpWrapKey); err != nil {
+				return nil, fmt.Errorf(`jwe.Encrypt: key for recipient #%d cannot be used: %w`, i, err)
+			}
+		}
+	}
+
 	// There is exactly one content encrypter.
 	contentcrypt, err := content_crypt.NewGeneric(calg)
 	if err != nil {
@@ -326,10 +484,6 @@ func Encrypt(payload []byte, options ...EncryptOption) ([]byte, error) {
 	}
 
 	if compression != jwa.NoCompress {
-		payload, err = compress(payload)
-		if err != nil {
-			return nil, fmt.Errorf(`jwe.Encrypt: failed to compress payload before encryption: %w`, err)
-		}
 		if err := protected.Set(CompressionKey, compression); err != nil {
 			return nil, fmt.Errorf(`jwe.Encrypt: failed to set "zip" in protected header: %w`, err)
 		}
@@ -350,39 +504,37 @@ func Encrypt(payload []byte, options ...EncryptOption) ([]byte, error) {
 		return nil, fmt.Errorf(`failed to base64 encode protected headers: %w`, err)
 	}
 
-	iv, ciphertext, tag, err := contentcrypt.Encrypt(cek, payload, aad)
-	if err != nil {
-		return nil, fmt.Errorf(`failed to encrypt payload: %w`, err)
-	}
+	return &encryptCtx{
+		calg:         calg,
+		compression:  compression,
+		format:       format,
+		contentcrypt: contentcrypt,
+		cek:          cek,
+		recipients:   recipients,
+		protected:    protected,
+		aad:          aad,
+	}, nil
+}
 
+// message creates a Message that contains everything but the ciphertext
+func (ec *encryptCtx) message(iv, tag []byte) (*Message, error) {
 	msg := NewMessage()
 
-	if err := msg.Set(CipherTextKey, ciphertext); err != nil {
-		return nil, fmt.Errorf(`failed to set %s: %w`, CipherTextKey, err)
-	}
 	if err := msg.Set(InitializationVectorKey, iv); err != nil {
 		return nil, fmt.Errorf(`failed to set %s: %w`, InitializationVectorKey, err)
 	}
-	if err := msg.Set(ProtectedHeadersKey, protected); err != nil {
+	if err := msg.Set(ProtectedHeadersKey, ec.protected); err != nil {
 		return nil, fmt.Errorf(`failed to set %s: %w`, ProtectedHeadersKey, err)
 	}
-	if err := msg.Set(RecipientsKey, recipients); err != nil {
+	if err := msg.Set(RecipientsKey, ec.recipients); err != nil {
 		return nil, fmt.Errorf(`failed to set %s: %w`, RecipientsKey, err)
 	}
-	if err := msg.Set(TagKey, tag); err != nil {
-		return nil, fmt.Errorf(`failed to set %s: %w`, TagKey, err)
-	}
-
-	switch format {
-	case fmtCompact:
-		return Compact(msg)
-	case fmtJSON:
-		return json.Marshal(msg)
-	case fmtJSONPretty:
-		return json.MarshalIndent(msg, "", "  ")
-	default:
-		return nil, fmt.Errorf(`jwe.Encrypt: invalid serialization`)
+	if tag != nil {
+		if err := msg.Set(TagKey, tag); err != nil {
+			return nil, fmt.Errorf(`failed to set %s: %w`, TagKey, err)
+		}
 	}
+	return msg, nil
 }
 
 type decryptCtx struct {
@@ -391,8 +543,19 @@ type decryptCtx struct {
 	computedAad      []byte
 	keyProviders     []KeyProvider
 	protectedHeaders Headers
+	keyUsed          interface{}
+	critical         []string
+	dst              *Message
+	keyUsageCheck    bool
+	allowedKeyAlgs   []jwa.KeyEncryptionAlgorithm
+	allowedEncAlgs   []jwa.ContentEncryptionAlgorithm
 }
 
+// decryptFunc is called with a decrypter that has been configured for
+// a particular recipient/key pair. It should return an error if the
+// content could not be decrypted, in which case the next pair is tried
+type decryptFunc func(dec *decrypter, recipient Recipient, h Headers) error
+
 // Decrypt takes the key encryption algorithm and the corresponding
 // key to decrypt the JWE message, and returns the decrypted payload.
 // The JWE message can be either compact or full JSON format.
@@ -403,50 +566,123 @@ type decryptCtx struct {
 //
 // `key` must be a private key. It can be either in its raw format (e.g. *rsa.PrivateKey) or a jwk.Key
 func Decrypt(buf []byte, options ...DecryptOption) ([]byte, error) {
-	var keyProviders []KeyProvider
-	var keyUsed interface{}
+	dctx, err := newDecryptCtx(options)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := parseJSONOrCompact(buf)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse buffer for Decrypt: %w`, err)
+	}
+
+	var plaintext []byte
+	err = dctx.decrypt(context.TODO(), msg, func(dec *decrypter, recipient Recipient, h Headers) error {
+		decrypted, err := dec.Decrypt(recipient.EncryptedKey(), msg.cipherText)
+		if err != nil {
+			return fmt.Errorf(`jwe.Decrypt: decryption failed: %w`, err)
+		}
+
+		if h.Compression() == jwa.Deflate {
+			buf, err := uncompress(decrypted)
+			if err != nil {
+				return fmt.Errorf(`jwe.Derypt: failed to uncompress payload: %w`, err)
+			}
+			decrypted = buf
+		}
+
+		if decrypted == nil {
+			return fmt.Errorf(`failed to find matching recipient`)
+		}
+
+		plaintext = decrypted
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+func newDecryptCtx(options []DecryptOption) (*decryptCtx, error) {
+	var dctx decryptCtx
+	dctx.keyUsageCheck = atomic.LoadUint32(&keyUsageCheck) == 1
+	dctx.allowedKeyAlgs, dctx.allowedEncAlgs = globalAllowedAlgorithms()
+
+	// algorithms given to jwe.Decrypt() replace the global lists
+	var localKeyAlgs, localEncAlgs bool
 
-	var dst *Message
 	//nolint:forcetypeassert
 	for _, option := range options {
 		switch option.Ident() {
+		case identKeyUsageCheck{}:
+			dctx.keyUsageCheck = option.Value().(bool)
+		case identAllowedKeyEncryptionAlgorithms{}:
+			algs := option.Value().([]jwa.KeyEncryptionAlgorithm)
+			if len(algs) == 0 {
+				return nil, fmt.Errorf(`jwe.Decrypt: jwe.WithAllowedKeyEncryptionAlgorithms() must be given at least one algorithm`)
+			}
+			if !localKeyAlgs {
+				dctx.allowedKeyAlgs = nil
+				localKeyAlgs = true
+			}
+			dctx.allowedKeyAlgs = append(dctx.allowedKeyAlgs, algs...)
+		case identAllowedContentEncryptionAlgorithms{}:
+			algs := option.Value().([]jwa.ContentEncryptionAlgorithm)
+			if len(algs) == 0 {
+				return nil, fmt.Errorf(`jwe.Decrypt: jwe.WithAllowedContentEncryptionAlgorithms() must be given at least one algorithm`)
+			}
+			if !localEncAlgs {
+				dctx.allowedEncAlgs = nil
+				localEncAlgs = true
+			}
+			dctx.allowedEncAlgs = append(dctx.allowedEncAlgs, algs...)
 		case identMessage{}:
-			dst = option.Value().(*Message)
+			dctx.dst = option.Value().(*Message)
 		case identKeyProvider{}:
-			keyProviders = append(keyProviders, option.Value().(KeyProvider))
+			dctx.keyProviders = append(dctx.keyProviders, option.Value().(KeyProvider))
 		case identKeyUsed{}:
-			keyUsed = option.Value()
+			dctx.keyUsed = option.Value()
+		case identCriticalExtensions{}:
+			dctx.critical = append(dctx.critical, option.Value().([]string)...)
 		case identKey{}:
 			pair := option.Value().(*withKey)
 			alg, ok := pair.alg.(jwa.KeyEncryptionAlgorithm)
 			if !ok {
 				return nil, fmt.Errorf(`WithKey() option must be specified using jwa.KeyEncryptionAlgorithm (got %T)`, pair.alg)
 			}
-			keyProviders = append(keyProviders, &staticKeyProvider{
+			dctx.keyProviders = append(dctx.keyProviders, &staticKeyProvider{
 				alg: alg,
 				key: pair.key,
 			})
 		}
 	}
 
-	if len(keyProviders) < 1 {
+	if len(dctx.keyProviders) < 1 {
 		return nil, fmt.Errorf(`jwe.Decrypt: no key providers have been provided (see jwe.WithKey(), jwe.WithKeySet(), and jwe.WithKeyProvider()`)
 	}
+	return &dctx, nil
+}
 
-	msg, err := parseJSONOrCompact(buf, true)
-	if err != nil {
-		return nil, fmt.Errorf(`failed to parse buffer for Decrypt: %w`, err)
+// decrypt sets up the context for the given message, and calls fn
+// for each recipient/key pair until one of them succeeds
+func (dctx *decryptCtx) decrypt(ctx context.Context, msg *Message, fn decryptFunc) error {
+	if err := verifyCritical(msg, dctx.critical); err != nil {
+		return fmt.Errorf(`jwe.Decrypt: %w`, err)
 	}
 
 	// Process things that are common to the message
-	ctx := context.TODO()
 	h, err := msg.protectedHeaders.Clone(ctx)
 	if err != nil {
-		return nil, fmt.Errorf(`failed to copy protected headers: %w`, err)
+		return fmt.Errorf(`failed to copy protected headers: %w`, err)
 	}
 	h, err = h.Merge(ctx, msg.unprotectedHeaders)
 	if err != nil {
-		return nil, fmt.Errorf(`failed to merge headers for message decryption: %w`, err)
+		return fmt.Errorf(`failed to merge headers for message decryption: %w`, err)
+	}
+
+	if enc := h.ContentEncryption(); !isAllowedContentEncryptionAlgorithm(dctx.allowedEncAlgs, enc) {
+		return fmt.Errorf(`jwe.Decrypt: content encryption algorithm %q is not allowed`, enc)
 	}
 
 	var aad []byte
@@ -462,7 +698,7 @@ func Decrypt(buf []byte, options ...DecryptOption) ([]byte, error) {
 		var err error
 		computedAad, err = msg.protectedHeaders.Encode()
 		if err != nil {
-			return nil, fmt.Errorf(`failed to encode protected headers: %w`, err)
+			return fmt.Errorf(`failed to encode protected headers: %w`, err)
 		}
 	}
 
@@ -472,43 +708,124 @@ func Decrypt(buf []byte, options ...DecryptOption) ([]byte, error) {
 	if len(recipients) == 0 {
 		r := NewRecipient()
 		if err := r.SetHeaders(msg.protectedHeaders); err != nil {
-			return nil, fmt.Errorf(`failed to set headers to recipient: %w`, err)
+			return fmt.Errorf(`failed to set headers to recipient: %w`, err)
 		}
 		recipients = append(recipients, r)
 	}
 
-	var dctx decryptCtx
-
 	dctx.aad = aad
 	dctx.computedAad = computedAad
 	dctx.msg = msg
-	dctx.keyProviders = keyProviders
 	dctx.protectedHeaders = h
 
 	var lastError error
 	for _, recipient := range recipients {
-		decrypted, err := dctx.try(ctx, recipient, keyUsed)
-		if err != nil {
+		if err := dctx.try(ctx, recipient, fn); err != nil {
 			lastError = err
 			continue
 		}
-		if dst != nil {
+		if dst := dctx.dst; dst != nil {
 			*dst = *msg
-			dst.rawProtectedHeaders = nil
-			dst.storeProtectedHeaders = false
 		}
-		return decrypted, nil
+		return nil
 	}
-	return nil, fmt.Errorf(`jwe.Decrypt: failed to decrypt any of the recipients (last error = %w)`, lastError)
+	return fmt.Errorf(`jwe.Decrypt: failed to decrypt any of the recipients (last error = %w)`, lastError)
+}
+
+// registeredHeaderNames contains the header parameter names defined
+// in RFC7516 and RFC7518. These must not appear in the "crit" header
+var registeredHeaderNames = map[string]struct{}{
+	AgreementPartyUInfoKey:    {},
+	AgreementPartyVInfoKey:    {},
+	AlgorithmKey:              {},
+	CompressionKey:            {},
+	ContentEncryptionKey:      {},
+	ContentTypeKey:            {},
+	CriticalKey:               {},
+	EphemeralPublicKeyKey:     {},
+	JWKKey:                    {},
+	JWKSetURLKey:              {},
+	KeyIDKey:                  {},
+	TypeKey:                   {},
+	X509CertChainKey:          {},
+	X509CertThumbprintKey:     {},
+	X509CertThumbprintS256Key: {},
+	X509URLKey:                {},
+	"iv":                      {},
+	"tag":                     {},
+	"p2s":                     {},
+	"p2c":                     {},
 }
 
-func (dctx *decryptCtx) try(ctx context.Context, recipient Recipient, keyUsed interface{}) ([]byte, error) {
+// verifyCritical checks the "crit" header of the message as described in
+// RFC7516 section 4.1.13. This package does not process any extensions
+// on its own, so all extensions must be explicitly listed by the user
+// via `jwe.WithCriticalExtensions()`
+func verifyCritical(msg *Message, understood []string) error {
+	if public := msg.unprotectedHeaders; public != nil {
+		if _, ok := public.Get(CriticalKey); ok {
+			return fmt.Errorf(`"crit" header must be integrity protected`)
+		}
+	}
+
+	for i, recipient := range msg.recipients {
+		if hdrs := recipient.Headers(); hdrs != nil {
+			if _, ok := hdrs.Get(CriticalKey); ok {
+				return fmt.Errorf(`"crit" header must be integrity protected (found in recipient #%d)`, i)
+			}
+		}
+	}
+
+	protected := msg.protectedHeaders
+	if protected == nil {
+		return nil
+	}
+
+	if _, ok := protected.Get(CriticalKey); !ok {
+		return nil
+	}
+
+	names := protected.Critical()
+	if len(names) == 0 {
+		return fmt.Errorf(`"crit" header must not be empty`)
+	}
+
+	for _, name := range names {
+		if _, ok := registeredHeaderNames[name]; ok {
+			return fmt.Errorf(`"crit" header must not contain registered header %q`, name)
+		}
+
+		if _, ok := protected.Get(name); !ok {
+			return fmt.Errorf(`critical header %q is not present in protected header`, name)
+		}
+
+		var found bool
+		for _, v := range understood {
+			if v == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf(`critical header %q is not supported`, name)
+		}
+	}
+	return nil
+}
+
+func (dctx *decryptCtx) try(ctx context.Context, recipient Recipient, fn decryptFunc) error {
 	var tried int
 	var lastError error
+
+	// the algorithm is checked before any keys are looked up
+	if alg := recipient.Headers().Algorithm(); !isAllowedKeyEncryptionAlgorithm(dctx.allowedKeyAlgs, alg) {
+		return fmt.Errorf(`jwe.Decrypt: key encryption algorithm %q is not allowed`, alg)
+	}
+
 	for i, kp := range dctx.keyProviders {
 		var sink algKeySink
 		if err := kp.FetchKeys(ctx, &sink, recipient, dctx.msg); err != nil {
-			return nil, fmt.Errorf(`key provider %d failed: %w`, i, err)
+			return fmt.Errorf(`key provider %d failed: %w`, i, err)
 		}
 
 		for _, pair := range sink.list {
@@ -518,30 +835,49 @@ func (dctx *decryptCtx) try(ctx context.Context, recipient Recipient, keyUsed in
 			// structs for `alg jwa.KeyAlgorithm` and `alg jwa.SignatureAlgorithm`
 			//nolint:forcetypeassert
 			alg := pair.alg.(jwa.KeyEncryptionAlgorithm)
+			if !isAllowedKeyEncryptionAlgorithm(dctx.allowedKeyAlgs, alg) {
+				continue
+			}
+
 			key := pair.key
+			if dctx.keyUsageCheck {
+				if err := checkKeyUsage(key, alg, jwk.KeyOpDecrypt, jwk.KeyOpUnwrapKey); err != nil {
+					lastError = err
+					continue
+				}
+			}
 
-			decrypted, err := dctx.decryptKey(ctx, alg, key, recipient)
+			dec, h, err := dctx.buildDecrypter(ctx, alg, key, recipient)
 			if err != nil {
 				lastError = err
 				continue
 			}
 
-			if keyUsed != nil {
+			if err := fn(dec, recipient, h); err != nil {
+				lastError = err
+				continue
+			}
+
+			if keyUsed := dctx.keyUsed; keyUsed != nil {
 				if err := blackmagic.AssignIfCompatible(keyUsed, key); err != nil {
-					return nil, fmt.Errorf(`failed to assign used key (%T) to %T: %w`, key, keyUsed, err)
+					return fmt.Errorf(`failed to assign used key (%T) to %T: %w`, key, keyUsed, err)
 				}
 			}
-			return decrypted, nil
+			return nil
 		}
 	}
-	return nil, fmt.Errorf(`jwe.Decrypt: tried %d keys, but failed to match any of the keys with recipient (last error = %s)`, tried, lastError)
+	return fmt.Errorf(`jwe.Decrypt: tried %d keys, but failed to match any of the keys with recipient (last error = %w)`, tried, lastError)
 }
 
-func (dctx *decryptCtx) decryptKey(ctx context.Context, alg jwa.KeyEncryptionAlgorithm, key interface{}, recipient Recipient) ([]byte, error) {
+// buildDecrypter creates a decrypter for the given recipient and key.
+// It also returns the headers that apply to the recipient
+func (dctx *decryptCtx) buildDecrypter(ctx context.Context, alg jwa.KeyEncryptionAlgorithm, key interface{}, recipient Recipient) (*decrypter, Headers, error) {
+	// User-supplied key decrypters receive the key as-is
+	userKey := key
 	if jwkKey, ok := key.(jwk.Key); ok {
 		var raw interface{}
 		if err := jwkKey.Raw(&raw); err != nil {
-			return nil, fmt.Errorf(`failed to retrieve raw key from %T: %w`, key, err)
+			return nil, nil, fmt.Errorf(`failed to retrieve raw key from %T: %w`, key, err)
 		}
 		key = raw
 	}
@@ -554,120 +890,115 @@ func (dctx *decryptCtx) decryptKey(ctx context.Context, alg jwa.KeyEncryptionAlg
 
 	if recipient.Headers().Algorithm() != alg {
 		// algorithms don't match
-		return nil, fmt.Errorf(`jwe.Decrypt: key and recipient algorithms do not match`)
+		return nil, nil, fmt.Errorf(`jwe.Decrypt: key and recipient algorithms do not match`)
 	}
 
 	h2, err := dctx.protectedHeaders.Clone(ctx)
 	if err != nil {
-		return nil, fmt.Errorf(`jwe.Decrypt: failed to copy headers (1): %w`, err)
+		return nil, nil, fmt.Errorf(`jwe.Decrypt: failed to copy headers (1): %w`, err)
 	}
 
 	h2, err = h2.Merge(ctx, recipient.Headers())
 	if err != nil {
-		return nil, fmt.Errorf(`failed to copy headers (2): %w`, err)
+		return nil, nil, fmt.Errorf(`failed to copy headers (2): %w`, err)
 	}
 
-	switch alg {
-	case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
-		epkif, ok := h2.Get(EphemeralPublicKeyKey)
-		if !ok {
-			return nil, fmt.Errorf(`failed to get 'epk' field`)
-		}
-		switch epk := epkif.(type) {
-		case jwk.ECDSAPublicKey:
-			var pubkey ecdsa.PublicKey
-			if err := epk.Raw(&pubkey); err != nil {
-				return nil, fmt.Errorf(`failed to get public key: %w`, err)
-			}
-			dec.PublicKey(&pubkey)
-		case jwk.OKPPublicKey:
-			var pubkey interface{}
-			if err := epk.Raw(&pubkey); err != nil {
-				return nil, fmt.Errorf(`failed to get public key: %w`, err)
-			}
-			dec.PublicKey(pubkey)
-		default:
-			return nil, fmt.Errorf("unexpected 'epk' type %T for alg %s", epkif, alg)
-		}
-
-		if apu := h2.AgreementPartyUInfo(); len(apu) > 0 {
-			dec.AgreementPartyUInfo(apu)
-		}
-
-		if apv := h2.AgreementPartyVInfo(); len(apv) > 0 {
-			dec.AgreementPartyVInfo(apv)
-		}
-	case jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW:
-		ivB64, ok := h2.Get(InitializationVectorKey)
-		if !ok {
-			return nil, fmt.Errorf(`failed to get 'iv' field`)
-		}
-		ivB64Str, ok := ivB64.(string)
-		if !ok {
-			return nil, fmt.Errorf("unexpected type for 'iv': %T", ivB64)
-		}
-		tagB64, ok := h2.Get(TagKey)
-		if !ok {
-			return nil, fmt.Errorf(`failed to get 'tag' field`)
-		}
-		tagB64Str, ok := tagB64.(string)
-		if !ok {
-			return nil, fmt.Errorf("unexpected type for 'tag': %T", tagB64)
-		}
-		iv, err := base64.DecodeString(ivB64Str)
-		if err != nil {
-			return nil, fmt.Errorf(`failed to b64-decode 'iv': %w`, err)
-		}
-		tag, err := base64.DecodeString(tagB64Str)
+	if f, ok := keyDecrypterDB[alg]; ok {
+		kd, err := f.Create()
 		if err != nil {
-			return nil, fmt.Errorf(`failed to b64-decode 'tag': %w`, err)
-		}
-		dec.KeyInitializationVector(iv)
-		dec.KeyTag(tag)
-	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
-		saltB64, ok := h2.Get(SaltKey)
-		if !ok {
-			return nil, fmt.Errorf(`failed to get 'p2s' field`)
-		}
-		saltB64Str, ok := saltB64.(string)
-		if !ok {
-			return nil, fmt.Errorf("unexpected type for 'p2s': %T", saltB64)
+			return nil, nil, fmt.Errorf(`jwe.Decrypt: failed to create key decrypter for %s: %w`, alg, err)
 		}
+		dec.KeyDecrypter(&keyDecrypterAdapter{
+			decrypter: kd,
+			key:       userKey,
+			headers:   h2,
+		})
+	} else {
+		switch alg {
+		case jwa.ECDH_ES, jwa.ECDH_ES_A128KW, jwa.ECDH_ES_A192KW, jwa.ECDH_ES_A256KW:
+			epkif, ok := h2.Get(EphemeralPublicKeyKey)
+			if !ok {
+				return nil, nil, fmt.Errorf(`failed to get 'epk' field`)
+			}
+			switch epk := epkif.(type) {
+			case jwk.ECDSAPublicKey:
+				var pubkey ecdsa.PublicKey
+				if err := epk.Raw(&pubkey); err != nil {
+					return nil, nil, fmt.Errorf(`failed to get public key: %w`, err)
+				}
+				dec.PublicKey(&pubkey)
+			case jwk.OKPPublicKey:
+				var pubkey interface{}
+				if err := epk.Raw(&pubkey); err != nil {
+					return nil, nil, fmt.Errorf(`failed to get public key: %w`, err)
+				}
+				dec.PublicKey(pubkey)
+			default:
+				return nil, nil, fmt.Errorf("unexpected 'epk' type %T for alg %s", epkif, alg)
+			}
 
-		count, ok := h2.Get(CountKey)
-		if !ok {
-			return nil, fmt.Errorf(`failed to get 'p2c' field`)
-		}
-		countFlt, ok := count.(float64)
-		if !ok {
-			return nil, fmt.Errorf("unexpected type for 'p2c': %T", count)
-		}
-		salt, err := base64.DecodeString(saltB64Str)
-		if err != nil {
-			return nil, fmt.Errorf(`failed to b64-decode 'salt': %w`, err)
-		}
-		dec.KeySalt(salt)
-		dec.KeyCount(int(countFlt))
-	}
+			if apu := h2.AgreementPartyUInfo(); len(apu) > 0 {
+				dec.AgreementPartyUInfo(apu)
+			}
 
-	plaintext, err := dec.Decrypt(recipient.EncryptedKey(), dctx.msg.cipherText)
-	if err != nil {
-		return nil, fmt.Errorf(`jwe.Decrypt: decryption failed: %w`, err)
-	}
+			if apv := h2.AgreementPartyVInfo(); len(apv) > 0 {
+				dec.AgreementPartyVInfo(apv)
+			}
+		case jwa.A128GCMKW, jwa.A192GCMKW, jwa.A256GCMKW:
+			ivB64, ok := h2.Get(InitializationVectorKey)
+			if !ok {
+				return nil, nil, fmt.Errorf(`failed to get 'iv' field`)
+			}
+			ivB64Str, ok := ivB64.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("unexpected type for 'iv': %T", ivB64)
+			}
+			tagB64, ok := h2.Get(TagKey)
+			if !ok {
+				return nil, nil, fmt.Errorf(`failed to get 'tag' field`)
+			}
+			tagB64Str, ok := tagB64.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("unexpected type for 'tag': %T", tagB64)
+			}
+			iv, err := base64.DecodeString(ivB64Str)
+			if err != nil {
+				return nil, nil, fmt.Errorf(`failed to b64-decode 'iv': %w`, err)
+			}
+			tag, err := base64.DecodeString(tagB64Str)
+			if err != nil {
+				return nil, nil, fmt.Errorf(`failed to b64-decode 'tag': %w`, err)
+			}
+			dec.KeyInitializationVector(iv)
+			dec.KeyTag(tag)
+		case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+			saltB64, ok := h2.Get(SaltKey)
+			if !ok {
+				return nil, nil, fmt.Errorf(`failed to get 'p2s' field`)
+			}
+			saltB64Str, ok := saltB64.(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("unexpected type for 'p2s': %T", saltB64)
+			}
 
-	if h2.Compression() == jwa.Deflate {
-		buf, err := uncompress(plaintext)
-		if err != nil {
-			return nil, fmt.Errorf(`jwe.Derypt: failed to uncompress payload: %w`, err)
+			count, ok := h2.Get(CountKey)
+			if !ok {
+				return nil, nil, fmt.Errorf(`failed to get 'p2c' field`)
+			}
+			countFlt, ok := count.(float64)
+			if !ok {
+				return nil, nil, fmt.Errorf("unexpected type for 'p2c': %T", count)
+			}
+			salt, err := base64.DecodeString(saltB64Str)
+			if err != nil {
+				return nil, nil, fmt.Errorf(`failed to b64-decode 'salt': %w`, err)
+			}
+			dec.KeySalt(salt)
+			dec.KeyCount(int(countFlt))
 		}
-		plaintext = buf
 	}
 
-	if plaintext == nil {
-		return nil, fmt.Errorf(`failed to find matching recipient`)
-	}
-
-	return plaintext, nil
+	return dec, h2, nil
 }
 
 // Parse parses the JWE message into a Message object. The JWE message
@@ -676,19 +1007,19 @@ func (dctx *decryptCtx) decryptKey(ctx context.Context, alg jwa.KeyEncryptionAlg
 // Parse() currently does not take any options, but the API accepts it
 // in anticipation of future addition.
 func Parse(buf []byte, _ ...ParseOption) (*Message, error) {
-	return parseJSONOrCompact(buf, false)
+	return parseJSONOrCompact(buf)
 }
 
-func parseJSONOrCompact(buf []byte, storeProtectedHeaders bool) (*Message, error) {
+func parseJSONOrCompact(buf []byte) (*Message, error) {
 	buf = bytes.TrimSpace(buf)
 	if len(buf) == 0 {
 		return nil, fmt.Errorf(`empty buffer`)
 	}
 
 	if buf[0] == '{' {
-		return parseJSON(buf, storeProtectedHeaders)
+		return parseJSON(buf)
 	}
-	return parseCompact(buf, storeProtectedHeaders)
+	return parseCompact(buf)
 }
 
 // ParseString is the same as Parse, but takes a string.
@@ -705,16 +1036,15 @@ func ParseReader(src io.Reader) (*Message, error) {
 	return Parse(buf)
 }
 
-func parseJSON(buf []byte, storeProtectedHeaders bool) (*Message, error) {
+func parseJSON(buf []byte) (*Message, error) {
 	m := NewMessage()
-	m.storeProtectedHeaders = storeProtectedHeaders
 	if err := json.Unmarshal(buf, &m); err != nil {
 		return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
 	}
 	return m, nil
 }
 
-func parseCompact(buf []byte, storeProtectedHeaders bool) (*Message, error) {
+func parseCompact(buf []byte) (*Message, error) {
 	parts := bytes.Split(buf, []byte{'.'})
 	if len(parts) != 5 {
 		return nil, fmt.Errorf(`compact JWE format must have five parts (%d)`, len(parts))
@@ -764,10 +1094,10 @@ func parseCompact(buf []byte, storeProtectedHeaders bool) (*Message, error) {
 		return nil, fmt.Errorf(`failed to set %s: %w`, TagKey, err)
 	}
 
-	if storeProtectedHeaders {
-		// This is later used for decryption.
-		m.rawProtectedHeaders = parts[0]
-	}
+	// This is later used for decryption and serialization. Make a copy,
+	// as buf belongs to the caller
+	m.rawProtectedHeaders = make([]byte, len(parts[0]))
+	copy(m.rawProtectedHeaders, parts[0])
 
 	return m, nil
 }
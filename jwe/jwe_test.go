@@ -1,15 +1,22 @@
 package jwe_test
 
 import (
+	"bytes"
 	"context"
 	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -21,7 +28,9 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwe"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 const (
@@ -460,6 +469,15 @@ func TestEncode_X25519(t *testing.T) {
 	testEncodeECDHWithKey(t, privkey, pubkey)
 }
 
+func TestEncode_X448(t *testing.T) {
+	pubkey, privkey, err := x448.GenerateKey(rand.Reader)
+	if !assert.NoError(t, err, `x448.GenerateKey should succeed`) {
+		return
+	}
+
+	testEncodeECDHWithKey(t, privkey, pubkey)
+}
+
 func Test_GHIssue207(t *testing.T) {
 	const plaintext = "hi\n"
 	var testcases = []struct {
@@ -793,3 +811,959 @@ func TestGH554(t *testing.T) {
 		return
 	}
 }
+
+func TestCriticalExtensions(t *testing.T) {
+	const plaintext = `Lorem ipsum`
+	key := []byte("0123456789abcdef")
+
+	hdrs := jwe.NewHeaders()
+	if !assert.NoError(t, hdrs.Set(jwe.CriticalKey, []string{"exp"}), `hdrs.Set should succeed`) {
+		return
+	}
+	if !assert.NoError(t, hdrs.Set("exp", 1363284000), `hdrs.Set should succeed`) {
+		return
+	}
+
+	encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithKey(jwa.A128KW, key), jwe.WithProtectedHeaders(hdrs))
+	if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+		return
+	}
+
+	_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.A128KW, key))
+	if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+		return
+	}
+
+	decrypted, err := jwe.Decrypt(encrypted, jwe.WithKey(jwa.A128KW, key), jwe.WithCriticalExtensions("exp"))
+	if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+		return
+	}
+	if !assert.Equal(t, plaintext, string(decrypted), `decrypted content should match`) {
+		return
+	}
+
+	t.Run("registered header", func(t *testing.T) {
+		hdrs := jwe.NewHeaders()
+		if !assert.NoError(t, hdrs.Set(jwe.CriticalKey, []string{jwe.ContentEncryptionKey}), `hdrs.Set should succeed`) {
+			return
+		}
+		encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithKey(jwa.A128KW, key), jwe.WithProtectedHeaders(hdrs))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.A128KW, key), jwe.WithCriticalExtensions(jwe.ContentEncryptionKey))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+	})
+	t.Run("per-recipient header", func(t *testing.T) {
+		hdrs := jwe.NewHeaders()
+		if !assert.NoError(t, hdrs.Set(jwe.CriticalKey, []string{"exp"}), `hdrs.Set should succeed`) {
+			return
+		}
+		if !assert.NoError(t, hdrs.Set("exp", 1363284000), `hdrs.Set should succeed`) {
+			return
+		}
+		encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithJSON(), jwe.WithKey(jwa.A128KW, key, jwe.WithPerRecipientHeaders(hdrs)))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.A128KW, key), jwe.WithCriticalExtensions("exp"))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+	})
+}
+
+// xorKeyHandle emulates a key that is stored outside of the process,
+// such as in an HSM. Only the key encrypter/decrypter knows how to use it
+type xorKeyHandle struct {
+	secret byte
+}
+
+const xorAlgorithm = jwa.KeyEncryptionAlgorithm("x-test-xor")
+
+type xorKeyEncrypter struct{}
+
+func (xorKeyEncrypter) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return xorAlgorithm
+}
+
+func (xorKeyEncrypter) EncryptKey(cek []byte, key interface{}, hdrs jwe.Headers) ([]byte, error) {
+	handle, ok := key.(*xorKeyHandle)
+	if !ok {
+		return nil, fmt.Errorf(`expected *xorKeyHandle, got %T`, key)
+	}
+	if err := hdrs.Set("x-test-xor-version", "1"); err != nil {
+		return nil, err
+	}
+	enckey := make([]byte, len(cek))
+	for i, b := range cek {
+		enckey[i] = b ^ handle.secret
+	}
+	return enckey, nil
+}
+
+type xorKeyDecrypter struct{}
+
+func (xorKeyDecrypter) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return xorAlgorithm
+}
+
+func (xorKeyDecrypter) DecryptKey(enckey []byte, key interface{}, hdrs jwe.Headers) ([]byte, error) {
+	handle, ok := key.(*xorKeyHandle)
+	if !ok {
+		return nil, fmt.Errorf(`expected *xorKeyHandle, got %T`, key)
+	}
+	if v, ok := hdrs.Get("x-test-xor-version"); !ok || v != "1" {
+		return nil, fmt.Errorf(`missing or invalid "x-test-xor-version" header`)
+	}
+	cek := make([]byte, len(enckey))
+	for i, b := range enckey {
+		cek[i] = b ^ handle.secret
+	}
+	return cek, nil
+}
+
+func TestCustomKeyEncryption(t *testing.T) {
+	jwe.RegisterKeyEncrypter(xorAlgorithm, jwe.KeyEncrypterFactoryFn(func() (jwe.KeyEncrypter, error) {
+		return xorKeyEncrypter{}, nil
+	}))
+	jwe.RegisterKeyDecrypter(xorAlgorithm, jwe.KeyDecrypterFactoryFn(func() (jwe.KeyDecrypter, error) {
+		return xorKeyDecrypter{}, nil
+	}))
+
+	const plaintext = `Lorem ipsum`
+	handle := &xorKeyHandle{secret: 0x5a}
+
+	for _, serialization := range []jwe.EncryptOption{jwe.WithCompact(), jwe.WithJSON()} {
+		encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithKey(xorAlgorithm, handle), serialization)
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+
+		msg, err := jwe.Parse(encrypted)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, xorAlgorithm, msg.Recipients()[0].Headers().Algorithm(), `algorithm should match`) {
+			return
+		}
+
+		decrypted, err := jwe.Decrypt(encrypted, jwe.WithKey(xorAlgorithm, handle))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, plaintext, string(decrypted), `decrypted content should match`) {
+			return
+		}
+
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(xorAlgorithm, &xorKeyHandle{secret: 0x42}))
+		if !assert.Error(t, err, `jwe.Decrypt with the wrong key should fail`) {
+			return
+		}
+	}
+}
+
+const xc20p = jwa.ContentEncryptionAlgorithm("XC20P")
+
+// xc20pCipher implements XChaCha20-Poly1305 content encryption
+type xc20pCipher struct{}
+
+func (xc20pCipher) KeySize() int {
+	return chacha20poly1305.KeySize
+}
+
+func (xc20pCipher) Encrypt(cek, plaintext, aad []byte) ([]byte, []byte, []byte, error) {
+	aead, err := chacha20poly1305.NewX(cek)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	sealed := aead.Seal(nil, iv, plaintext, aad)
+	tagoffset := len(sealed) - aead.Overhead()
+	return iv, sealed[:tagoffset], sealed[tagoffset:], nil
+}
+
+func (xc20pCipher) Decrypt(cek, iv, ciphertext, tag, aad []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(cek)
+	if err != nil {
+		return nil, err
+	}
+	combined := make([]byte, 0, len(ciphertext)+len(tag))
+	combined = append(combined, ciphertext...)
+	combined = append(combined, tag...)
+	return aead.Open(nil, iv, combined, aad)
+}
+
+func TestCustomContentCipher(t *testing.T) {
+	jwe.RegisterContentCipher(xc20p, jwe.ContentCipherFactoryFn(func() (jwe.ContentCipher, error) {
+		return xc20pCipher{}, nil
+	}))
+
+	const plaintext = `Lorem ipsum`
+	ecdsaKey, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+	if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+		return
+	}
+
+	testcases := []struct {
+		Name    string
+		Alg     jwa.KeyEncryptionAlgorithm
+		Key     interface{}
+		Decrypt interface{}
+	}{
+		{
+			Name:    "A128KW",
+			Alg:     jwa.A128KW,
+			Key:     []byte("0123456789abcdef"),
+			Decrypt: []byte("0123456789abcdef"),
+		},
+		{
+			Name:    "RSA-OAEP",
+			Alg:     jwa.RSA_OAEP,
+			Key:     &rsaPrivKey.PublicKey,
+			Decrypt: &rsaPrivKey,
+		},
+		{
+			Name:    "ECDH-ES",
+			Alg:     jwa.ECDH_ES,
+			Key:     &ecdsaKey.PublicKey,
+			Decrypt: ecdsaKey,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithKey(tc.Alg, tc.Key), jwe.WithContentEncryption(xc20p))
+			if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+				return
+			}
+
+			msg, err := jwe.Parse(encrypted)
+			if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+				return
+			}
+			if !assert.Equal(t, xc20p, msg.ProtectedHeaders().ContentEncryption(), `"enc" should be XC20P`) {
+				return
+			}
+
+			decrypted, err := jwe.Decrypt(encrypted, jwe.WithKey(tc.Alg, tc.Decrypt))
+			if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+				return
+			}
+			if !assert.Equal(t, plaintext, string(decrypted), `decrypted content should match`) {
+				return
+			}
+		})
+	}
+}
+
+// opaqueDecrypter emulates a key that is stored in a KMS, which is only
+// available as a crypto.Decrypter
+type opaqueDecrypter struct {
+	decrypter crypto.Decrypter
+}
+
+func (d *opaqueDecrypter) Public() crypto.PublicKey {
+	return d.decrypter.Public()
+}
+
+func (d *opaqueDecrypter) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return d.decrypter.Decrypt(rand, msg, opts)
+}
+
+func TestDecryptCryptoDecrypter(t *testing.T) {
+	const plaintext = `Lorem ipsum`
+	decrypter := &opaqueDecrypter{decrypter: &rsaPrivKey}
+
+	for _, alg := range []jwa.KeyEncryptionAlgorithm{jwa.RSA1_5, jwa.RSA_OAEP, jwa.RSA_OAEP_256} {
+		alg := alg
+		t.Run(alg.String(), func(t *testing.T) {
+			encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithKey(alg, &rsaPrivKey.PublicKey))
+			if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+				return
+			}
+
+			decrypted, err := jwe.Decrypt(encrypted, jwe.WithKey(alg, decrypter))
+			if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+				return
+			}
+			if !assert.Equal(t, plaintext, string(decrypted), `decrypted content should match`) {
+				return
+			}
+		})
+	}
+
+	t.Run("non-RSA crypto.Decrypter", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt([]byte(plaintext), jwe.WithKey(jwa.RSA_OAEP, &rsaPrivKey.PublicKey))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA_OAEP, &nonRSADecrypter{}))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+	})
+}
+
+type nonRSADecrypter struct{}
+
+func (nonRSADecrypter) Public() crypto.PublicKey {
+	return ed25519.PublicKey(make([]byte, ed25519.PublicKeySize))
+}
+
+func (nonRSADecrypter) Decrypt(io.Reader, []byte, crypto.DecrypterOpts) ([]byte, error) {
+	return nil, fmt.Errorf(`should not be called`)
+}
+
+func TestStream(t *testing.T) {
+	rsaKey, err := jwxtest.GenerateRsaKey()
+	if !assert.NoError(t, err, `jwxtest.GenerateRsaKey should succeed`) {
+		return
+	}
+	ecKey, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+	if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+		return
+	}
+
+	// large enough to span multiple internal buffers
+	payload := []byte(strings.Repeat(examplePayload, 2000))
+
+	serializations := []struct {
+		Name    string
+		Options []jwe.EncryptOption
+	}{
+		{Name: "Compact"},
+		{Name: "JSON", Options: []jwe.EncryptOption{jwe.WithJSON()}},
+		{Name: "JSON (pretty)", Options: []jwe.EncryptOption{jwe.WithJSON(jwe.WithPretty(true))}},
+	}
+	calgs := []jwa.ContentEncryptionAlgorithm{jwa.A128CBC_HS256, jwa.A192CBC_HS384, jwa.A256CBC_HS512}
+	zips := []jwa.CompressionAlgorithm{jwa.NoCompress, jwa.Deflate}
+
+	for _, s := range serializations {
+		s := s
+		for _, calg := range calgs {
+			calg := calg
+			for _, zip := range zips {
+				zip := zip
+				t.Run(fmt.Sprintf("%s/%s/%s", s.Name, calg, zip), func(t *testing.T) {
+					options := append([]jwe.EncryptOption{
+						jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey),
+						jwe.WithContentEncryption(calg),
+						jwe.WithCompress(zip),
+					}, s.Options...)
+
+					var buf bytes.Buffer
+					w, err := jwe.NewEncryptWriter(&buf, options...)
+					if !assert.NoError(t, err, `jwe.NewEncryptWriter should succeed`) {
+						return
+					}
+					// write in chunks that do not align with the block size
+					for in := payload; len(in) > 0; {
+						n := 1000
+						if n > len(in) {
+							n = len(in)
+						}
+						if _, err := w.Write(in[:n]); !assert.NoError(t, err, `w.Write should succeed`) {
+							return
+						}
+						in = in[n:]
+					}
+					if !assert.NoError(t, w.Close(), `w.Close should succeed`) {
+						return
+					}
+
+					// The streamed message must be readable by the regular API
+					decrypted, err := jwe.Decrypt(buf.Bytes(), jwe.WithKey(jwa.RSA_OAEP, rsaKey))
+					if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+						return
+					}
+					if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+						return
+					}
+
+					r, err := jwe.NewDecryptReader(bytes.NewReader(buf.Bytes()), jwe.WithKey(jwa.RSA_OAEP, rsaKey))
+					if !assert.NoError(t, err, `jwe.NewDecryptReader should succeed`) {
+						return
+					}
+					defer r.Close()
+
+					decrypted, err = ioutil.ReadAll(r)
+					if !assert.NoError(t, err, `reading from decrypt reader should succeed`) {
+						return
+					}
+					if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+						return
+					}
+				})
+			}
+		}
+	}
+	t.Run("Decrypt message from jwe.Encrypt", func(t *testing.T) {
+		for _, s := range serializations {
+			options := append([]jwe.EncryptOption{
+				jwe.WithKey(jwa.ECDH_ES_A128KW, &ecKey.PublicKey),
+				jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey),
+				jwe.WithContentEncryption(jwa.A128CBC_HS256),
+			}, s.Options...)
+			if s.Name == "Compact" {
+				options = options[1:]
+			}
+
+			encrypted, err := jwe.Encrypt(payload, options...)
+			if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+				return
+			}
+
+			r, err := jwe.NewDecryptReader(bytes.NewReader(encrypted), jwe.WithKey(jwa.RSA_OAEP, rsaKey))
+			if !assert.NoError(t, err, `jwe.NewDecryptReader should succeed (%s)`, s.Name) {
+				return
+			}
+			decrypted, err := ioutil.ReadAll(r)
+			_ = r.Close()
+			if !assert.NoError(t, err, `reading from decrypt reader should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+				return
+			}
+		}
+	})
+	t.Run("Multiple recipients", func(t *testing.T) {
+		var buf bytes.Buffer
+		w, err := jwe.NewEncryptWriter(&buf,
+			jwe.WithJSON(),
+			jwe.WithKey(jwa.ECDH_ES_A128KW, &ecKey.PublicKey),
+			jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey),
+		)
+		if !assert.NoError(t, err, `jwe.NewEncryptWriter should succeed`) {
+			return
+		}
+		_, _ = w.Write(payload)
+		if !assert.NoError(t, w.Close(), `w.Close should succeed`) {
+			return
+		}
+
+		for _, key := range []jwe.DecryptOption{jwe.WithKey(jwa.RSA_OAEP, rsaKey), jwe.WithKey(jwa.ECDH_ES_A128KW, ecKey)} {
+			r, err := jwe.NewDecryptReader(bytes.NewReader(buf.Bytes()), key)
+			if !assert.NoError(t, err, `jwe.NewDecryptReader should succeed`) {
+				return
+			}
+			decrypted, err := ioutil.ReadAll(r)
+			_ = r.Close()
+			if !assert.NoError(t, err, `reading from decrypt reader should succeed`) {
+				return
+			}
+			if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+				return
+			}
+		}
+	})
+	t.Run("AES-GCM is not supported", func(t *testing.T) {
+		_, err := jwe.NewEncryptWriter(ioutil.Discard, jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey), jwe.WithContentEncryption(jwa.A256GCM))
+		if !assert.Error(t, err, `jwe.NewEncryptWriter should fail`) {
+			return
+		}
+
+		encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey), jwe.WithContentEncryption(jwa.A256GCM))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		_, err = jwe.NewDecryptReader(bytes.NewReader(encrypted), jwe.WithKey(jwa.RSA_OAEP, rsaKey))
+		if !assert.Error(t, err, `jwe.NewDecryptReader should fail`) {
+			return
+		}
+	})
+	t.Run("Staging options", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey), jwe.WithContentEncryption(jwa.A128CBC_HS256))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+
+		dir, err := ioutil.TempDir("", "jwe-stream-test-")
+		if !assert.NoError(t, err, `ioutil.TempDir should succeed`) {
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		r, err := jwe.NewDecryptReader(bytes.NewReader(encrypted), jwe.WithKey(jwa.RSA_OAEP, rsaKey), jwe.WithStagingDir(dir), jwe.WithMaxCiphertextSize(int64(len(encrypted))))
+		if !assert.NoError(t, err, `jwe.NewDecryptReader should succeed`) {
+			return
+		}
+		files, err := ioutil.ReadDir(dir)
+		if !assert.NoError(t, err, `ioutil.ReadDir should succeed`) {
+			return
+		}
+		if !assert.Len(t, files, 1, `staging file should be created in the staging directory`) {
+			return
+		}
+		decrypted, err := ioutil.ReadAll(r)
+		if !assert.NoError(t, err, `reading from decrypt reader should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payloads should match`) {
+			return
+		}
+		if !assert.NoError(t, r.Close(), `r.Close should succeed`) {
+			return
+		}
+		files, err = ioutil.ReadDir(dir)
+		if !assert.NoError(t, err, `ioutil.ReadDir should succeed`) {
+			return
+		}
+		if !assert.Len(t, files, 0, `staging file should be removed`) {
+			return
+		}
+
+		_, err = jwe.NewDecryptReader(bytes.NewReader(encrypted), jwe.WithKey(jwa.RSA_OAEP, rsaKey), jwe.WithStagingDir(dir), jwe.WithMaxCiphertextSize(int64(len(payload)/2)))
+		if !assert.Error(t, err, `jwe.NewDecryptReader should fail`) {
+			return
+		}
+		files, err = ioutil.ReadDir(dir)
+		if !assert.NoError(t, err, `ioutil.ReadDir should succeed`) {
+			return
+		}
+		if !assert.Len(t, files, 0, `staging file should be removed`) {
+			return
+		}
+	})
+	t.Run("Tampered ciphertext", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey), jwe.WithContentEncryption(jwa.A128CBC_HS256))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+
+		parts := strings.Split(string(encrypted), ".")
+		ciphertext := []byte(parts[3])
+		if ciphertext[10] == 'A' {
+			ciphertext[10] = 'B'
+		} else {
+			ciphertext[10] = 'A'
+		}
+		parts[3] = string(ciphertext)
+
+		_, err = jwe.NewDecryptReader(strings.NewReader(strings.Join(parts, ".")), jwe.WithKey(jwa.RSA_OAEP, rsaKey))
+		if !assert.Error(t, err, `jwe.NewDecryptReader should fail`) {
+			return
+		}
+	})
+	t.Run("Truncated message", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, &rsaKey.PublicKey), jwe.WithContentEncryption(jwa.A128CBC_HS256), jwe.WithJSON())
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+
+		_, err = jwe.NewDecryptReader(bytes.NewReader(encrypted[:len(encrypted)/2]), jwe.WithKey(jwa.RSA_OAEP, rsaKey))
+		if !assert.Error(t, err, `jwe.NewDecryptReader should fail`) {
+			return
+		}
+	})
+}
+
+func TestEncryptKey(t *testing.T) {
+	password := []byte(`correct horse battery staple`)
+
+	raw, err := jwxtest.GenerateRsaKey()
+	if !assert.NoError(t, err, `jwxtest.GenerateRsaKey should succeed`) {
+		return
+	}
+	key, err := jwk.FromRaw(raw)
+	if !assert.NoError(t, err, `jwk.FromRaw should succeed`) {
+		return
+	}
+	if !assert.NoError(t, key.Set(jwk.KeyIDKey, `my-key`), `key.Set should succeed`) {
+		return
+	}
+
+	t.Run("Key", func(t *testing.T) {
+		encrypted, err := jwe.EncryptKey(key, password)
+		if !assert.NoError(t, err, `jwe.EncryptKey should succeed`) {
+			return
+		}
+
+		msg, err := jwe.Parse(encrypted)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, jwa.PBES2_HS512_A256KW, msg.ProtectedHeaders().Algorithm(), `"alg" should match`) {
+			return
+		}
+		if !assert.Equal(t, jwe.JWKContentType, msg.ProtectedHeaders().ContentType(), `"cty" should match`) {
+			return
+		}
+
+		decrypted, err := jwe.DecryptKey(encrypted, password)
+		if !assert.NoError(t, err, `jwe.DecryptKey should succeed`) {
+			return
+		}
+		if !assertJSONEqual(t, key, decrypted) {
+			return
+		}
+
+		set, err := jwe.DecryptSet(encrypted, password)
+		if !assert.NoError(t, err, `jwe.DecryptSet should succeed for a single key`) {
+			return
+		}
+		if !assert.Equal(t, 1, set.Len(), `set should contain one key`) {
+			return
+		}
+
+		_, err = jwe.DecryptKey(encrypted, []byte(`wrong password`))
+		if !assert.Error(t, err, `jwe.DecryptKey should fail with the wrong password`) {
+			return
+		}
+	})
+	t.Run("Set", func(t *testing.T) {
+		set := jwk.NewSet()
+		set.Add(key)
+		symmetric, err := jwk.FromRaw([]byte(`0123456789abcdef0123456789abcdef`))
+		if !assert.NoError(t, err, `jwk.FromRaw should succeed`) {
+			return
+		}
+		set.Add(symmetric)
+
+		encrypted, err := jwe.EncryptSet(set, password, jwe.WithContentEncryption(jwa.A128CBC_HS256))
+		if !assert.NoError(t, err, `jwe.EncryptSet should succeed`) {
+			return
+		}
+
+		decrypted, err := jwe.DecryptSet(encrypted, password)
+		if !assert.NoError(t, err, `jwe.DecryptSet should succeed`) {
+			return
+		}
+		if !assert.Equal(t, set.Len(), decrypted.Len(), `sets should have the same number of keys`) {
+			return
+		}
+		for i := 0; i < set.Len(); i++ {
+			expected, _ := set.Get(i)
+			actual, _ := decrypted.Get(i)
+			if !assertJSONEqual(t, expected, actual) {
+				return
+			}
+		}
+
+		_, err = jwe.DecryptKey(encrypted, password)
+		if !assert.Error(t, err, `jwe.DecryptKey should fail for a set`) {
+			return
+		}
+	})
+	t.Run("Non-PBES2", func(t *testing.T) {
+		encrypted, err := jwe.Encrypt([]byte(`{"kty":"oct","k":"c2VjcmV0"}`), jwe.WithKey(jwa.A128KW, []byte(`0123456789abcdef`)))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+
+		_, err = jwe.DecryptKey(encrypted, []byte(`0123456789abcdef`))
+		if !assert.Error(t, err, `jwe.DecryptKey should fail for non-PBES2 algorithms`) {
+			return
+		}
+	})
+	t.Run("Empty password", func(t *testing.T) {
+		_, err := jwe.EncryptKey(key, nil)
+		if !assert.Error(t, err, `jwe.EncryptKey should fail with an empty password`) {
+			return
+		}
+	})
+}
+
+func assertJSONEqual(t *testing.T, expected, actual interface{}) bool {
+	t.Helper()
+	expectedJSON, err := json.Marshal(expected)
+	if !assert.NoError(t, err, `json.Marshal should succeed`) {
+		return false
+	}
+	actualJSON, err := json.Marshal(actual)
+	if !assert.NoError(t, err, `json.Marshal should succeed`) {
+		return false
+	}
+	return assert.JSONEq(t, string(expectedJSON), string(actualJSON), `values should match`)
+}
+
+func TestKeyUsageCheck(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	newKey := func(options ...jwk.GenerateOption) jwk.Key {
+		key, err := jwk.Generate(jwa.RSA, options...)
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			t.FailNow()
+		}
+		return key
+	}
+
+	testcases := []struct {
+		Name string
+		Key  jwk.Key
+	}{
+		{Name: "use=sig", Key: newKey(jwk.WithKeyUsage(jwk.ForSignature))},
+		{Name: "key_ops without encryption", Key: newKey(jwk.WithKeyOps(jwk.KeyOpSign))},
+		{Name: "Different alg", Key: newKey(jwk.WithAlgorithm(jwa.RSA1_5))},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			pubkey, err := tc.Key.PublicKey()
+			if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+				return
+			}
+
+			encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, pubkey))
+			if !assert.NoError(t, err, `jwe.Encrypt should succeed without key usage checks`) {
+				return
+			}
+			_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA_OAEP, tc.Key))
+			if !assert.NoError(t, err, `jwe.Decrypt should succeed without key usage checks`) {
+				return
+			}
+
+			_, err = jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, pubkey), jwe.WithKeyUsageCheck(true))
+			if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jwe.Encrypt should fail with key usage checks (got %v)`, err) {
+				return
+			}
+			_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA_OAEP, tc.Key), jwe.WithKeyUsageCheck(true))
+			if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jwe.Decrypt should fail with key usage checks (got %v)`, err) {
+				return
+			}
+		})
+	}
+	t.Run("Allowed keys", func(t *testing.T) {
+		key := newKey(jwk.WithKeyUsage(jwk.ForEncryption), jwk.WithKeyOps(jwk.KeyOpWrapKey, jwk.KeyOpUnwrapKey), jwk.WithAlgorithm(jwa.RSA_OAEP))
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, pubkey), jwe.WithKeyUsageCheck(true))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA_OAEP, key), jwe.WithKeyUsageCheck(true))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, decrypted, `payload should match`) {
+			return
+		}
+	})
+	t.Run("ECDH-ES with deriveKey", func(t *testing.T) {
+		key, err := jwk.Generate(jwa.EC, jwk.WithKeyOps(jwk.KeyOpDeriveKey))
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.ECDH_ES, pubkey), jwe.WithKeyUsageCheck(true))
+		if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.ECDH_ES, key), jwe.WithKeyUsageCheck(true))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+	})
+	t.Run("Settings", func(t *testing.T) {
+		key := newKey(jwk.WithKeyUsage(jwk.ForSignature))
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+
+		jwe.Settings(jwe.WithKeyUsageCheck(true))
+		defer jwe.Settings(jwe.WithKeyUsageCheck(false))
+
+		_, err = jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, pubkey))
+		if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jwe.Encrypt should fail with global key usage checks (got %v)`, err) {
+			return
+		}
+		_, err = jwe.Encrypt(payload, jwe.WithKey(jwa.RSA_OAEP, pubkey), jwe.WithKeyUsageCheck(false))
+		if !assert.NoError(t, err, `jwe.WithKeyUsageCheck(false) should override the global setting`) {
+			return
+		}
+	})
+}
+
+func TestAllowedAlgorithms(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	key, err := jwk.Generate(jwa.RSA)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	pubkey, err := key.PublicKey()
+	if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+		return
+	}
+
+	encrypted, err := jwe.Encrypt(payload, jwe.WithKey(jwa.RSA1_5, pubkey), jwe.WithContentEncryption(jwa.A128CBC_HS256))
+	if !assert.NoError(t, err, `jwe.Encrypt should succeed`) {
+		return
+	}
+
+	t.Run("No policy", func(t *testing.T) {
+		_, err := jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+	})
+	t.Run("Key encryption algorithms", func(t *testing.T) {
+		_, err := jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedKeyEncryptionAlgorithms(jwa.RSA_OAEP, jwa.RSA_OAEP_256))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `key encryption algorithm "RSA1_5" is not allowed`, `error should mention the algorithm`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedKeyEncryptionAlgorithms(jwa.RSA1_5))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+	})
+	t.Run("Content encryption algorithms", func(t *testing.T) {
+		_, err := jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedContentEncryptionAlgorithms(jwa.A256GCM))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `content encryption algorithm "A128CBC-HS256" is not allowed`, `error should mention the algorithm`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedContentEncryptionAlgorithms(jwa.A128CBC_HS256))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+	})
+	t.Run("Settings", func(t *testing.T) {
+		jwe.Settings(jwe.WithAllowedKeyEncryptionAlgorithms(jwa.RSA_OAEP))
+		defer jwe.Settings(jwe.WithAllowedKeyEncryptionAlgorithms())
+
+		_, err := jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key))
+		if !assert.Error(t, err, `jwe.Decrypt should fail with the global policy`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedKeyEncryptionAlgorithms(jwa.RSA1_5))
+		if !assert.NoError(t, err, `jwe.WithAllowedKeyEncryptionAlgorithms should override the global policy`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedKeyEncryptionAlgorithms())
+		if !assert.Error(t, err, `empty jwe.WithAllowedKeyEncryptionAlgorithms should not override the global policy`) {
+			return
+		}
+		_, err = jwe.Decrypt(encrypted, jwe.WithKey(jwa.RSA1_5, key), jwe.WithAllowedKeyEncryptionAlgorithms(jwa.RSA1_5), jwe.WithAllowedContentEncryptionAlgorithms())
+		if !assert.Error(t, err, `empty jwe.WithAllowedContentEncryptionAlgorithms should be rejected`) {
+			return
+		}
+	})
+}
+
+func TestRawProtectedHeaders(t *testing.T) {
+	// Create a message whose protected header contains line breaks, which
+	// would not survive being parsed and serialized again
+	const hdr = `{"alg":"dir",` + "\r\n" + ` "enc":"A128GCM"}`
+	key := make([]byte, 16)
+	iv := make([]byte, 12)
+	for _, buf := range [][]byte{key, iv} {
+		if _, err := rand.Read(buf); !assert.NoError(t, err, `rand.Read should succeed`) {
+			return
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if !assert.NoError(t, err, `aes.NewCipher should succeed`) {
+		return
+	}
+	aead, err := cipher.NewGCM(block)
+	if !assert.NoError(t, err, `cipher.NewGCM should succeed`) {
+		return
+	}
+
+	rawProtected := base64.RawURLEncoding.EncodeToString([]byte(hdr))
+	sealed := aead.Seal(nil, iv, []byte(examplePayload), []byte(rawProtected))
+	tagOffset := len(sealed) - aead.Overhead()
+	compact := strings.Join([]string{
+		rawProtected,
+		``,
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(sealed[:tagOffset]),
+		base64.RawURLEncoding.EncodeToString(sealed[tagOffset:]),
+	}, `.`)
+
+	decrypted, err := jwe.Decrypt([]byte(compact), jwe.WithKey(jwa.DIRECT, key))
+	if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+		return
+	}
+	if !assert.Equal(t, examplePayload, string(decrypted), `payload should match`) {
+		return
+	}
+
+	t.Run("JSON serialization", func(t *testing.T) {
+		msg, err := jwe.Parse([]byte(compact))
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		serialized, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		if !assert.Contains(t, string(serialized), `"protected":"`+rawProtected+`"`, `original protected header should be used`) {
+			return
+		}
+		decrypted, err := jwe.Decrypt(serialized, jwe.WithKey(jwa.DIRECT, key))
+		if !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		if !assert.Equal(t, examplePayload, string(decrypted), `payload should match`) {
+			return
+		}
+
+		// parse the JSON serialization, and convert it back to compact form
+		parsed, err := jwe.Parse(serialized)
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		reserialized, err := jwe.Compact(parsed)
+		if !assert.NoError(t, err, `jwe.Compact should succeed`) {
+			return
+		}
+		if !assert.Equal(t, compact, string(reserialized), `compact serialization should match`) {
+			return
+		}
+	})
+	t.Run("WithMessage", func(t *testing.T) {
+		msg := jwe.NewMessage()
+		if _, err := jwe.Decrypt([]byte(compact), jwe.WithKey(jwa.DIRECT, key), jwe.WithMessage(msg)); !assert.NoError(t, err, `jwe.Decrypt should succeed`) {
+			return
+		}
+		reserialized, err := jwe.Compact(msg)
+		if !assert.NoError(t, err, `jwe.Compact should succeed`) {
+			return
+		}
+		if !assert.Equal(t, compact, string(reserialized), `compact serialization should match`) {
+			return
+		}
+	})
+	t.Run("Modified protected headers", func(t *testing.T) {
+		msg, err := jwe.Parse([]byte(compact))
+		if !assert.NoError(t, err, `jwe.Parse should succeed`) {
+			return
+		}
+		if !assert.NoError(t, msg.ProtectedHeaders().Set(jwe.KeyIDKey, `my-key`), `Set should succeed`) {
+			return
+		}
+		reserialized, err := jwe.Compact(msg)
+		if !assert.NoError(t, err, `jwe.Compact should succeed`) {
+			return
+		}
+		if !assert.False(t, strings.HasPrefix(string(reserialized), rawProtected+`.`), `original protected header should not be used`) {
+			return
+		}
+		_, err = jwe.Decrypt(reserialized, jwe.WithKey(jwa.DIRECT, key))
+		if !assert.Error(t, err, `jwe.Decrypt should fail`) {
+			return
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package jwe
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// Content types for encrypted JWK and JWK Set (RFC7517 section 7 and 8.5)
+const (
+	JWKContentType    = `jwk+json`
+	JWKSetContentType = `jwk-set+json`
+)
+
+// EncryptKey encrypts `key` using a password, as described in RFC7517
+// section 7. The key is serialized in JSON format, and encrypted using
+// PBES2-HS512+A256KW. The "cty" header is set to "jwk+json".
+//
+// The options are passed to `jwe.Encrypt()`, which means that for example
+// `jwe.WithContentEncryption()` can be used to change the content encryption
+// algorithm. Protected headers specified via `jwe.WithProtectedHeaders()`
+// are merged with the "cty" header.
+//
+// Note that these functions are provided in the `jwe` package, as the
+// `jwk` package cannot depend on the `jwe` package.
+func EncryptKey(key jwk.Key, password []byte, options ...EncryptOption) ([]byte, error) {
+	buf, err := json.Marshal(key)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.EncryptKey: failed to marshal key: %w`, err)
+	}
+
+	encrypted, err := encryptWithPassword(buf, password, JWKContentType, options)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.EncryptKey: %w`, err)
+	}
+	return encrypted, nil
+}
+
+// EncryptSet encrypts `set` using a password, in the same manner as
+// `jwe.EncryptKey()`, except that the "cty" header is set to "jwk-set+json".
+func EncryptSet(set jwk.Set, password []byte, options ...EncryptOption) ([]byte, error) {
+	buf, err := json.Marshal(set)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.EncryptSet: failed to marshal set: %w`, err)
+	}
+
+	encrypted, err := encryptWithPassword(buf, password, JWKSetContentType, options)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.EncryptSet: %w`, err)
+	}
+	return encrypted, nil
+}
+
+func encryptWithPassword(payload, password []byte, cty string, options []EncryptOption) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, fmt.Errorf(`password must not be empty`)
+	}
+
+	hdrs := NewHeaders()
+	if err := hdrs.Set(ContentTypeKey, cty); err != nil {
+		return nil, fmt.Errorf(`failed to set %q: %w`, ContentTypeKey, err)
+	}
+
+	encryptOptions := make([]EncryptOption, 0, len(options)+3)
+	encryptOptions = append(encryptOptions,
+		WithKey(jwa.PBES2_HS512_A256KW, password),
+		WithMergeProtectedHeaders(true),
+		WithProtectedHeaders(hdrs),
+	)
+	encryptOptions = append(encryptOptions, options...)
+	return Encrypt(payload, encryptOptions...)
+}
+
+// DecryptKey decrypts a key that was encrypted using a password, such as
+// those created by `jwe.EncryptKey()`. The message must be encrypted using
+// one of the PBES2 algorithms, and if the "cty" header is present, it must
+// be "jwk+json".
+//
+// The options are passed to `jwe.Decrypt()`
+func DecryptKey(data, password []byte, options ...DecryptOption) (jwk.Key, error) {
+	payload, err := decryptWithPassword(data, password, []string{JWKContentType}, options)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.DecryptKey: %w`, err)
+	}
+
+	key, err := jwk.ParseKey(payload)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.DecryptKey: failed to parse key: %w`, err)
+	}
+	return key, nil
+}
+
+// DecryptSet decrypts a JWK Set that was encrypted using a password, such
+// as those created by `jwe.EncryptSet()`. The message must be encrypted using
+// one of the PBES2 algorithms, and if the "cty" header is present, it must
+// be either "jwk-set+json" or "jwk+json". In the latter case, the returned
+// set contains the single key.
+//
+// The options are passed to `jwe.Decrypt()`
+func DecryptSet(data, password []byte, options ...DecryptOption) (jwk.Set, error) {
+	payload, err := decryptWithPassword(data, password, []string{JWKSetContentType, JWKContentType}, options)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.DecryptSet: %w`, err)
+	}
+
+	set, err := jwk.Parse(payload)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.DecryptSet: failed to parse set: %w`, err)
+	}
+	return set, nil
+}
+
+func decryptWithPassword(data, password []byte, ctys []string, options []DecryptOption) ([]byte, error) {
+	msg, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse message: %w`, err)
+	}
+
+	if cty := msg.ProtectedHeaders().ContentType(); cty != "" && !isContentType(cty, ctys) {
+		return nil, fmt.Errorf(`unexpected content type %q`, cty)
+	}
+
+	// all recipients must use the same PBES2 algorithm, as the
+	// password can only be specified for a single algorithm
+	var alg jwa.KeyEncryptionAlgorithm
+	for _, r := range msg.Recipients() {
+		v, err := recipientAlgorithm(msg, r)
+		if err != nil {
+			return nil, err
+		}
+		if alg != "" && alg != v {
+			return nil, fmt.Errorf(`recipients use different algorithms (%q, %q)`, alg, v)
+		}
+		alg = v
+	}
+
+	switch alg {
+	case jwa.PBES2_HS256_A128KW, jwa.PBES2_HS384_A192KW, jwa.PBES2_HS512_A256KW:
+	default:
+		return nil, fmt.Errorf(`unsupported key encryption algorithm %q (must be one of PBES2)`, alg)
+	}
+
+	decryptOptions := make([]DecryptOption, 0, len(options)+1)
+	decryptOptions = append(decryptOptions, WithKey(alg, password))
+	decryptOptions = append(decryptOptions, options...)
+	payload, err := Decrypt(data, decryptOptions...)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to decrypt: %w`, err)
+	}
+	return payload, nil
+}
+
+func recipientAlgorithm(msg *Message, r Recipient) (jwa.KeyEncryptionAlgorithm, error) {
+	if h := r.Headers(); h != nil && h.Algorithm() != "" {
+		return h.Algorithm(), nil
+	}
+	if alg := msg.ProtectedHeaders().Algorithm(); alg != "" {
+		return alg, nil
+	}
+	return "", fmt.Errorf(`"alg" not found`)
+}
+
+// isContentType returns true if cty matches one of ctys. As described in
+// RFC7515 section 4.1.10, the "application/" prefix may be omitted, and
+// the comparison is case-insensitive.
+func isContentType(cty string, ctys []string) bool {
+	cty = strings.TrimPrefix(strings.ToLower(cty), `application/`)
+	for _, v := range ctys {
+		if cty == v {
+			return true
+		}
+	}
+	return false
+}
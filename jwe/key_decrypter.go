@@ -0,0 +1,49 @@
+package jwe
+
+import (
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+type KeyDecrypterFactory interface {
+	Create() (KeyDecrypter, error)
+}
+type KeyDecrypterFactoryFn func() (KeyDecrypter, error)
+
+func (fn KeyDecrypterFactoryFn) Create() (KeyDecrypter, error) {
+	return fn()
+}
+
+var keyDecrypterDB = make(map[jwa.KeyEncryptionAlgorithm]KeyDecrypterFactory)
+
+// RegisterKeyDecrypter is used to register a factory object that creates
+// KeyDecrypter objects based on the given algorithm.
+//
+// For example, if you would like to decrypt content encryption keys
+// using a key stored in an HSM, or would like to support a key encryption
+// algorithm that this library does not know about, use this function
+// to register a `KeyDecrypterFactory` (probably in your `init()`)
+//
+// A KeyDecrypter registered for an algorithm that is supported natively
+// takes precedence over the built-in implementation. If the algorithm is
+// not known to the `jwa` package, it is registered using
+// `jwa.RegisterKeyEncryptionAlgorithm()`.
+func RegisterKeyDecrypter(alg jwa.KeyEncryptionAlgorithm, f KeyDecrypterFactory) {
+	jwa.RegisterKeyEncryptionAlgorithm(alg)
+	keyDecrypterDB[alg] = f
+}
+
+// keyDecrypterAdapter wraps a user supplied KeyDecrypter so that it
+// can be used in place of the built-in key decrypters
+type keyDecrypterAdapter struct {
+	decrypter KeyDecrypter
+	key       interface{}
+	headers   Headers
+}
+
+func (a *keyDecrypterAdapter) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return a.decrypter.Algorithm()
+}
+
+func (a *keyDecrypterAdapter) Decrypt(enckey []byte) ([]byte, error) {
+	return a.decrypter.DecryptKey(enckey, a.key, a.headers)
+}
@@ -0,0 +1,88 @@
+package jwe
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe/internal/keygen"
+)
+
+type KeyEncrypterFactory interface {
+	Create() (KeyEncrypter, error)
+}
+type KeyEncrypterFactoryFn func() (KeyEncrypter, error)
+
+func (fn KeyEncrypterFactoryFn) Create() (KeyEncrypter, error) {
+	return fn()
+}
+
+var keyEncrypterDB = make(map[jwa.KeyEncryptionAlgorithm]KeyEncrypterFactory)
+
+// RegisterKeyEncrypter is used to register a factory object that creates
+// KeyEncrypter objects based on the given algorithm.
+//
+// For example, if you would like to encrypt content encryption keys
+// using a key stored in an HSM, or would like to support a key encryption
+// algorithm that this library does not know about, use this function
+// to register a `KeyEncrypterFactory` (probably in your `init()`)
+//
+// A KeyEncrypter registered for an algorithm that is supported natively
+// takes precedence over the built-in implementation. If the algorithm is
+// not known to the `jwa` package, it is registered using
+// `jwa.RegisterKeyEncryptionAlgorithm()`.
+func RegisterKeyEncrypter(alg jwa.KeyEncryptionAlgorithm, f KeyEncrypterFactory) {
+	jwa.RegisterKeyEncryptionAlgorithm(alg)
+	keyEncrypterDB[alg] = f
+}
+
+// keyEncrypterAdapter wraps a user supplied KeyEncrypter so that it
+// can be used in place of the built-in key encrypters
+type keyEncrypterAdapter struct {
+	encrypter KeyEncrypter
+	key       interface{}
+	keyID     string
+}
+
+func (a *keyEncrypterAdapter) Algorithm() jwa.KeyEncryptionAlgorithm {
+	return a.encrypter.Algorithm()
+}
+
+func (a *keyEncrypterAdapter) KeyID() string {
+	return a.keyID
+}
+
+func (a *keyEncrypterAdapter) SetKeyID(v string) {
+	a.keyID = v
+}
+
+func (a *keyEncrypterAdapter) Encrypt(cek []byte) (keygen.ByteSource, error) {
+	hdrs := NewHeaders()
+	enckey, err := a.encrypter.EncryptKey(cek, a.key, hdrs)
+	if err != nil {
+		return nil, err
+	}
+	return byteWithHeaders{
+		ByteKey: keygen.ByteKey(enckey),
+		headers: hdrs,
+	}, nil
+}
+
+// byteWithHeaders holds the encrypted key along with the headers
+// that the KeyEncrypter requested to be set in the recipient's header
+type byteWithHeaders struct {
+	keygen.ByteKey
+	headers Headers
+}
+
+func (k byteWithHeaders) Populate(h keygen.Setter) error {
+	for iter := k.headers.Iterate(context.TODO()); iter.Next(context.TODO()); {
+		pair := iter.Pair()
+		//nolint:forcetypeassert
+		name := pair.Key.(string)
+		if err := h.Set(name, pair.Value); err != nil {
+			return fmt.Errorf(`failed to set header %q: %w`, name, err)
+		}
+	}
+	return nil
+}
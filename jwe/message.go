@@ -1,6 +1,7 @@
 package jwe
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"sort"
@@ -229,7 +230,7 @@ func (m *Message) MarshalJSON() ([]byte, error) {
 
 	var encodedProtectedHeaders []byte
 	if h := m.ProtectedHeaders(); h != nil {
-		v, err := h.Encode()
+		v, err := m.encodeProtectedHeaders(h)
 		if err != nil {
 			return nil, fmt.Errorf(`failed to encode protected headers: %w`, err)
 		}
@@ -433,10 +434,8 @@ func (m *Message) UnmarshalJSON(buf []byte) error {
 	}
 
 	m.protectedHeaders = h
-	if m.storeProtectedHeaders {
-		// this is later used for decryption
-		m.rawProtectedHeaders = base64.Encode(protectedHeadersRaw)
-	}
+	// this is later used for decryption and serialization
+	m.rawProtectedHeaders = []byte(protectedHeadersStr)
 
 	if iz, ok := proxy.UnprotectedHeaders.(isZeroer); ok {
 		if !iz.isZero() {
@@ -465,6 +464,11 @@ func (m *Message) makeDummyRecipient(enckeybuf string, protected Headers) error
 		return fmt.Errorf(`failed to remove %#v from public header: %w`, ContentEncryptionKey, err)
 	}
 
+	// "crit" only belongs to the protected header
+	if err := hdrs.Remove(CriticalKey); err != nil {
+		return fmt.Errorf(`failed to remove %#v from public header: %w`, CriticalKey, err)
+	}
+
 	enckey, err := base64.DecodeString(enckeybuf)
 	if err != nil {
 		return fmt.Errorf(`failed to decode encrypted key: %w`, err)
@@ -481,6 +485,37 @@ func (m *Message) makeDummyRecipient(enckeybuf string, protected Headers) error
 	return nil
 }
 
+// encodeProtectedHeaders encodes h, which is expected to be the protected
+// headers of m (possibly merged with other headers). If m was parsed and h
+// still represents the original protected header, the original buffer is
+// returned as-is, so that the integrity value computed from it stays valid.
+func (m *Message) encodeProtectedHeaders(h Headers) ([]byte, error) {
+	encoded, err := h.Encode()
+	if err != nil {
+		return nil, err
+	}
+
+	if raw := m.rawProtectedHeaders; len(raw) > 0 && !bytes.Equal(raw, encoded) && isEquivalentHeader(raw, encoded) {
+		return raw, nil
+	}
+	return encoded, nil
+}
+
+// isEquivalentHeader returns true if the base64url encoded header raw
+// is equivalent to the header encoded using (Headers).Encode()
+func isEquivalentHeader(raw, encoded []byte) bool {
+	h := NewHeaders()
+	if err := h.Decode(raw); err != nil {
+		return false
+	}
+
+	canonical, err := h.Encode()
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(canonical, encoded)
+}
+
 // Compact generates a JWE message in compact serialization format from a
 // `*jwe.Message` object. The object contain exactly one recipient, or
 // an error is returned.
@@ -517,7 +552,7 @@ func Compact(m *Message, _ ...CompactOption) ([]byte, error) {
 		return nil, fmt.Errorf(`failed to merge recipient header: %w`, err)
 	}
 
-	protected, err := hcopy.Encode()
+	protected, err := m.encodeProtectedHeaders(hcopy)
 	if err != nil {
 		return nil, fmt.Errorf(`failed to encode header: %w`, err)
 	}
@@ -49,6 +49,11 @@ func WithPerRecipientHeaders(hdr Headers) WithKeySuboption {
 // passed to the option. If you specify other algorithm types such as `jwa.ContentEncryptionAlgorithm`,
 // then you will get an error when `jwe.Encrypt()` or `jwe.Decrypt()` is executed.
 //
+// When decrypting messages using RSA1_5, RSA-OAEP, or RSA-OAEP-256, a
+// `crypto.Decrypter` may be passed as `key`. This is useful when the private
+// part of a key is kept in an inaccessible location, such as a KMS.
+// The `crypto.Decrypter`'s `Public()` method must return a `*rsa.PublicKey`.
+//
 // Unlike `jwe.WithKeySet()`, the `kid` field does not need to match for the key
 // to be tried.
 func WithKey(alg jwa.KeyAlgorithm, key interface{}, options ...WithKeySuboption) EncryptDecryptOption {
@@ -105,3 +110,41 @@ func WithJSON(options ...WithJSONSuboption) EncryptOption {
 	}
 	return &encryptOption{option.New(identSerialization{}, format)}
 }
+
+// WithCriticalExtensions specifies the names of the header parameters
+// listed in the "crit" header that the caller understands and processes.
+//
+// By default `jwe.Decrypt()` rejects messages whose "crit" header
+// contains any extensions. Specifying names via this option tells
+// `jwe.Decrypt()` that the application will handle those extensions
+// on its own, and that it is safe to accept them.
+//
+// This option may be specified multiple times, in which case the
+// names are accumulated.
+func WithCriticalExtensions(names ...string) DecryptOption {
+	return &decryptOption{option.New(identCriticalExtensions{}, names)}
+}
+
+// WithAllowedKeyEncryptionAlgorithms specifies the key encryption
+// algorithms that are accepted by `jwe.Decrypt()`. Recipients whose
+// "alg" header is not listed are rejected before any keys are looked up.
+//
+// When passed to `jwe.Settings()`, the list replaces the global list
+// that applies to all subsequent calls to `jwe.Decrypt()`. When passed
+// to `jwe.Decrypt()`, it replaces the global list for that call, and
+// may be specified multiple times, in which case the algorithms are
+// accumulated. An empty list passed to `jwe.Settings()` allows all
+// algorithms, which is the default. An empty list passed to `jwe.Decrypt()`
+// is an error.
+func WithAllowedKeyEncryptionAlgorithms(algs ...jwa.KeyEncryptionAlgorithm) GlobalDecryptOption {
+	return &globalDecryptOption{option.New(identAllowedKeyEncryptionAlgorithms{}, algs)}
+}
+
+// WithAllowedContentEncryptionAlgorithms specifies the content encryption
+// algorithms that are accepted by `jwe.Decrypt()`. Messages whose "enc"
+// header is not listed are rejected before any keys are looked up.
+//
+// The list is handled in the same way as `jwe.WithAllowedKeyEncryptionAlgorithms()`.
+func WithAllowedContentEncryptionAlgorithms(algs ...jwa.ContentEncryptionAlgorithm) GlobalDecryptOption {
+	return &globalDecryptOption{option.New(identAllowedContentEncryptionAlgorithms{}, algs)}
+}
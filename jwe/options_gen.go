@@ -62,6 +62,53 @@ type encryptOption struct {
 
 func (*encryptOption) encryptOption() {}
 
+// GlobalDecryptOption describes options that can be passed to `jwe.Settings()`,
+// as well as to `jwe.Decrypt()`
+type GlobalDecryptOption interface {
+	Option
+	globalOption()
+	decryptOption()
+}
+
+type globalDecryptOption struct {
+	Option
+}
+
+func (*globalDecryptOption) globalOption() {}
+
+func (*globalDecryptOption) decryptOption() {}
+
+// GlobalEncryptDecryptOption describes options that can be passed to `jwe.Settings()`,
+// as well as to `jwe.Encrypt()` and `jwe.Decrypt()`
+type GlobalEncryptDecryptOption interface {
+	Option
+	globalOption()
+	encryptOption()
+	decryptOption()
+}
+
+type globalEncryptDecryptOption struct {
+	Option
+}
+
+func (*globalEncryptDecryptOption) globalOption() {}
+
+func (*globalEncryptDecryptOption) encryptOption() {}
+
+func (*globalEncryptDecryptOption) decryptOption() {}
+
+// GlobalOption describes options that can be passed to `jwe.Settings()`
+type GlobalOption interface {
+	Option
+	globalOption()
+}
+
+type globalOption struct {
+	Option
+}
+
+func (*globalOption) globalOption() {}
+
 // ReadFileOption is a type of `Option` that can be passed to `jwe.Parse`
 type ParseOption interface {
 	Option
@@ -110,12 +157,17 @@ type withKeySetSuboption struct {
 
 func (*withKeySetSuboption) withKeySetSuboption() {}
 
+type identAllowedContentEncryptionAlgorithms struct{}
+type identAllowedKeyEncryptionAlgorithms struct{}
 type identCompress struct{}
 type identContentEncryptionAlgorithm struct{}
+type identCriticalExtensions struct{}
 type identFS struct{}
 type identKey struct{}
 type identKeyProvider struct{}
+type identKeyUsageCheck struct{}
 type identKeyUsed struct{}
+type identMaxCiphertextSize struct{}
 type identMergeProtectedHeaders struct{}
 type identMessage struct{}
 type identPerRecipientHeaders struct{}
@@ -123,6 +175,15 @@ type identPretty struct{}
 type identProtectedHeaders struct{}
 type identRequireKid struct{}
 type identSerialization struct{}
+type identStagingDir struct{}
+
+func (identAllowedContentEncryptionAlgorithms) String() string {
+	return "WithAllowedContentEncryptionAlgorithms"
+}
+
+func (identAllowedKeyEncryptionAlgorithms) String() string {
+	return "WithAllowedKeyEncryptionAlgorithms"
+}
 
 func (identCompress) String() string {
 	return "WithCompress"
@@ -132,6 +193,10 @@ func (identContentEncryptionAlgorithm) String() string {
 	return "WithContentEncryption"
 }
 
+func (identCriticalExtensions) String() string {
+	return "WithCriticalExtensions"
+}
+
 func (identFS) String() string {
 	return "WithFS"
 }
@@ -144,10 +209,18 @@ func (identKeyProvider) String() string {
 	return "WithKeyProvider"
 }
 
+func (identKeyUsageCheck) String() string {
+	return "WithKeyUsageCheck"
+}
+
 func (identKeyUsed) String() string {
 	return "WithKeyUsed"
 }
 
+func (identMaxCiphertextSize) String() string {
+	return "WithMaxCiphertextSize"
+}
+
 func (identMergeProtectedHeaders) String() string {
 	return "WithMergeProtectedHeaders"
 }
@@ -176,6 +249,10 @@ func (identSerialization) String() string {
 	return "WithCompact"
 }
 
+func (identStagingDir) String() string {
+	return "WithStagingDir"
+}
+
 // WithCompress specifies the compression algorithm to use when encrypting
 // a payload using `jwe.Encrypt` (Yes, we know it can only be "" or "DEF",
 // but the way the specification is written it could allow for more options,
@@ -199,6 +276,21 @@ func WithKeyProvider(v KeyProvider) DecryptOption {
 	return &decryptOption{option.New(identKeyProvider{}, v)}
 }
 
+// WithKeyUsageCheck specifies whether the "use", "key_ops" and "alg" fields
+// of keys of type `jwk.Key` are enforced by `jwe.Encrypt()` and `jwe.Decrypt()`.
+// When enabled, the key used to encrypt must allow "encrypt" or "wrapKey", and the key used to
+// decrypt must allow "decrypt" or "unwrapKey" ("deriveKey" is also accepted
+// for ECDH-ES). Keys that are not allowed are skipped during decryption.
+// See `jwk.CheckKeyUsage()` for details. Checks are not performed
+// against raw keys (e.g. *rsa.PrivateKey), as they do not carry such metadata.
+//
+// When passed to `jwe.Settings()`, the setting applies to all subsequent
+// calls. When passed directly to `jwe.Encrypt()` or `jwe.Decrypt()`, it overrides
+// the global setting for that call. The default is false.
+func WithKeyUsageCheck(v bool) GlobalEncryptDecryptOption {
+	return &globalEncryptDecryptOption{option.New(identKeyUsageCheck{}, v)}
+}
+
 // WithKeyUsed allows you to specify the `jwe.Decrypt()` function to
 // return the key used for decryption. This may be useful when
 // you specify multiple key sources or if you pass a `jwk.Set`
@@ -213,6 +305,16 @@ func WithKeyUsed(v interface{}) DecryptOption {
 	return &decryptOption{option.New(identKeyUsed{}, v)}
 }
 
+// WithMaxCiphertextSize specifies the maximum number of bytes of
+// (decoded) ciphertext that `jwe.NewDecryptReader()` writes to its
+// staging file. If the message contains more ciphertext than this,
+// `jwe.NewDecryptReader()` returns an error. By default there is no limit.
+//
+// This option has no effect on `jwe.Decrypt()`.
+func WithMaxCiphertextSize(v int64) DecryptOption {
+	return &decryptOption{option.New(identMaxCiphertextSize{}, v)}
+}
+
 // WithMergeProtectedHeaders specify that when given multiple headers
 // as options to `jwe.Encrypt`, these headers should be merged instead
 // of overwritten
@@ -253,3 +355,13 @@ func WithRequireKid(v bool) WithKeySetSuboption {
 func WithCompact() EncryptOption {
 	return &encryptOption{option.New(identSerialization{}, fmtCompact)}
 }
+
+// WithStagingDir specifies the directory in which `jwe.NewDecryptReader()`
+// creates the temporary file used to stage the ciphertext. If not
+// provided, the default directory for temporary files is used
+// (see `os.TempDir()`).
+//
+// This option has no effect on `jwe.Decrypt()`.
+func WithStagingDir(v string) DecryptOption {
+	return &decryptOption{option.New(identStagingDir{}, v)}
+}
@@ -9,12 +9,17 @@ import (
 )
 
 func TestOptionIdent(t *testing.T) {
+	require.Equal(t, "WithAllowedContentEncryptionAlgorithms", identAllowedContentEncryptionAlgorithms{}.String())
+	require.Equal(t, "WithAllowedKeyEncryptionAlgorithms", identAllowedKeyEncryptionAlgorithms{}.String())
 	require.Equal(t, "WithCompress", identCompress{}.String())
 	require.Equal(t, "WithContentEncryption", identContentEncryptionAlgorithm{}.String())
+	require.Equal(t, "WithCriticalExtensions", identCriticalExtensions{}.String())
 	require.Equal(t, "WithFS", identFS{}.String())
 	require.Equal(t, "WithKey", identKey{}.String())
 	require.Equal(t, "WithKeyProvider", identKeyProvider{}.String())
+	require.Equal(t, "WithKeyUsageCheck", identKeyUsageCheck{}.String())
 	require.Equal(t, "WithKeyUsed", identKeyUsed{}.String())
+	require.Equal(t, "WithMaxCiphertextSize", identMaxCiphertextSize{}.String())
 	require.Equal(t, "WithMergeProtectedHeaders", identMergeProtectedHeaders{}.String())
 	require.Equal(t, "WithMessage", identMessage{}.String())
 	require.Equal(t, "WithPerRecipientHeaders", identPerRecipientHeaders{}.String())
@@ -22,4 +27,5 @@ func TestOptionIdent(t *testing.T) {
 	require.Equal(t, "WithProtectedHeaders", identProtectedHeaders{}.String())
 	require.Equal(t, "WithRequireKid", identRequireKid{}.String())
 	require.Equal(t, "WithCompact", identSerialization{}.String())
+	require.Equal(t, "WithStagingDir", identStagingDir{}.String())
 }
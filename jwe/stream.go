@@ -0,0 +1,615 @@
+package jwe
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwe/internal/cipher"
+)
+
+// NewEncryptWriter creates an io.WriteCloser that encrypts the data written
+// to it, and writes the resulting JWE message to `dst`. It accepts the same
+// options as `jwe.Encrypt()`, and produces the same serialization.
+//
+// Unlike `jwe.Encrypt()`, the payload is never held in memory as a whole:
+// the ciphertext is written to `dst` as the payload is written. The
+// authentication tag is written when Close() is called, so the message
+// is incomplete until then. Close() does NOT close `dst`.
+//
+// Only the AES-CBC-HMAC-SHA2 content encryption algorithms can be used
+// for streaming, and unlike `jwe.Encrypt()`, `jwa.A256CBC_HS512` is used
+// if `jwe.WithContentEncryption()` is not specified. Use `jwe.Encrypt()`
+// to produce messages encrypted using AES-GCM.
+func NewEncryptWriter(dst io.Writer, options ...EncryptOption) (io.WriteCloser, error) {
+	options = append([]EncryptOption{WithContentEncryption(jwa.A256CBC_HS512)}, options...)
+	ec, err := newEncryptCtx(options)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.NewEncryptWriter: %w`, err)
+	}
+
+	w := &encryptWriter{
+		ec:  ec,
+		dst: dst,
+		b64: base64.NewEncoder(base64.RawURLEncoding, dst),
+	}
+
+	enc, err := cipher.NewStreamEncrypter(ec.calg, ec.cek, ec.aad, w.b64)
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.NewEncryptWriter: failed to create content encrypter: %w`, err)
+	}
+	w.enc = enc
+	w.out = enc
+
+	if ec.compression != jwa.NoCompress {
+		zw, err := flate.NewWriter(enc, 1)
+		if err != nil {
+			return nil, fmt.Errorf(`jwe.NewEncryptWriter: failed to create compression writer: %w`, err)
+		}
+		w.zw = zw
+		w.out = zw
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return nil, fmt.Errorf(`jwe.NewEncryptWriter: failed to write header: %w`, err)
+	}
+	return w, nil
+}
+
+type encryptWriter struct {
+	ec     *encryptCtx
+	dst    io.Writer
+	b64    io.WriteCloser
+	enc    cipher.StreamEncrypter
+	zw     *flate.Writer
+	out    io.Writer
+	inner  []byte // JSON serialization only: fields other than ciphertext and tag
+	err    error
+	closed bool
+}
+
+// writeHeader writes everything that precedes the ciphertext
+func (w *encryptWriter) writeHeader() error {
+	var header []byte
+	switch w.ec.format {
+	case fmtCompact:
+		if len(w.ec.recipients) != 1 {
+			return fmt.Errorf(`wrong number of recipients for compact serialization`)
+		}
+		var buf bytes.Buffer
+		buf.Write(w.ec.aad)
+		buf.WriteByte('.')
+		buf.WriteString(base64.RawURLEncoding.EncodeToString(w.ec.recipients[0].EncryptedKey()))
+		buf.WriteByte('.')
+		buf.WriteString(base64.RawURLEncoding.EncodeToString(w.enc.IV()))
+		buf.WriteByte('.')
+		header = buf.Bytes()
+	case fmtJSON, fmtJSONPretty:
+		// Marshal the message without the ciphertext and the tag, and
+		// then splice those two in as the first and the last fields.
+		// This produces the same (sorted) field order as jwe.Encrypt()
+		msg, err := w.ec.message(w.enc.IV(), nil)
+		if err != nil {
+			return err
+		}
+
+		if w.ec.format == fmtJSON {
+			skeleton, err := json.Marshal(msg)
+			if err != nil {
+				return fmt.Errorf(`failed to marshal message: %w`, err)
+			}
+			w.inner = skeleton[1 : len(skeleton)-1]
+			header = []byte(`{"ciphertext":"`)
+		} else {
+			skeleton, err := json.MarshalIndent(msg, "", "  ")
+			if err != nil {
+				return fmt.Errorf(`failed to marshal message: %w`, err)
+			}
+			w.inner = skeleton[2 : len(skeleton)-2]
+			header = []byte("{\n  \"ciphertext\": \"")
+		}
+	default:
+		return fmt.Errorf(`invalid serialization`)
+	}
+
+	_, err := w.dst.Write(header)
+	return err
+}
+
+// writeTrailer writes everything that follows the ciphertext
+func (w *encryptWriter) writeTrailer() error {
+	tag := base64.RawURLEncoding.EncodeToString(w.enc.Tag())
+
+	var buf bytes.Buffer
+	switch w.ec.format {
+	case fmtCompact:
+		buf.WriteByte('.')
+		buf.WriteString(tag)
+	case fmtJSON:
+		buf.WriteString(`",`)
+		buf.Write(w.inner)
+		fmt.Fprintf(&buf, `,"tag":%q}`, tag)
+	case fmtJSONPretty:
+		buf.WriteString("\",\n")
+		buf.Write(w.inner)
+		fmt.Fprintf(&buf, ",\n  \"tag\": %q\n}", tag)
+	}
+
+	_, err := w.dst.Write(buf.Bytes())
+	return err
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf(`jwe: write to closed writer`)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n, err := w.out.Write(p)
+	if err != nil {
+		w.err = fmt.Errorf(`jwe: failed to write payload: %w`, err)
+		return n, w.err
+	}
+	return n, nil
+}
+
+// Close flushes the remaining data and writes the authentication tag.
+func (w *encryptWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.err != nil {
+		return w.err
+	}
+
+	if w.zw != nil {
+		if err := w.zw.Close(); err != nil {
+			return fmt.Errorf(`jwe: failed to close compression writer: %w`, err)
+		}
+	}
+	if err := w.enc.Close(); err != nil {
+		return fmt.Errorf(`jwe: failed to finalize encryption: %w`, err)
+	}
+	if err := w.b64.Close(); err != nil {
+		return fmt.Errorf(`jwe: failed to flush ciphertext: %w`, err)
+	}
+	if err := w.writeTrailer(); err != nil {
+		return fmt.Errorf(`jwe: failed to write trailer: %w`, err)
+	}
+	return nil
+}
+
+// NewDecryptReader reads a JWE message from `src`, and returns an
+// io.ReadCloser that yields the decrypted payload. It accepts the same
+// options as `jwe.Decrypt()`, and both the compact and the JSON
+// serializations are supported.
+//
+// The plaintext is never released before the message is authenticated.
+// To achieve this without holding the message in memory, the decryption
+// is staged: first the ciphertext is read from `src` and stored in a
+// temporary file as it is decoded. Once the entire message has been
+// read, the content encryption key is decrypted, and the authentication
+// tag is verified against the stored ciphertext. Only if this succeeds
+// does NewDecryptReader return, and the returned reader then decrypts
+// the stored ciphertext as it is read. No plaintext is ever written to
+// the temporary file.
+//
+// The caller must call Close() on the returned reader to remove the
+// temporary file. The location of the temporary file can be specified
+// using `jwe.WithStagingDir()`, and the amount of ciphertext that is
+// staged can be limited using `jwe.WithMaxCiphertextSize()`.
+//
+// Only the AES-CBC-HMAC-SHA2 content encryption algorithms can be used
+// for streaming. Use `jwe.Decrypt()` for messages encrypted using AES-GCM.
+func NewDecryptReader(src io.Reader, options ...DecryptOption) (io.ReadCloser, error) {
+	dctx, err := newDecryptCtx(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var dir string
+	var maxSize int64
+	//nolint:forcetypeassert
+	for _, option := range options {
+		switch option.Ident() {
+		case identStagingDir{}:
+			dir = option.Value().(string)
+		case identMaxCiphertextSize{}:
+			maxSize = option.Value().(int64)
+		}
+	}
+
+	staging, err := ioutil.TempFile(dir, "jwe-stream-")
+	if err != nil {
+		return nil, fmt.Errorf(`jwe.NewDecryptReader: failed to create staging file: %w`, err)
+	}
+
+	r := &decryptReader{staging: staging, maxSize: maxSize}
+	if err := r.stage(dctx, src); err != nil {
+		_ = r.Close()
+		return nil, fmt.Errorf(`jwe.NewDecryptReader: %w`, err)
+	}
+	return r, nil
+}
+
+type decryptReader struct {
+	io.Reader
+	staging *os.File
+	maxSize int64
+	zr      io.ReadCloser
+}
+
+// limitWriter fails writes once more than n bytes have been written
+type limitWriter struct {
+	dst io.Writer
+	n   int64
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > w.n {
+		return 0, fmt.Errorf(`ciphertext exceeds the maximum allowed size`)
+	}
+	w.n -= int64(len(p))
+	return w.dst.Write(p)
+}
+
+// stage reads the message from src, and stores its ciphertext in the
+// staging file. When the ciphertext has been authenticated, the reader
+// is setup to decrypt the staged ciphertext
+func (r *decryptReader) stage(dctx *decryptCtx, src io.Reader) error {
+	w := bufio.NewWriter(r.staging)
+	var dst io.Writer = w
+	if r.maxSize > 0 {
+		dst = &limitWriter{dst: w, n: r.maxSize}
+	}
+	msg, err := parseStream(bufio.NewReader(src), dst)
+	if err != nil {
+		return fmt.Errorf(`failed to parse message: %w`, err)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf(`failed to write to staging file: %w`, err)
+	}
+
+	var calg jwa.ContentEncryptionAlgorithm
+	var cek, iv []byte
+	var compression jwa.CompressionAlgorithm
+	err = dctx.decrypt(context.TODO(), msg, func(dec *decrypter, recipient Recipient, h Headers) error {
+		key, err := dec.DecryptKey(recipient.EncryptedKey())
+		if err != nil {
+			return fmt.Errorf(`failed to decrypt key: %w`, err)
+		}
+
+		auth, err := cipher.NewStreamAuthenticator(dec.ctalg, key, dec.iv, dec.additionalData())
+		if err != nil {
+			return fmt.Errorf(`failed to create content authenticator: %w`, err)
+		}
+
+		if _, err := r.staging.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf(`failed to rewind staging file: %w`, err)
+		}
+		if _, err := io.Copy(auth, r.staging); err != nil {
+			return fmt.Errorf(`failed to read staging file: %w`, err)
+		}
+		if err := auth.Verify(dec.tag); err != nil {
+			return fmt.Errorf(`failed to decrypt payload: %w`, err)
+		}
+
+		calg = dec.ctalg
+		cek = key
+		iv = dec.iv
+		compression = h.Compression()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.staging.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(`failed to rewind staging file: %w`, err)
+	}
+
+	plaintext, err := cipher.NewStreamDecrypter(calg, cek, iv, bufio.NewReader(r.staging))
+	if err != nil {
+		return fmt.Errorf(`failed to create content decrypter: %w`, err)
+	}
+
+	if compression == jwa.Deflate {
+		r.zr = flate.NewReader(plaintext)
+		plaintext = r.zr
+	}
+	r.Reader = plaintext
+	return nil
+}
+
+// Close releases the resources associated with the reader, including
+// the staging file.
+func (r *decryptReader) Close() error {
+	if r.zr != nil {
+		_ = r.zr.Close()
+	}
+
+	if r.staging == nil {
+		return nil
+	}
+
+	name := r.staging.Name()
+	err := r.staging.Close()
+	r.staging = nil
+	if rmerr := os.Remove(name); err == nil {
+		err = rmerr
+	}
+	return err
+}
+
+// parseStream parses a JWE message in either the compact or the JSON
+// serialization, writing the decoded ciphertext to dst. The ciphertext
+// in the returned message is empty
+func parseStream(src *bufio.Reader, dst io.Writer) (*Message, error) {
+	c, err := skipSpace(src)
+	if err != nil {
+		return nil, fmt.Errorf(`empty buffer`)
+	}
+	_ = src.UnreadByte()
+
+	if c == '{' {
+		return parseJSONStream(src, dst)
+	}
+	return parseCompactStream(src, dst)
+}
+
+func parseCompactStream(src *bufio.Reader, dst io.Writer) (*Message, error) {
+	// The protected header, the encrypted key, and the initialization
+	// vector are small enough to be kept in memory
+	var buf bytes.Buffer
+	for i := 0; i < 3; i++ {
+		part, err := src.ReadBytes('.')
+		if err != nil {
+			return nil, fmt.Errorf(`compact JWE format must have five parts (%d)`, i+1)
+		}
+		buf.Write(part)
+	}
+
+	ctr := &ciphertextReader{src: src, delim: '.'}
+	if _, err := io.Copy(dst, base64.NewDecoder(base64.RawURLEncoding, ctr)); err != nil {
+		if !ctr.done {
+			return nil, fmt.Errorf(`compact JWE format must have five parts (4)`)
+		}
+		return nil, fmt.Errorf(`failed to base64 decode content: %w`, err)
+	}
+
+	tag, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to read tag: %w`, err)
+	}
+
+	// The ciphertext is left empty, so that the rest of the message
+	// can be parsed by the regular parser
+	buf.WriteByte('.')
+	buf.Write(bytes.TrimSpace(tag))
+	return parseCompact(buf.Bytes())
+}
+
+func parseJSONStream(src *bufio.Reader, dst io.Writer) (*Message, error) {
+	// Everything except for the ciphertext is collected, and then
+	// handed to the regular parser
+	fields := make(map[string]json.RawMessage)
+
+	if c, _ := skipSpace(src); c != '{' {
+		return nil, fmt.Errorf(`failed to parse JSON: expected '{'`)
+	}
+
+	// Field names are matched case-insensitively, just like the regular
+	// parser does. Duplicate fields are rejected, as there would be no
+	// way to tell which one of them the regular parser would use
+	seen := make(map[string]struct{})
+	for i := 0; ; i++ {
+		c, err := skipSpace(src)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+		}
+		if c == '}' {
+			break
+		}
+
+		if i > 0 {
+			if c != ',' {
+				return nil, fmt.Errorf(`failed to parse JSON: expected ','`)
+			}
+			if c, err = skipSpace(src); err != nil {
+				return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+			}
+		}
+
+		if c != '"' {
+			return nil, fmt.Errorf(`failed to parse JSON: expected object key`)
+		}
+		_ = src.UnreadByte()
+		rawKey, err := readJSONValue(src)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+		}
+		var key string
+		if err := json.Unmarshal(rawKey, &key); err != nil {
+			return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+		}
+
+		if c, _ := skipSpace(src); c != ':' {
+			return nil, fmt.Errorf(`failed to parse JSON: expected ':'`)
+		}
+
+		folded := strings.ToLower(strings.ToUpper(key))
+		if _, ok := seen[folded]; ok {
+			return nil, fmt.Errorf(`failed to parse JSON: duplicate %q field`, key)
+		}
+		seen[folded] = struct{}{}
+
+		if folded == CipherTextKey {
+			if c, _ := skipSpace(src); c != '"' {
+				return nil, fmt.Errorf(`failed to parse JSON: %q must be a string`, CipherTextKey)
+			}
+
+			ctr := &ciphertextReader{src: src, delim: '"', json: true}
+			if _, err := io.Copy(dst, base64.NewDecoder(base64.RawURLEncoding, ctr)); err != nil {
+				return nil, fmt.Errorf(`failed to decode "ciphertext": %w`, err)
+			}
+			continue
+		}
+
+		if _, err := skipSpace(src); err != nil {
+			return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+		}
+		_ = src.UnreadByte()
+		value, err := readJSONValue(src)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+		}
+		fields[key] = value
+	}
+
+	buf, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse JSON: %w`, err)
+	}
+	return parseJSON(buf)
+}
+
+func skipSpace(src *bufio.Reader) (byte, error) {
+	for {
+		c, err := src.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch c {
+		case ' ', '\t', '\r', '\n':
+		default:
+			return c, nil
+		}
+	}
+}
+
+// readJSONValue reads a single JSON value from src, and returns its raw
+// representation. The value is not validated.
+func readJSONValue(src *bufio.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	var depth int
+	var inString, escaped bool
+	for {
+		c, err := src.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				if depth == 0 && !inString && buf.Len() > 0 {
+					return buf.Bytes(), nil
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		if inString {
+			buf.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+				if depth == 0 {
+					return buf.Bytes(), nil
+				}
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']', ',':
+			if depth == 0 {
+				_ = src.UnreadByte()
+				return buf.Bytes(), nil
+			}
+			if c != ',' {
+				depth--
+				if depth == 0 {
+					buf.WriteByte(c)
+					return buf.Bytes(), nil
+				}
+			}
+		case ' ', '\t', '\r', '\n':
+			if depth == 0 && buf.Len() > 0 {
+				return buf.Bytes(), nil
+			}
+			continue
+		}
+		buf.WriteByte(c)
+	}
+}
+
+// ciphertextReader reads base64 encoded data from src, up to (but not
+// including) delim. Just like when the message is parsed in full, both the
+// standard and the URL-safe alphabets are accepted, and padding is ignored.
+// The output is normalized so that it can be decoded as base64.RawURLEncoding
+type ciphertextReader struct {
+	src   *bufio.Reader
+	delim byte
+	json  bool
+	done  bool
+}
+
+func (r *ciphertextReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) && !r.done {
+		c, err := r.src.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+
+		switch c {
+		case r.delim:
+			r.done = true
+			continue
+		case '\\':
+			if !r.json {
+				return n, fmt.Errorf(`invalid character %q in base64 data`, c)
+			}
+			// The only escape sequence that may appear in base64 data
+			// is the (optionally) escaped solidus
+			if next, err := r.src.ReadByte(); err != nil || next != '/' {
+				return n, fmt.Errorf(`unsupported escape sequence in base64 data`)
+			}
+			c = '_'
+		case '+':
+			c = '-'
+		case '/':
+			c = '_'
+		case '=':
+			continue
+		}
+		p[n] = c
+		n++
+	}
+
+	if n == 0 && r.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
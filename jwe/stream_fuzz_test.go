@@ -0,0 +1,147 @@
+//go:build go1.18
+// +build go1.18
+
+package jwe
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	jwxbase64 "github.com/lestrrat-go/jwx/v2/internal/base64"
+)
+
+const fuzzCompactMessage = `eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZHQ00ifQ.OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg.48V1_ALb6US04U3b.5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A.XFBoMYUZodetZdvTiFvSkQ`
+
+const fuzzJSONMessage = `{"ciphertext":"5eym8TW_c8SuK0ltJ3rpYIzOeDQz7TALvtu6UG9oMo4vpzs9tX_EFShS8iB7j6jiSdiwkIr3ajwQzaBtQD_A","iv":"48V1_ALb6US04U3b","protected":"eyJhbGciOiJSU0EtT0FFUCIsImVuYyI6IkEyNTZHQ00ifQ","recipients":[{"header":{"kid":"a\"}b"},"encrypted_key":"OKOawDo13gRp2ojaHV7LFpZcgV7T6DVZKTyKOMTYUmKoTCVJRgckCL9kiMT03JGeipsEdY3mx_etLbbWSrFr05kLzcSr4qKAq7YN7e9jwQRb23nfa6c9d-StnImGyFDbSv04uVuxIp5Zms1gNxKKK2Da14B8S4rzVRltdYwam_lDp5XnZAYpQdb76FdIKLaVmqgfwX7XWRxv2322i-vDxRfqNzo_tETKzpVLzfiwQyeyPGLBIO56YJ7eObdv0je81860ppamavo35UgoRdbYaBcoh9QcfylQr66oc6vFWXRcZ_ZT2LawVCWTIy3brGPi6UklfCpIMfIjf7iGdXKHzg"}],"tag":"XFBoMYUZodetZdvTiFvSkQ"}`
+
+// FuzzParseStream checks that the streaming parser never panics, and that
+// whenever both the streaming and the regular parser accept a message, they
+// agree on its contents
+func FuzzParseStream(f *testing.F) {
+	f.Add([]byte(fuzzCompactMessage))
+	f.Add([]byte(fuzzJSONMessage))
+	f.Add([]byte(`{"ciphertext":"YW\/j","iv":"","tag":""}`))
+	f.Add([]byte(` {"protected":"e30", "ciphertext" : "YWJj==" } `))
+	f.Add([]byte(`e30...YWJj.`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var ciphertext bytes.Buffer
+		msg, err := parseStream(bufio.NewReader(bytes.NewReader(data)), &ciphertext)
+		if err != nil {
+			return
+		}
+
+		expected, err := Parse(data)
+		if err != nil {
+			return
+		}
+
+		if !bytes.Equal(expected.CipherText(), ciphertext.Bytes()) {
+			t.Fatalf("ciphertext mismatch: %q != %q", expected.CipherText(), ciphertext.Bytes())
+		}
+		if !bytes.Equal(expected.rawProtectedHeaders, msg.rawProtectedHeaders) {
+			t.Fatalf("protected header mismatch: %q != %q", expected.rawProtectedHeaders, msg.rawProtectedHeaders)
+		}
+		if !bytes.Equal(expected.Tag(), msg.Tag()) {
+			t.Fatalf("tag mismatch: %q != %q", expected.Tag(), msg.Tag())
+		}
+		if len(expected.Recipients()) != len(msg.Recipients()) {
+			t.Fatalf("number of recipients mismatch: %d != %d", len(expected.Recipients()), len(msg.Recipients()))
+		}
+	})
+}
+
+// FuzzReadJSONValue checks that readJSONValue extracts exactly one JSON
+// value, and leaves the delimiter that follows it in the buffer
+func FuzzReadJSONValue(f *testing.F) {
+	f.Add(`"foo"`)
+	f.Add(`"a\"}b\\"`)
+	f.Add(`{"a":[1,2,{"b":"]"}],"c":null}`)
+	f.Add(`[ "x" , { } ]`)
+	f.Add(`-1.5e10`)
+	f.Add(`true`)
+
+	f.Fuzz(func(t *testing.T, value string) {
+		value = strings.TrimSpace(value)
+		if !json.Valid([]byte(value)) {
+			return
+		}
+		var expected interface{}
+		if err := json.Unmarshal([]byte(value), &expected); err != nil {
+			return
+		}
+
+		for _, delim := range []string{",", "}", " ,"} {
+			src := bufio.NewReader(strings.NewReader(value + delim + `"next"`))
+			raw, err := readJSONValue(src)
+			if err != nil {
+				t.Fatalf("readJSONValue failed for %q: %s", value, err)
+			}
+
+			var actual interface{}
+			if err := json.Unmarshal(raw, &actual); err != nil {
+				t.Fatalf("readJSONValue returned invalid JSON %q for %q: %s", raw, value, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("readJSONValue returned %q for %q", raw, value)
+			}
+
+			c, err := skipSpace(src)
+			if err != nil || c != delim[len(delim)-1] {
+				t.Fatalf("delimiter was not left in the buffer for %q", value)
+			}
+		}
+	})
+}
+
+// FuzzCiphertextReader checks that the base64 data extracted by
+// ciphertextReader decodes to the same bytes as the regular parser
+// produces, and that ciphertextReader stops at the delimiter
+func FuzzCiphertextReader(f *testing.F) {
+	f.Add(`YWJj`, false)
+	f.Add(`YWJjZA==`, false)
+	f.Add(`-_+/`, false)
+	f.Add(`YW\/j`, true)
+
+	f.Fuzz(func(t *testing.T, data string, isJSON bool) {
+		delim := byte('.')
+		if isJSON {
+			delim = '"'
+		}
+		if strings.IndexByte(data, delim) >= 0 {
+			return
+		}
+
+		src := bufio.NewReader(strings.NewReader(data + string(delim) + `rest`))
+		ctr := &ciphertextReader{src: src, delim: delim, json: isJSON}
+		decoded, err := ioutil.ReadAll(base64.NewDecoder(base64.RawURLEncoding, ctr))
+		if err != nil {
+			return
+		}
+
+		if rest, _ := ioutil.ReadAll(src); string(rest) != `rest` {
+			t.Fatalf("ciphertextReader consumed data past the delimiter: %q", rest)
+		}
+
+		if isJSON {
+			var s string
+			if err := json.Unmarshal([]byte(`"`+data+`"`), &s); err != nil {
+				return
+			}
+			data = s
+		}
+		expected, err := jwxbase64.DecodeString(data)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(expected, decoded) {
+			t.Fatalf("ciphertextReader decoded %q as %q, expected %q", data, decoded, expected)
+		}
+	})
+}
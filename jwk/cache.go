@@ -2,12 +2,16 @@ package jwk
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/lestrrat-go/httprc"
+	"github.com/lestrrat-go/jwx/v2/internal/json"
 )
 
 type Transformer = httprc.Transformer
@@ -29,8 +33,52 @@ type Whitelist = httprc.Whitelist
 //
 // All JWKS objects that are retrieved via this mechanism should be
 // treated read-only, as they are shared among the consumers and this object.
+//
+// By default the Set objects are only kept in memory. Use `jwk.WithCacheStorage()`
+// to persist them, and `jwk.WithMaxStaleness()` to control how long they
+// may be used while refreshes fail.
 type Cache struct {
 	cache *httprc.Cache
+
+	// the following are only used when tracking is enabled
+	ctx          context.Context
+	errSink      ErrSink
+	storage      CacheStorage
+	maxStaleness time.Duration
+	mu           sync.RWMutex
+	entries      map[string]*cacheEntry
+
+	// issuers registered via RegisterIssuer, protected by mu
+	issuers map[string]*issuerEntry
+
+	// state of RefreshWithMinInterval for each URL, protected by mu
+	limits map[string]*refreshLimit
+}
+
+// refreshLimit keeps track of the refreshes performed by
+// RefreshWithMinInterval for a URL
+type refreshLimit struct {
+	lastRefresh time.Time
+	inflight    *refreshCall
+}
+
+// refreshCall represents a refresh that is in progress. Goroutines
+// that need its result wait for done to be closed
+type refreshCall struct {
+	done chan struct{}
+	set  Set
+	err  error
+}
+
+// cacheEntry holds the last Set that was successfully fetched
+// (or loaded from storage) for a URL
+type cacheEntry struct {
+	mu        sync.RWMutex
+	set       Set
+	fetchedAt time.Time
+	// loaded is true if set was loaded from storage, and a fetch
+	// has not been attempted since
+	loaded bool
 }
 
 // PostFetcher is an interface for objects that want to perform
@@ -55,6 +103,7 @@ func (f PostFetchFunc) PostFetch(u string, set Set) (Set, error) {
 type jwksTransform struct {
 	postFetch    PostFetcher
 	parseOptions []ParseOption
+	cache        *Cache
 }
 
 // Default transform has no postFetch. This can be shared
@@ -80,6 +129,10 @@ func (t *jwksTransform) Transform(u string, res *http.Response) (interface{}, er
 		set = v
 	}
 
+	if c := t.cache; c != nil {
+		c.fetched(u, set)
+	}
+
 	return set, nil
 }
 
@@ -89,19 +142,109 @@ func (t *jwksTransform) Transform(u string, res *http.Response) (interface{}, er
 // details.
 func NewCache(ctx context.Context, options ...CacheOption) *Cache {
 	var hrcopts []httprc.CacheOption
+	var errSink ErrSink
+	var storage CacheStorage
+	var maxStaleness time.Duration
 	for _, option := range options {
 		//nolint:forcetypeassert
 		switch option.Ident() {
 		case identRefreshWindow{}:
 			hrcopts = append(hrcopts, httprc.WithRefreshWindow(option.Value().(time.Duration)))
 		case identErrSink{}:
-			hrcopts = append(hrcopts, httprc.WithErrSink(option.Value().(ErrSink)))
+			errSink = option.Value().(ErrSink)
+			hrcopts = append(hrcopts, httprc.WithErrSink(errSink))
+		case identCacheStorage{}:
+			storage = option.Value().(CacheStorage)
+		case identMaxStaleness{}:
+			maxStaleness = option.Value().(time.Duration)
 		}
 	}
 
 	return &Cache{
-		cache: httprc.NewCache(ctx, hrcopts...),
+		cache:        httprc.NewCache(ctx, hrcopts...),
+		ctx:          ctx,
+		errSink:      errSink,
+		storage:      storage,
+		maxStaleness: maxStaleness,
+		entries:      make(map[string]*cacheEntry),
+		issuers:      make(map[string]*issuerEntry),
+		limits:       make(map[string]*refreshLimit),
+	}
+}
+
+// tracking returns true if the cache needs to keep track of
+// the Set objects by itself, in addition to httprc.Cache
+func (c *Cache) tracking() bool {
+	return c.storage != nil || c.maxStaleness > 0
+}
+
+func (c *Cache) reportError(err error) {
+	if c.errSink != nil {
+		c.errSink.Error(err)
+	}
+}
+
+func (c *Cache) entry(u string) (*cacheEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.entries[u]
+	return e, ok
+}
+
+// fetched is called when a Set has been successfully fetched from `u`
+func (c *Cache) fetched(u string, set Set) {
+	e, ok := c.entry(u)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	e.mu.Lock()
+	e.set = set
+	e.fetchedAt = now
+	e.mu.Unlock()
+
+	if c.storage == nil {
+		return
+	}
+
+	buf, err := json.Marshal(set)
+	if err != nil {
+		c.reportError(fmt.Errorf(`failed to marshal JWKS from %q for storage: %w`, u, err))
+		return
+	}
+	if err := c.storage.Store(c.ctx, u, buf, now); err != nil {
+		c.reportError(fmt.Errorf(`failed to store JWKS from %q: %w`, u, err))
+	}
+}
+
+// load populates the entry for `u` using the data in the storage
+func (c *Cache) load(u string, e *cacheEntry, parseOptions []ParseOption) {
+	buf, fetchedAt, err := c.storage.Load(c.ctx, u)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			c.reportError(fmt.Errorf(`failed to load JWKS for %q from storage: %w`, u, err))
+		}
+		return
+	}
+
+	// data that is already too old is of no use. Let the
+	// first Get() fetch the JWKS instead
+	if c.maxStaleness > 0 && time.Since(fetchedAt) > c.maxStaleness {
+		return
 	}
+
+	set, err := Parse(buf, parseOptions...)
+	if err != nil {
+		c.reportError(fmt.Errorf(`failed to parse JWKS for %q from storage: %w`, u, err))
+		return
+	}
+
+	e.mu.Lock()
+	e.set = set
+	e.fetchedAt = fetchedAt
+	e.loaded = true
+	e.mu.Unlock()
 }
 
 // Register registers a URL to be managed by the cache. URLs must
@@ -143,7 +286,7 @@ func (c *Cache) Register(u string, options ...RegisterOption) error {
 	}
 
 	var t *jwksTransform
-	if pf == nil && len(parseOptions) == 0 {
+	if pf == nil && len(parseOptions) == 0 && !c.tracking() {
 		t = defaultTransform
 	} else {
 		// User-supplied PostFetcher is attached to the transformer
@@ -151,18 +294,58 @@ func (c *Cache) Register(u string, options ...RegisterOption) error {
 			postFetch:    pf,
 			parseOptions: parseOptions,
 		}
+		if c.tracking() {
+			t.cache = c
+		}
 	}
 
 	// Set the transfomer at the end so that nobody can override it
 	hrropts = append(hrropts, httprc.WithTransformer(t))
-	return c.cache.Register(u, hrropts...)
+	if err := c.cache.Register(u, hrropts...); err != nil {
+		return err
+	}
+
+	if c.tracking() {
+		e := &cacheEntry{}
+		if c.storage != nil {
+			c.load(u, e, parseOptions)
+		}
+		c.mu.Lock()
+		c.entries[u] = e
+		c.mu.Unlock()
+	}
+	return nil
 }
 
 // Get returns the stored JWK set (`Set`) from the cache.
 //
+// If `jwk.WithCacheStorage()` was specified and a Set for `u` was loaded
+// from the storage, it is returned without waiting for the Set to be fetched.
+// Instead, a refresh is started in the background.
+//
+// If `jwk.WithMaxStaleness()` was specified and the Set has not been
+// successfully fetched for longer than that duration, an error is returned.
+//
 // Please refer to the documentation for `(httprc.Cache).Get` for more
 // details.
 func (c *Cache) Get(ctx context.Context, u string) (Set, error) {
+	if e, ok := c.entry(u); ok {
+		e.mu.Lock()
+		set, fetchedAt := e.set, e.fetchedAt
+		if e.loaded {
+			e.loaded = false
+			go c.refreshLoaded(u)
+		}
+		e.mu.Unlock()
+
+		if set != nil {
+			if c.maxStaleness > 0 && time.Since(fetchedAt) > c.maxStaleness {
+				return nil, fmt.Errorf(`JWKS for %q is stale: last fetched at %s`, u, fetchedAt.Format(time.RFC3339))
+			}
+			return set, nil
+		}
+	}
+
 	v, err := c.cache.Get(ctx, u)
 	if err != nil {
 		return nil, err
@@ -193,6 +376,67 @@ func (c *Cache) Refresh(ctx context.Context, u string) (Set, error) {
 	return set, nil
 }
 
+// RefreshWithMinInterval is identical to Refresh(), except the resource
+// is fetched at most once every `minInterval` per URL. Within the interval,
+// the currently cached Set is returned as if Get() was called. This is
+// useful when refreshes are triggered by untrusted input, such as tokens
+// signed with unknown keys.
+//
+// Concurrent calls for the same URL wait for a single fetch. The fetch is
+// performed using the context that was passed to `jwk.NewCache()`, so `ctx`
+// only controls how long the caller waits for the result.
+func (c *Cache) RefreshWithMinInterval(ctx context.Context, u string, minInterval time.Duration) (Set, error) {
+	if !c.IsRegistered(u) {
+		return nil, fmt.Errorf(`url %q is not registered`, u)
+	}
+
+	c.mu.Lock()
+	limit, ok := c.limits[u]
+	if !ok {
+		limit = &refreshLimit{}
+		c.limits[u] = limit
+	}
+
+	call := limit.inflight
+	if call == nil {
+		if !limit.lastRefresh.IsZero() && time.Since(limit.lastRefresh) < minInterval {
+			c.mu.Unlock()
+			return c.Get(ctx, u)
+		}
+
+		call = &refreshCall{done: make(chan struct{})}
+		limit.inflight = call
+		limit.lastRefresh = time.Now()
+		go c.limitedRefresh(u, limit, call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-call.done:
+		return call.set, call.err
+	}
+}
+
+// limitedRefresh performs the refresh started by RefreshWithMinInterval
+func (c *Cache) limitedRefresh(u string, limit *refreshLimit, call *refreshCall) {
+	call.set, call.err = c.Refresh(c.ctx, u)
+
+	c.mu.Lock()
+	limit.inflight = nil
+	c.mu.Unlock()
+	close(call.done)
+}
+
+// refreshLoaded fetches a Set that was loaded from the storage. Regardless
+// of the result, this schedules the periodic refresh for `u`
+func (c *Cache) refreshLoaded(u string) {
+	if _, err := c.cache.Refresh(c.ctx, u); err != nil {
+		c.reportError(fmt.Errorf(`failed to refresh JWKS for %q: %w`, u, err))
+	}
+}
+
 // IsRegistered returns true if the given URL `u` has already been registered
 // in the cache.
 //
@@ -207,6 +451,10 @@ func (c *Cache) IsRegistered(u string) bool {
 // Please refer to the documentation for `(httprc.Cache).Unregister` for more
 // details.
 func (c *Cache) Unregister(u string) error {
+	c.mu.Lock()
+	delete(c.entries, u)
+	delete(c.limits, u)
+	c.mu.Unlock()
 	return c.cache.Unregister(u)
 }
 
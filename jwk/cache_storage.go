@@ -0,0 +1,108 @@
+package jwk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/internal/json"
+)
+
+// CacheStorage is used by `jwk.Cache` to persist the JWKS that were
+// fetched, so that they can be used after the application restarts,
+// even if the URLs are not reachable at that time.
+//
+// Implementations must be safe for concurrent use.
+type CacheStorage interface {
+	// Load returns the JWKS that was stored for `u` along with the time it
+	// was fetched. If nothing has been stored for `u`, Load must return
+	// an error for which `errors.Is(err, os.ErrNotExist)` is true.
+	Load(ctx context.Context, u string) ([]byte, time.Time, error)
+
+	// Store saves the JWKS `data` fetched from `u` at `fetchedAt`,
+	// replacing any previously stored data for `u`.
+	Store(ctx context.Context, u string, data []byte, fetchedAt time.Time) error
+}
+
+type fileCacheStorage struct {
+	dir string
+}
+
+type fileCacheEntry struct {
+	URL       string          `json:"url"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Data      json.RawMessage `json:"jwks"`
+}
+
+// NewFileCacheStorage creates a `jwk.CacheStorage` that stores each JWKS
+// in a separate file under `dir`. The directory is created if it does not
+// exist. Files are replaced atomically, so that a crash while writing
+// does not corrupt previously stored data.
+//
+// Note that if the JWKS contain private or symmetric keys, they are
+// written to disk as is.
+func NewFileCacheStorage(dir string) CacheStorage {
+	return &fileCacheStorage{dir: dir}
+}
+
+func (s *fileCacheStorage) filename(u string) string {
+	h := sha256.Sum256([]byte(u))
+	return filepath.Join(s.dir, hex.EncodeToString(h[:])+`.json`)
+}
+
+func (s *fileCacheStorage) Load(_ context.Context, u string) ([]byte, time.Time, error) {
+	buf, err := ioutil.ReadFile(s.filename(u))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf(`failed to read cache file for %q: %w`, u, err)
+	}
+
+	var entry fileCacheEntry
+	if err := json.Unmarshal(buf, &entry); err != nil {
+		return nil, time.Time{}, fmt.Errorf(`failed to parse cache file for %q: %w`, u, err)
+	}
+
+	// guard against hash collisions, however unlikely
+	if entry.URL != u {
+		return nil, time.Time{}, fmt.Errorf(`cache file for %q contains data for %q: %w`, u, entry.URL, os.ErrNotExist)
+	}
+	return entry.Data, entry.FetchedAt, nil
+}
+
+func (s *fileCacheStorage) Store(_ context.Context, u string, data []byte, fetchedAt time.Time) error {
+	buf, err := json.Marshal(fileCacheEntry{
+		URL:       u,
+		FetchedAt: fetchedAt,
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf(`failed to marshal cache entry for %q: %w`, u, err)
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf(`failed to create cache directory: %w`, err)
+	}
+
+	f, err := ioutil.TempFile(s.dir, `.jwks-`)
+	if err != nil {
+		return fmt.Errorf(`failed to create temporary file: %w`, err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(buf); err != nil {
+		f.Close()
+		return fmt.Errorf(`failed to write cache file for %q: %w`, u, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf(`failed to write cache file for %q: %w`, u, err)
+	}
+
+	if err := os.Rename(f.Name(), s.filename(u)); err != nil {
+		return fmt.Errorf(`failed to replace cache file for %q: %w`, u, err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/lestrrat-go/jwx/v2/internal/ecutil"
 	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,3 +16,13 @@ func TestES256K(t *testing.T) {
 		return
 	}
 }
+
+func TestGenerateSecp256k1(t *testing.T) {
+	key, err := jwk.Generate(jwa.EC, jwk.WithCurve(jwa.Secp256k1))
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	if !assert.Equal(t, jwa.Secp256k1, key.(jwk.ECDSAPrivateKey).Crv(), `curve should match`) {
+		return
+	}
+}
@@ -0,0 +1,165 @@
+package jwk
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+
+	"github.com/lestrrat-go/jwx/v2/ed448"
+	"github.com/lestrrat-go/jwx/v2/internal/ecutil"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
+)
+
+// Generate generates a new private key of type `kty`.
+//
+//   - RSA keys are 2048 bits by default. Use `jwk.WithRSAKeySize()` to change it.
+//   - EC keys use P-256 by default. Use `jwk.WithCurve()` to specify any of the
+//     curves in `jwk.AvailableCurves()`, including secp256k1 when compiled with
+//     the `jwx_es256k` build tag.
+//   - OKP keys use Ed25519 by default. Use `jwk.WithCurve()` to specify
+//     Ed25519, X25519, Ed448 or X448.
+//   - Symmetric ("oct") keys are 32 bytes by default. Use `jwk.WithSymmetricKeyLength()`
+//     to change it.
+//
+// Options that do not apply to the key type are ignored. The "alg", "use" and
+// "key_ops" fields can be populated using `jwk.WithAlgorithm()`, `jwk.WithKeyUsage()`
+// and `jwk.WithKeyOps()`, and `jwk.WithThumbprintKeyID()` sets the "kid" field
+// to the thumbprint of the generated key.
+//
+// Use `jwk.PublicKeyOf()` to obtain the public key for asymmetric keys.
+func Generate(kty jwa.KeyType, options ...GenerateOption) (Key, error) {
+	var crv jwa.EllipticCurveAlgorithm
+	var alg jwa.KeyAlgorithm
+	var usage KeyUsageType
+	var ops KeyOperationList
+	var thumbprint bool
+	rsaKeySize := 2048
+	symmetricKeyLength := 32
+	var rr io.Reader = rand.Reader
+	//nolint:forcetypeassert
+	for _, option := range options {
+		switch option.Ident() {
+		case identCurve{}:
+			crv = option.Value().(jwa.EllipticCurveAlgorithm)
+		case identRSAKeySize{}:
+			rsaKeySize = option.Value().(int)
+		case identSymmetricKeyLength{}:
+			symmetricKeyLength = option.Value().(int)
+		case identAlgorithm{}:
+			alg = option.Value().(jwa.KeyAlgorithm)
+		case identKeyUsage{}:
+			usage = option.Value().(KeyUsageType)
+		case identKeyOps{}:
+			ops = option.Value().(KeyOperationList)
+		case identThumbprintKeyID{}:
+			thumbprint = option.Value().(bool)
+		case identRandReader{}:
+			rr = option.Value().(io.Reader)
+		}
+	}
+
+	var raw interface{}
+	switch kty {
+	case jwa.RSA:
+		v, err := rsa.GenerateKey(rr, rsaKeySize)
+		if err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: failed to generate RSA key: %w`, err)
+		}
+		raw = v
+	case jwa.EC:
+		if crv == "" {
+			crv = jwa.P256
+		}
+		v, err := generateECDSAKey(crv, rr)
+		if err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: %w`, err)
+		}
+		raw = v
+	case jwa.OKP:
+		if crv == "" {
+			crv = jwa.Ed25519
+		}
+		v, err := generateOKPKey(crv, rr)
+		if err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: %w`, err)
+		}
+		raw = v
+	case jwa.OctetSeq:
+		if symmetricKeyLength <= 0 {
+			return nil, fmt.Errorf(`jwk.Generate: invalid symmetric key length %d`, symmetricKeyLength)
+		}
+		v := make([]byte, symmetricKeyLength)
+		if _, err := io.ReadFull(rr, v); err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: failed to generate symmetric key: %w`, err)
+		}
+		raw = v
+	default:
+		return nil, fmt.Errorf(`jwk.Generate: unsupported key type %q`, kty)
+	}
+
+	key, err := FromRaw(raw)
+	if err != nil {
+		return nil, fmt.Errorf(`jwk.Generate: failed to create key: %w`, err)
+	}
+
+	if alg != nil && alg.String() != "" {
+		if err := key.Set(AlgorithmKey, alg); err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: failed to set %q: %w`, AlgorithmKey, err)
+		}
+	}
+	if usage != "" {
+		if err := key.Set(KeyUsageKey, usage); err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: failed to set %q: %w`, KeyUsageKey, err)
+		}
+	}
+	if len(ops) > 0 {
+		if err := key.Set(KeyOpsKey, ops); err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: failed to set %q: %w`, KeyOpsKey, err)
+		}
+	}
+	if thumbprint {
+		if err := AssignKeyID(key); err != nil {
+			return nil, fmt.Errorf(`jwk.Generate: failed to assign key ID: %w`, err)
+		}
+	}
+	return key, nil
+}
+
+func generateECDSAKey(alg jwa.EllipticCurveAlgorithm, rr io.Reader) (*ecdsa.PrivateKey, error) {
+	crv, ok := ecutil.CurveForAlgorithm(alg)
+	if !ok {
+		return nil, fmt.Errorf(`unsupported curve %q for EC key`, alg)
+	}
+
+	key, err := ecdsa.GenerateKey(crv, rr)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to generate EC key: %w`, err)
+	}
+	return key, nil
+}
+
+func generateOKPKey(alg jwa.EllipticCurveAlgorithm, rr io.Reader) (interface{}, error) {
+	var key interface{}
+	var err error
+	switch alg {
+	case jwa.Ed25519:
+		_, key, err = ed25519.GenerateKey(rr)
+	case jwa.X25519:
+		_, key, err = x25519.GenerateKey(rr)
+	case jwa.Ed448:
+		_, key, err = ed448.GenerateKey(rr)
+	case jwa.X448:
+		_, key, err = x448.GenerateKey(rr)
+	default:
+		return nil, fmt.Errorf(`unsupported curve %q for OKP key`, alg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(`failed to generate %s key: %w`, alg, err)
+	}
+	return key, nil
+}
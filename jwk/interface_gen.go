@@ -88,6 +88,15 @@ type Key interface {
 	// If the key is already a public key, it returns a new copy minus the disallowed fields as above.
 	PublicKey() (Key, error)
 
+	// Validate checks the structural and mathematical consistency of the key,
+	// such as whether the EC point is on the curve, or the CRT values of an RSA
+	// private key match its modulus. It also checks that the key is not smaller
+	// than the minimum size configured via `jwk.Settings()`, and that the "use",
+	// "key_ops" and "alg" fields do not contradict each other.
+	//
+	// The returned error is a `jwk.ValidationError`.
+	Validate() error
+
 	// KeyType returns the `kid` of a JWK
 	KeyType() jwa.KeyType
 	// KeyUsage returns `use` of a JWK
@@ -0,0 +1,351 @@
+package jwk
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/httprc"
+	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+const (
+	openIDConfigurationPath         = `/.well-known/openid-configuration`
+	authorizationServerMetadataPath = `/.well-known/oauth-authorization-server`
+)
+
+// IssuerMetadata represents the metadata published by an OpenID Provider
+// (OpenID Connect Discovery 1.0) or an OAuth 2.0 Authorization Server (RFC8414).
+//
+// Only the commonly used fields are available as struct fields. Use `Get()`
+// to access other fields.
+type IssuerMetadata struct {
+	Issuer                                     string                           `json:"issuer"`
+	AuthorizationEndpoint                      string                           `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                              string                           `json:"token_endpoint,omitempty"`
+	UserinfoEndpoint                           string                           `json:"userinfo_endpoint,omitempty"`
+	JWKSURI                                    string                           `json:"jwks_uri"`
+	RegistrationEndpoint                       string                           `json:"registration_endpoint,omitempty"`
+	RevocationEndpoint                         string                           `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint                      string                           `json:"introspection_endpoint,omitempty"`
+	EndSessionEndpoint                         string                           `json:"end_session_endpoint,omitempty"`
+	ServiceDocumentation                       string                           `json:"service_documentation,omitempty"`
+	ScopesSupported                            []string                         `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported                     []string                         `json:"response_types_supported,omitempty"`
+	ResponseModesSupported                     []string                         `json:"response_modes_supported,omitempty"`
+	GrantTypesSupported                        []string                         `json:"grant_types_supported,omitempty"`
+	SubjectTypesSupported                      []string                         `json:"subject_types_supported,omitempty"`
+	ClaimsSupported                            []string                         `json:"claims_supported,omitempty"`
+	CodeChallengeMethodsSupported              []string                         `json:"code_challenge_methods_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported          []string                         `json:"token_endpoint_auth_methods_supported,omitempty"`
+	TokenEndpointAuthSigningAlgValuesSupported []jwa.SignatureAlgorithm         `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IDTokenSigningAlgValuesSupported           []jwa.SignatureAlgorithm         `json:"id_token_signing_alg_values_supported,omitempty"`
+	IDTokenEncryptionAlgValuesSupported        []jwa.KeyEncryptionAlgorithm     `json:"id_token_encryption_alg_values_supported,omitempty"`
+	IDTokenEncryptionEncValuesSupported        []jwa.ContentEncryptionAlgorithm `json:"id_token_encryption_enc_values_supported,omitempty"`
+	UserinfoSigningAlgValuesSupported          []jwa.SignatureAlgorithm         `json:"userinfo_signing_alg_values_supported,omitempty"`
+	RequestObjectSigningAlgValuesSupported     []jwa.SignatureAlgorithm         `json:"request_object_signing_alg_values_supported,omitempty"`
+	DPoPSigningAlgValuesSupported              []jwa.SignatureAlgorithm         `json:"dpop_signing_alg_values_supported,omitempty"`
+
+	raw map[string]interface{}
+}
+
+// Get returns the value of the field `name` as it appeared in the
+// metadata document, including fields that are not available as
+// struct fields.
+func (md *IssuerMetadata) Get(name string) (interface{}, bool) {
+	v, ok := md.raw[name]
+	return v, ok
+}
+
+func (md *IssuerMetadata) UnmarshalJSON(data []byte) error {
+	type fields IssuerMetadata
+	var proxy fields
+	if err := json.Unmarshal(data, &proxy); err != nil {
+		return fmt.Errorf(`failed to unmarshal issuer metadata: %w`, err)
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf(`failed to unmarshal issuer metadata: %w`, err)
+	}
+
+	*md = IssuerMetadata(proxy)
+	md.raw = raw
+	return nil
+}
+
+// issuerMetadataURL returns the URL of the metadata document for `issuer`
+func issuerMetadataURL(issuer string, rfc8414 bool) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return "", fmt.Errorf(`failed to parse issuer %q: %w`, issuer, err)
+	}
+
+	if (u.Scheme != `https` && u.Scheme != `http`) || u.Host == "" {
+		return "", fmt.Errorf(`issuer %q must be an absolute http(s) URL`, issuer)
+	}
+
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf(`issuer %q must not contain query or fragment components`, issuer)
+	}
+
+	path := strings.TrimSuffix(u.EscapedPath(), `/`)
+	u.Path = ""
+	u.RawPath = ""
+	if rfc8414 {
+		// RFC8414 section 3: the well-known path is inserted between
+		// the host and the path components of the issuer
+		return u.String() + authorizationServerMetadataPath + path, nil
+	}
+	// OpenID Connect Discovery 1.0 section 4: the well-known path is
+	// appended to the issuer
+	return u.String() + path + openIDConfigurationPath, nil
+}
+
+// httprc.Transformer that transforms the response into an *IssuerMetadata
+type issuerMetadataTransform struct {
+	issuer string
+}
+
+func (t *issuerMetadataTransform) Transform(u string, res *http.Response) (interface{}, error) {
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(`failed to fetch issuer metadata at %q: unexpected status code %d`, u, res.StatusCode)
+	}
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to read response body: %w`, err)
+	}
+
+	var md IssuerMetadata
+	if err := json.Unmarshal(buf, &md); err != nil {
+		return nil, fmt.Errorf(`failed to parse issuer metadata at %q: %w`, u, err)
+	}
+
+	if md.Issuer != t.issuer {
+		return nil, fmt.Errorf(`issuer in metadata at %q (%q) does not match %q`, u, md.Issuer, t.issuer)
+	}
+
+	if md.JWKSURI == "" {
+		return nil, fmt.Errorf(`issuer metadata at %q does not contain "jwks_uri"`, u)
+	}
+
+	jwksURI, err := url.Parse(md.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse "jwks_uri" in issuer metadata at %q: %w`, u, err)
+	}
+	if !jwksURI.IsAbs() || jwksURI.Host == "" {
+		return nil, fmt.Errorf(`"jwks_uri" in issuer metadata at %q must be an absolute URL`, u)
+	}
+	if strings.HasPrefix(t.issuer, `https:`) && jwksURI.Scheme != `https` {
+		return nil, fmt.Errorf(`"jwks_uri" in issuer metadata at %q must use https`, u)
+	}
+
+	return &md, nil
+}
+
+// issuerEntry keeps track of an issuer registered via RegisterIssuer
+type issuerEntry struct {
+	metadataURL string
+	options     []RegisterOption
+
+	mu      sync.Mutex
+	jwksURI string
+	// owned is true if jwksURI was registered by us, and thus should
+	// be unregistered when it is no longer used
+	owned bool
+}
+
+func (c *Cache) issuer(issuer string) (*issuerEntry, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	e, ok := c.issuers[issuer]
+	return e, ok
+}
+
+// RegisterIssuer registers an issuer to be managed by the cache. Instead
+// of registering the URL of the JWKS directly, the URL is discovered
+// from the metadata published by the issuer. The issuer must be
+// registered before issuing `GetIssuer` or `GetIssuerMetadata`.
+//
+// By default the OpenID Provider Metadata is retrieved from
+// `/.well-known/openid-configuration` under the issuer. Use
+// `jwk.WithAuthorizationServerMetadata(true)` to retrieve the
+// OAuth 2.0 Authorization Server Metadata (RFC8414) instead.
+//
+// The metadata is only accepted if its "issuer" exactly matches `issuer`,
+// and if it contains a "jwks_uri". Both the metadata and the JWKS are
+// refreshed automatically, and if the "jwks_uri" changes, the new JWKS
+// is used from then on.
+//
+// The options are used for both the metadata and the JWKS, except for
+// those that only apply to JWKS, such as `jwk.WithPostFetcher`.
+func (c *Cache) RegisterIssuer(issuer string, options ...RegisterIssuerOption) error {
+	var rfc8414 bool
+	var hrropts []httprc.RegisterOption
+	var jwksOptions []RegisterOption
+	for _, option := range options {
+		//nolint:forcetypeassert
+		switch option.Ident() {
+		case identAuthorizationServerMetadata{}:
+			rfc8414 = option.Value().(bool)
+			continue
+		case identHTTPClient{}:
+			hrropts = append(hrropts, httprc.WithHTTPClient(option.Value().(HTTPClient)))
+		case identRefreshInterval{}:
+			hrropts = append(hrropts, httprc.WithRefreshInterval(option.Value().(time.Duration)))
+		case identMinRefreshInterval{}:
+			hrropts = append(hrropts, httprc.WithMinRefreshInterval(option.Value().(time.Duration)))
+		case identFetchWhitelist{}:
+			hrropts = append(hrropts, httprc.WithWhitelist(option.Value().(httprc.Whitelist)))
+		}
+
+		if ro, ok := option.(RegisterOption); ok {
+			jwksOptions = append(jwksOptions, ro)
+		}
+	}
+
+	metadataURL, err := issuerMetadataURL(issuer, rfc8414)
+	if err != nil {
+		return err
+	}
+
+	hrropts = append(hrropts, httprc.WithTransformer(&issuerMetadataTransform{issuer: issuer}))
+	if err := c.cache.Register(metadataURL, hrropts...); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	prev := c.issuers[issuer]
+	c.issuers[issuer] = &issuerEntry{
+		metadataURL: metadataURL,
+		options:     jwksOptions,
+	}
+	c.mu.Unlock()
+
+	if prev != nil {
+		c.releaseIssuer(prev, metadataURL)
+	}
+	return nil
+}
+
+// releaseIssuer unregisters the URLs that were registered for `e`,
+// except for `keepURL`
+func (c *Cache) releaseIssuer(e *issuerEntry, keepURL string) {
+	if e.metadataURL != keepURL {
+		_ = c.cache.Unregister(e.metadataURL)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.owned {
+		_ = c.Unregister(e.jwksURI)
+		e.owned = false
+	}
+	e.jwksURI = ""
+}
+
+// IsIssuerRegistered returns true if the given issuer has already been
+// registered in the cache via `RegisterIssuer()`
+func (c *Cache) IsIssuerRegistered(issuer string) bool {
+	_, ok := c.issuer(issuer)
+	return ok
+}
+
+// UnregisterIssuer removes the given issuer from the cache, along with
+// the JWKS that was registered for it.
+func (c *Cache) UnregisterIssuer(issuer string) error {
+	c.mu.Lock()
+	e, ok := c.issuers[issuer]
+	delete(c.issuers, issuer)
+	c.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf(`issuer %q is not registered`, issuer)
+	}
+	c.releaseIssuer(e, "")
+	return nil
+}
+
+// GetIssuerMetadata returns the metadata of the issuer from the cache.
+// The issuer must have been registered via `RegisterIssuer()`
+//
+// The returned object is shared, and should be treated read-only.
+func (c *Cache) GetIssuerMetadata(ctx context.Context, issuer string) (*IssuerMetadata, error) {
+	e, ok := c.issuer(issuer)
+	if !ok {
+		return nil, fmt.Errorf(`issuer %q is not registered`, issuer)
+	}
+	return c.issuerMetadata(ctx, e)
+}
+
+func (c *Cache) issuerMetadata(ctx context.Context, e *issuerEntry) (*IssuerMetadata, error) {
+	v, err := c.cache.Get(ctx, e.metadataURL)
+	if err != nil {
+		return nil, err
+	}
+
+	md, ok := v.(*IssuerMetadata)
+	if !ok {
+		return nil, fmt.Errorf(`cached object is not an *IssuerMetadata (was %T)`, v)
+	}
+	return md, nil
+}
+
+// GetIssuer returns the JWK set (`Set`) of the issuer from the cache.
+// The issuer must have been registered via `RegisterIssuer()`
+//
+// The JWKS is retrieved from the "jwks_uri" found in the metadata of the
+// issuer. The URL is registered in the cache upon the first call, and is
+// refreshed like any other URL registered via `Register()`
+func (c *Cache) GetIssuer(ctx context.Context, issuer string) (Set, error) {
+	e, ok := c.issuer(issuer)
+	if !ok {
+		return nil, fmt.Errorf(`issuer %q is not registered`, issuer)
+	}
+
+	md, err := c.issuerMetadata(ctx, e)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to retrieve metadata for issuer %q: %w`, issuer, err)
+	}
+
+	if err := c.registerIssuerJWKS(e, md.JWKSURI); err != nil {
+		return nil, fmt.Errorf(`failed to register JWKS for issuer %q: %w`, issuer, err)
+	}
+	return c.Get(ctx, md.JWKSURI)
+}
+
+// registerIssuerJWKS makes sure that `jwksURI` is registered, and
+// unregisters the previous JWKS of the issuer if it has changed
+func (c *Cache) registerIssuerJWKS(e *issuerEntry, jwksURI string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// the URL may have been unregistered by somebody else, in
+	// which case it needs to be registered again
+	if e.jwksURI == jwksURI && c.IsRegistered(jwksURI) {
+		return nil
+	}
+
+	// URLs that were registered by somebody else are used as is
+	var owned bool
+	if !c.IsRegistered(jwksURI) {
+		if err := c.Register(jwksURI, e.options...); err != nil {
+			return err
+		}
+		owned = true
+	}
+
+	if e.owned && e.jwksURI != jwksURI {
+		_ = c.Unregister(e.jwksURI)
+	}
+	e.jwksURI = jwksURI
+	e.owned = owned
+	return nil
+}
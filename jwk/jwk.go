@@ -17,11 +17,13 @@ import (
 	"io/ioutil"
 	"math/big"
 
+	"github.com/lestrrat-go/jwx/v2/ed448"
 	"github.com/lestrrat-go/jwx/v2/internal/base64"
 	"github.com/lestrrat-go/jwx/v2/internal/ecutil"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 )
 
 var registry = json.NewRegistry()
@@ -41,6 +43,7 @@ func bigIntToBytes(n *big.Int) ([]byte, error) {
 //   * "crypto/rsa".PrivateKey and "crypto/rsa".PublicKey creates an RSA based key
 //   * "crypto/ecdsa".PrivateKey and "crypto/ecdsa".PublicKey creates an EC based key
 //   * "crypto/ed25519".PrivateKey and "crypto/ed25519".PublicKey creates an OKP based key
+//   * x25519, ed448, and x448 PrivateKey and PublicKey from this module creates an OKP based key
 //   * []byte creates a symmetric key
 func FromRaw(key interface{}) (Key, error) {
 	if key == nil {
@@ -110,6 +113,30 @@ func FromRaw(key interface{}) (Key, error) {
 			return nil, fmt.Errorf(`failed to initialize %T from %T: %w`, k, rawKey, err)
 		}
 		return k, nil
+	case ed448.PrivateKey:
+		k := newOKPPrivateKey()
+		if err := k.FromRaw(rawKey); err != nil {
+			return nil, fmt.Errorf(`failed to initialize %T from %T: %w`, k, rawKey, err)
+		}
+		return k, nil
+	case ed448.PublicKey:
+		k := newOKPPublicKey()
+		if err := k.FromRaw(rawKey); err != nil {
+			return nil, fmt.Errorf(`failed to initialize %T from %T: %w`, k, rawKey, err)
+		}
+		return k, nil
+	case x448.PrivateKey:
+		k := newOKPPrivateKey()
+		if err := k.FromRaw(rawKey); err != nil {
+			return nil, fmt.Errorf(`failed to initialize %T from %T: %w`, k, rawKey, err)
+		}
+		return k, nil
+	case x448.PublicKey:
+		k := newOKPPublicKey()
+		if err := k.FromRaw(rawKey); err != nil {
+			return nil, fmt.Errorf(`failed to initialize %T from %T: %w`, k, rawKey, err)
+		}
+		return k, nil
 	case []byte:
 		k := newSymmetricKey()
 		if err := k.FromRaw(rawKey); err != nil {
@@ -225,6 +252,14 @@ func PublicRawKeyOf(v interface{}) (interface{}, error) {
 		return x.Public(), nil
 	case x25519.PublicKey:
 		return x, nil
+	case ed448.PrivateKey:
+		return x.Public(), nil
+	case ed448.PublicKey:
+		return x, nil
+	case x448.PrivateKey:
+		return x.Public(), nil
+	case x448.PublicKey:
+		return x, nil
 	case []byte:
 		return x, nil
 	default:
@@ -393,15 +428,19 @@ func (ctx *setDecodeCtx) IgnoreParseError() bool {
 // Note that a successful parsing of any type of key does NOT necessarily
 // guarantee a valid key. For example, no checks against expiration dates
 // are performed for certificate expiration, no checks against missing
-// parameters are performed, etc.
+// parameters are performed, etc. Pass `jwk.WithValidate(true)` to check
+// the consistency of the key material using `(jwk.Key).Validate()`.
 func ParseKey(data []byte, options ...ParseOption) (Key, error) {
 	var parsePEM bool
+	var validate bool
 	var localReg *json.Registry
 	for _, option := range options {
 		//nolint:forcetypeassert
 		switch option.Ident() {
 		case identPEM{}:
 			parsePEM = option.Value().(bool)
+		case identValidate{}:
+			validate = option.Value().(bool)
 		case identLocalRegistry{}:
 			// in reality you can only pass either withLocalRegistry or
 			// WithTypedField, but since withLocalRegistry is used only by us,
@@ -423,7 +462,16 @@ func ParseKey(data []byte, options ...ParseOption) (Key, error) {
 		if err != nil {
 			return nil, fmt.Errorf(`failed to parse PEM encoded key: %w`, err)
 		}
-		return FromRaw(raw)
+		key, err := FromRaw(raw)
+		if err != nil {
+			return nil, err
+		}
+		if validate {
+			if err := key.Validate(); err != nil {
+				return nil, fmt.Errorf(`failed to validate key: %w`, err)
+			}
+		}
+		return key, nil
 	}
 
 	var hint struct {
@@ -475,6 +523,12 @@ func ParseKey(data []byte, options ...ParseOption) (Key, error) {
 		return nil, fmt.Errorf(`failed to unmarshal JSON into key (%T): %w`, key, err)
 	}
 
+	if validate {
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf(`failed to validate key: %w`, err)
+		}
+	}
+
 	return key, nil
 }
 
@@ -494,6 +548,7 @@ func ParseKey(data []byte, options ...ParseOption) (Key, error) {
 // for `jwk.ParseKey()`.
 func Parse(src []byte, options ...ParseOption) (Set, error) {
 	var parsePEM bool
+	var validate bool
 	var localReg *json.Registry
 	var ignoreParseError bool
 	for _, option := range options {
@@ -501,6 +556,8 @@ func Parse(src []byte, options ...ParseOption) (Set, error) {
 		switch option.Ident() {
 		case identPEM{}:
 			parsePEM = option.Value().(bool)
+		case identValidate{}:
+			validate = option.Value().(bool)
 		case identIgnoreParseError{}:
 			ignoreParseError = option.Value().(bool)
 		case identTypedField{}:
@@ -528,29 +585,54 @@ func Parse(src []byte, options ...ParseOption) (Set, error) {
 			s.Add(key)
 			src = bytes.TrimSpace(rest)
 		}
-		return s, nil
-	}
-
-	if localReg != nil || ignoreParseError {
-		dcKs, ok := s.(KeyWithDecodeCtx)
-		if !ok {
-			return nil, fmt.Errorf(`typed field was requested, but the key set (%T) does not support DecodeCtx`, s)
+	} else {
+		if localReg != nil || ignoreParseError {
+			dcKs, ok := s.(KeyWithDecodeCtx)
+			if !ok {
+				return nil, fmt.Errorf(`typed field was requested, but the key set (%T) does not support DecodeCtx`, s)
+			}
+			dc := &setDecodeCtx{
+				DecodeCtx:        json.NewDecodeCtx(localReg),
+				ignoreParseError: ignoreParseError,
+			}
+			dcKs.SetDecodeCtx(dc)
+			defer func() { dcKs.SetDecodeCtx(nil) }()
 		}
-		dc := &setDecodeCtx{
-			DecodeCtx:        json.NewDecodeCtx(localReg),
-			ignoreParseError: ignoreParseError,
+
+		if err := json.Unmarshal(src, s); err != nil {
+			return nil, fmt.Errorf(`failed to unmarshal JWK set: %w`, err)
 		}
-		dcKs.SetDecodeCtx(dc)
-		defer func() { dcKs.SetDecodeCtx(nil) }()
 	}
 
-	if err := json.Unmarshal(src, s); err != nil {
-		return nil, fmt.Errorf(`failed to unmarshal JWK set: %w`, err)
+	if validate {
+		if err := validateSet(s, ignoreParseError); err != nil {
+			return nil, err
+		}
 	}
 
 	return s, nil
 }
 
+// validateSet validates each key in the set. If ignoreParseError is true,
+// keys that fail validation are removed from the set.
+func validateSet(s Set, ignoreParseError bool) error {
+	var invalid []Key
+	for i := 0; i < s.Len(); i++ {
+		key, _ := s.Get(i)
+		if err := key.Validate(); err != nil {
+			if !ignoreParseError {
+				return fmt.Errorf(`failed to validate key #%d: %w`, i, err)
+			}
+			invalid = append(invalid, key)
+		}
+	}
+
+	for _, key := range invalid {
+		s.Remove(key)
+	}
+	return nil
+}
+
 // ParseReader parses a JWK set from the incoming byte buffer.
 func ParseReader(src io.Reader, options ...ParseOption) (Set, error) {
 	// meh, there's no way to tell if a stream has "ended" a single
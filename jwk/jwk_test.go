@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/cert"
+	"github.com/lestrrat-go/jwx/v2/ed448"
 	"github.com/lestrrat-go/jwx/v2/internal/ecutil"
 	"github.com/lestrrat-go/jwx/v2/internal/jose"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
@@ -30,6 +31,7 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -151,6 +153,10 @@ func expectedRawKeyType(key jwk.Key) interface{} {
 			return ed25519.PrivateKey(nil)
 		case jwa.X25519:
 			return x25519.PrivateKey(nil)
+		case jwa.Ed448:
+			return ed448.PrivateKey(nil)
+		case jwa.X448:
+			return x448.PrivateKey(nil)
 		default:
 			panic("unknown curve type for OKPPrivateKey:" + key.Crv())
 		}
@@ -160,6 +166,10 @@ func expectedRawKeyType(key jwk.Key) interface{} {
 			return ed25519.PublicKey(nil)
 		case jwa.X25519:
 			return x25519.PublicKey(nil)
+		case jwa.Ed448:
+			return ed448.PublicKey(nil)
+		case jwa.X448:
+			return x448.PublicKey(nil)
 		default:
 			panic("unknown curve type for OKPPublicKey:" + key.Crv())
 		}
@@ -391,6 +401,18 @@ func TestParse(t *testing.T) {
 							return
 						}
 						crawkey = rawkey
+					case jwa.Ed448:
+						var rawkey ed448.PrivateKey
+						if !assert.NoError(t, key.Raw(&rawkey), `key.Raw(&ed448.PrivateKey) should succeed`) {
+							return
+						}
+						crawkey = rawkey
+					case jwa.X448:
+						var rawkey x448.PrivateKey
+						if !assert.NoError(t, key.Raw(&rawkey), `key.Raw(&x448.PrivateKey) should succeed`) {
+							return
+						}
+						crawkey = rawkey
 					default:
 						t.Errorf(`invalid curve %s`, k.Crv())
 					}
@@ -411,6 +433,18 @@ func TestParse(t *testing.T) {
 							return
 						}
 						crawkey = rawkey
+					case jwa.Ed448:
+						var rawkey ed448.PublicKey
+						if !assert.NoError(t, key.Raw(&rawkey), `key.Raw(&ed448.PublicKey) should succeed`) {
+							return
+						}
+						crawkey = rawkey
+					case jwa.X448:
+						var rawkey x448.PublicKey
+						if !assert.NoError(t, key.Raw(&rawkey), `key.Raw(&x448.PublicKey) should succeed`) {
+							return
+						}
+						crawkey = rawkey
 					default:
 						t.Errorf(`invalid curve %s`, k.Crv())
 					}
@@ -503,6 +537,27 @@ func TestParse(t *testing.T) {
 		}`
 		verify(t, src, reflect.TypeOf((*jwk.OKPPrivateKey)(nil)).Elem())
 	})
+	t.Run("Ed448 Public Key", func(t *testing.T) {
+		t.Parallel()
+		// Key taken from Wycheproof test vectors
+		const src = `{
+		  "kty" : "OKP",
+		  "crv" : "Ed448",
+		  "x"   : "QZYQpTSvEn9YOwSBjNt_D_MAsCXy4BaCvK4z_Wkc7gOVEd8M3caQ7peEJuizjlDOWvfc-6UPcEwA"
+		}`
+		verify(t, src, reflect.TypeOf((*jwk.OKPPublicKey)(nil)).Elem())
+	})
+	t.Run("Ed448 Private Key", func(t *testing.T) {
+		t.Parallel()
+		// Key taken from Wycheproof test vectors
+		const src = `{
+		  "kty" : "OKP",
+		  "crv" : "Ed448",
+		  "d"   : "iDAeB2UY01N_kwLuD1Ij5LY-HwFgB9PC69_sX3CZfoEZxrrQrnuAP0h5HKjsVJqiobhi96UVkLnV",
+		  "x"   : "QZYQpTSvEn9YOwSBjNt_D_MAsCXy4BaCvK4z_Wkc7gOVEd8M3caQ7peEJuizjlDOWvfc-6UPcEwA"
+		}`
+		verify(t, src, reflect.TypeOf((*jwk.OKPPrivateKey)(nil)).Elem())
+	})
 	t.Run("X25519 Public Key", func(t *testing.T) {
 		t.Parallel()
 		// Key taken from RFC 8037
@@ -583,6 +638,28 @@ func TestRoundtrip(t *testing.T) {
 		return k, nil
 	}
 
+	generateEd448 := func(use, keyID string) (jwk.Key, error) {
+		k, err := jwxtest.GenerateEd448Jwk()
+		if err != nil {
+			return nil, err
+		}
+
+		k.Set(jwk.KeyUsageKey, use)
+		k.Set(jwk.KeyIDKey, keyID)
+		return k, nil
+	}
+
+	generateX448 := func(use, keyID string) (jwk.Key, error) {
+		k, err := jwxtest.GenerateX448Jwk()
+		if err != nil {
+			return nil, err
+		}
+
+		k.Set(jwk.KeyUsageKey, use)
+		k.Set(jwk.KeyIDKey, keyID)
+		return k, nil
+	}
+
 	tests := []struct {
 		generate func(string, string) (jwk.Key, error)
 		use      string
@@ -643,6 +720,16 @@ func TestRoundtrip(t *testing.T) {
 			keyID:    "enc6",
 			generate: generateX25519,
 		},
+		{
+			use:      "sig",
+			keyID:    "sig7",
+			generate: generateEd448,
+		},
+		{
+			use:      "enc",
+			keyID:    "enc7",
+			generate: generateX448,
+		},
 	}
 
 	ks1 := jwk.NewSet()
@@ -2061,3 +2148,175 @@ func TestGH664(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerate(t *testing.T) {
+	testcases := []struct {
+		Name    string
+		KeyType jwa.KeyType
+		Options []jwk.GenerateOption
+		Check   func(*testing.T, interface{})
+		Error   bool
+	}{
+		{
+			Name:    "RSA (default)",
+			KeyType: jwa.RSA,
+			Check: func(t *testing.T, raw interface{}) {
+				assert.Equal(t, 2048, raw.(*rsa.PrivateKey).N.BitLen())
+			},
+		},
+		{
+			Name:    "RSA 3072",
+			KeyType: jwa.RSA,
+			Options: []jwk.GenerateOption{jwk.WithRSAKeySize(3072)},
+			Check: func(t *testing.T, raw interface{}) {
+				assert.Equal(t, 3072, raw.(*rsa.PrivateKey).N.BitLen())
+			},
+		},
+		{
+			Name:    "EC (default)",
+			KeyType: jwa.EC,
+			Check: func(t *testing.T, raw interface{}) {
+				assert.Equal(t, `P-256`, raw.(*ecdsa.PrivateKey).Curve.Params().Name)
+			},
+		},
+		{
+			Name:    "EC P-384",
+			KeyType: jwa.EC,
+			Options: []jwk.GenerateOption{jwk.WithCurve(jwa.P384)},
+			Check: func(t *testing.T, raw interface{}) {
+				assert.Equal(t, `P-384`, raw.(*ecdsa.PrivateKey).Curve.Params().Name)
+			},
+		},
+		{
+			Name:    "EC with OKP curve",
+			KeyType: jwa.EC,
+			Options: []jwk.GenerateOption{jwk.WithCurve(jwa.Ed25519)},
+			Error:   true,
+		},
+		{
+			Name:    "OKP (default)",
+			KeyType: jwa.OKP,
+			Check: func(t *testing.T, raw interface{}) {
+				assert.IsType(t, ed25519.PrivateKey(nil), raw)
+			},
+		},
+		{
+			Name:    "OKP X25519",
+			KeyType: jwa.OKP,
+			Options: []jwk.GenerateOption{jwk.WithCurve(jwa.X25519)},
+			Check: func(t *testing.T, raw interface{}) {
+				assert.IsType(t, x25519.PrivateKey(nil), raw)
+			},
+		},
+		{
+			Name:    "OKP Ed448",
+			KeyType: jwa.OKP,
+			Options: []jwk.GenerateOption{jwk.WithCurve(jwa.Ed448)},
+			Check: func(t *testing.T, raw interface{}) {
+				assert.IsType(t, ed448.PrivateKey(nil), raw)
+			},
+		},
+		{
+			Name:    "OKP X448",
+			KeyType: jwa.OKP,
+			Options: []jwk.GenerateOption{jwk.WithCurve(jwa.X448)},
+			Check: func(t *testing.T, raw interface{}) {
+				assert.IsType(t, x448.PrivateKey(nil), raw)
+			},
+		},
+		{
+			Name:    "OKP with EC curve",
+			KeyType: jwa.OKP,
+			Options: []jwk.GenerateOption{jwk.WithCurve(jwa.P256)},
+			Error:   true,
+		},
+		{
+			Name:    "oct (default)",
+			KeyType: jwa.OctetSeq,
+			Check: func(t *testing.T, raw interface{}) {
+				assert.Len(t, raw, 32)
+			},
+		},
+		{
+			Name:    "oct 64 bytes",
+			KeyType: jwa.OctetSeq,
+			Options: []jwk.GenerateOption{jwk.WithSymmetricKeyLength(64)},
+			Check: func(t *testing.T, raw interface{}) {
+				assert.Len(t, raw, 64)
+			},
+		},
+		{
+			Name:    "Unknown key type",
+			KeyType: jwa.KeyType(`foo`),
+			Error:   true,
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			key, err := jwk.Generate(tc.KeyType, tc.Options...)
+			if tc.Error {
+				assert.Error(t, err, `jwk.Generate should fail`)
+				return
+			}
+			if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.KeyType, key.KeyType(), `key type should match`) {
+				return
+			}
+
+			var raw interface{}
+			if !assert.NoError(t, key.Raw(&raw), `key.Raw should succeed`) {
+				return
+			}
+			tc.Check(t, raw)
+		})
+	}
+
+	t.Run("Fields", func(t *testing.T) {
+		key, err := jwk.Generate(jwa.EC,
+			jwk.WithAlgorithm(jwa.ES256),
+			jwk.WithKeyUsage(jwk.ForSignature),
+			jwk.WithKeyOps(jwk.KeyOpSign, jwk.KeyOpVerify),
+			jwk.WithThumbprintKeyID(true),
+		)
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+
+		if !assert.Equal(t, jwa.ES256, key.Algorithm(), `"alg" should match`) {
+			return
+		}
+		if !assert.Equal(t, `sig`, key.KeyUsage(), `"use" should match`) {
+			return
+		}
+		if !assert.Equal(t, jwk.KeyOperationList{jwk.KeyOpSign, jwk.KeyOpVerify}, key.KeyOps(), `"key_ops" should match`) {
+			return
+		}
+
+		tp, err := key.Thumbprint(crypto.SHA256)
+		if !assert.NoError(t, err, `key.Thumbprint should succeed`) {
+			return
+		}
+		if !assert.Equal(t, base64.EncodeToString(tp), key.KeyID(), `"kid" should be the thumbprint`) {
+			return
+		}
+	})
+	t.Run("RandReader", func(t *testing.T) {
+		src := bytes.Repeat([]byte{0x2a}, 16)
+		key, err := jwk.Generate(jwa.OctetSeq, jwk.WithSymmetricKeyLength(16), jwk.WithRandReader(bytes.NewReader(src)))
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+		if !assert.Equal(t, src, key.(jwk.SymmetricKey).Octets(), `octets should be read from the given source`) {
+			return
+		}
+
+		_, err = jwk.Generate(jwa.OctetSeq, jwk.WithSymmetricKeyLength(32), jwk.WithRandReader(bytes.NewReader(src)))
+		if !assert.Error(t, err, `jwk.Generate should fail when the source is exhausted`) {
+			return
+		}
+	})
+}
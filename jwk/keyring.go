@@ -0,0 +1,327 @@
+package jwk
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+// Clock is used by `jwk.Keyring` to determine the current time
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc is a Clock based on a function
+type ClockFunc func() time.Time
+
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// KeyringEntry describes a key held in a `jwk.Keyring`, along with
+// the times at which its state changes.
+type KeyringEntry struct {
+	Key Key
+
+	// ActivateAt is the time from which Key may be used for signing.
+	ActivateAt time.Time
+
+	// DeactivateAt is the time from which Key is no longer used for
+	// signing. The zero value means that the key is never deactivated.
+	DeactivateAt time.Time
+
+	// RemoveAt is the time from which Key is no longer included in the
+	// public key set. The zero value means that the key is never removed.
+	RemoveAt time.Time
+}
+
+// Keyring holds signing keys and the schedule by which they are rotated.
+//
+// At any point in time, the active key with the latest activation time is
+// used for signing (see `ActiveKey()`), while the public key set includes
+// all keys that have not been removed yet, including those that are not
+// active yet, or have already been deactivated (see `PublicSet()`)
+//
+// Keys may be added manually via `Add()`, or generated automatically by
+// `Rotate()` when a template key and a rotation period are specified:
+//
+//  kr := jwk.NewKeyring(
+//    jwk.WithKeyTemplate(template),
+//    jwk.WithRotationPeriod(24*time.Hour),
+//    jwk.WithPrePublishPeriod(time.Hour),
+//    jwk.WithRetentionPeriod(2*time.Hour),
+//  )
+//  // call kr.Rotate() periodically
+//  key, _ := kr.ActiveKey()
+//  signed, _ := jwt.Sign(tok, jwt.WithKey(key.Algorithm(), key))
+//
+// Keyring is safe for concurrent use.
+type Keyring struct {
+	mu         sync.RWMutex
+	clock      Clock
+	template   Key
+	rotation   time.Duration
+	prePublish time.Duration
+	retention  time.Duration
+	entries    []*KeyringEntry
+}
+
+// NewKeyring creates a new empty `jwk.Keyring`
+func NewKeyring(options ...KeyringOption) *Keyring {
+	kr := &Keyring{
+		clock: ClockFunc(time.Now),
+	}
+	for _, option := range options {
+		//nolint:forcetypeassert
+		switch option.Ident() {
+		case identClock{}:
+			kr.clock = option.Value().(Clock)
+		case identKeyTemplate{}:
+			kr.template = option.Value().(Key)
+		case identRotationPeriod{}:
+			kr.rotation = option.Value().(time.Duration)
+		case identPrePublishPeriod{}:
+			kr.prePublish = option.Value().(time.Duration)
+		case identRetentionPeriod{}:
+			kr.retention = option.Value().(time.Duration)
+		}
+	}
+	return kr
+}
+
+// Add adds a key to the keyring. If the key does not have a key ID,
+// one is assigned using `jwk.AssignKeyID()`. Key IDs must be unique
+// within the keyring.
+func (kr *Keyring) Add(entry KeyringEntry) error {
+	if entry.Key == nil {
+		return fmt.Errorf(`jwk.Keyring: key must not be nil`)
+	}
+	if !entry.DeactivateAt.IsZero() && !entry.DeactivateAt.After(entry.ActivateAt) {
+		return fmt.Errorf(`jwk.Keyring: deactivation time must be after activation time`)
+	}
+	if !entry.RemoveAt.IsZero() && (entry.DeactivateAt.IsZero() || entry.RemoveAt.Before(entry.DeactivateAt)) {
+		return fmt.Errorf(`jwk.Keyring: removal time must not be before deactivation time`)
+	}
+	if err := AssignKeyID(entry.Key); err != nil {
+		return fmt.Errorf(`jwk.Keyring: failed to assign key ID: %w`, err)
+	}
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.add(&entry)
+}
+
+// add adds the entry. Must be called while holding the lock
+func (kr *Keyring) add(entry *KeyringEntry) error {
+	kid := entry.Key.KeyID()
+	for _, e := range kr.entries {
+		if e.Key.KeyID() == kid {
+			return fmt.Errorf(`jwk.Keyring: key with key ID %q already exists`, kid)
+		}
+	}
+
+	kr.entries = append(kr.entries, entry)
+	sort.SliceStable(kr.entries, func(i, j int) bool {
+		return kr.entries[i].ActivateAt.Before(kr.entries[j].ActivateAt)
+	})
+	return nil
+}
+
+// Entries returns the keys held in the keyring, ordered by their
+// activation time, including those that should have been removed.
+func (kr *Keyring) Entries() []KeyringEntry {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	entries := make([]KeyringEntry, len(kr.entries))
+	for i, e := range kr.entries {
+		entries[i] = *e
+	}
+	return entries
+}
+
+// ActiveKey returns the key that should be used for signing at the
+// current time. If multiple keys are active, the one with the latest
+// activation time is returned.
+//
+// The key is shared with the keyring, and should be treated read-only.
+func (kr *Keyring) ActiveKey() (Key, error) {
+	now := kr.clock.Now()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	var active *KeyringEntry
+	for _, e := range kr.entries {
+		if e.ActivateAt.After(now) {
+			// entries are sorted by activation time
+			break
+		}
+		if e.DeactivateAt.IsZero() || now.Before(e.DeactivateAt) {
+			active = e
+		}
+	}
+
+	if active == nil {
+		return nil, fmt.Errorf(`jwk.Keyring: no active key`)
+	}
+	return active.Key, nil
+}
+
+// PublicSet returns a new `jwk.Set` containing the public keys of all
+// the keys in the keyring that have not been removed at the current time.
+//
+// Symmetric keys are never included.
+func (kr *Keyring) PublicSet() (Set, error) {
+	now := kr.clock.Now()
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	set := NewSet()
+	for _, e := range kr.entries {
+		if !e.RemoveAt.IsZero() && !now.Before(e.RemoveAt) {
+			continue
+		}
+		if e.Key.KeyType() == jwa.OctetSeq {
+			continue
+		}
+
+		pubkey, err := PublicKeyOf(e.Key)
+		if err != nil {
+			return nil, fmt.Errorf(`jwk.Keyring: failed to get public key of %q: %w`, e.Key.KeyID(), err)
+		}
+		set.Add(pubkey)
+	}
+	return set, nil
+}
+
+// Rotate removes the keys whose removal time has passed, and generates
+// new keys according to the schedule specified by `jwk.WithRotationPeriod()`,
+// `jwk.WithPrePublishPeriod()` and `jwk.WithRetentionPeriod()`, using the
+// template specified by `jwk.WithKeyTemplate()`.
+//
+// The successor of the last key is generated as soon as the last key
+// becomes active, and is activated when the last key is deactivated.
+// Rotate should therefore be called often enough so that the successor
+// can be published for the pre-publish period before it is activated. If
+// it is not, the deactivation of the last key is postponed accordingly.
+//
+// If no keys are scheduled to be active, a new key is generated and
+// activated immediately. If any key is never deactivated, no keys are
+// generated.
+func (kr *Keyring) Rotate() error {
+	if kr.template == nil || kr.rotation <= 0 {
+		return fmt.Errorf(`jwk.Keyring: both jwk.WithKeyTemplate() and jwk.WithRotationPeriod() must be specified to rotate keys`)
+	}
+
+	now := kr.clock.Now()
+
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	entries := make([]*KeyringEntry, 0, len(kr.entries))
+	var last *KeyringEntry
+	var permanent bool
+	for _, e := range kr.entries {
+		if !e.RemoveAt.IsZero() && !now.Before(e.RemoveAt) {
+			continue
+		}
+		entries = append(entries, e)
+
+		if e.DeactivateAt.IsZero() {
+			permanent = true
+			continue
+		}
+		if last == nil || e.DeactivateAt.After(last.DeactivateAt) {
+			last = e
+		}
+	}
+	kr.entries = entries
+
+	if permanent {
+		return nil
+	}
+
+	for {
+		var activateAt time.Time
+		switch {
+		case last == nil || !last.DeactivateAt.After(now):
+			// no keys are active, so the new key needs to be used immediately
+			activateAt = now
+		case last.ActivateAt.After(now) && last.DeactivateAt.Sub(now) > kr.prePublish:
+			// the successor of the last key has already been published
+			return nil
+		default:
+			activateAt = last.DeactivateAt
+			if earliest := now.Add(kr.prePublish); activateAt.Before(earliest) {
+				// keep using the last key until the new key has been
+				// published for long enough
+				delay := earliest.Sub(activateAt)
+				last.DeactivateAt = earliest
+				if !last.RemoveAt.IsZero() {
+					last.RemoveAt = last.RemoveAt.Add(delay)
+				}
+				activateAt = earliest
+			}
+		}
+
+		key, err := generateFromTemplate(kr.template)
+		if err != nil {
+			return fmt.Errorf(`jwk.Keyring: failed to generate key: %w`, err)
+		}
+
+		deactivateAt := activateAt.Add(kr.rotation)
+		entry := &KeyringEntry{
+			Key:          key,
+			ActivateAt:   activateAt,
+			DeactivateAt: deactivateAt,
+			RemoveAt:     deactivateAt.Add(kr.retention),
+		}
+		if err := kr.add(entry); err != nil {
+			return err
+		}
+		last = entry
+	}
+}
+
+// generateFromTemplate generates a new private key of the same type
+// and size as `template`, with the "alg", "use" and "key_ops" fields
+// copied from it
+func generateFromTemplate(template Key) (Key, error) {
+	var options []GenerateOption
+	switch template := template.(type) {
+	case RSAPrivateKey:
+		options = append(options, WithRSAKeySize(len(template.N())*8))
+	case RSAPublicKey:
+		options = append(options, WithRSAKeySize(len(template.N())*8))
+	case ECDSAPrivateKey:
+		options = append(options, WithCurve(template.Crv()))
+	case ECDSAPublicKey:
+		options = append(options, WithCurve(template.Crv()))
+	case OKPPrivateKey:
+		options = append(options, WithCurve(template.Crv()))
+	case OKPPublicKey:
+		options = append(options, WithCurve(template.Crv()))
+	case SymmetricKey:
+		options = append(options, WithSymmetricKeyLength(len(template.Octets())))
+	default:
+		return nil, fmt.Errorf(`unsupported template key type %T`, template)
+	}
+
+	if v := template.Algorithm(); v != nil && v.String() != "" {
+		options = append(options, WithAlgorithm(v))
+	}
+	if v := template.KeyUsage(); v != "" {
+		options = append(options, WithKeyUsage(KeyUsageType(v)))
+	}
+	if v := template.KeyOps(); len(v) > 0 {
+		options = append(options, WithKeyOps(v...))
+	}
+	options = append(options, WithThumbprintKeyID(true))
+
+	return Generate(template.KeyType(), options...)
+}
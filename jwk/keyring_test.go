@@ -0,0 +1,226 @@
+package jwk_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/internal/jwxtest"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyringClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *keyringClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *keyringClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func TestKeyring(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Manual", func(t *testing.T) {
+		t.Parallel()
+
+		t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := &keyringClock{now: t0}
+		kr := jwk.NewKeyring(jwk.WithClock(clock))
+
+		if _, err := kr.ActiveKey(); !assert.Error(t, err, `kr.ActiveKey should fail`) {
+			return
+		}
+
+		var keys []jwk.Key
+		for i := 0; i < 2; i++ {
+			key, err := jwxtest.GenerateRsaJwk()
+			if !assert.NoError(t, err, `jwxtest.GenerateRsaJwk should succeed`) {
+				return
+			}
+			keys = append(keys, key)
+		}
+
+		if !assert.NoError(t, kr.Add(jwk.KeyringEntry{
+			Key:          keys[0],
+			ActivateAt:   t0,
+			DeactivateAt: t0.Add(time.Hour),
+			RemoveAt:     t0.Add(2 * time.Hour),
+		}), `kr.Add should succeed`) {
+			return
+		}
+		if !assert.NoError(t, kr.Add(jwk.KeyringEntry{
+			Key:        keys[1],
+			ActivateAt: t0.Add(time.Hour),
+		}), `kr.Add should succeed`) {
+			return
+		}
+		if !assert.NotEmpty(t, keys[0].KeyID(), `key ID should be assigned`) {
+			return
+		}
+
+		if !assert.Error(t, kr.Add(jwk.KeyringEntry{Key: keys[0]}), `kr.Add with duplicate key ID should fail`) {
+			return
+		}
+		if !assert.Error(t, kr.Add(jwk.KeyringEntry{Key: keys[0], ActivateAt: t0, DeactivateAt: t0}), `kr.Add with invalid schedule should fail`) {
+			return
+		}
+
+		testcases := []struct {
+			Now       time.Time
+			Active    jwk.Key
+			Published int
+		}{
+			{Now: t0, Active: keys[0], Published: 2},
+			{Now: t0.Add(time.Hour), Active: keys[1], Published: 2},
+			{Now: t0.Add(2 * time.Hour), Active: keys[1], Published: 1},
+		}
+		for _, tc := range testcases {
+			clock.Set(tc.Now)
+			active, err := kr.ActiveKey()
+			if !assert.NoError(t, err, `kr.ActiveKey should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.Active.KeyID(), active.KeyID(), `active key should match at %s`, tc.Now) {
+				return
+			}
+
+			set, err := kr.PublicSet()
+			if !assert.NoError(t, err, `kr.PublicSet should succeed`) {
+				return
+			}
+			if !assert.Equal(t, tc.Published, set.Len(), `number of published keys should match at %s`, tc.Now) {
+				return
+			}
+			for i := 0; i < set.Len(); i++ {
+				key, _ := set.Get(i)
+				if _, ok := key.(jwk.RSAPrivateKey); !assert.False(t, ok, `published keys should be public`) {
+					return
+				}
+			}
+		}
+	})
+	t.Run("Rotate", func(t *testing.T) {
+		t.Parallel()
+
+		raw, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+		if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+			return
+		}
+		template, err := jwk.FromRaw(raw)
+		if !assert.NoError(t, err, `jwk.FromRaw should succeed`) {
+			return
+		}
+		_ = template.Set(jwk.AlgorithmKey, jwa.ES256)
+		_ = template.Set(jwk.KeyUsageKey, jwk.ForSignature)
+
+		t0 := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock := &keyringClock{now: t0}
+		kr := jwk.NewKeyring(
+			jwk.WithClock(clock),
+			jwk.WithKeyTemplate(template),
+			jwk.WithRotationPeriod(24*time.Hour),
+			jwk.WithPrePublishPeriod(time.Hour),
+			jwk.WithRetentionPeriod(2*time.Hour),
+		)
+
+		rotate := func(now time.Time, expected int) bool {
+			t.Helper()
+			clock.Set(now)
+			if !assert.NoError(t, kr.Rotate(), `kr.Rotate should succeed`) {
+				return false
+			}
+			return assert.Len(t, kr.Entries(), expected, `number of keys should match at %s`, now)
+		}
+		activeKeyID := func(now time.Time) string {
+			t.Helper()
+			clock.Set(now)
+			key, err := kr.ActiveKey()
+			if !assert.NoError(t, err, `kr.ActiveKey should succeed`) {
+				return ""
+			}
+			return key.KeyID()
+		}
+
+		// the successor is generated as soon as the first key is active
+		if !rotate(t0, 2) {
+			return
+		}
+		first := kr.Entries()[0]
+		if !assert.Equal(t, jwa.ES256, first.Key.Algorithm(), `"alg" should be copied from template`) {
+			return
+		}
+		if !assert.Equal(t, jwa.P256, first.Key.(jwk.ECDSAPrivateKey).Crv(), `curve should match template`) {
+			return
+		}
+		if !assert.NotEqual(t, template.KeyID(), first.Key.KeyID(), `a new key should be generated`) {
+			return
+		}
+		second := kr.Entries()[1]
+		if !assert.Equal(t, t0.Add(24*time.Hour), second.ActivateAt, `successor should be activated when the first key is deactivated`) {
+			return
+		}
+		if !rotate(t0.Add(22*time.Hour), 2) {
+			return
+		}
+		if !assert.Equal(t, first.Key.KeyID(), activeKeyID(t0.Add(23*time.Hour+30*time.Minute)), `first key should be active`) {
+			return
+		}
+		if !assert.Equal(t, second.Key.KeyID(), activeKeyID(t0.Add(24*time.Hour)), `second key should be active`) {
+			return
+		}
+
+		// tokens signed by the previous key can be verified during the retention period
+		clock.Set(t0.Add(23 * time.Hour))
+		signed, err := jws.Sign([]byte(`Lorem ipsum`), jws.WithKey(first.Key.Algorithm(), first.Key))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		clock.Set(t0.Add(25 * time.Hour))
+		set, err := kr.PublicSet()
+		if !assert.NoError(t, err, `kr.PublicSet should succeed`) {
+			return
+		}
+		if _, err := jws.Verify(signed, jws.WithKeySet(set)); !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+
+		// the first key is removed after the retention period
+		if !rotate(t0.Add(26*time.Hour), 2) {
+			return
+		}
+		third := kr.Entries()[1]
+
+		// Rotate was called late: the third key stays active until
+		// its successor has been published for the pre-publish period
+		if !rotate(t0.Add(71*time.Hour+30*time.Minute), 2) {
+			return
+		}
+		if !assert.Equal(t, third.Key.KeyID(), activeKeyID(t0.Add(72*time.Hour+15*time.Minute)), `third key should still be active`) {
+			return
+		}
+		if !assert.Equal(t, t0.Add(72*time.Hour+30*time.Minute), kr.Entries()[1].ActivateAt, `activation should be postponed`) {
+			return
+		}
+
+		// Rotate was not called at all: a new key is activated immediately
+		now := t0.Add(200 * time.Hour)
+		if !rotate(now, 2) {
+			return
+		}
+		if !assert.Equal(t, now, kr.Entries()[0].ActivateAt, `new key should be activated immediately`) {
+			return
+		}
+	})
+}
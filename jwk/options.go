@@ -1,6 +1,8 @@
 package jwk
 
 import (
+	"crypto/x509"
+
 	"github.com/lestrrat-go/option"
 )
 
@@ -36,3 +38,17 @@ func WithTypedField(name string, object interface{}) ParseOption {
 		),
 	}
 }
+
+// WithX509ExtKeyUsage specifies the extended key usages that the leaf
+// certificate must be valid for, when validated using `jwk.ValidateX509()`.
+// This option is required: pass `x509.ExtKeyUsageAny` to accept any
+// extended key usage.
+func WithX509ExtKeyUsage(usages ...x509.ExtKeyUsage) ValidateX509Option {
+	return &validateX509Option{option.New(identX509ExtKeyUsage{}, usages)}
+}
+
+// WithKeyOps specifies the value of the "key_ops" field of the key
+// generated by `jwk.Generate()`.
+func WithKeyOps(ops ...KeyOperation) GenerateOption {
+	return &generateOption{option.New(identKeyOps{}, KeyOperationList(ops))}
+}
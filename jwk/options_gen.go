@@ -4,10 +4,13 @@ package jwk
 
 import (
 	"crypto"
+	"crypto/x509"
+	"io"
 	"io/fs"
 	"time"
 
 	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/option"
 )
 
@@ -45,6 +48,7 @@ type FetchOption interface {
 	fetchOption()
 	parseOption()
 	registerOption()
+	registerIssuerOption()
 }
 
 type fetchOption struct {
@@ -57,6 +61,60 @@ func (*fetchOption) parseOption() {}
 
 func (*fetchOption) registerOption() {}
 
+func (*fetchOption) registerIssuerOption() {}
+
+// GenerateOption describes options that can be passed to `jwk.Generate()`
+type GenerateOption interface {
+	Option
+	generateOption()
+}
+
+type generateOption struct {
+	Option
+}
+
+func (*generateOption) generateOption() {}
+
+// GlobalOption describes an Option that can be passed to `jwk.Settings()`
+type GlobalOption interface {
+	Option
+	globalOption()
+}
+
+type globalOption struct {
+	Option
+}
+
+func (*globalOption) globalOption() {}
+
+// KeyringOption describes options that can be passed to `jwk.NewKeyring()`
+type KeyringOption interface {
+	Option
+	keyringOption()
+}
+
+type keyringOption struct {
+	Option
+}
+
+func (*keyringOption) keyringOption() {}
+
+// KeyringValidateX509Option describes options that can be passed to both
+// `jwk.NewKeyring()` and `jwk.ValidateX509()`
+type KeyringValidateX509Option interface {
+	Option
+	keyringOption()
+	validateX509Option()
+}
+
+type keyringValidateX509Option struct {
+	Option
+}
+
+func (*keyringValidateX509Option) keyringOption() {}
+
+func (*keyringValidateX509Option) validateX509Option() {}
+
 // ParseOption is a type of Option that can be passed to `jwk.Parse()`
 // ParseOption also implmentsthe `ReadFileOption` and `CacheOption`,
 // and thus safely be passed to `jwk.ReadFile` and `(*jwk.Cache).Configure()`
@@ -64,6 +122,7 @@ type ParseOption interface {
 	Option
 	fetchOption()
 	registerOption()
+	registerIssuerOption()
 	readFileOption()
 }
 
@@ -75,6 +134,8 @@ func (*parseOption) fetchOption() {}
 
 func (*parseOption) registerOption() {}
 
+func (*parseOption) registerIssuerOption() {}
+
 func (*parseOption) readFileOption() {}
 
 // ReadFileOption is a type of `Option` that can be passed to `jwk.ReadFile`
@@ -89,10 +150,25 @@ type readFileOption struct {
 
 func (*readFileOption) readFileOption() {}
 
+// RegisterIssuerOption describes options that can be passed to `(jwk.Cache).RegisterIssuer()`
+type RegisterIssuerOption interface {
+	Option
+	registerIssuerOption()
+}
+
+type registerIssuerOption struct {
+	Option
+}
+
+func (*registerIssuerOption) registerIssuerOption() {}
+
 // RegisterOption desribes options that can be passed to `(jwk.Cache).Register()`
+// RegisterOption also implements the `RegisterIssuerOption`, and thus can
+// safely be passed to `(jwk.Cache).RegisterIssuer()`
 type RegisterOption interface {
 	Option
 	registerOption()
+	registerIssuerOption()
 }
 
 type registerOption struct {
@@ -101,18 +177,73 @@ type registerOption struct {
 
 func (*registerOption) registerOption() {}
 
+func (*registerOption) registerIssuerOption() {}
+
+// ValidateX509Option describes options that can be passed to `jwk.ValidateX509()`
+type ValidateX509Option interface {
+	Option
+	validateX509Option()
+}
+
+type validateX509Option struct {
+	Option
+}
+
+func (*validateX509Option) validateX509Option() {}
+
+type identAlgorithm struct{}
+type identAuthorizationServerMetadata struct{}
+type identCacheStorage struct{}
+type identClock struct{}
+type identCurve struct{}
 type identErrSink struct{}
 type identFS struct{}
 type identFetchWhitelist struct{}
 type identHTTPClient struct{}
 type identIgnoreParseError struct{}
+type identKeyOps struct{}
+type identKeyTemplate struct{}
+type identKeyUsage struct{}
 type identLocalRegistry struct{}
+type identMaxStaleness struct{}
+type identMinRSAKeySize struct{}
 type identMinRefreshInterval struct{}
+type identMinSymmetricKeyLength struct{}
 type identPEM struct{}
 type identPostFetcher struct{}
+type identPrePublishPeriod struct{}
+type identRSAKeySize struct{}
+type identRandReader struct{}
 type identRefreshInterval struct{}
 type identRefreshWindow struct{}
+type identRetentionPeriod struct{}
+type identRotationPeriod struct{}
+type identSymmetricKeyLength struct{}
 type identThumbprintHash struct{}
+type identThumbprintKeyID struct{}
+type identValidate struct{}
+type identX509ExtKeyUsage struct{}
+type identX509KeyUsage struct{}
+
+func (identAlgorithm) String() string {
+	return "WithAlgorithm"
+}
+
+func (identAuthorizationServerMetadata) String() string {
+	return "WithAuthorizationServerMetadata"
+}
+
+func (identCacheStorage) String() string {
+	return "WithCacheStorage"
+}
+
+func (identClock) String() string {
+	return "WithClock"
+}
+
+func (identCurve) String() string {
+	return "WithCurve"
+}
 
 func (identErrSink) String() string {
 	return "WithErrSink"
@@ -134,14 +265,38 @@ func (identIgnoreParseError) String() string {
 	return "WithIgnoreParseError"
 }
 
+func (identKeyOps) String() string {
+	return "WithKeyOps"
+}
+
+func (identKeyTemplate) String() string {
+	return "WithKeyTemplate"
+}
+
+func (identKeyUsage) String() string {
+	return "WithKeyUsage"
+}
+
 func (identLocalRegistry) String() string {
 	return "withLocalRegistry"
 }
 
+func (identMaxStaleness) String() string {
+	return "WithMaxStaleness"
+}
+
+func (identMinRSAKeySize) String() string {
+	return "WithMinRSAKeySize"
+}
+
 func (identMinRefreshInterval) String() string {
 	return "WithMinRefreshInterval"
 }
 
+func (identMinSymmetricKeyLength) String() string {
+	return "WithMinSymmetricKeyLength"
+}
+
 func (identPEM) String() string {
 	return "WithPEM"
 }
@@ -150,6 +305,18 @@ func (identPostFetcher) String() string {
 	return "WithPostFetcher"
 }
 
+func (identPrePublishPeriod) String() string {
+	return "WithPrePublishPeriod"
+}
+
+func (identRSAKeySize) String() string {
+	return "WithRSAKeySize"
+}
+
+func (identRandReader) String() string {
+	return "WithRandReader"
+}
+
 func (identRefreshInterval) String() string {
 	return "WithRefreshInterval"
 }
@@ -158,10 +325,81 @@ func (identRefreshWindow) String() string {
 	return "WithRefreshWindow"
 }
 
+func (identRetentionPeriod) String() string {
+	return "WithRetentionPeriod"
+}
+
+func (identRotationPeriod) String() string {
+	return "WithRotationPeriod"
+}
+
+func (identSymmetricKeyLength) String() string {
+	return "WithSymmetricKeyLength"
+}
+
 func (identThumbprintHash) String() string {
 	return "WithThumbprintHash"
 }
 
+func (identThumbprintKeyID) String() string {
+	return "WithThumbprintKeyID"
+}
+
+func (identValidate) String() string {
+	return "WithValidate"
+}
+
+func (identX509ExtKeyUsage) String() string {
+	return "WithX509ExtKeyUsage"
+}
+
+func (identX509KeyUsage) String() string {
+	return "WithX509KeyUsage"
+}
+
+// WithAlgorithm specifies the value of the "alg" field of the key
+// generated by `jwk.Generate()`.
+func WithAlgorithm(v jwa.KeyAlgorithm) GenerateOption {
+	return &generateOption{option.New(identAlgorithm{}, v)}
+}
+
+// WithAuthorizationServerMetadata specifies that `(jwk.Cache).RegisterIssuer()`
+// should retrieve the OAuth 2.0 Authorization Server Metadata (RFC8414)
+// from `/.well-known/oauth-authorization-server`, instead of the
+// OpenID Provider Metadata from `/.well-known/openid-configuration`.
+func WithAuthorizationServerMetadata(v bool) RegisterIssuerOption {
+	return &registerIssuerOption{option.New(identAuthorizationServerMetadata{}, v)}
+}
+
+// WithCacheStorage specifies the `jwk.CacheStorage` object that is used to
+// persist the `jwk.Set` objects fetched by `jwk.Cache`.
+//
+// When specified, the last successfully fetched `jwk.Set` for each URL is
+// saved along with the time it was fetched. Upon `(jwk.Cache).Register()`,
+// previously saved data is loaded so that `(jwk.Cache).Get()` can return
+// it immediately, while the `jwk.Set` is refreshed in the background.
+//
+// See `jwk.NewFileCacheStorage()` for a filesystem based implementation.
+func WithCacheStorage(v CacheStorage) CacheOption {
+	return &cacheOption{option.New(identCacheStorage{}, v)}
+}
+
+// WithClock specifies the `jwk.Clock` that is used to determine the
+// current time. By default the current system time is used.
+//
+// When used with `jwk.ValidateX509()`, the current time is used to
+// check the validity period of the certificates.
+func WithClock(v Clock) KeyringValidateX509Option {
+	return &keyringValidateX509Option{option.New(identClock{}, v)}
+}
+
+// WithCurve specifies the curve of the EC or OKP key generated by
+// `jwk.Generate()`. The default is P-256 for EC keys, and Ed25519
+// for OKP keys.
+func WithCurve(v jwa.EllipticCurveAlgorithm) GenerateOption {
+	return &generateOption{option.New(identCurve{}, v)}
+}
+
 // WithErrSink specifies the `httprc.ErrSink` object that handles errors
 // that occurred during the cache's execution.
 //
@@ -211,11 +449,43 @@ func WithIgnoreParseError(v bool) ParseOption {
 	return &parseOption{option.New(identIgnoreParseError{}, v)}
 }
 
+// WithKeyTemplate specifies the key that `(*jwk.Keyring).Rotate()` uses as
+// a template to generate new keys. The new keys are of the same type and size
+// (or curve), and inherit the "alg", "use" and "key_ops" fields of the template.
+// The contents of the template key itself are not used.
+func WithKeyTemplate(v Key) KeyringOption {
+	return &keyringOption{option.New(identKeyTemplate{}, v)}
+}
+
+// WithKeyUsage specifies the value of the "use" field of the key
+// generated by `jwk.Generate()`.
+func WithKeyUsage(v KeyUsageType) GenerateOption {
+	return &generateOption{option.New(identKeyUsage{}, v)}
+}
+
 // This option is only available for internal code. Users don't get to play with it
 func withLocalRegistry(v *json.Registry) ParseOption {
 	return &parseOption{option.New(identLocalRegistry{}, v)}
 }
 
+// WithMaxStaleness specifies how long a `jwk.Set` may continue to be
+// served by `(jwk.Cache).Get()` after it has been fetched, while attempts to
+// refresh it fail. Once this period has passed, `(jwk.Cache).Get()` returns
+// an error until the `jwk.Set` is successfully refreshed.
+//
+// The value should be larger than the refresh interval of the URLs.
+// The default value of 0 means that the last fetched `jwk.Set` is served
+// indefinitely.
+func WithMaxStaleness(v time.Duration) CacheOption {
+	return &cacheOption{option.New(identMaxStaleness{}, v)}
+}
+
+// WithMinRSAKeySize specifies the minimum size in bits of RSA keys
+// that `(jwk.Key).Validate()` accepts. The default is 2048.
+func WithMinRSAKeySize(v int) GlobalOption {
+	return &globalOption{option.New(identMinRSAKeySize{}, v)}
+}
+
 // WithMinRefreshInterval specifies the minimum refresh interval to be used
 // when using `jwk.Cache`. This value is ONLY used if you did not specify
 // a user-supplied static refresh interval via `WithRefreshInterval`.
@@ -239,6 +509,16 @@ func WithMinRefreshInterval(v time.Duration) RegisterOption {
 	return &registerOption{option.New(identMinRefreshInterval{}, v)}
 }
 
+// WithMinSymmetricKeyLength specifies the minimum length in bytes of
+// symmetric keys that `(jwk.Key).Validate()` accepts. The default is 16.
+//
+// Regardless of this value, keys that specify an HMAC algorithm in the
+// "alg" field must be at least as long as the output of the hash function,
+// as required by RFC7518 section 3.2.
+func WithMinSymmetricKeyLength(v int) GlobalOption {
+	return &globalOption{option.New(identMinSymmetricKeyLength{}, v)}
+}
+
 // WithPEM specifies that the input to `Parse()` is a PEM encoded key.
 func WithPEM(v bool) ParseOption {
 	return &parseOption{option.New(identPEM{}, v)}
@@ -252,6 +532,29 @@ func WithPostFetcher(v PostFetcher) RegisterOption {
 	return &registerOption{option.New(identPostFetcher{}, v)}
 }
 
+// WithPrePublishPeriod specifies how long before activation the keys
+// generated by `(*jwk.Keyring).Rotate()` are included in the public key set,
+// so that verifiers have the chance to fetch them before they are used.
+func WithPrePublishPeriod(v time.Duration) KeyringOption {
+	return &keyringOption{option.New(identPrePublishPeriod{}, v)}
+}
+
+// WithRSAKeySize specifies the size in bits of the RSA key generated
+// by `jwk.Generate()`. The default is 2048.
+func WithRSAKeySize(v int) GenerateOption {
+	return &generateOption{option.New(identRSAKeySize{}, v)}
+}
+
+// WithRandReader specifies the source of randomness used by `jwk.Generate()`.
+// The default is `crypto/rand.Reader`.
+//
+// Note that even with a deterministic source, the generated keys may not
+// be reproducible, as the underlying libraries may deliberately consume
+// a varying amount of randomness.
+func WithRandReader(v io.Reader) GenerateOption {
+	return &generateOption{option.New(identRandReader{}, v)}
+}
+
 // WithRefreshInterval specifies the static interval between refreshes
 // of jwk.Set objects controlled by jwk.Cache.
 //
@@ -269,6 +572,50 @@ func WithRefreshWindow(v time.Duration) CacheOption {
 	return &cacheOption{option.New(identRefreshWindow{}, v)}
 }
 
+// WithRetentionPeriod specifies how long after deactivation the keys
+// generated by `(*jwk.Keyring).Rotate()` remain in the public key set, so
+// that tokens signed before the rotation can still be verified.
+// This value should be at least as long as the lifetime of the tokens.
+func WithRetentionPeriod(v time.Duration) KeyringOption {
+	return &keyringOption{option.New(identRetentionPeriod{}, v)}
+}
+
+// WithRotationPeriod specifies how long each key generated by
+// `(*jwk.Keyring).Rotate()` remains active.
+func WithRotationPeriod(v time.Duration) KeyringOption {
+	return &keyringOption{option.New(identRotationPeriod{}, v)}
+}
+
+// WithSymmetricKeyLength specifies the length in bytes of the symmetric
+// key generated by `jwk.Generate()`. The default is 32.
+func WithSymmetricKeyLength(v int) GenerateOption {
+	return &generateOption{option.New(identSymmetricKeyLength{}, v)}
+}
+
 func WithThumbprintHash(v crypto.Hash) AssignKeyIDOption {
 	return &assignKeyIDOption{option.New(identThumbprintHash{}, v)}
 }
+
+// WithThumbprintKeyID specifies that the "kid" field of the key generated
+// by `jwk.Generate()` is set to its SHA-256 thumbprint, as done by
+// `jwk.AssignKeyID()`.
+func WithThumbprintKeyID(v bool) GenerateOption {
+	return &generateOption{option.New(identThumbprintKeyID{}, v)}
+}
+
+// WithValidate specifies that `(jwk.Key).Validate()` should be called on
+// each key after it has been parsed. If a key fails validation, `jwk.ParseKey()`
+// and `jwk.Parse()` return the error.
+//
+// When used together with `jwk.WithIgnoreParseError(true)` in `jwk.Parse()`,
+// keys that fail validation are removed from the resulting set instead.
+func WithValidate(v bool) ParseOption {
+	return &parseOption{option.New(identValidate{}, v)}
+}
+
+// WithX509KeyUsage specifies the key usage bits that must be set in the
+// leaf certificate, if the certificate contains the key usage extension.
+// The default is `x509.KeyUsageDigitalSignature`.
+func WithX509KeyUsage(v x509.KeyUsage) ValidateX509Option {
+	return &validateX509Option{option.New(identX509KeyUsage{}, v)}
+}
@@ -9,16 +9,37 @@ import (
 )
 
 func TestOptionIdent(t *testing.T) {
+	require.Equal(t, "WithAlgorithm", identAlgorithm{}.String())
+	require.Equal(t, "WithAuthorizationServerMetadata", identAuthorizationServerMetadata{}.String())
+	require.Equal(t, "WithCacheStorage", identCacheStorage{}.String())
+	require.Equal(t, "WithClock", identClock{}.String())
+	require.Equal(t, "WithCurve", identCurve{}.String())
 	require.Equal(t, "WithErrSink", identErrSink{}.String())
 	require.Equal(t, "WithFS", identFS{}.String())
 	require.Equal(t, "WithFetchWhitelist", identFetchWhitelist{}.String())
 	require.Equal(t, "WithHTTPClient", identHTTPClient{}.String())
 	require.Equal(t, "WithIgnoreParseError", identIgnoreParseError{}.String())
+	require.Equal(t, "WithKeyOps", identKeyOps{}.String())
+	require.Equal(t, "WithKeyTemplate", identKeyTemplate{}.String())
+	require.Equal(t, "WithKeyUsage", identKeyUsage{}.String())
 	require.Equal(t, "withLocalRegistry", identLocalRegistry{}.String())
+	require.Equal(t, "WithMaxStaleness", identMaxStaleness{}.String())
+	require.Equal(t, "WithMinRSAKeySize", identMinRSAKeySize{}.String())
 	require.Equal(t, "WithMinRefreshInterval", identMinRefreshInterval{}.String())
+	require.Equal(t, "WithMinSymmetricKeyLength", identMinSymmetricKeyLength{}.String())
 	require.Equal(t, "WithPEM", identPEM{}.String())
 	require.Equal(t, "WithPostFetcher", identPostFetcher{}.String())
+	require.Equal(t, "WithPrePublishPeriod", identPrePublishPeriod{}.String())
+	require.Equal(t, "WithRSAKeySize", identRSAKeySize{}.String())
+	require.Equal(t, "WithRandReader", identRandReader{}.String())
 	require.Equal(t, "WithRefreshInterval", identRefreshInterval{}.String())
 	require.Equal(t, "WithRefreshWindow", identRefreshWindow{}.String())
+	require.Equal(t, "WithRetentionPeriod", identRetentionPeriod{}.String())
+	require.Equal(t, "WithRotationPeriod", identRotationPeriod{}.String())
+	require.Equal(t, "WithSymmetricKeyLength", identSymmetricKeyLength{}.String())
 	require.Equal(t, "WithThumbprintHash", identThumbprintHash{}.String())
+	require.Equal(t, "WithThumbprintKeyID", identThumbprintKeyID{}.String())
+	require.Equal(t, "WithValidate", identValidate{}.String())
+	require.Equal(t, "WithX509ExtKeyUsage", identX509ExtKeyUsage{}.String())
+	require.Equal(t, "WithX509KeyUsage", identX509KeyUsage{}.String())
 }
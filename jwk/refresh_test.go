@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -13,6 +15,7 @@ import (
 	"github.com/lestrrat-go/iter/arrayiter"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
 	"github.com/lestrrat-go/jwx/v2/internal/jwxtest"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/stretchr/testify/assert"
 )
@@ -481,3 +484,353 @@ func TestPostFetch(t *testing.T) {
 		})
 	}
 }
+
+type memoryCacheStorage struct {
+	mu        sync.Mutex
+	data      []byte
+	fetchedAt time.Time
+}
+
+func (s *memoryCacheStorage) Load(_ context.Context, _ string) ([]byte, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data == nil {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	return s.data, s.fetchedAt, nil
+}
+
+func (s *memoryCacheStorage) Store(_ context.Context, _ string, data []byte, fetchedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	s.fetchedAt = fetchedAt
+	return nil
+}
+
+func TestCacheStorage(t *testing.T) {
+	t.Parallel()
+
+	const jwks = `{"keys":[{"kty":"EC","crv":"P-256","kid":"my-key","x":"SVqB4JcUD6lsfvqMr-OKUNUphdNn64Eay60978ZlL74","y":"lf0u0pMj4lGAzZix5u4Cm5CMQIgMNpkwy163wtKYVKI"}]}`
+
+	var mu sync.Mutex
+	var available = true
+	var accessCount int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		accessCount++
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprint(w, jwks)
+	}))
+	defer srv.Close()
+	setAvailable := func(v bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		available = v
+	}
+	getAccessCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return accessCount
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	t.Run("Persist and warm-start from filesystem", func(t *testing.T) {
+		storage := jwk.NewFileCacheStorage(filepath.Join(t.TempDir(), `jwks`))
+
+		setAvailable(true)
+		c1 := jwk.NewCache(ctx, jwk.WithCacheStorage(storage))
+		if !assert.NoError(t, c1.Register(srv.URL), `c1.Register should succeed`) {
+			return
+		}
+		if _, err := c1.Get(ctx, srv.URL); !assert.NoError(t, err, `c1.Get should succeed`) {
+			return
+		}
+
+		_, fetchedAt, err := storage.Load(ctx, srv.URL)
+		if !assert.NoError(t, err, `storage.Load should succeed`) {
+			return
+		}
+		if !assert.False(t, fetchedAt.IsZero(), `fetch time should be recorded`) {
+			return
+		}
+
+		// the URL is not reachable, but the stored JWKS should be used
+		setAvailable(false)
+		count := getAccessCount()
+		c2 := jwk.NewCache(ctx, jwk.WithCacheStorage(storage))
+		if !assert.NoError(t, c2.Register(srv.URL), `c2.Register should succeed`) {
+			return
+		}
+		set, err := c2.Get(ctx, srv.URL)
+		if !assert.NoError(t, err, `c2.Get should succeed`) {
+			return
+		}
+		if _, ok := set.LookupKeyID(`my-key`); !assert.True(t, ok, `stored key should be found`) {
+			return
+		}
+
+		// refresh happens in the background, and fails
+		time.Sleep(500 * time.Millisecond)
+		if !assert.Equal(t, count+1, getAccessCount(), `a refresh should have been attempted`) {
+			return
+		}
+		if _, err := c2.Get(ctx, srv.URL); !assert.NoError(t, err, `c2.Get should succeed after failed refresh`) {
+			return
+		}
+		if _, _, err := storage.Load(ctx, `https://example.com`); !assert.ErrorIs(t, err, os.ErrNotExist, `storage.Load for unknown URL should fail`) {
+			return
+		}
+	})
+	t.Run("Maximum staleness", func(t *testing.T) {
+		setAvailable(false)
+		testcases := []struct {
+			Name  string
+			Age   time.Duration
+			Error bool
+		}{
+			{Name: "Within limits", Age: 30 * time.Minute},
+			{Name: "Too old", Age: 2 * time.Hour, Error: true},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				storage := &memoryCacheStorage{data: []byte(jwks), fetchedAt: time.Now().Add(-1 * tc.Age)}
+				c := jwk.NewCache(ctx, jwk.WithCacheStorage(storage), jwk.WithMaxStaleness(time.Hour))
+				if !assert.NoError(t, c.Register(srv.URL), `c.Register should succeed`) {
+					return
+				}
+				_, err := c.Get(ctx, srv.URL)
+				if tc.Error {
+					assert.Error(t, err, `c.Get should fail`)
+					return
+				}
+				assert.NoError(t, err, `c.Get should succeed`)
+			})
+		}
+	})
+}
+
+func TestCacheRegisterIssuer(t *testing.T) {
+	t.Parallel()
+
+	const jwks = `{"keys":[{"kty":"EC","crv":"P-256","kid":"%s","x":"SVqB4JcUD6lsfvqMr-OKUNUphdNn64Eay60978ZlL74","y":"lf0u0pMj4lGAzZix5u4Cm5CMQIgMNpkwy163wtKYVKI"}]}`
+
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc(`/.well-known/openid-configuration`, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q,"id_token_signing_alg_values_supported":["RS256","ES256"],"x-custom":"foo"}`, srv.URL, srv.URL+`/jwks`)
+	})
+	mux.HandleFunc(`/.well-known/oauth-authorization-server/tenant`, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q,"token_endpoint":%q}`, srv.URL+`/tenant`, srv.URL+`/tenant/jwks`, srv.URL+`/tenant/token`)
+	})
+	mux.HandleFunc(`/impostor/.well-known/openid-configuration`, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprintf(w, `{"issuer":%q,"jwks_uri":%q}`, srv.URL, srv.URL+`/jwks`)
+	})
+	mux.HandleFunc(`/jwks`, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprintf(w, jwks, `oidc`)
+	})
+	mux.HandleFunc(`/tenant/jwks`, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprintf(w, jwks, `tenant`)
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := jwk.NewCache(ctx)
+
+	t.Run("OpenID Connect Discovery", func(t *testing.T) {
+		if !assert.NoError(t, c.RegisterIssuer(srv.URL), `c.RegisterIssuer should succeed`) {
+			return
+		}
+		if !assert.True(t, c.IsIssuerRegistered(srv.URL), `c.IsIssuerRegistered should be true`) {
+			return
+		}
+
+		md, err := c.GetIssuerMetadata(ctx, srv.URL)
+		if !assert.NoError(t, err, `c.GetIssuerMetadata should succeed`) {
+			return
+		}
+		if !assert.Equal(t, srv.URL+`/jwks`, md.JWKSURI, `"jwks_uri" should match`) {
+			return
+		}
+		if !assert.Equal(t, []jwa.SignatureAlgorithm{jwa.RS256, jwa.ES256}, md.IDTokenSigningAlgValuesSupported, `"id_token_signing_alg_values_supported" should match`) {
+			return
+		}
+		v, ok := md.Get(`x-custom`)
+		if !assert.True(t, ok, `md.Get should succeed`) {
+			return
+		}
+		if !assert.Equal(t, `foo`, v, `custom field should match`) {
+			return
+		}
+
+		set, err := c.GetIssuer(ctx, srv.URL)
+		if !assert.NoError(t, err, `c.GetIssuer should succeed`) {
+			return
+		}
+		if _, ok := set.LookupKeyID(`oidc`); !assert.True(t, ok, `set should contain the key`) {
+			return
+		}
+		if !assert.True(t, c.IsRegistered(srv.URL+`/jwks`), `"jwks_uri" should be registered`) {
+			return
+		}
+
+		if !assert.NoError(t, c.UnregisterIssuer(srv.URL), `c.UnregisterIssuer should succeed`) {
+			return
+		}
+		if !assert.False(t, c.IsRegistered(srv.URL+`/jwks`), `"jwks_uri" should be unregistered`) {
+			return
+		}
+		if _, err := c.GetIssuer(ctx, srv.URL); !assert.Error(t, err, `c.GetIssuer should fail`) {
+			return
+		}
+	})
+	t.Run("Authorization Server Metadata", func(t *testing.T) {
+		issuer := srv.URL + `/tenant`
+		if !assert.NoError(t, c.RegisterIssuer(issuer, jwk.WithAuthorizationServerMetadata(true)), `c.RegisterIssuer should succeed`) {
+			return
+		}
+
+		md, err := c.GetIssuerMetadata(ctx, issuer)
+		if !assert.NoError(t, err, `c.GetIssuerMetadata should succeed`) {
+			return
+		}
+		if !assert.Equal(t, srv.URL+`/tenant/token`, md.TokenEndpoint, `"token_endpoint" should match`) {
+			return
+		}
+
+		set, err := c.GetIssuer(ctx, issuer)
+		if !assert.NoError(t, err, `c.GetIssuer should succeed`) {
+			return
+		}
+		if _, ok := set.LookupKeyID(`tenant`); !assert.True(t, ok, `set should contain the key`) {
+			return
+		}
+	})
+	t.Run("Issuer mismatch", func(t *testing.T) {
+		issuer := srv.URL + `/impostor`
+		if !assert.NoError(t, c.RegisterIssuer(issuer), `c.RegisterIssuer should succeed`) {
+			return
+		}
+		if _, err := c.GetIssuerMetadata(ctx, issuer); !assert.Error(t, err, `c.GetIssuerMetadata should fail`) {
+			return
+		}
+		if _, err := c.GetIssuer(ctx, issuer); !assert.Error(t, err, `c.GetIssuer should fail`) {
+			return
+		}
+	})
+	t.Run("Invalid issuer", func(t *testing.T) {
+		for _, issuer := range []string{`example.com`, `ftp://example.com`, `https://example.com/?foo=bar`} {
+			if !assert.Error(t, c.RegisterIssuer(issuer), `c.RegisterIssuer should fail for %q`, issuer) {
+				return
+			}
+		}
+	})
+}
+
+func TestCacheRefreshWithMinInterval(t *testing.T) {
+	t.Parallel()
+
+	const jwks = `{"keys":[{"kty":"EC","crv":"P-256","kid":"my-key","x":"SVqB4JcUD6lsfvqMr-OKUNUphdNn64Eay60978ZlL74","y":"lf0u0pMj4lGAzZix5u4Cm5CMQIgMNpkwy163wtKYVKI"}]}`
+
+	var mu sync.Mutex
+	var accessCount int
+	var blocked chan struct{}
+	started := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		accessCount++
+		ch := blocked
+		mu.Unlock()
+		if ch != nil {
+			started <- struct{}{}
+			<-ch
+		}
+		w.Header().Set(`Content-Type`, `application/json`)
+		fmt.Fprint(w, jwks)
+	}))
+	defer srv.Close()
+	getAccessCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return accessCount
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := jwk.NewCache(ctx)
+	if !assert.NoError(t, c.Register(srv.URL), `c.Register should succeed`) {
+		return
+	}
+	if _, err := c.Get(ctx, srv.URL); !assert.NoError(t, err, `c.Get should succeed`) {
+		return
+	}
+
+	// the caller that started the refresh gives up, but the refresh
+	// continues for the other callers
+	release := make(chan struct{})
+	mu.Lock()
+	blocked = release
+	mu.Unlock()
+
+	cctx, ccancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.RefreshWithMinInterval(cctx, srv.URL, time.Hour)
+		errCh <- err
+	}()
+	<-started
+	ccancel()
+	if !assert.ErrorIs(t, <-errCh, context.Canceled, `c.RefreshWithMinInterval should return the context error`) {
+		return
+	}
+
+	setCh := make(chan jwk.Set, 1)
+	go func() {
+		set, err := c.RefreshWithMinInterval(ctx, srv.URL, time.Hour)
+		assert.NoError(t, err, `c.RefreshWithMinInterval should succeed`)
+		setCh <- set
+	}()
+	close(release)
+	if set := <-setCh; !assert.NotNil(t, set, `c.RefreshWithMinInterval should return a set`) {
+		return
+	}
+	if !assert.Equal(t, 2, getAccessCount(), `JWKS should be refreshed once`) {
+		return
+	}
+
+	// within the minimum interval, the cached set is returned
+	mu.Lock()
+	blocked = nil
+	mu.Unlock()
+	set, err := c.RefreshWithMinInterval(ctx, srv.URL, time.Hour)
+	if !assert.NoError(t, err, `c.RefreshWithMinInterval should succeed`) {
+		return
+	}
+	if _, ok := set.LookupKeyID(`my-key`); !assert.True(t, ok, `set should contain the key`) {
+		return
+	}
+	if !assert.Equal(t, 2, getAccessCount(), `JWKS should not be refreshed`) {
+		return
+	}
+
+	if _, err := c.RefreshWithMinInterval(ctx, srv.URL+`/unregistered`, time.Hour); !assert.Error(t, err, `c.RefreshWithMinInterval should fail for unregistered URLs`) {
+		return
+	}
+}
@@ -0,0 +1,574 @@
+package jwk
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v2/ed448"
+	"github.com/lestrrat-go/jwx/v2/internal/ecutil"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
+)
+
+var validationPolicy = struct {
+	mu                    sync.RWMutex
+	minRSAKeySize         int
+	minSymmetricKeyLength int
+}{
+	minRSAKeySize:         2048,
+	minSymmetricKeyLength: 16,
+}
+
+// Settings controls global settings that are specific to JWKs.
+// Only the settings that are specified are changed.
+func Settings(options ...GlobalOption) {
+	validationPolicy.mu.Lock()
+	defer validationPolicy.mu.Unlock()
+
+	//nolint:forcetypeassert
+	for _, option := range options {
+		switch option.Ident() {
+		case identMinRSAKeySize{}:
+			validationPolicy.minRSAKeySize = option.Value().(int)
+		case identMinSymmetricKeyLength{}:
+			validationPolicy.minSymmetricKeyLength = option.Value().(int)
+		}
+	}
+}
+
+func minKeySizes() (int, int) {
+	validationPolicy.mu.RLock()
+	defer validationPolicy.mu.RUnlock()
+	return validationPolicy.minRSAKeySize, validationPolicy.minSymmetricKeyLength
+}
+
+// ValidationError is the type of errors returned by `(jwk.Key).Validate()`.
+// Use `errors.Is()` with `jwk.ErrInvalidKeyMaterial()`, `jwk.ErrKeyTooSmall()`
+// or `jwk.ErrInconsistentKeyUsage()` to determine the kind of the failure.
+type ValidationError interface {
+	error
+	isValidationError()
+}
+
+type validationError struct {
+	kind error
+	err  error
+}
+
+func (e *validationError) isValidationError() {}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *validationError) Unwrap() error {
+	return e.err
+}
+
+func (e *validationError) Is(target error) bool {
+	return target == e.kind
+}
+
+var errInvalidKeyMaterial = errors.New(`invalid key material`)
+var errKeyTooSmall = errors.New(`key too small`)
+var errInconsistentKeyUsage = errors.New(`inconsistent key usage`)
+
+// ErrInvalidKeyMaterial returns the immutable error used when the
+// key material is mathematically inconsistent, such as when the CRT
+// values of an RSA private key do not match its modulus, or when
+// an EC point is not on the declared curve
+func ErrInvalidKeyMaterial() error {
+	return errInvalidKeyMaterial
+}
+
+// ErrKeyTooSmall returns the immutable error used when the key is
+// smaller than the minimum size configured via `jwk.Settings()`,
+// or the size required by the algorithm in the "alg" field
+func ErrKeyTooSmall() error {
+	return errKeyTooSmall
+}
+
+// ErrInconsistentKeyUsage returns the immutable error used when the
+// "use", "key_ops" and "alg" fields contradict each other, or do not
+// match the key type
+func ErrInconsistentKeyUsage() error {
+	return errInconsistentKeyUsage
+}
+
+// IsValidationError returns true if the error is a validation error
+func IsValidationError(err error) bool {
+	var verr ValidationError
+	return errors.As(err, &verr)
+}
+
+func newValidationError(kind error, f string, args ...interface{}) error {
+	return &validationError{kind: kind, err: fmt.Errorf(`jwk: `+f, args...)}
+}
+
+var signatureKeyOps = map[KeyOperation]struct{}{
+	KeyOpSign:   {},
+	KeyOpVerify: {},
+}
+
+var encryptionKeyOps = map[KeyOperation]struct{}{
+	KeyOpEncrypt:    {},
+	KeyOpDecrypt:    {},
+	KeyOpWrapKey:    {},
+	KeyOpUnwrapKey:  {},
+	KeyOpDeriveKey:  {},
+	KeyOpDeriveBits: {},
+}
+
+type algorithmRequirement struct {
+	kty    jwa.KeyType
+	curves []jwa.EllipticCurveAlgorithm
+	use    KeyUsageType
+	// minimum size for symmetric keys (exact size if exactSize is true)
+	size      int
+	exactSize bool
+}
+
+var algorithmRequirements = map[string]algorithmRequirement{
+	jwa.RS256.String():              {kty: jwa.RSA, use: ForSignature},
+	jwa.RS384.String():              {kty: jwa.RSA, use: ForSignature},
+	jwa.RS512.String():              {kty: jwa.RSA, use: ForSignature},
+	jwa.PS256.String():              {kty: jwa.RSA, use: ForSignature},
+	jwa.PS384.String():              {kty: jwa.RSA, use: ForSignature},
+	jwa.PS512.String():              {kty: jwa.RSA, use: ForSignature},
+	jwa.ES256.String():              {kty: jwa.EC, use: ForSignature, curves: []jwa.EllipticCurveAlgorithm{jwa.P256}},
+	jwa.ES384.String():              {kty: jwa.EC, use: ForSignature, curves: []jwa.EllipticCurveAlgorithm{jwa.P384}},
+	jwa.ES512.String():              {kty: jwa.EC, use: ForSignature, curves: []jwa.EllipticCurveAlgorithm{jwa.P521}},
+	jwa.ES256K.String():             {kty: jwa.EC, use: ForSignature, curves: []jwa.EllipticCurveAlgorithm{`secp256k1`}},
+	jwa.EdDSA.String():              {kty: jwa.OKP, use: ForSignature, curves: []jwa.EllipticCurveAlgorithm{jwa.Ed25519, jwa.Ed448}},
+	jwa.HS256.String():              {kty: jwa.OctetSeq, use: ForSignature, size: 32},
+	jwa.HS384.String():              {kty: jwa.OctetSeq, use: ForSignature, size: 48},
+	jwa.HS512.String():              {kty: jwa.OctetSeq, use: ForSignature, size: 64},
+	jwa.RSA1_5.String():             {kty: jwa.RSA, use: ForEncryption},
+	jwa.RSA_OAEP.String():           {kty: jwa.RSA, use: ForEncryption},
+	jwa.RSA_OAEP_256.String():       {kty: jwa.RSA, use: ForEncryption},
+	jwa.A128KW.String():             {kty: jwa.OctetSeq, use: ForEncryption, size: 16, exactSize: true},
+	jwa.A192KW.String():             {kty: jwa.OctetSeq, use: ForEncryption, size: 24, exactSize: true},
+	jwa.A256KW.String():             {kty: jwa.OctetSeq, use: ForEncryption, size: 32, exactSize: true},
+	jwa.A128GCMKW.String():          {kty: jwa.OctetSeq, use: ForEncryption, size: 16, exactSize: true},
+	jwa.A192GCMKW.String():          {kty: jwa.OctetSeq, use: ForEncryption, size: 24, exactSize: true},
+	jwa.A256GCMKW.String():          {kty: jwa.OctetSeq, use: ForEncryption, size: 32, exactSize: true},
+	jwa.DIRECT.String():             {kty: jwa.OctetSeq, use: ForEncryption},
+	jwa.PBES2_HS256_A128KW.String(): {kty: jwa.OctetSeq, use: ForEncryption},
+	jwa.PBES2_HS384_A192KW.String(): {kty: jwa.OctetSeq, use: ForEncryption},
+	jwa.PBES2_HS512_A256KW.String(): {kty: jwa.OctetSeq, use: ForEncryption},
+	jwa.ECDH_ES.String():            {use: ForEncryption},
+	jwa.ECDH_ES_A128KW.String():     {use: ForEncryption},
+	jwa.ECDH_ES_A192KW.String():     {use: ForEncryption},
+	jwa.ECDH_ES_A256KW.String():     {use: ForEncryption},
+}
+
+// validateKeyParameters checks that the "use", "key_ops" and "alg" fields
+// are consistent with each other and with the key type, and returns the
+// requirements of the algorithm, if it is known
+func validateKeyParameters(key Key, crv jwa.EllipticCurveAlgorithm) (*algorithmRequirement, error) {
+	use := KeyUsageType(key.KeyUsage())
+
+	var hasSignatureOps, hasEncryptionOps bool
+	seen := make(map[KeyOperation]struct{})
+	for _, op := range key.KeyOps() {
+		if _, ok := seen[op]; ok {
+			return nil, newValidationError(errInconsistentKeyUsage, `duplicate value %q in %q`, op, KeyOpsKey)
+		}
+		seen[op] = struct{}{}
+
+		if _, ok := signatureKeyOps[op]; ok {
+			hasSignatureOps = true
+		}
+		if _, ok := encryptionKeyOps[op]; ok {
+			hasEncryptionOps = true
+		}
+	}
+
+	if hasSignatureOps && hasEncryptionOps {
+		return nil, newValidationError(errInconsistentKeyUsage, `%q contains both signature and encryption operations`, KeyOpsKey)
+	}
+	if use == ForSignature && hasEncryptionOps {
+		return nil, newValidationError(errInconsistentKeyUsage, `%q is %q, but %q contains encryption operations`, KeyUsageKey, use, KeyOpsKey)
+	}
+	if use == ForEncryption && hasSignatureOps {
+		return nil, newValidationError(errInconsistentKeyUsage, `%q is %q, but %q contains signature operations`, KeyUsageKey, use, KeyOpsKey)
+	}
+
+	alg := key.Algorithm()
+	if alg == nil || alg.String() == "" {
+		return nil, nil
+	}
+	req, ok := algorithmRequirements[alg.String()]
+	if !ok {
+		return nil, nil
+	}
+
+	if use != "" && use != req.use {
+		return nil, newValidationError(errInconsistentKeyUsage, `%q is %q, but %q is %q`, KeyUsageKey, use, AlgorithmKey, alg)
+	}
+	if (req.use == ForSignature && hasEncryptionOps) || (req.use == ForEncryption && hasSignatureOps) {
+		return nil, newValidationError(errInconsistentKeyUsage, `%q contains operations that cannot be performed by %q`, KeyOpsKey, alg)
+	}
+
+	kty := key.KeyType()
+	if req.kty == "" {
+		// ECDH-ES family accepts EC keys and OKP keys for key agreement
+		if kty != jwa.EC && !(kty == jwa.OKP && (crv == jwa.X25519 || crv == jwa.X448)) {
+			return nil, newValidationError(errInconsistentKeyUsage, `%q cannot be used with %s key (crv = %q)`, alg, kty, crv)
+		}
+	} else if kty != req.kty {
+		return nil, newValidationError(errInconsistentKeyUsage, `%q cannot be used with %s key`, alg, kty)
+	}
+
+	if len(req.curves) > 0 {
+		var found bool
+		for _, v := range req.curves {
+			if v == crv {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, newValidationError(errInconsistentKeyUsage, `%q cannot be used with curve %q`, alg, crv)
+		}
+	}
+	return &req, nil
+}
+
+// Validate checks the consistency of the RSA public key
+func (k *rsaPublicKey) Validate() error {
+	if _, err := validateKeyParameters(k, ""); err != nil {
+		return err
+	}
+	_, err := validateRSAPublicKey(k.N(), k.E())
+	return err
+}
+
+// Validate checks the consistency of the RSA private key. The
+// CRT values ("dp", "dq" and "qi"), if present, are checked against
+// the primes and the private exponent.
+func (k *rsaPrivateKey) Validate() error {
+	if _, err := validateKeyParameters(k, ""); err != nil {
+		return err
+	}
+
+	pubkey, err := validateRSAPublicKey(k.N(), k.E())
+	if err != nil {
+		return err
+	}
+
+	if len(k.D()) == 0 {
+		return newValidationError(errInvalidKeyMaterial, `required field "d" is missing`)
+	}
+	d := new(big.Int).SetBytes(k.D())
+	if d.Sign() <= 0 || d.Cmp(pubkey.N) >= 0 {
+		return newValidationError(errInvalidKeyMaterial, `"d" is out of range`)
+	}
+
+	// RFC7518 section 6.3.2: if any of the optional private parameters
+	// are present, all of them must be present
+	optional := []struct {
+		name  string
+		value []byte
+	}{
+		{RSAPKey, k.P()},
+		{RSAQKey, k.Q()},
+		{RSADPKey, k.DP()},
+		{RSADQKey, k.DQ()},
+		{RSAQIKey, k.QI()},
+	}
+	var missing []string
+	for _, v := range optional {
+		if len(v.value) == 0 {
+			missing = append(missing, v.name)
+		}
+	}
+
+	if len(missing) == len(optional) {
+		// without the primes, the best we can do is to make sure that
+		// "d" is the inverse of "e" by round-tripping a value
+		m := big.NewInt(2)
+		c := new(big.Int).Exp(m, big.NewInt(int64(pubkey.E)), pubkey.N)
+		if new(big.Int).Exp(c, d, pubkey.N).Cmp(m) != 0 {
+			return newValidationError(errInvalidKeyMaterial, `"d" does not match "n" and "e"`)
+		}
+		return nil
+	}
+
+	if len(missing) > 0 {
+		return newValidationError(errInvalidKeyMaterial, `%q is missing, while other private key parameters are present`, missing[0])
+	}
+
+	p := new(big.Int).SetBytes(k.P())
+	q := new(big.Int).SetBytes(k.Q())
+	raw := rsa.PrivateKey{
+		PublicKey: *pubkey,
+		D:         d,
+		Primes:    []*big.Int{p, q},
+	}
+	if err := raw.Validate(); err != nil {
+		return newValidationError(errInvalidKeyMaterial, `inconsistent private key: %s`, err)
+	}
+
+	one := big.NewInt(1)
+	dp := new(big.Int).Mod(d, new(big.Int).Sub(p, one))
+	if dp.Cmp(new(big.Int).SetBytes(k.DP())) != 0 {
+		return newValidationError(errInvalidKeyMaterial, `%q does not match "d" and "p"`, RSADPKey)
+	}
+	dq := new(big.Int).Mod(d, new(big.Int).Sub(q, one))
+	if dq.Cmp(new(big.Int).SetBytes(k.DQ())) != 0 {
+		return newValidationError(errInvalidKeyMaterial, `%q does not match "d" and "q"`, RSADQKey)
+	}
+	qi := new(big.Int).SetBytes(k.QI())
+	if new(big.Int).Mod(new(big.Int).Mul(qi, q), p).Cmp(one) != 0 {
+		return newValidationError(errInvalidKeyMaterial, `%q is not the inverse of "q" modulo "p"`, RSAQIKey)
+	}
+	return nil
+}
+
+func validateRSAPublicKey(n, e []byte) (*rsa.PublicKey, error) {
+	if len(n) == 0 {
+		return nil, newValidationError(errInvalidKeyMaterial, `required field "n" is missing`)
+	}
+	if len(e) == 0 {
+		return nil, newValidationError(errInvalidKeyMaterial, `required field "e" is missing`)
+	}
+
+	bn := new(big.Int).SetBytes(n)
+	if bn.Bit(0) == 0 {
+		return nil, newValidationError(errInvalidKeyMaterial, `"n" must be odd`)
+	}
+
+	be := new(big.Int).SetBytes(e)
+	if !be.IsInt64() || be.Int64() < 3 || be.Int64() > 1<<31-1 || be.Bit(0) == 0 {
+		return nil, newValidationError(errInvalidKeyMaterial, `"e" must be an odd number between 3 and 2^31-1`)
+	}
+
+	minRSAKeySize, _ := minKeySizes()
+	if size := bn.BitLen(); size < minRSAKeySize {
+		return nil, newValidationError(errKeyTooSmall, `RSA key size %d is smaller than the minimum %d`, size, minRSAKeySize)
+	}
+
+	return &rsa.PublicKey{N: bn, E: int(be.Int64())}, nil
+}
+
+// Validate checks that the point of the EC public key is on its curve
+func (k *ecdsaPublicKey) Validate() error {
+	if _, err := validateKeyParameters(k, k.Crv()); err != nil {
+		return err
+	}
+	return validateECPoint(k.Crv(), k.X(), k.Y(), nil)
+}
+
+// Validate checks that the point of the EC private key is on its curve,
+// and that it matches the private key
+func (k *ecdsaPrivateKey) Validate() error {
+	if _, err := validateKeyParameters(k, k.Crv()); err != nil {
+		return err
+	}
+	if len(k.D()) == 0 {
+		return newValidationError(errInvalidKeyMaterial, `required field "d" is missing`)
+	}
+	return validateECPoint(k.Crv(), k.X(), k.Y(), k.D())
+}
+
+func validateECPoint(alg jwa.EllipticCurveAlgorithm, x, y, d []byte) error {
+	crv, ok := ecutil.CurveForAlgorithm(alg)
+	if !ok {
+		return newValidationError(errInvalidKeyMaterial, `unsupported curve %q`, alg)
+	}
+	if len(x) == 0 || len(y) == 0 {
+		return newValidationError(errInvalidKeyMaterial, `required fields "x" and "y" must be present`)
+	}
+
+	bx := new(big.Int).SetBytes(x)
+	by := new(big.Int).SetBytes(y)
+	if !crv.IsOnCurve(bx, by) {
+		return newValidationError(errInvalidKeyMaterial, `point is not on curve %q`, alg)
+	}
+
+	if d == nil {
+		return nil
+	}
+
+	bd := new(big.Int).SetBytes(d)
+	if bd.Sign() <= 0 || bd.Cmp(crv.Params().N) >= 0 {
+		return newValidationError(errInvalidKeyMaterial, `"d" is out of range`)
+	}
+	px, py := crv.ScalarBaseMult(d)
+	if px.Cmp(bx) != 0 || py.Cmp(by) != 0 {
+		return newValidationError(errInvalidKeyMaterial, `"d" does not match "x" and "y"`)
+	}
+	return nil
+}
+
+// Validate checks that the OKP public key has the correct size for its curve
+func (k *okpPublicKey) Validate() error {
+	if _, err := validateKeyParameters(k, k.Crv()); err != nil {
+		return err
+	}
+	return validateOKPKey(k.Crv(), k.X(), nil)
+}
+
+// Validate checks that the OKP private key has the correct size for its
+// curve, and that it matches the public key
+func (k *okpPrivateKey) Validate() error {
+	if _, err := validateKeyParameters(k, k.Crv()); err != nil {
+		return err
+	}
+	if len(k.D()) == 0 {
+		return newValidationError(errInvalidKeyMaterial, `required field "d" is missing`)
+	}
+	return validateOKPKey(k.Crv(), k.X(), k.D())
+}
+
+func validateOKPKey(crv jwa.EllipticCurveAlgorithm, x, d []byte) error {
+	var size, seedSize int
+	switch crv {
+	case jwa.Ed25519:
+		size, seedSize = ed25519.PublicKeySize, ed25519.SeedSize
+	case jwa.X25519:
+		size, seedSize = x25519.PublicKeySize, x25519.SeedSize
+	case jwa.Ed448:
+		size, seedSize = ed448.PublicKeySize, ed448.SeedSize
+	case jwa.X448:
+		size, seedSize = x448.PublicKeySize, x448.SeedSize
+	default:
+		return newValidationError(errInvalidKeyMaterial, `unsupported curve %q`, crv)
+	}
+
+	if len(x) != size {
+		return newValidationError(errInvalidKeyMaterial, `"x" must be %d bytes for curve %q`, size, crv)
+	}
+	if d == nil {
+		return nil
+	}
+	if len(d) != seedSize {
+		return newValidationError(errInvalidKeyMaterial, `"d" must be %d bytes for curve %q`, seedSize, crv)
+	}
+
+	var pub []byte
+	switch crv {
+	case jwa.Ed25519:
+		pub = ed25519.NewKeyFromSeed(d).Public().(ed25519.PublicKey) //nolint:forcetypeassert
+	case jwa.X25519:
+		key, err := x25519.NewKeyFromSeed(d)
+		if err != nil {
+			return newValidationError(errInvalidKeyMaterial, `invalid "d": %s`, err)
+		}
+		pub = key.Public().(x25519.PublicKey) //nolint:forcetypeassert
+	case jwa.Ed448:
+		key, err := ed448.NewKeyFromSeed(d)
+		if err != nil {
+			return newValidationError(errInvalidKeyMaterial, `invalid "d": %s`, err)
+		}
+		pub = key.Public().(ed448.PublicKey) //nolint:forcetypeassert
+	case jwa.X448:
+		key, err := x448.NewKeyFromSeed(d)
+		if err != nil {
+			return newValidationError(errInvalidKeyMaterial, `invalid "d": %s`, err)
+		}
+		pub = key.Public().(x448.PublicKey) //nolint:forcetypeassert
+	}
+
+	if !bytes.Equal(pub, x) {
+		return newValidationError(errInvalidKeyMaterial, `"d" does not match "x"`)
+	}
+	return nil
+}
+
+// Validate checks that the symmetric key is at least as long as the
+// minimum length configured via `jwk.Settings()`, and that it has the
+// size required by the algorithm in the "alg" field
+func (k *symmetricKey) Validate() error {
+	req, err := validateKeyParameters(k, "")
+	if err != nil {
+		return err
+	}
+
+	size := len(k.Octets())
+	if size == 0 {
+		return newValidationError(errInvalidKeyMaterial, `required field "k" is missing`)
+	}
+
+	if req != nil && req.size > 0 {
+		if req.exactSize {
+			if size != req.size {
+				return newValidationError(errInvalidKeyMaterial, `%q requires a key of %d bytes (got %d)`, k.Algorithm(), req.size, size)
+			}
+			return nil
+		}
+		if size < req.size {
+			return newValidationError(errKeyTooSmall, `%q requires a key of at least %d bytes (got %d)`, k.Algorithm(), req.size, size)
+		}
+	}
+
+	_, minSymmetricKeyLength := minKeySizes()
+	if size < minSymmetricKeyLength {
+		return newValidationError(errKeyTooSmall, `symmetric key length %d is smaller than the minimum %d`, size, minSymmetricKeyLength)
+	}
+	return nil
+}
+
+var errKeyOperationNotAllowed = errors.New(`key operation not allowed`)
+
+// ErrKeyOperationNotAllowed returns the immutable error used when the
+// "use", "key_ops" or "alg" fields of a key do not allow it to be used
+// for the requested operation. See `jwk.CheckKeyUsage()`
+func ErrKeyOperationNotAllowed() error {
+	return errKeyOperationNotAllowed
+}
+
+// CheckKeyUsage checks that the metadata of `key` allows it to be used
+// with the algorithm `alg` for any of the operations in `ops`. Fields that
+// are not present in the key are not checked.
+//
+//   - "use" must be "sig" for "sign" and "verify", and "enc" for other operations
+//   - "key_ops" must contain at least one of `ops`
+//   - "alg" must be the same as `alg`
+//
+// The returned error satisfies `errors.Is(err, jwk.ErrKeyOperationNotAllowed())`.
+// This function is used by the `jws` and `jwe` packages when key usage
+// checks are enabled.
+func CheckKeyUsage(key Key, alg jwa.KeyAlgorithm, ops ...KeyOperation) error {
+	if len(ops) == 0 {
+		return fmt.Errorf(`jwk.CheckKeyUsage: at least one operation must be specified`)
+	}
+
+	if use := key.KeyUsage(); use != "" {
+		expected := ForEncryption
+		if _, ok := signatureKeyOps[ops[0]]; ok {
+			expected = ForSignature
+		}
+		if use != expected.String() {
+			return fmt.Errorf(`%w: key with %q = %q cannot be used to %s`, errKeyOperationNotAllowed, KeyUsageKey, use, ops[0])
+		}
+	}
+
+	if keyOps := key.KeyOps(); len(keyOps) > 0 {
+		var found bool
+		for _, op := range ops {
+			for _, keyOp := range keyOps {
+				if op == keyOp {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf(`%w: key with %q = %v cannot be used to %s`, errKeyOperationNotAllowed, KeyOpsKey, keyOps, ops[0])
+		}
+	}
+
+	if keyAlg := key.Algorithm(); keyAlg != nil && keyAlg.String() != "" && alg != nil {
+		if keyAlg.String() != alg.String() {
+			return fmt.Errorf(`%w: key with %q = %q cannot be used with algorithm %q`, errKeyOperationNotAllowed, AlgorithmKey, keyAlg, alg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,313 @@
+package jwk_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	rsaKey, err := jwk.Generate(jwa.RSA)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	ecKey, err := jwk.Generate(jwa.EC)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	otherECKey, err := jwk.Generate(jwa.EC)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	okpKey, err := jwk.Generate(jwa.OKP)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	otherOKPKey, err := jwk.Generate(jwa.OKP)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+
+	t.Run("Valid keys", func(t *testing.T) {
+		keys := []jwk.Key{rsaKey, ecKey, okpKey}
+		for _, crv := range []jwa.EllipticCurveAlgorithm{jwa.P384, jwa.P521} {
+			key, err := jwk.Generate(jwa.EC, jwk.WithCurve(crv))
+			if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+				return
+			}
+			keys = append(keys, key)
+		}
+		for _, crv := range []jwa.EllipticCurveAlgorithm{jwa.X25519, jwa.Ed448, jwa.X448} {
+			key, err := jwk.Generate(jwa.OKP, jwk.WithCurve(crv))
+			if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+				return
+			}
+			keys = append(keys, key)
+		}
+		symmetricKey, err := jwk.Generate(jwa.OctetSeq, jwk.WithAlgorithm(jwa.HS256), jwk.WithKeyUsage(jwk.ForSignature))
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+		keys = append(keys, symmetricKey)
+
+		for _, key := range keys {
+			if !assert.NoError(t, key.Validate(), `key.Validate should succeed`) {
+				return
+			}
+
+			pubkey, err := key.PublicKey()
+			if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+				return
+			}
+			if !assert.NoError(t, pubkey.Validate(), `pubkey.Validate should succeed`) {
+				return
+			}
+		}
+	})
+
+	testcases := []struct {
+		Name  string
+		Key   func() (jwk.Key, error)
+		Error error
+	}{
+		{
+			Name: "RSA with mismatched dp",
+			Key: func() (jwk.Key, error) {
+				key, err := rsaKey.Clone()
+				if err != nil {
+					return nil, err
+				}
+				dp := append([]byte(nil), key.(jwk.RSAPrivateKey).DP()...)
+				dp[len(dp)-1] ^= 0x01
+				return key, key.Set(jwk.RSADPKey, dp)
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "RSA with mismatched qi",
+			Key: func() (jwk.Key, error) {
+				key, err := rsaKey.Clone()
+				if err != nil {
+					return nil, err
+				}
+				qi := append([]byte(nil), key.(jwk.RSAPrivateKey).QI()...)
+				qi[len(qi)-1] ^= 0x01
+				return key, key.Set(jwk.RSAQIKey, qi)
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "RSA with mismatched d",
+			Key: func() (jwk.Key, error) {
+				key, err := rsaKey.Clone()
+				if err != nil {
+					return nil, err
+				}
+				d := append([]byte(nil), key.(jwk.RSAPrivateKey).D()...)
+				d[len(d)-1] ^= 0x02
+				return key, key.Set(jwk.RSADKey, d)
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "RSA with missing q",
+			Key: func() (jwk.Key, error) {
+				key, err := rsaKey.Clone()
+				if err != nil {
+					return nil, err
+				}
+				return key, key.Remove(jwk.RSAQKey)
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "RSA 1024",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.RSA, jwk.WithRSAKeySize(1024))
+			},
+			Error: jwk.ErrKeyTooSmall(),
+		},
+		{
+			Name: "EC point not on curve",
+			Key: func() (jwk.Key, error) {
+				key, err := ecKey.PublicKey()
+				if err != nil {
+					return nil, err
+				}
+				y := append([]byte(nil), key.(jwk.ECDSAPublicKey).Y()...)
+				y[len(y)-1] ^= 0x01
+				return key, key.Set(jwk.ECDSAYKey, y)
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "EC with mismatched d",
+			Key: func() (jwk.Key, error) {
+				key, err := ecKey.Clone()
+				if err != nil {
+					return nil, err
+				}
+				return key, key.Set(jwk.ECDSADKey, otherECKey.(jwk.ECDSAPrivateKey).D())
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "OKP with mismatched d",
+			Key: func() (jwk.Key, error) {
+				key, err := okpKey.Clone()
+				if err != nil {
+					return nil, err
+				}
+				return key, key.Set(jwk.OKPDKey, otherOKPKey.(jwk.OKPPrivateKey).D())
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "Short symmetric key",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.OctetSeq, jwk.WithSymmetricKeyLength(8))
+			},
+			Error: jwk.ErrKeyTooSmall(),
+		},
+		{
+			Name: "Short HMAC key",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.OctetSeq, jwk.WithSymmetricKeyLength(32), jwk.WithAlgorithm(jwa.HS512))
+			},
+			Error: jwk.ErrKeyTooSmall(),
+		},
+		{
+			Name: "AES key wrap with wrong size",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.OctetSeq, jwk.WithSymmetricKeyLength(32), jwk.WithAlgorithm(jwa.A128KW))
+			},
+			Error: jwk.ErrInvalidKeyMaterial(),
+		},
+		{
+			Name: "use=sig with encryption key_ops",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.EC, jwk.WithKeyUsage(jwk.ForSignature), jwk.WithKeyOps(jwk.KeyOpEncrypt))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+		{
+			Name: "Signature and encryption key_ops",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.EC, jwk.WithKeyOps(jwk.KeyOpSign, jwk.KeyOpWrapKey))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+		{
+			Name: "Duplicate key_ops",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.EC, jwk.WithKeyOps(jwk.KeyOpSign, jwk.KeyOpSign))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+		{
+			Name: "use=enc with signature algorithm",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.EC, jwk.WithKeyUsage(jwk.ForEncryption), jwk.WithAlgorithm(jwa.ES256))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+		{
+			Name: "Algorithm for another key type",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.EC, jwk.WithAlgorithm(jwa.RS256))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+		{
+			Name: "Algorithm for another curve",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.EC, jwk.WithAlgorithm(jwa.ES384))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+		{
+			Name: "ECDH-ES with Ed25519",
+			Key: func() (jwk.Key, error) {
+				return jwk.Generate(jwa.OKP, jwk.WithAlgorithm(jwa.ECDH_ES))
+			},
+			Error: jwk.ErrInconsistentKeyUsage(),
+		},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			key, err := tc.Key()
+			if !assert.NoError(t, err, `creating the key should succeed`) {
+				return
+			}
+
+			err = key.Validate()
+			if !assert.Error(t, err, `key.Validate should fail`) {
+				return
+			}
+			if !assert.True(t, errors.Is(err, tc.Error), `error should be %q (got %q)`, tc.Error, err) {
+				return
+			}
+			if !assert.True(t, jwk.IsValidationError(err), `error should be a validation error`) {
+				return
+			}
+		})
+	}
+
+	t.Run("Settings", func(t *testing.T) {
+		key, err := jwk.Generate(jwa.RSA, jwk.WithRSAKeySize(1024))
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+
+		jwk.Settings(jwk.WithMinRSAKeySize(1024))
+		defer jwk.Settings(jwk.WithMinRSAKeySize(2048))
+		if !assert.NoError(t, key.Validate(), `key.Validate should succeed with a lower minimum`) {
+			return
+		}
+	})
+	t.Run("WithValidate", func(t *testing.T) {
+		valid, err := jwk.Generate(jwa.OctetSeq)
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+		validJSON, err := json.Marshal(valid)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		invalidJSON := []byte(`{"kty":"oct","k":"c2hvcnQ"}`)
+
+		_, err = jwk.ParseKey(invalidJSON)
+		if !assert.NoError(t, err, `jwk.ParseKey should succeed without jwk.WithValidate`) {
+			return
+		}
+		_, err = jwk.ParseKey(invalidJSON, jwk.WithValidate(true))
+		if !assert.True(t, errors.Is(err, jwk.ErrKeyTooSmall()), `jwk.ParseKey should fail with jwk.WithValidate`) {
+			return
+		}
+		_, err = jwk.ParseKey(validJSON, jwk.WithValidate(true))
+		if !assert.NoError(t, err, `jwk.ParseKey should succeed for valid keys`) {
+			return
+		}
+
+		setJSON := []byte(fmt.Sprintf(`{"keys":[%s,%s]}`, validJSON, invalidJSON))
+		_, err = jwk.Parse(setJSON, jwk.WithValidate(true))
+		if !assert.Error(t, err, `jwk.Parse should fail with jwk.WithValidate`) {
+			return
+		}
+
+		set, err := jwk.Parse(setJSON, jwk.WithValidate(true), jwk.WithIgnoreParseError(true))
+		if !assert.NoError(t, err, `jwk.Parse should succeed with jwk.WithIgnoreParseError`) {
+			return
+		}
+		if !assert.Equal(t, 1, set.Len(), `invalid keys should be removed`) {
+			return
+		}
+	})
+}
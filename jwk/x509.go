@@ -0,0 +1,134 @@
+package jwk
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/cert"
+	"github.com/lestrrat-go/jwx/v2/internal/base64"
+)
+
+// ValidateX509 validates the certificate chain in the "x5c" field of `key`.
+//
+// The first certificate in the chain must be the certificate of `key`,
+// and it must chain up to one of the certificates in `roots`, using the
+// rest of the certificates in the chain as intermediates. `roots` must not
+// be nil: to trust the system certificate pool, pass the result of
+// `x509.SystemCertPool()` explicitly.
+//
+// In addition to the verification performed by `(*x509.Certificate).Verify()`,
+// which includes the validity period, extended key usages and name
+// constraints, the following are checked:
+//
+//   - The key usage of the leaf certificate (see `jwk.WithX509KeyUsage()`)
+//   - The public key of the leaf certificate matches the key material of `key`
+//   - The "x5t" and "x5t#S256" fields, if present, match the leaf certificate
+//
+// The extended key usages that the leaf certificate must be valid for must
+// be specified using `jwk.WithX509ExtKeyUsage()`, as there is no extended
+// key usage that is specific to JOSE. Pass `x509.ExtKeyUsageAny` if
+// any extended key usage is acceptable. Use `jwk.WithClock()` to specify
+// the time at which the certificates should be valid.
+//
+// Upon success, the verified chain from the leaf certificate to the root
+// certificate is returned.
+func ValidateX509(key Key, roots *x509.CertPool, options ...ValidateX509Option) ([]*x509.Certificate, error) {
+	if roots == nil {
+		return nil, fmt.Errorf(`jwk.ValidateX509: roots must not be nil`)
+	}
+
+	var clock Clock = ClockFunc(time.Now)
+	var extKeyUsages []x509.ExtKeyUsage
+	keyUsage := x509.KeyUsageDigitalSignature
+	for _, option := range options {
+		//nolint:forcetypeassert
+		switch option.Ident() {
+		case identClock{}:
+			clock = option.Value().(Clock)
+		case identX509ExtKeyUsage{}:
+			extKeyUsages = option.Value().([]x509.ExtKeyUsage)
+		case identX509KeyUsage{}:
+			keyUsage = option.Value().(x509.KeyUsage)
+		}
+	}
+
+	if len(extKeyUsages) == 0 {
+		return nil, fmt.Errorf(`jwk.ValidateX509: extended key usages must be specified using jwk.WithX509ExtKeyUsage()`)
+	}
+
+	chain := key.X509CertChain()
+	if chain == nil || chain.Len() == 0 {
+		return nil, fmt.Errorf(`jwk.ValidateX509: %q field is empty`, X509CertChainKey)
+	}
+
+	certs := make([]*x509.Certificate, chain.Len())
+	for i := range certs {
+		der, _ := chain.Get(i)
+		c, err := cert.Parse(der)
+		if err != nil {
+			return nil, fmt.Errorf(`jwk.ValidateX509: failed to parse certificate #%d: %w`, i, err)
+		}
+		certs[i] = c
+	}
+
+	leaf := certs[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   clock.Now(),
+		KeyUsages:     extKeyUsages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf(`jwk.ValidateX509: failed to verify certificate chain: %w`, err)
+	}
+
+	// x509.Verify does not check the key usage extension
+	if leaf.KeyUsage != 0 && leaf.KeyUsage&keyUsage != keyUsage {
+		return nil, fmt.Errorf(`jwk.ValidateX509: leaf certificate does not allow the required key usage`)
+	}
+
+	pubkey, err := PublicRawKeyOf(key)
+	if err != nil {
+		return nil, fmt.Errorf(`jwk.ValidateX509: failed to get public key: %w`, err)
+	}
+	eq, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !eq.Equal(pubkey) {
+		return nil, fmt.Errorf(`jwk.ValidateX509: public key of leaf certificate does not match the key`)
+	}
+
+	sha1sum := sha1.Sum(leaf.Raw) //nolint:gosec
+	if err := checkX509Thumbprint(X509CertThumbprintKey, key.X509CertThumbprint(), sha1sum[:]); err != nil {
+		return nil, err
+	}
+	sha256sum := sha256.Sum256(leaf.Raw)
+	if err := checkX509Thumbprint(X509CertThumbprintS256Key, key.X509CertThumbprintS256(), sha256sum[:]); err != nil {
+		return nil, err
+	}
+
+	return chains[0], nil
+}
+
+func checkX509Thumbprint(name, value string, expected []byte) error {
+	if value == "" {
+		return nil
+	}
+
+	decoded, err := base64.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf(`jwk.ValidateX509: failed to decode %q: %w`, name, err)
+	}
+	if !bytes.Equal(decoded, expected) {
+		return fmt.Errorf(`jwk.ValidateX509: %q does not match the leaf certificate`, name)
+	}
+	return nil
+}
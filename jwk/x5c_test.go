@@ -1,10 +1,20 @@
 package jwk_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/lestrrat-go/jwx/v2/cert"
+	"github.com/lestrrat-go/jwx/v2/internal/base64"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/internal/jwxtest"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -47,3 +57,154 @@ func Test_X5CHeader(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateX509(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+		if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+			t.FailNow()
+		}
+		return key
+	}
+	var serial int64
+	newCert := func(template *x509.Certificate, parent *x509.Certificate, key *ecdsa.PrivateKey, parentKey *ecdsa.PrivateKey) *x509.Certificate {
+		serial++
+		template.SerialNumber = big.NewInt(serial)
+		if template.NotBefore.IsZero() {
+			template.NotBefore = now.Add(-time.Hour)
+		}
+		if template.NotAfter.IsZero() {
+			template.NotAfter = now.Add(time.Hour)
+		}
+		c, err := jwxtest.CreateCertificate(template, parent, &key.PublicKey, parentKey)
+		if !assert.NoError(t, err, `jwxtest.CreateCertificate should succeed`) {
+			t.FailNow()
+		}
+		return c
+	}
+
+	rootKey := newKey()
+	root := newCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: `Root CA`},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, rootKey, rootKey)
+
+	intermediateKey := newKey()
+	intermediate := newCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: `Intermediate CA`},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		PermittedDNSDomains:   []string{`example.com`},
+	}, root, intermediateKey, rootKey)
+
+	leafKey := newKey()
+	newLeaf := func(template *x509.Certificate) *x509.Certificate {
+		template.Subject = pkix.Name{CommonName: `signer`}
+		if template.DNSNames == nil {
+			template.DNSNames = []string{`signer.example.com`}
+		}
+		if template.KeyUsage == 0 {
+			template.KeyUsage = x509.KeyUsageDigitalSignature
+		}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		return newCert(template, intermediate, leafKey, intermediateKey)
+	}
+	leaf := newLeaf(&x509.Certificate{})
+
+	newJwk := func(key *ecdsa.PrivateKey, certs ...*x509.Certificate) jwk.Key {
+		k, err := jwk.FromRaw(&key.PublicKey)
+		if !assert.NoError(t, err, `jwk.FromRaw should succeed`) {
+			t.FailNow()
+		}
+		var chain cert.Chain
+		for _, c := range certs {
+			b64, _ := cert.EncodeBase64(c.Raw)
+			_ = chain.Add(b64)
+		}
+		_ = k.Set(jwk.X509CertChainKey, &chain)
+		return k
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	t.Run("Valid chain", func(t *testing.T) {
+		t.Parallel()
+		key := newJwk(leafKey, leaf, intermediate)
+		sum := sha256.Sum256(leaf.Raw)
+		_ = key.Set(jwk.X509CertThumbprintS256Key, base64.EncodeToString(sum[:]))
+
+		chain, err := jwk.ValidateX509(key, roots, jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageClientAuth))
+		if !assert.NoError(t, err, `jwk.ValidateX509 should succeed`) {
+			return
+		}
+		if !assert.Len(t, chain, 3, `verified chain should contain 3 certificates`) {
+			return
+		}
+		if !assert.True(t, chain[2].Equal(root), `verified chain should end with the root`) {
+			return
+		}
+	})
+	t.Run("Invalid chains", func(t *testing.T) {
+		t.Parallel()
+
+		wrongThumbprint := newJwk(leafKey, leaf, intermediate)
+		sum := sha256.Sum256(intermediate.Raw)
+		_ = wrongThumbprint.Set(jwk.X509CertThumbprintS256Key, base64.EncodeToString(sum[:]))
+
+		testcases := []struct {
+			Name    string
+			Key     jwk.Key
+			Roots   *x509.CertPool
+			Options []jwk.ValidateX509Option
+		}{
+			{Name: "No x5c", Key: newJwk(leafKey)},
+			{Name: "Untrusted root", Key: newJwk(leafKey, leaf, intermediate), Roots: x509.NewCertPool()},
+			{Name: "Missing intermediate", Key: newJwk(leafKey, leaf)},
+			{Name: "Key mismatch", Key: newJwk(newKey(), leaf, intermediate)},
+			{Name: "Thumbprint mismatch", Key: wrongThumbprint},
+			{Name: "Expired", Key: newJwk(leafKey, leaf, intermediate), Options: []jwk.ValidateX509Option{jwk.WithClock(jwk.ClockFunc(func() time.Time { return now.Add(2 * time.Hour) }))}},
+			{Name: "Extended key usage", Key: newJwk(leafKey, leaf, intermediate), Options: []jwk.ValidateX509Option{jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageServerAuth)}},
+			{Name: "Key usage", Key: newJwk(leafKey, newLeaf(&x509.Certificate{KeyUsage: x509.KeyUsageKeyEncipherment}), intermediate)},
+			{Name: "Name constraints", Key: newJwk(leafKey, newLeaf(&x509.Certificate{DNSNames: []string{`signer.example.org`}}), intermediate)},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				t.Parallel()
+				r := tc.Roots
+				if r == nil {
+					r = roots
+				}
+				options := append([]jwk.ValidateX509Option{jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageClientAuth)}, tc.Options...)
+				_, err := jwk.ValidateX509(tc.Key, r, options...)
+				if !assert.Error(t, err, `jwk.ValidateX509 should fail`) {
+					return
+				}
+			})
+		}
+	})
+	t.Run("Required parameters", func(t *testing.T) {
+		t.Parallel()
+		key := newJwk(leafKey, leaf, intermediate)
+
+		_, err := jwk.ValidateX509(key, nil, jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageClientAuth))
+		if !assert.Error(t, err, `jwk.ValidateX509 should fail without roots`) {
+			return
+		}
+		_, err = jwk.ValidateX509(key, roots)
+		if !assert.Error(t, err, `jwk.ValidateX509 should fail without extended key usages`) {
+			return
+		}
+		_, err = jwk.ValidateX509(key, roots, jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageAny))
+		if !assert.NoError(t, err, `jwk.ValidateX509 should succeed with x509.ExtKeyUsageAny`) {
+			return
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"encoding/asn1"
 	"fmt"
+	"hash"
 	"math/big"
 
 	"github.com/lestrrat-go/jwx/v2/internal/keyconv"
@@ -53,14 +54,21 @@ func (es ecdsaSigner) Algorithm() jwa.SignatureAlgorithm {
 }
 
 func (es *ecdsaSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
-	if key == nil {
-		return nil, fmt.Errorf(`missing private key while signing payload`)
-	}
-
 	h := es.hash.New()
 	if _, err := h.Write(payload); err != nil {
 		return nil, fmt.Errorf(`failed to write payload using ecdsa: %w`, err)
 	}
+	return es.signHash(h, key)
+}
+
+func (es *ecdsaSigner) newHash(_ interface{}) (hash.Hash, error) {
+	return es.hash.New(), nil
+}
+
+func (es *ecdsaSigner) signHash(h hash.Hash, key interface{}) ([]byte, error) {
+	if key == nil {
+		return nil, fmt.Errorf(`missing private key while signing payload`)
+	}
 
 	signer, ok := key.(crypto.Signer)
 	if ok {
@@ -75,6 +83,15 @@ func (es *ecdsaSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 	var r, s *big.Int
 	var curveBits int
 	if ok {
+		// When we use the crypto.Signer interface, the PrivateKey is
+		// hidden. But we need some information about the key: we need
+		// to make sure that it's an ECDSA key, and we need its bit size.
+		pubkey, ok := signer.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf(`expected crypto.Signer.Public() to return *ecdsa.PublicKey, but got %T`, signer.Public())
+		}
+		curveBits = pubkey.Curve.Params().BitSize
+
 		signed, err := signer.Sign(rand.Reader, h.Sum(nil), es.hash)
 		if err != nil {
 			return nil, err
@@ -88,20 +105,6 @@ func (es *ecdsaSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 			return nil, fmt.Errorf(`failed to unmarshal ASN1 encoded signature: %w`, err)
 		}
 
-		// Okay, this is silly, but hear me out. When we use the
-		// crypto.Signer interface, the PrivateKey is hidden.
-		// But we need some information about the key (it's bit size).
-		//
-		// So while silly, we're going to have to make another call
-		// here and fetch the Public key.
-		// This probably means that this should be cached some where.
-		cpub := signer.Public()
-		pubkey, ok := cpub.(*ecdsa.PublicKey)
-		if !ok {
-			return nil, fmt.Errorf(`expected *ecdsa.PublicKey, got %T`, pubkey)
-		}
-		curveBits = pubkey.Curve.Params().BitSize
-
 		r = p.R
 		s = p.S
 	} else {
@@ -151,6 +154,18 @@ func (v ecdsaVerifier) Algorithm() jwa.SignatureAlgorithm {
 }
 
 func (v *ecdsaVerifier) Verify(payload []byte, signature []byte, key interface{}) error {
+	h := v.hash.New()
+	if _, err := h.Write(payload); err != nil {
+		return fmt.Errorf(`failed to write payload using ecdsa: %w`, err)
+	}
+	return v.verifyHash(h, signature, key)
+}
+
+func (v *ecdsaVerifier) newHash(_ interface{}) (hash.Hash, error) {
+	return v.hash.New(), nil
+}
+
+func (v *ecdsaVerifier) verifyHash(h hash.Hash, signature []byte, key interface{}) error {
 	if key == nil {
 		return fmt.Errorf(`missing public key while verifying payload`)
 	}
@@ -181,11 +196,6 @@ func (v *ecdsaVerifier) Verify(payload []byte, signature []byte, key interface{}
 	r.SetBytes(signature[:n])
 	s.SetBytes(signature[n:])
 
-	h := v.hash.New()
-	if _, err := h.Write(payload); err != nil {
-		return fmt.Errorf(`failed to write payload using ecdsa: %w`, err)
-	}
-
 	if !ecdsa.Verify(&pubkey, h.Sum(nil), r, s) {
 		return fmt.Errorf(`failed to verify signature using ecdsa`)
 	}
@@ -6,6 +6,7 @@ import (
 	"crypto/rand"
 	"fmt"
 
+	"github.com/lestrrat-go/jwx/v2/ed448"
 	"github.com/lestrrat-go/jwx/v2/internal/keyconv"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 )
@@ -25,17 +26,30 @@ func (s eddsaSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 		return nil, fmt.Errorf(`missing private key while signing payload`)
 	}
 
-	// The ed25519.PrivateKey object implements crypto.Signer, so we should
-	// simply accept a crypto.Signer here.
+	// The ed25519.PrivateKey and ed448.PrivateKey objects implement
+	// crypto.Signer, so we should simply accept a crypto.Signer here.
 	signer, ok := key.(crypto.Signer)
-	if !ok {
+	if ok {
+		// Opaque signers (e.g. keys stored in a KMS) may be backed by
+		// any type of key, so make sure that it's an EdDSA key
+		switch signer.Public().(type) {
+		case ed25519.PublicKey, ed448.PublicKey:
+		default:
+			return nil, fmt.Errorf(`expected crypto.Signer.Public() to return ed25519.PublicKey or ed448.PublicKey, but got %T`, signer.Public())
+		}
+	} else {
 		// This fallback exists for cases when jwk.Key was passed, or
 		// users gave us a pointer instead of non-pointer, etc.
 		var privkey ed25519.PrivateKey
-		if err := keyconv.Ed25519PrivateKey(&privkey, key); err != nil {
-			return nil, fmt.Errorf(`failed to retrieve ed25519.PrivateKey out of %T: %w`, key, err)
+		if err := keyconv.Ed25519PrivateKey(&privkey, key); err == nil {
+			signer = privkey
+		} else {
+			var ed448key ed448.PrivateKey
+			if err448 := keyconv.Ed448PrivateKey(&ed448key, key); err448 != nil {
+				return nil, fmt.Errorf(`failed to retrieve ed25519.PrivateKey or ed448.PrivateKey out of %T: %w`, key, err)
+			}
+			signer = ed448key
 		}
-		signer = privkey
 	}
 	return signer.Sign(rand.Reader, payload, crypto.Hash(0))
 }
@@ -51,21 +65,33 @@ func (v eddsaVerifier) Verify(payload, signature []byte, key interface{}) (err e
 		return fmt.Errorf(`missing public key while verifying payload`)
 	}
 
-	var pubkey ed25519.PublicKey
-	signer, ok := key.(crypto.Signer)
-	if ok {
-		v := signer.Public()
-		pubkey, ok = v.(ed25519.PublicKey)
-		if !ok {
-			return fmt.Errorf(`expected crypto.Signer.Public() to return ed25519.PublicKey, but got %T`, v)
-		}
+	var pubkey interface{}
+	if signer, ok := key.(crypto.Signer); ok {
+		pubkey = signer.Public()
 	} else {
-		if err := keyconv.Ed25519PublicKey(&pubkey, key); err != nil {
-			return fmt.Errorf(`failed to retrieve ed25519.PublicKey out of %T: %w`, key, err)
+		var ed25519key ed25519.PublicKey
+		if err := keyconv.Ed25519PublicKey(&ed25519key, key); err == nil {
+			pubkey = ed25519key
+		} else {
+			var ed448key ed448.PublicKey
+			if err448 := keyconv.Ed448PublicKey(&ed448key, key); err448 != nil {
+				return fmt.Errorf(`failed to retrieve ed25519.PublicKey or ed448.PublicKey out of %T: %w`, key, err)
+			}
+			pubkey = ed448key
 		}
 	}
 
-	if !ed25519.Verify(pubkey, payload, signature) {
+	var verified bool
+	switch pubkey := pubkey.(type) {
+	case ed25519.PublicKey:
+		verified = ed25519.Verify(pubkey, payload, signature)
+	case ed448.PublicKey:
+		verified = ed448.Verify(pubkey, payload, signature)
+	default:
+		return fmt.Errorf(`expected crypto.Signer.Public() to return ed25519.PublicKey or ed448.PublicKey, but got %T`, pubkey)
+	}
+
+	if !verified {
 		return fmt.Errorf(`failed to match EdDSA signature`)
 	}
 
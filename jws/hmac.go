@@ -12,6 +12,7 @@ import (
 )
 
 var hmacSignFuncs = map[jwa.SignatureAlgorithm]hmacSignFunc{}
+var hmacHashFuncs = map[jwa.SignatureAlgorithm]func() hash.Hash{}
 
 func init() {
 	algs := map[jwa.SignatureAlgorithm]func() hash.Hash{
@@ -22,6 +23,7 @@ func init() {
 
 	for alg, h := range algs {
 		hmacSignFuncs[alg] = makeHMACSignFunc(h)
+		hmacHashFuncs[alg] = h
 	}
 }
 
@@ -46,7 +48,7 @@ func (s HMACSigner) Algorithm() jwa.SignatureAlgorithm {
 	return s.alg
 }
 
-func (s HMACSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
+func hmacKey(key interface{}) ([]byte, error) {
 	var hmackey []byte
 	if err := keyconv.ByteSliceKey(&hmackey, key); err != nil {
 		return nil, fmt.Errorf(`invalid key type %T. []byte is required: %w`, key, err)
@@ -55,10 +57,31 @@ func (s HMACSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 	if len(hmackey) == 0 {
 		return nil, fmt.Errorf(`missing key while signing payload`)
 	}
+	return hmackey, nil
+}
+
+func (s HMACSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
+	hmackey, err := hmacKey(key)
+	if err != nil {
+		return nil, err
+	}
 
 	return s.sign(payload, hmackey)
 }
 
+func (s HMACSigner) newHash(key interface{}) (hash.Hash, error) {
+	hmackey, err := hmacKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return hmac.New(hmacHashFuncs[s.alg], hmackey), nil
+}
+
+func (s HMACSigner) signHash(h hash.Hash, _ interface{}) ([]byte, error) {
+	return h.Sum(nil), nil
+}
+
 func newHMACVerifier(alg jwa.SignatureAlgorithm) Verifier {
 	s := newHMACSigner(alg)
 	return &HMACVerifier{signer: s}
@@ -75,3 +98,15 @@ func (v HMACVerifier) Verify(payload, signature []byte, key interface{}) (err er
 	}
 	return nil
 }
+
+func (v HMACVerifier) newHash(key interface{}) (hash.Hash, error) {
+	//nolint:forcetypeassert
+	return v.signer.(hashSigner).newHash(key)
+}
+
+func (v HMACVerifier) verifyHash(h hash.Hash, signature []byte, _ interface{}) error {
+	if !hmac.Equal(signature, h.Sum(nil)) {
+		return fmt.Errorf(`failed to match hmac signature`)
+	}
+	return nil
+}
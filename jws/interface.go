@@ -1,6 +1,8 @@
 package jws
 
 import (
+	"hash"
+
 	"github.com/lestrrat-go/iter/mapiter"
 	"github.com/lestrrat-go/jwx/v2/internal/iter"
 	"github.com/lestrrat-go/jwx/v2/jwa"
@@ -18,10 +20,8 @@ type DecodeCtx interface {
 // signed payload with. You should only use this when you want to actually
 // programmatically view the contents of the full JWS payload.
 //
-// As of this version, there is one big incompatibility when using Message
-// objects to convert between compact and JSON representations.
-// The protected header is sometimes encoded differently from the original
-// message and the JSON serialization that we use in Go.
+// Note that the protected header is sometimes encoded differently from
+// the JSON serialization that we use in Go.
 //
 // For example, the protected header `eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9`
 // decodes to
@@ -34,19 +34,18 @@ type DecodeCtx interface {
 //
 //   {"typ":"JWT","alg":"HS256"}
 //
-// Notice that serialization lacks a line break and a space between `"JWT",`
-// and `"alg"`. This causes a problem when verifying the signatures AFTER
-// a compact JWS message has been unmarshaled into a jws.Message.
-//
-// jws.Verify() doesn't go through this step, and therefore this does not
-// manifest itself. However, you may see this discrepancy when you manually
-// go through these conversions, and/or use the `jwx` tool like so:
+// Because the signature is computed over the original bytes, each Signature
+// in a parsed message keeps the original base64url encoded protected header,
+// and uses it verbatim when the message is serialized via `json.Marshal()`
+// or `jws.Compact()`. This allows a parsed message to be verified again
+// after it has been converted between the compact and JSON representations,
+// for example when using the `jwx` tool like so:
 //
 //   jwx jws parse message.jws | jwx jws verify --key somekey.jwk --stdin
 //
-// In this scenario, the first `jwx jws parse` outputs a parsed jws.Message
-// which is marshaled into JSON. At this point the message's protected
-// headers and the signatures don't match.
+// The original header is only used as long as it still represents the
+// contents of `ProtectedHeaders()`: once the protected headers are modified,
+// they are serialized from their parsed form.
 //
 // To sign and verify, use the appropriate `Sign()` and `Verify()` functions.
 type Message struct {
@@ -57,11 +56,12 @@ type Message struct {
 }
 
 type Signature struct {
-	dc        DecodeCtx
-	headers   Headers // Unprotected Headers
-	protected Headers // Protected Headers
-	signature []byte  // Signature
-	detached  bool
+	dc           DecodeCtx
+	headers      Headers // Unprotected Headers
+	protected    Headers // Protected Headers
+	rawProtected []byte  // Original base64url encoded protected headers, if parsed
+	signature    []byte  // Signature
+	detached     bool
 }
 
 type Visitor = iter.MapVisitor
@@ -82,6 +82,19 @@ type Signer interface {
 	Algorithm() jwa.SignatureAlgorithm
 }
 
+// hashSigner is implemented by signers that sign a digest of the
+// signing input, which allows the input to be processed incrementally
+type hashSigner interface {
+	newHash(key interface{}) (hash.Hash, error)
+	signHash(h hash.Hash, key interface{}) ([]byte, error)
+}
+
+// hashVerifier is the counterpart of hashSigner for verifiers
+type hashVerifier interface {
+	newHash(key interface{}) (hash.Hash, error)
+	verifyHash(h hash.Hash, signature []byte, key interface{}) error
+}
+
 type hmacSignFunc func([]byte, []byte) ([]byte, error)
 
 // HMACSigner uses crypto/hmac to sign the payloads.
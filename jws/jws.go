@@ -34,16 +34,19 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/lestrrat-go/blackmagic"
+	"github.com/lestrrat-go/jwx/v2/ed448"
 	"github.com/lestrrat-go/jwx/v2/internal/base64"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
 	"github.com/lestrrat-go/jwx/v2/internal/pool"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 )
 
 var registry = json.NewRegistry()
@@ -71,6 +74,33 @@ func (s *payloadSigner) PublicHeader() Headers {
 	return s.public
 }
 
+// newSignature creates a Signature object with the headers for this
+// signer. The signature itself is not computed
+func (s *payloadSigner) newSignature(detached bool) (*Signature, error) {
+	protected := s.ProtectedHeader()
+	if protected == nil {
+		protected = NewHeaders()
+	}
+
+	if err := protected.Set(AlgorithmKey, s.Algorithm()); err != nil {
+		return nil, fmt.Errorf(`failed to set "alg" header: %w`, err)
+	}
+
+	if key, ok := s.key.(jwk.Key); ok {
+		if kid := key.KeyID(); kid != "" {
+			if err := protected.Set(KeyIDKey, kid); err != nil {
+				return nil, fmt.Errorf(`failed to set "kid" header: %w`, err)
+			}
+		}
+	}
+	return &Signature{
+		headers:   s.PublicHeader(),
+		protected: protected,
+		// cheat. FIXXXXXXMEEEEEE
+		detached: detached,
+	}, nil
+}
+
 var signers = make(map[jwa.SignatureAlgorithm]Signer)
 var muSigner = &sync.Mutex{}
 
@@ -108,6 +138,79 @@ const (
 var _ = fmtInvalid
 var _ = fmtMax
 
+var keyUsageCheck uint32
+
+var muAllowedAlgorithms sync.RWMutex
+var allowedAlgorithms []jwa.SignatureAlgorithm
+
+// Settings controls global settings that are specific to JWS.
+// Only the settings that are specified are changed.
+func Settings(options ...GlobalOption) {
+	//nolint:forcetypeassert
+	for _, option := range options {
+		switch option.Ident() {
+		case identKeyUsageCheck{}:
+			var v uint32
+			if option.Value().(bool) {
+				v = 1
+			}
+			atomic.StoreUint32(&keyUsageCheck, v)
+		case identAllowedAlgorithms{}:
+			algs := option.Value().([]jwa.SignatureAlgorithm)
+			muAllowedAlgorithms.Lock()
+			allowedAlgorithms = append([]jwa.SignatureAlgorithm(nil), algs...)
+			muAllowedAlgorithms.Unlock()
+		}
+	}
+}
+
+func globalAllowedAlgorithms() []jwa.SignatureAlgorithm {
+	muAllowedAlgorithms.RLock()
+	defer muAllowedAlgorithms.RUnlock()
+	return allowedAlgorithms
+}
+
+// isAllowedAlgorithm returns true if `alg` is listed in `allowed`.
+// An empty list allows all algorithms
+func isAllowedAlgorithm(allowed []jwa.SignatureAlgorithm, alg jwa.SignatureAlgorithm) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, v := range allowed {
+		if v == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAllowedAlgorithm checks the "alg" protected header of `sig`
+// against `allowed`, before any keys are looked up
+func checkAllowedAlgorithm(sig *Signature, allowed []jwa.SignatureAlgorithm) error {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	var alg jwa.SignatureAlgorithm
+	if protected := sig.protected; protected != nil {
+		alg = protected.Algorithm()
+	}
+	if !isAllowedAlgorithm(allowed, alg) {
+		return fmt.Errorf(`algorithm %q is not allowed`, alg)
+	}
+	return nil
+}
+
+// checkKeyUsage checks that `key` may be used for `op` using `alg`,
+// if it is a jwk.Key. Raw keys are always accepted
+func checkKeyUsage(key interface{}, alg jwa.SignatureAlgorithm, op jwk.KeyOperation) error {
+	jwkKey, ok := key.(jwk.Key)
+	if !ok {
+		return nil
+	}
+	return jwk.CheckKeyUsage(jwkKey, alg, op)
+}
+
 // Sign generates a JWS message for the given payload and returns
 // it in serialized form, which can be in either compact or
 // JSON format. Default is compact.
@@ -128,7 +231,9 @@ var _ = fmtMax
 //
 // If you want to use a detached payload, use `jws.WithDetachedPayload()` as
 // one of the options. When you use this option, you must always set the
-// first parameter (`payload`) to `nil`, or the function will return an error
+// first parameter (`payload`) to `nil`, or the function will return an error.
+// For large payloads, `jws.WithDetachedPayloadReader()` can be used instead
+// to read the payload from an io.Reader.
 //
 // You may also wantt to look at how to pass protected headers to the
 // signing process, as you will likely be required to set the `b64` field
@@ -140,11 +245,15 @@ func Sign(payload []byte, options ...SignOption) ([]byte, error) {
 	format := fmtCompact
 	var signers []*payloadSigner
 	var detached bool
+	var detachedReader io.Reader
+	checkUsage := atomic.LoadUint32(&keyUsageCheck) == 1
 	for _, option := range options {
 		//nolint:forcetypeassert
 		switch option.Ident() {
 		case identSerialization{}:
 			format = option.Value().(int)
+		case identKeyUsageCheck{}:
+			checkUsage = option.Value().(bool)
 		case identKey{}:
 			data := option.Value().(*withKey)
 
@@ -163,14 +272,32 @@ func Sign(payload []byte, options ...SignOption) ([]byte, error) {
 				return nil, fmt.Errorf(`jws.Sign: payload must be nil when jws.WithDetachedPayload() is specified`)
 			}
 			payload = option.Value().([]byte)
+		case identDetachedPayloadReader{}:
+			detached = true
+			if payload != nil {
+				return nil, fmt.Errorf(`jws.Sign: payload must be nil when jws.WithDetachedPayloadReader() is specified`)
+			}
+			detachedReader = option.Value().(io.Reader)
 		}
 	}
 
+	if detachedReader != nil && payload != nil {
+		return nil, fmt.Errorf(`jws.Sign: jws.WithDetachedPayload() and jws.WithDetachedPayloadReader() cannot be used together`)
+	}
+
 	lsigner := len(signers)
 	if lsigner == 0 {
 		return nil, fmt.Errorf(`jws.Sign: no signers available. Specify an alogirthm and akey using jws.WithKey()`)
 	}
 
+	if checkUsage {
+		for i, signer := range signers {
+			if err := checkKeyUsage(signer.key, signer.Algorithm(), jwk.KeyOpSign); err != nil {
+				return nil, fmt.Errorf(`jws.Sign: key for signer #%d cannot be used: %w`, i, err)
+			}
+		}
+	}
+
 	// Design note: while we could have easily set format = fmtJSON when
 	// lsigner > 1, I believe the decision to change serialization formats
 	// must be explicitly stated by the caller. Otherwise I'm pretty sure
@@ -191,36 +318,29 @@ func Sign(payload []byte, options ...SignOption) ([]byte, error) {
 
 	result.signatures = make([]*Signature, 0, len(signers))
 	for i, signer := range signers {
-		protected := signer.ProtectedHeader()
-		if protected == nil {
-			protected = NewHeaders()
-		}
-
-		if err := protected.Set(AlgorithmKey, signer.Algorithm()); err != nil {
-			return nil, fmt.Errorf(`failed to set "alg" header: %w`, err)
+		sig, err := signer.newSignature(detached)
+		if err != nil {
+			return nil, err
 		}
 
-		if key, ok := signer.key.(jwk.Key); ok {
-			if kid := key.KeyID(); kid != "" {
-				if err := protected.Set(KeyIDKey, kid); err != nil {
-					return nil, fmt.Errorf(`failed to set "kid" header: %w`, err)
-				}
+		// When the payload is read from an io.Reader, all signatures are
+		// generated at once after this loop
+		if detachedReader == nil {
+			_, _, err := sig.Sign(payload, signer.signer, signer.key)
+			if err != nil {
+				return nil, fmt.Errorf(`failed to generate signature for signer #%d (alg=%s): %w`, i, signer.Algorithm(), err)
 			}
 		}
-		sig := &Signature{
-			headers:   signer.PublicHeader(),
-			protected: protected,
-			// cheat. FIXXXXXXMEEEEEE
-			detached: detached,
-		}
-		_, _, err := sig.Sign(payload, signer.signer, signer.key)
-		if err != nil {
-			return nil, fmt.Errorf(`failed to generate signature for signer #%d (alg=%s): %w`, i, signer.Algorithm(), err)
-		}
 
 		result.signatures = append(result.signatures, sig)
 	}
 
+	if detachedReader != nil {
+		if err := signReader(detachedReader, result.signatures, signers); err != nil {
+			return nil, fmt.Errorf(`jws.Sign: %w`, err)
+		}
+	}
+
 	switch format {
 	case fmtJSON:
 		return json.Marshal(result)
@@ -252,11 +372,19 @@ var allowNoneWhitelist = jwk.WhitelistFunc(func(string) bool {
 // `Verifier` in `verify` subpackage, and call `Verify` method on it.
 // If you need to access signatures and JOSE headers in a JWS message,
 // use `Parse` function to get `Message` object.
+//
+// To find out which signature and key were used, or why the other
+// signatures and keys were rejected, use `jws.WithVerifyResult()`.
 func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 	var dst *Message
 	var detachedPayload []byte
-	var keyProviders []KeyProvider
+	var detachedReader io.Reader
 	var keyUsed interface{}
+	var localAllowedAlgs bool
+	vctx := verifyCtx{
+		keyUsageCheck: atomic.LoadUint32(&keyUsageCheck) == 1,
+		allowedAlgs:   globalAllowedAlgorithms(),
+	}
 
 	ctx := context.Background()
 
@@ -267,28 +395,51 @@ func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 			dst = option.Value().(*Message)
 		case identDetachedPayload{}:
 			detachedPayload = option.Value().([]byte)
+		case identDetachedPayloadReader{}:
+			detachedReader = option.Value().(io.Reader)
 		case identKey{}:
 			pair := option.Value().(*withKey)
 			alg, ok := pair.alg.(jwa.SignatureAlgorithm)
 			if !ok {
 				return nil, fmt.Errorf(`WithKey() option must be specified using jwa.SignatureAlgorithm (got %T)`, pair.alg)
 			}
-			keyProviders = append(keyProviders, &staticKeyProvider{
+			vctx.keyProviders = append(vctx.keyProviders, &staticKeyProvider{
 				alg: alg,
 				key: pair.key,
 			})
 		case identKeyProvider{}:
-			keyProviders = append(keyProviders, option.Value().(KeyProvider))
+			vctx.keyProviders = append(vctx.keyProviders, option.Value().(KeyProvider))
 		case identKeyUsed{}:
 			keyUsed = option.Value()
+		case identVerifyResult{}:
+			vctx.result = option.Value().(*VerifyResult)
+		case identVerifyPolicy{}:
+			vctx.policy = option.Value().(VerifyPolicy)
 		case identContext{}:
 			ctx = option.Value().(context.Context)
+		case identCriticalExtensions{}:
+			vctx.critical = append(vctx.critical, option.Value().([]string)...)
+		case identKeyUsageCheck{}:
+			vctx.keyUsageCheck = option.Value().(bool)
+		case identAllowedAlgorithms{}:
+			// algorithms given to jws.Verify() replace the global list.
+			// An empty list would allow all algorithms, which is never
+			// what the caller intended
+			algs := option.Value().([]jwa.SignatureAlgorithm)
+			if len(algs) == 0 {
+				return nil, fmt.Errorf(`jws.Verify: jws.WithAllowedAlgorithms() must be given at least one algorithm`)
+			}
+			if !localAllowedAlgs {
+				vctx.allowedAlgs = nil
+				localAllowedAlgs = true
+			}
+			vctx.allowedAlgs = append(vctx.allowedAlgs, algs...)
 		default:
 			return nil, fmt.Errorf(`invalid jws.VerifyOption %q passed`, `With`+strings.TrimPrefix(fmt.Sprintf(`%T`, option.Ident()), `jws.ident`))
 		}
 	}
 
-	if len(keyProviders) < 1 {
+	if len(vctx.keyProviders) < 1 {
 		return nil, fmt.Errorf(`jws.Verify: no key providers have been provided (see jws.WithKey(), jws.WithKeySet(), jws.WithVerifyAuto(), and jws.WithKeyProvider()`)
 	}
 
@@ -298,6 +449,10 @@ func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 	}
 	defer msg.clearRaw()
 
+	if err := vctx.init(msg); err != nil {
+		return nil, err
+	}
+
 	if detachedPayload != nil {
 		if len(msg.payload) != 0 {
 			return nil, fmt.Errorf(`can't specify detached payload for JWS with payload`)
@@ -306,6 +461,31 @@ func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 		msg.payload = detachedPayload
 	}
 
+	if detachedReader != nil {
+		if detachedPayload != nil {
+			return nil, fmt.Errorf(`jws.WithDetachedPayload() and jws.WithDetachedPayloadReader() cannot be used together`)
+		}
+		if len(msg.payload) != 0 {
+			return nil, fmt.Errorf(`can't specify detached payload for JWS with payload`)
+		}
+
+		if err := verifyReader(ctx, &vctx, msg, detachedReader); err != nil {
+			return nil, err
+		}
+
+		if keyUsed != nil {
+			key := vctx.verified[0].key
+			if err := blackmagic.AssignIfCompatible(keyUsed, key); err != nil {
+				return nil, fmt.Errorf(`failed to assign used key (%T) to %T: %w`, key, keyUsed, err)
+			}
+		}
+
+		if dst != nil {
+			*(dst) = *msg
+		}
+		return nil, nil
+	}
+
 	// Pre-compute the base64 encoded version of payload
 	var payload string
 	if msg.b64 {
@@ -317,33 +497,30 @@ func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 	verifyBuf := pool.GetBytesBuffer()
 	defer pool.ReleaseBytesBuffer(verifyBuf)
 
+SIGNATURES:
 	for i, sig := range msg.signatures {
-		verifyBuf.Reset()
-
-		var encodedProtectedHeader string
-		if rbp, ok := sig.protected.(interface{ rawBuffer() []byte }); ok {
-			if raw := rbp.rawBuffer(); raw != nil {
-				encodedProtectedHeader = base64.EncodeToString(raw)
-			}
+		if !vctx.acceptSignature(i, sig) {
+			continue
 		}
 
-		if encodedProtectedHeader == "" {
-			protected, err := json.Marshal(sig.protected)
-			if err != nil {
-				return nil, fmt.Errorf(`failed to marshal "protected" for signature #%d: %w`, i+1, err)
-			}
+		verifyBuf.Reset()
 
-			encodedProtectedHeader = base64.EncodeToString(protected)
+		encodedProtectedHeader, err := signingInputHeader(sig)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to marshal "protected" for signature #%d: %w`, i+1, err)
 		}
 
 		verifyBuf.WriteString(encodedProtectedHeader)
 		verifyBuf.WriteByte('.')
 		verifyBuf.WriteString(payload)
 
-		for i, kp := range keyProviders {
+		for j, kp := range vctx.keyProviders {
 			var sink algKeySink
 			if err := kp.FetchKeys(ctx, &sink, sig, msg); err != nil {
-				return nil, fmt.Errorf(`key provider %d failed: %w`, i, err)
+				if err := vctx.fetchError(i, j, err); err != nil {
+					return nil, err
+				}
+				continue
 			}
 
 			for _, pair := range sink.list {
@@ -353,16 +530,27 @@ func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 				//nolint:forcetypeassert
 				alg := pair.alg.(jwa.SignatureAlgorithm)
 				key := pair.key
+				if !vctx.acceptKey(i, alg, key) {
+					continue
+				}
+
 				verifier, err := NewVerifier(alg)
 				if err != nil {
 					return nil, fmt.Errorf(`failed to create verifier for algorithm %q: %w`, alg, err)
 				}
 
 				if err := verifier.Verify(verifyBuf.Bytes(), sig.signature, key); err != nil {
+					vctx.result.addFailure(i, alg, key, err)
 					continue
 				}
 
+				if !vctx.addVerified(i, sig, alg, key) {
+					// the verification policy requires more signatures
+					continue SIGNATURES
+				}
+
 				if keyUsed != nil {
+					key := vctx.verified[0].key
 					if err := blackmagic.AssignIfCompatible(keyUsed, key); err != nil {
 						return nil, fmt.Errorf(`failed to assign used key (%T) to %T: %w`, key, keyUsed, err)
 					}
@@ -376,7 +564,139 @@ func Verify(buf []byte, options ...VerifyOption) ([]byte, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf(`could not verify message using any of the signatures or keys`)
+	return nil, vctx.verifyError()
+}
+
+// signingInputHeader returns the base64 encoded protected header of a
+// signature that is about to be verified. The signature has just been
+// parsed, so the original header is used as is
+func signingInputHeader(sig *Signature) (string, error) {
+	if raw := sig.rawProtected; len(raw) > 0 {
+		return string(raw), nil
+	}
+
+	if rbp, ok := sig.protected.(interface{ rawBuffer() []byte }); ok {
+		if raw := rbp.rawBuffer(); raw != nil {
+			return base64.EncodeToString(raw), nil
+		}
+	}
+
+	protected, err := json.Marshal(sig.protected)
+	if err != nil {
+		return "", err
+	}
+	return base64.EncodeToString(protected), nil
+}
+
+// encodeProtectedHeader returns the base64 encoded protected header of
+// the signature, for serialization. If the signature was parsed, the
+// original header is used as long as it still represents the current
+// protected headers, as they may have been modified since
+func encodeProtectedHeader(sig *Signature) (string, error) {
+	protected, err := json.Marshal(sig.protected)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.EncodeToString(protected)
+	if raw := sig.rawProtected; len(raw) > 0 {
+		if string(raw) == encoded {
+			return encoded, nil
+		}
+		if decoded, err := base64.Decode(raw); err == nil && isEquivalentHeader(decoded, protected) {
+			return string(raw), nil
+		}
+	}
+
+	if rbp, ok := sig.protected.(interface{ rawBuffer() []byte }); ok {
+		if raw := rbp.rawBuffer(); raw != nil && !bytes.Equal(raw, protected) && isEquivalentHeader(raw, protected) {
+			return base64.EncodeToString(raw), nil
+		}
+	}
+	return encoded, nil
+}
+
+// isEquivalentHeader returns true if the JSON header raw contains the
+// same values as the header serialized in marshaled
+func isEquivalentHeader(raw, marshaled []byte) bool {
+	hdrs := NewHeaders()
+	if err := json.Unmarshal(raw, hdrs); err != nil {
+		return false
+	}
+
+	buf, err := json.Marshal(hdrs)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(buf, marshaled)
+}
+
+// registeredHeaderNames contains the header parameter names defined
+// in RFC7515 and RFC7518. These must not appear in the "crit" header
+var registeredHeaderNames = map[string]struct{}{
+	AlgorithmKey:              {},
+	ContentTypeKey:            {},
+	CriticalKey:               {},
+	JWKKey:                    {},
+	JWKSetURLKey:              {},
+	KeyIDKey:                  {},
+	TypeKey:                   {},
+	X509CertChainKey:          {},
+	X509CertThumbprintKey:     {},
+	X509CertThumbprintS256Key: {},
+	X509URLKey:                {},
+}
+
+// verifyCritical checks the "crit" header of the signature as described in
+// RFC7515 section 4.1.11. Extensions that this package processes on its own
+// (i.e. "b64" from RFC7797) are always accepted. All other extensions must
+// be explicitly listed by the user via `jws.WithCriticalExtensions()`
+func verifyCritical(sig *Signature, understood []string) error {
+	if public := sig.headers; public != nil {
+		if _, ok := public.Get(CriticalKey); ok {
+			return fmt.Errorf(`"crit" header must be integrity protected`)
+		}
+	}
+
+	protected := sig.protected
+	if protected == nil {
+		return nil
+	}
+
+	if _, ok := protected.Get(CriticalKey); !ok {
+		return nil
+	}
+
+	names := protected.Critical()
+	if len(names) == 0 {
+		return fmt.Errorf(`"crit" header must not be empty`)
+	}
+
+	for _, name := range names {
+		if _, ok := registeredHeaderNames[name]; ok {
+			return fmt.Errorf(`"crit" header must not contain registered header %q`, name)
+		}
+
+		if _, ok := protected.Get(name); !ok {
+			return fmt.Errorf(`critical header %q is not present in protected header`, name)
+		}
+
+		if name == "b64" {
+			continue
+		}
+
+		var found bool
+		for _, v := range understood {
+			if v == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf(`critical header %q is not supported`, name)
+		}
+	}
+	return nil
 }
 
 // get the value of b64 header field.
@@ -628,11 +948,17 @@ func parse(protected, payload, signature []byte) (*Message, error) {
 		return nil, fmt.Errorf(`failed to decode signature: %w`, err)
 	}
 
+	// Keep a copy of the original protected header, as the
+	// buffer belongs to the caller
+	rawProtected := make([]byte, len(protected))
+	copy(rawProtected, protected)
+
 	var msg Message
 	msg.payload = decodedPayload
 	msg.signatures = append(msg.signatures, &Signature{
-		protected: hdr,
-		signature: decodedSignature,
+		protected:    hdr,
+		rawProtected: rawProtected,
+		signature:    decodedSignature,
 	})
 	msg.b64 = b64
 	return &msg, nil
@@ -667,6 +993,7 @@ var keyTypeToAlgorithms = make(map[jwa.KeyType][]jwa.SignatureAlgorithm)
 func init() {
 	rawKeyToKeyType[reflect.TypeOf([]byte(nil))] = jwa.OctetSeq
 	rawKeyToKeyType[reflect.TypeOf(ed25519.PublicKey(nil))] = jwa.OKP
+	rawKeyToKeyType[reflect.TypeOf(ed448.PublicKey(nil))] = jwa.OKP
 	rawKeyToKeyType[reflect.TypeOf(rsa.PublicKey{})] = jwa.RSA
 	rawKeyToKeyType[reflect.TypeOf((*rsa.PublicKey)(nil))] = jwa.RSA
 	rawKeyToKeyType[reflect.TypeOf(ecdsa.PublicKey{})] = jwa.EC
@@ -701,7 +1028,8 @@ func AlgorithmsForKey(key interface{}) ([]jwa.SignatureAlgorithm, error) {
 		kty = jwa.RSA
 	case ecdsa.PublicKey, *ecdsa.PublicKey, ecdsa.PrivateKey, *ecdsa.PrivateKey:
 		kty = jwa.EC
-	case ed25519.PublicKey, ed25519.PrivateKey, x25519.PublicKey, x25519.PrivateKey:
+	case ed25519.PublicKey, ed25519.PrivateKey, x25519.PublicKey, x25519.PrivateKey,
+		ed448.PublicKey, ed448.PrivateKey, x448.PublicKey, x448.PrivateKey:
 		kty = jwa.OKP
 	case []byte:
 		kty = jwa.OctetSeq
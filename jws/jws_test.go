@@ -9,7 +9,10 @@ import (
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -18,10 +21,13 @@ import (
 	"net/http/httptest"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/lestrrat-go/httprc"
+	"github.com/lestrrat-go/jwx/v2/cert"
+	"github.com/lestrrat-go/jwx/v2/ed448"
 	"github.com/lestrrat-go/jwx/v2/internal/base64"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
 	"github.com/lestrrat-go/jwx/v2/internal/jwxtest"
@@ -29,6 +35,7 @@ import (
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/x25519"
+	"github.com/lestrrat-go/jwx/v2/x448"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -368,6 +375,20 @@ func TestRoundtrip(t *testing.T) {
 			})
 		}
 	})
+	t.Run("EdDSA (Ed448)", func(t *testing.T) {
+		t.Parallel()
+		key, err := jwxtest.GenerateEd448Key()
+		if !assert.NoError(t, err, "ed448 key generated") {
+			return
+		}
+		pubkey := key.Public()
+		jwkKey, _ := jwk.FromRaw(pubkey)
+		keys := map[string]interface{}{
+			"Verify(ed448.Public())": pubkey,
+			"Verify(jwk.Key)":        jwkKey,
+		}
+		testRoundtrip(t, payload, jwa.EdDSA, key, keys)
+	})
 }
 
 func TestSignMulti2(t *testing.T) {
@@ -1344,6 +1365,34 @@ func TestRFC7797(t *testing.T) {
 		}
 	})
 
+	t.Run("JSON serialization when b64 = false", func(t *testing.T) {
+		const payload = `hello, world`
+		hdrs := jws.NewHeaders()
+		hdrs.Set("b64", false)
+		hdrs.Set("crit", "b64")
+
+		signed, err := jws.Sign([]byte(payload), jws.WithJSON(), jws.WithKey(jwa.HS256, key, jws.WithProtectedHeaders(hdrs)))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		if !assert.Contains(t, string(signed), `"payload":"hello, world"`, `payload should not be base64 encoded`) {
+			return
+		}
+
+		verified, err := jws.Verify(signed, jws.WithKey(jwa.HS256, key))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, string(verified), `payload should match`) {
+			return
+		}
+
+		_, err = jws.Sign([]byte{'h', 'i', 0xff}, jws.WithJSON(), jws.WithKey(jwa.HS256, key, jws.WithProtectedHeaders(hdrs)))
+		if !assert.Error(t, err, `jws.Sign should fail for payloads that are not valid UTF-8`) {
+			return
+		}
+	})
+
 	t.Run("Verify", func(t *testing.T) {
 		detached := []byte(`$.02`)
 		testcases := []struct {
@@ -1429,7 +1478,13 @@ func TestGH485(t *testing.T) {
     "signatures": [{"protected": %q, "signature": %q}]
 }`, payload, protected, signature)
 
-	verified, err := jws.Verify([]byte(signed), jws.WithKey(jwa.HS256, []byte("secret")))
+	// "exp" is listed in "crit", so it must be explicitly understood
+	_, err := jws.Verify([]byte(signed), jws.WithKey(jwa.HS256, []byte("secret")))
+	if !assert.Error(t, err, `jws.Verify should fail without jws.WithCriticalExtensions`) {
+		return
+	}
+
+	verified, err := jws.Verify([]byte(signed), jws.WithKey(jwa.HS256, []byte("secret")), jws.WithCriticalExtensions("exp"))
 	if !assert.NoError(t, err, `jws.Verify should succeed`) {
 		return
 	}
@@ -1438,7 +1493,7 @@ func TestGH485(t *testing.T) {
 	}
 
 	compact := strings.Join([]string{protected, payload, signature}, ".")
-	verified, err = jws.Verify([]byte(compact), jws.WithKey(jwa.HS256, []byte("secret")))
+	verified, err = jws.Verify([]byte(compact), jws.WithKey(jwa.HS256, []byte("secret")), jws.WithCriticalExtensions("exp"))
 	if !assert.NoError(t, err, `jws.Verify should succeed`) {
 		return
 	}
@@ -1785,6 +1840,16 @@ func TestAlgorithmsForKey(t *testing.T) {
 			Key:      x25519.PublicKey(nil),
 			Expected: []jwa.SignatureAlgorithm{jwa.EdDSA},
 		},
+		{
+			Name:     "ed448.PublicKey",
+			Key:      ed448.PublicKey(nil),
+			Expected: []jwa.SignatureAlgorithm{jwa.EdDSA},
+		},
+		{
+			Name:     "x448.PublicKey",
+			Key:      x448.PublicKey(nil),
+			Expected: []jwa.SignatureAlgorithm{jwa.EdDSA},
+		},
 	}
 
 	for _, tc := range testcases {
@@ -1833,3 +1898,1264 @@ func TestGH681(t *testing.T) {
 		return
 	}
 }
+
+func TestCriticalExtensions(t *testing.T) {
+	key := []byte("abracadabra")
+
+	sign := func(t *testing.T, fields map[string]interface{}) ([]byte, bool) {
+		t.Helper()
+		hdrs := jws.NewHeaders()
+		for k, v := range fields {
+			if !assert.NoError(t, hdrs.Set(k, v), `hdrs.Set should succeed`) {
+				return nil, false
+			}
+		}
+		signed, err := jws.Sign([]byte("Lorem ipsum"), jws.WithKey(jwa.HS256, key, jws.WithProtectedHeaders(hdrs)))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return nil, false
+		}
+		return signed, true
+	}
+
+	t.Run("unknown extension", func(t *testing.T) {
+		signed, ok := sign(t, map[string]interface{}{
+			jws.CriticalKey: []string{"exp"},
+			"exp":           1363284000,
+		})
+		if !ok {
+			return
+		}
+		_, err := jws.Verify(signed, jws.WithKey(jwa.HS256, key))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+
+		_, err = jws.Verify(signed, jws.WithKey(jwa.HS256, key), jws.WithCriticalExtensions("foo"))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("understood extension", func(t *testing.T) {
+		signed, ok := sign(t, map[string]interface{}{
+			jws.CriticalKey: []string{"exp"},
+			"exp":           1363284000,
+		})
+		if !ok {
+			return
+		}
+		payload, err := jws.Verify(signed, jws.WithKey(jwa.HS256, key), jws.WithCriticalExtensions("exp"))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []byte("Lorem ipsum"), payload, `payload should match`) {
+			return
+		}
+	})
+	t.Run("extension missing from protected header", func(t *testing.T) {
+		signed, ok := sign(t, map[string]interface{}{
+			jws.CriticalKey: []string{"exp"},
+		})
+		if !ok {
+			return
+		}
+		_, err := jws.Verify(signed, jws.WithKey(jwa.HS256, key), jws.WithCriticalExtensions("exp"))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("registered header", func(t *testing.T) {
+		signed, ok := sign(t, map[string]interface{}{
+			jws.CriticalKey: []string{jws.KeyIDKey},
+			jws.KeyIDKey:    "my-key",
+		})
+		if !ok {
+			return
+		}
+		_, err := jws.Verify(signed, jws.WithKey(jwa.HS256, key), jws.WithCriticalExtensions(jws.KeyIDKey))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("empty list", func(t *testing.T) {
+		signed, ok := sign(t, map[string]interface{}{
+			jws.CriticalKey: []string{},
+		})
+		if !ok {
+			return
+		}
+		_, err := jws.Verify(signed, jws.WithKey(jwa.HS256, key))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+}
+
+func TestSignCryptoSignerKeyMismatch(t *testing.T) {
+	t.Parallel()
+
+	rsakey, err := jwxtest.GenerateRsaKey()
+	if !assert.NoError(t, err, `jwxtest.GenerateRsaKey should succeed`) {
+		return
+	}
+	ecdsakey, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+	if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+		return
+	}
+
+	testcases := []struct {
+		Alg jwa.SignatureAlgorithm
+		Key crypto.Signer
+	}{
+		{Alg: jwa.RS256, Key: &dummyCryptoSigner{raw: ecdsakey}},
+		{Alg: jwa.PS256, Key: &dummyCryptoSigner{raw: ecdsakey}},
+		{Alg: jwa.ES256, Key: &dummyCryptoSigner{raw: rsakey}},
+		{Alg: jwa.EdDSA, Key: &dummyCryptoSigner{raw: rsakey}},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Alg.String(), func(t *testing.T) {
+			t.Parallel()
+			_, err := jws.Sign([]byte("Lorem ipsum"), jws.WithKey(tc.Alg, tc.Key))
+			if !assert.Error(t, err, `jws.Sign should fail when crypto.Signer.Public() does not match the algorithm`) {
+				return
+			}
+		})
+	}
+}
+
+func TestDetachedPayloadReader(t *testing.T) {
+	rsaKey, err := jwxtest.GenerateRsaKey()
+	if !assert.NoError(t, err, `jwxtest.GenerateRsaKey should succeed`) {
+		return
+	}
+	ecKey, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+	if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+		return
+	}
+	hmacKey := []byte("the quick brown fox jumps over the lazy dog")
+
+	payload := []byte(strings.Repeat("Lorem ipsum dolor sit amet. ", 10000))
+
+	testcases := []struct {
+		Alg     jwa.SignatureAlgorithm
+		SignKey interface{}
+		PubKey  interface{}
+	}{
+		{Alg: jwa.HS256, SignKey: hmacKey, PubKey: hmacKey},
+		{Alg: jwa.RS256, SignKey: rsaKey, PubKey: &rsaKey.PublicKey},
+		{Alg: jwa.PS384, SignKey: rsaKey, PubKey: &rsaKey.PublicKey},
+		{Alg: jwa.ES256, SignKey: ecKey, PubKey: &ecKey.PublicKey},
+	}
+
+	for _, tc := range testcases {
+		tc := tc
+		for _, b64 := range []bool{true, false} {
+			b64 := b64
+			t.Run(fmt.Sprintf("%s (b64=%t)", tc.Alg, b64), func(t *testing.T) {
+				hdrs := jws.NewHeaders()
+				if !b64 {
+					_ = hdrs.Set("b64", false)
+					_ = hdrs.Set("crit", "b64")
+				}
+
+				signed, err := jws.Sign(nil,
+					jws.WithKey(tc.Alg, tc.SignKey, jws.WithProtectedHeaders(hdrs)),
+					jws.WithDetachedPayloadReader(bytes.NewReader(payload)),
+				)
+				if !assert.NoError(t, err, `jws.Sign should succeed`) {
+					return
+				}
+
+				// Must be compatible with the []byte based API
+				_, err = jws.Verify(signed, jws.WithKey(tc.Alg, tc.PubKey), jws.WithDetachedPayload(payload))
+				if !assert.NoError(t, err, `jws.Verify with jws.WithDetachedPayload should succeed`) {
+					return
+				}
+
+				var used interface{}
+				verified, err := jws.Verify(signed,
+					jws.WithKey(tc.Alg, tc.PubKey),
+					jws.WithDetachedPayloadReader(bytes.NewReader(payload)),
+					jws.WithKeyUsed(&used),
+				)
+				if !assert.NoError(t, err, `jws.Verify with jws.WithDetachedPayloadReader should succeed`) {
+					return
+				}
+				if !assert.Nil(t, verified, `payload should be nil`) {
+					return
+				}
+				if !assert.Equal(t, tc.PubKey, used, `used key should match`) {
+					return
+				}
+
+				signed, err = jws.Sign(nil,
+					jws.WithKey(tc.Alg, tc.SignKey, jws.WithProtectedHeaders(hdrs)),
+					jws.WithDetachedPayload(payload),
+				)
+				if !assert.NoError(t, err, `jws.Sign should succeed`) {
+					return
+				}
+				_, err = jws.Verify(signed, jws.WithKey(tc.Alg, tc.PubKey), jws.WithDetachedPayloadReader(bytes.NewReader(payload)))
+				if !assert.NoError(t, err, `jws.Verify with jws.WithDetachedPayloadReader should succeed`) {
+					return
+				}
+
+				tampered := append([]byte{'x'}, payload[1:]...)
+				_, err = jws.Verify(signed, jws.WithKey(tc.Alg, tc.PubKey), jws.WithDetachedPayloadReader(bytes.NewReader(tampered)))
+				if !assert.Error(t, err, `jws.Verify should fail`) {
+					return
+				}
+			})
+		}
+	}
+	t.Run("Multiple signatures", func(t *testing.T) {
+		signed, err := jws.Sign(nil,
+			jws.WithJSON(),
+			jws.WithKey(jwa.RS256, rsaKey),
+			jws.WithKey(jwa.ES256, ecKey),
+			jws.WithDetachedPayloadReader(bytes.NewReader(payload)),
+		)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		for _, key := range []jws.VerifyOption{jws.WithKey(jwa.RS256, &rsaKey.PublicKey), jws.WithKey(jwa.ES256, &ecKey.PublicKey)} {
+			_, err = jws.Verify(signed, key, jws.WithDetachedPayload(payload))
+			if !assert.NoError(t, err, `jws.Verify should succeed`) {
+				return
+			}
+		}
+
+		// Both signatures are tried against both keys, but the
+		// payload is only read once
+		keyset := jwk.NewSet()
+		for alg, raw := range map[jwa.SignatureAlgorithm]interface{}{jwa.ES256: &ecKey.PublicKey, jwa.RS256: &rsaKey.PublicKey} {
+			key, err := jwk.FromRaw(raw)
+			if !assert.NoError(t, err, `jwk.FromRaw should succeed`) {
+				return
+			}
+			_ = key.Set(jwk.AlgorithmKey, alg)
+			keyset.Add(key)
+		}
+		_, err = jws.Verify(signed, jws.WithKeySet(keyset, jws.WithRequireKid(false)), jws.WithDetachedPayloadReader(bytes.NewReader(payload)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+	t.Run("Unsupported algorithm", func(t *testing.T) {
+		_, edKey, err := ed25519.GenerateKey(nil)
+		if !assert.NoError(t, err, `ed25519.GenerateKey should succeed`) {
+			return
+		}
+		_, err = jws.Sign(nil, jws.WithKey(jwa.EdDSA, edKey), jws.WithDetachedPayloadReader(bytes.NewReader(payload)))
+		if !assert.Error(t, err, `jws.Sign should fail`) {
+			return
+		}
+	})
+	t.Run("Payload and reader", func(t *testing.T) {
+		_, err := jws.Sign(nil,
+			jws.WithKey(jwa.HS256, hmacKey),
+			jws.WithDetachedPayload(payload),
+			jws.WithDetachedPayloadReader(bytes.NewReader(payload)),
+		)
+		if !assert.Error(t, err, `jws.Sign should fail`) {
+			return
+		}
+	})
+}
+
+func TestCachedKeyProvider(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	newKey := func(kid string) (jwk.Key, jwk.Key) {
+		key, err := jwxtest.GenerateEcdsaJwk()
+		if !assert.NoError(t, err, `jwxtest.GenerateEcdsaJwk should succeed`) {
+			t.FailNow()
+		}
+		_ = key.Set(jwk.KeyIDKey, kid)
+		_ = key.Set(jwk.AlgorithmKey, jwa.ES256)
+		pubkey, err := jwk.PublicKeyOf(key)
+		if !assert.NoError(t, err, `jwk.PublicKeyOf should succeed`) {
+			t.FailNow()
+		}
+		return key, pubkey
+	}
+
+	key1, pubkey1 := newKey(`key-1`)
+	key2, pubkey2 := newKey(`key-2`)
+	key3, _ := newKey(`key-3`)
+
+	var mu sync.Mutex
+	var accessCount int
+	set := jwk.NewSet()
+	_ = set.Add(pubkey1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		accessCount++
+		w.Header().Set(`Content-Type`, `application/json`)
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer srv.Close()
+	getAccessCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return accessCount
+	}
+
+	cache := jwk.NewCache(ctx)
+	if !assert.NoError(t, cache.Register(srv.URL), `cache.Register should succeed`) {
+		return
+	}
+	kp := jws.NewCachedKeyProvider(cache, srv.URL, jws.WithMinRefreshInterval(time.Hour))
+
+	sign := func(key jwk.Key) []byte {
+		signed, err := jws.Sign([]byte(`Lorem ipsum`), jws.WithKey(jwa.ES256, key))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			t.FailNow()
+		}
+		return signed
+	}
+
+	if _, err := jws.Verify(sign(key1), jws.WithKeyProvider(kp)); !assert.NoError(t, err, `jws.Verify should succeed`) {
+		return
+	}
+	if !assert.Equal(t, 1, getAccessCount(), `JWKS should be fetched once`) {
+		return
+	}
+
+	// rotate keys: key-2 becomes available, but the cache does not know about it yet
+	mu.Lock()
+	_ = set.Add(pubkey2)
+	mu.Unlock()
+
+	// verify using the new key from multiple goroutines: only one refresh should happen
+	signed := sign(key2)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := jws.Verify(signed, jws.WithKeyProvider(kp))
+			assert.NoError(t, err, `jws.Verify should succeed after refresh`)
+		}()
+	}
+	wg.Wait()
+	if !assert.Equal(t, 2, getAccessCount(), `JWKS should be refreshed once`) {
+		return
+	}
+
+	// unknown keys do not cause refreshes within the minimum interval
+	for i := 0; i < 3; i++ {
+		if _, err := jws.Verify(sign(key3), jws.WithKeyProvider(kp)); !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	}
+	if !assert.Equal(t, 2, getAccessCount(), `JWKS should not be refreshed`) {
+		return
+	}
+
+	// the minimum interval is shared by providers using the same cache and URL
+	kp2 := jws.NewCachedKeyProvider(cache, srv.URL, jws.WithMinRefreshInterval(time.Hour))
+	if _, err := jws.Verify(sign(key3), jws.WithKeyProvider(kp2)); !assert.Error(t, err, `jws.Verify should fail`) {
+		return
+	}
+	if !assert.Equal(t, 2, getAccessCount(), `JWKS should not be refreshed by another provider`) {
+		return
+	}
+}
+
+func TestX509KeyProvider(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	newKey := func() *ecdsa.PrivateKey {
+		key, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+		if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+			t.FailNow()
+		}
+		return key
+	}
+
+	rootKey := newKey()
+	root, err := jwxtest.CreateCertificate(&x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: `Root CA`},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, &rootKey.PublicKey, rootKey)
+	if !assert.NoError(t, err, `jwxtest.CreateCertificate should succeed`) {
+		return
+	}
+
+	leafKey := newKey()
+	leaf, err := jwxtest.CreateCertificate(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: `signer`},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, root, &leafKey.PublicKey, rootKey)
+	if !assert.NoError(t, err, `jwxtest.CreateCertificate should succeed`) {
+		return
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	sign := func(key *ecdsa.PrivateKey, certs ...*x509.Certificate) []byte {
+		hdrs := jws.NewHeaders()
+		if len(certs) > 0 {
+			var chain cert.Chain
+			for _, c := range certs {
+				b64, _ := cert.EncodeBase64(c.Raw)
+				_ = chain.Add(b64)
+			}
+			_ = hdrs.Set(jws.X509CertChainKey, &chain)
+		}
+		signed, err := jws.Sign([]byte(`Lorem ipsum`), jws.WithKey(jwa.ES256, key, jws.WithProtectedHeaders(hdrs)))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			t.FailNow()
+		}
+		return signed
+	}
+
+	newProvider := func(roots *x509.CertPool) jws.KeyProvider {
+		kp, err := jws.NewX509KeyProvider(roots, jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageAny))
+		if !assert.NoError(t, err, `jws.NewX509KeyProvider should succeed`) {
+			t.FailNow()
+		}
+		return kp
+	}
+
+	t.Run("Nil roots", func(t *testing.T) {
+		t.Parallel()
+		_, err := jws.NewX509KeyProvider(nil, jwk.WithX509ExtKeyUsage(x509.ExtKeyUsageAny))
+		if !assert.Error(t, err, `jws.NewX509KeyProvider should fail`) {
+			return
+		}
+	})
+	t.Run("Valid x5c", func(t *testing.T) {
+		t.Parallel()
+		payload, err := jws.Verify(sign(leafKey, leaf), jws.WithKeyProvider(newProvider(roots)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`) {
+			return
+		}
+	})
+	t.Run("Invalid x5c", func(t *testing.T) {
+		t.Parallel()
+		testcases := []struct {
+			Name   string
+			Signed []byte
+			Roots  *x509.CertPool
+		}{
+			{Name: "No x5c", Signed: sign(leafKey), Roots: roots},
+			{Name: "Untrusted root", Signed: sign(leafKey, leaf), Roots: x509.NewCertPool()},
+			{Name: "Signed by another key", Signed: sign(newKey(), leaf), Roots: roots},
+		}
+		t.Run("No extended key usage", func(t *testing.T) {
+			t.Parallel()
+			kp, err := jws.NewX509KeyProvider(roots)
+			if !assert.NoError(t, err, `jws.NewX509KeyProvider should succeed`) {
+				return
+			}
+			_, err = jws.Verify(sign(leafKey, leaf), jws.WithKeyProvider(kp))
+			if !assert.Error(t, err, `jws.Verify should fail`) {
+				return
+			}
+		})
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				t.Parallel()
+				_, err := jws.Verify(tc.Signed, jws.WithKeyProvider(newProvider(tc.Roots)))
+				if !assert.Error(t, err, `jws.Verify should fail`) {
+					return
+				}
+			})
+		}
+	})
+}
+
+func TestKeyUsageCheck(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	newKey := func(options ...jwk.GenerateOption) jwk.Key {
+		key, err := jwk.Generate(jwa.EC, options...)
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			t.FailNow()
+		}
+		return key
+	}
+
+	testcases := []struct {
+		Name string
+		Key  jwk.Key
+	}{
+		{Name: "use=enc", Key: newKey(jwk.WithKeyUsage(jwk.ForEncryption))},
+		{Name: "key_ops without sign or verify", Key: newKey(jwk.WithKeyOps(jwk.KeyOpDeriveKey))},
+		{Name: "Different alg", Key: newKey(jwk.WithAlgorithm(jwa.ES384))},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			pubkey, err := tc.Key.PublicKey()
+			if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+				return
+			}
+
+			signed, err := jws.Sign(payload, jws.WithKey(jwa.ES256, tc.Key))
+			if !assert.NoError(t, err, `jws.Sign should succeed without key usage checks`) {
+				return
+			}
+			_, err = jws.Verify(signed, jws.WithKey(jwa.ES256, pubkey))
+			if !assert.NoError(t, err, `jws.Verify should succeed without key usage checks`) {
+				return
+			}
+
+			_, err = jws.Sign(payload, jws.WithKey(jwa.ES256, tc.Key), jws.WithKeyUsageCheck(true))
+			if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jws.Sign should fail with key usage checks (got %v)`, err) {
+				return
+			}
+			_, err = jws.Verify(signed, jws.WithKey(jwa.ES256, pubkey), jws.WithKeyUsageCheck(true))
+			if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jws.Verify should fail with key usage checks (got %v)`, err) {
+				return
+			}
+		})
+	}
+	t.Run("Allowed keys", func(t *testing.T) {
+		key := newKey(jwk.WithKeyUsage(jwk.ForSignature), jwk.WithAlgorithm(jwa.ES256))
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		signed, err := jws.Sign(payload, jws.WithKey(jwa.ES256, key), jws.WithKeyUsageCheck(true))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, jws.WithKey(jwa.ES256, pubkey), jws.WithKeyUsageCheck(true))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+	t.Run("Detached payload reader", func(t *testing.T) {
+		key := newKey(jwk.WithKeyUsage(jwk.ForEncryption))
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		signed, err := jws.Sign(nil, jws.WithKey(jwa.ES256, key), jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, jws.WithKey(jwa.ES256, pubkey), jws.WithDetachedPayloadReader(bytes.NewReader(payload)), jws.WithKeyUsageCheck(true))
+		if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jws.Verify should fail with key usage checks (got %v)`, err) {
+			return
+		}
+	})
+	t.Run("Settings", func(t *testing.T) {
+		key := newKey(jwk.WithKeyUsage(jwk.ForEncryption))
+
+		jws.Settings(jws.WithKeyUsageCheck(true))
+		defer jws.Settings(jws.WithKeyUsageCheck(false))
+
+		_, err := jws.Sign(payload, jws.WithKey(jwa.ES256, key))
+		if !assert.True(t, errors.Is(err, jwk.ErrKeyOperationNotAllowed()), `jws.Sign should fail with global key usage checks (got %v)`, err) {
+			return
+		}
+		_, err = jws.Sign(payload, jws.WithKey(jwa.ES256, key), jws.WithKeyUsageCheck(false))
+		if !assert.NoError(t, err, `jws.WithKeyUsageCheck(false) should override the global setting`) {
+			return
+		}
+	})
+}
+
+func TestAllowedAlgorithms(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	key, err := jwk.Generate(jwa.RSA)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	pubkey, err := key.PublicKey()
+	if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+		return
+	}
+	set := jwk.NewSet()
+	set.Add(pubkey)
+
+	signedRS256, err := jws.Sign(payload, jws.WithKey(jwa.RS256, key))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+	signedPS256, err := jws.Sign(payload, jws.WithKey(jwa.PS256, key))
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	keySet := jws.WithKeySet(set, jws.WithInferAlgorithmFromKey(true), jws.WithRequireKid(false))
+	t.Run("No policy", func(t *testing.T) {
+		for _, signed := range [][]byte{signedRS256, signedPS256} {
+			_, err := jws.Verify(signed, keySet)
+			if !assert.NoError(t, err, `jws.Verify should succeed`) {
+				return
+			}
+		}
+	})
+	t.Run("jws.WithAllowedAlgorithms", func(t *testing.T) {
+		_, err := jws.Verify(signedRS256, keySet, jws.WithAllowedAlgorithms(jwa.RS256))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signedPS256, keySet, jws.WithAllowedAlgorithms(jwa.RS256))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `algorithm "PS256" is not allowed`, `error should mention the algorithm`) {
+			return
+		}
+		_, err = jws.Verify(signedPS256, keySet, jws.WithAllowedAlgorithms(jwa.RS256), jws.WithAllowedAlgorithms(jwa.PS256))
+		if !assert.NoError(t, err, `algorithms should be accumulated`) {
+			return
+		}
+	})
+	t.Run("Detached payload reader", func(t *testing.T) {
+		signed, err := jws.Sign(nil, jws.WithKey(jwa.PS256, key), jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, keySet, jws.WithDetachedPayloadReader(bytes.NewReader(payload)), jws.WithAllowedAlgorithms(jwa.RS256))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `algorithm "PS256" is not allowed`, `error should mention the algorithm`) {
+			return
+		}
+	})
+	t.Run("Settings", func(t *testing.T) {
+		jws.Settings(jws.WithAllowedAlgorithms(jwa.RS256))
+		defer jws.Settings(jws.WithAllowedAlgorithms())
+
+		_, err := jws.Verify(signedPS256, keySet)
+		if !assert.Error(t, err, `jws.Verify should fail with the global policy`) {
+			return
+		}
+		_, err = jws.Verify(signedPS256, keySet, jws.WithAllowedAlgorithms(jwa.PS256))
+		if !assert.NoError(t, err, `jws.WithAllowedAlgorithms should override the global policy`) {
+			return
+		}
+		_, err = jws.Verify(signedPS256, keySet, jws.WithAllowedAlgorithms())
+		if !assert.Error(t, err, `empty jws.WithAllowedAlgorithms should not override the global policy`) {
+			return
+		}
+	})
+}
+
+func TestVerifyResult(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	key1, err := jwk.Generate(jwa.EC)
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	key2, err := jwk.Generate(jwa.RSA, jwk.WithThumbprintKeyID(true))
+	if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+		return
+	}
+	pubkey2, err := key2.PublicKey()
+	if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+		return
+	}
+	var rawPubkey2 rsa.PublicKey
+	if !assert.NoError(t, pubkey2.Raw(&rawPubkey2), `pubkey.Raw should succeed`) {
+		return
+	}
+	expectedThumbprint, err := pubkey2.Thumbprint(crypto.SHA256)
+	if !assert.NoError(t, err, `pubkey.Thumbprint should succeed`) {
+		return
+	}
+
+	hdrs := jws.NewHeaders()
+	if !assert.NoError(t, hdrs.Set(jws.KeyIDKey, key2.KeyID()), `hdrs.Set should succeed`) {
+		return
+	}
+	signed, err := jws.Sign(payload, jws.WithJSON(),
+		jws.WithKey(jwa.ES256, key1),
+		jws.WithKey(jwa.RS256, key2, jws.WithProtectedHeaders(hdrs)),
+	)
+	if !assert.NoError(t, err, `jws.Sign should succeed`) {
+		return
+	}
+
+	t.Run("Success", func(t *testing.T) {
+		for _, key := range []interface{}{pubkey2, &rawPubkey2} {
+			var result jws.VerifyResult
+			_, err := jws.Verify(signed, jws.WithKey(jwa.RS256, key), jws.WithVerifyResult(&result))
+			if !assert.NoError(t, err, `jws.Verify should succeed`) {
+				return
+			}
+			if !assert.Equal(t, 1, result.SignatureIndex(), `signature index should match`) {
+				return
+			}
+			if !assert.Equal(t, jwa.RS256, result.Algorithm(), `algorithm should match`) {
+				return
+			}
+			if !assert.Equal(t, key2.KeyID(), result.KeyID(), `key ID should match`) {
+				return
+			}
+			if !assert.Equal(t, key2.KeyID(), result.ProtectedHeaders().KeyID(), `protected headers should match`) {
+				return
+			}
+			if !assert.Equal(t, key, result.Key(), `key should match`) {
+				return
+			}
+			if !assert.Equal(t, expectedThumbprint, result.Thumbprint(), `thumbprint should match`) {
+				return
+			}
+			if !assert.Len(t, result.Failures(), 1, `there should be one failure`) {
+				return
+			}
+			failure := result.Failures()[0]
+			if !assert.Equal(t, 0, failure.SignatureIndex(), `failed signature index should match`) {
+				return
+			}
+			if !assert.Equal(t, key, failure.Key(), `failed key should match`) {
+				return
+			}
+		}
+	})
+	t.Run("Failure", func(t *testing.T) {
+		var result jws.VerifyResult
+		_, err := jws.Verify(signed, jws.WithKey(jwa.ES256, key1), jws.WithAllowedAlgorithms(jwa.RS256), jws.WithVerifyResult(&result))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+		if !assert.Equal(t, -1, result.SignatureIndex(), `signature index should be -1`) {
+			return
+		}
+		if !assert.Nil(t, result.Key(), `key should be nil`) {
+			return
+		}
+		if !assert.Len(t, result.Failures(), 2, `there should be two failures`) {
+			return
+		}
+		for i, failure := range result.Failures() {
+			if !assert.Equal(t, i, failure.SignatureIndex(), `failed signature index should match`) {
+				return
+			}
+			if !assert.Error(t, failure, `failure should be an error`) {
+				return
+			}
+		}
+	})
+	t.Run("Detached payload reader", func(t *testing.T) {
+		signed, err := jws.Sign(nil, jws.WithKey(jwa.RS256, key2), jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		var result jws.VerifyResult
+		_, err = jws.Verify(signed, jws.WithKey(jwa.RS256, pubkey2), jws.WithDetachedPayloadReader(bytes.NewReader(payload)), jws.WithVerifyResult(&result))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, 0, result.SignatureIndex(), `signature index should match`) {
+			return
+		}
+		if !assert.Equal(t, expectedThumbprint, result.Thumbprint(), `thumbprint should match`) {
+			return
+		}
+	})
+}
+
+func TestVerifyPolicy(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	var keys []jwk.Key
+	set := jwk.NewSet()
+	for i := 0; i < 3; i++ {
+		key, err := jwk.Generate(jwa.EC, jwk.WithAlgorithm(jwa.ES256), jwk.WithThumbprintKeyID(true))
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		keys = append(keys, key)
+		set.Add(pubkey)
+	}
+
+	sign := func(keys ...jwk.Key) []byte {
+		options := []jws.SignOption{jws.WithJSON()}
+		for _, key := range keys {
+			options = append(options, jws.WithKey(jwa.ES256, key))
+		}
+		signed, err := jws.Sign(payload, options...)
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			t.FailNow()
+		}
+		return signed
+	}
+
+	signedByAll := sign(keys...)
+	signedTwiceByOne := sign(keys[0], keys[1], keys[0])
+	signedByUnknown := sign(keys[0], keys[1], keys[2])
+
+	unknownSet := jwk.NewSet()
+	for i := 0; i < 2; i++ {
+		pubkey, err := keys[i].PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		unknownSet.Add(pubkey)
+	}
+
+	testcases := []struct {
+		Name   string
+		Signed []byte
+		Set    jwk.Set
+		Policy jws.VerifyPolicy
+		Error  bool
+	}{
+		{Name: "RequireAny", Signed: signedTwiceByOne, Set: set, Policy: jws.RequireAny()},
+		{Name: "RequireThreshold(3)", Signed: signedByAll, Set: set, Policy: jws.RequireThreshold(3)},
+		{Name: "RequireThreshold(3) with an unknown key", Signed: signedByUnknown, Set: unknownSet, Policy: jws.RequireThreshold(3), Error: true},
+		{Name: "RequireThreshold(2)", Signed: signedTwiceByOne, Set: set, Policy: jws.RequireThreshold(2)},
+		{Name: "RequireThreshold(2) with an unknown key", Signed: signedByUnknown, Set: unknownSet, Policy: jws.RequireThreshold(2)},
+		{Name: "RequireThreshold(3) with the same key twice", Signed: signedTwiceByOne, Set: set, Policy: jws.RequireThreshold(3), Error: true},
+		{Name: "RequireThreshold(4)", Signed: signedByAll, Set: set, Policy: jws.RequireThreshold(4), Error: true},
+		{Name: "RequireThreshold(0)", Signed: signedByAll, Set: set, Policy: jws.RequireThreshold(0), Error: true},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			_, err := jws.Verify(tc.Signed, jws.WithKeySet(tc.Set), jws.WithVerifyPolicy(tc.Policy))
+			if tc.Error {
+				if !assert.Error(t, err, `jws.Verify should fail`) {
+					return
+				}
+			} else {
+				if !assert.NoError(t, err, `jws.Verify should succeed`) {
+					return
+				}
+			}
+		})
+	}
+
+	t.Run("Stripped signatures", func(t *testing.T) {
+		msg, err := jws.Parse(signedByAll)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		stripped := jws.NewMessage().
+			SetPayload(msg.Payload()).
+			AppendSignature(msg.Signatures()[0])
+		signed, err := json.Marshal(stripped)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+
+		_, err = jws.Verify(signed, jws.WithKeySet(set))
+		if !assert.NoError(t, err, `jws.Verify should succeed with the default policy`) {
+			return
+		}
+		_, err = jws.Verify(signed, jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(3)))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Key provider errors", func(t *testing.T) {
+		notFound := jws.KeyProviderFunc(func(context.Context, jws.KeySink, *jws.Signature, *jws.Message) error {
+			return fmt.Errorf(`no key for this signature: %w`, jws.ErrKeyNotFound())
+		})
+		_, err := jws.Verify(signedByAll, jws.WithKeyProvider(notFound), jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(3)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+
+		failed := jws.KeyProviderFunc(func(context.Context, jws.KeySink, *jws.Signature, *jws.Message) error {
+			return fmt.Errorf(`failed to fetch key set`)
+		})
+		_, err = jws.Verify(signedByAll, jws.WithKeyProvider(failed), jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(3)))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+		if !assert.Contains(t, err.Error(), `failed to fetch key set`, `error should be propagated`) {
+			return
+		}
+	})
+	t.Run("VerifyResult", func(t *testing.T) {
+		var result jws.VerifyResult
+		_, err := jws.Verify(signedTwiceByOne, jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(2)), jws.WithVerifyResult(&result))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		verified := result.VerifiedSignatures()
+		if !assert.Len(t, verified, 2, `there should be two verified signatures`) {
+			return
+		}
+		for i, v := range verified {
+			if !assert.Equal(t, i, v.SignatureIndex(), `signature index should match`) {
+				return
+			}
+			if !assert.Equal(t, keys[i].KeyID(), v.KeyID(), `key ID should match`) {
+				return
+			}
+		}
+	})
+	t.Run("Detached payload reader", func(t *testing.T) {
+		signed, err := jws.Sign(nil, jws.WithJSON(), jws.WithKey(jwa.ES256, keys[0]), jws.WithKey(jwa.ES256, keys[0]), jws.WithDetachedPayloadReader(bytes.NewReader(payload)))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, jws.WithKeySet(set), jws.WithDetachedPayloadReader(bytes.NewReader(payload)), jws.WithVerifyPolicy(jws.RequireThreshold(2)))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+
+		signed, err = jws.Sign(nil, jws.WithJSON(), jws.WithKey(jwa.ES256, keys[0]), jws.WithKey(jwa.ES256, keys[1]), jws.WithDetachedPayloadReader(bytes.NewReader(payload)))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		_, err = jws.Verify(signed, jws.WithKeySet(set), jws.WithDetachedPayloadReader(bytes.NewReader(payload)), jws.WithVerifyPolicy(jws.RequireThreshold(2)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+}
+
+func TestMessageSign(t *testing.T) {
+	payload := []byte(`Lorem ipsum`)
+
+	var keys []jwk.Key
+	set := jwk.NewSet()
+	for i := 0; i < 2; i++ {
+		key, err := jwk.Generate(jwa.EC, jwk.WithAlgorithm(jwa.ES256), jwk.WithThumbprintKeyID(true))
+		if !assert.NoError(t, err, `jwk.Generate should succeed`) {
+			return
+		}
+		pubkey, err := key.PublicKey()
+		if !assert.NoError(t, err, `key.PublicKey should succeed`) {
+			return
+		}
+		keys = append(keys, key)
+		set.Add(pubkey)
+	}
+
+	t.Run("Append to compact serialization", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jws.WithKey(jwa.ES256, keys[0]))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+
+		msg, err := jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.NoError(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1])), `msg.Sign should succeed`) {
+			return
+		}
+		if !assert.Len(t, msg.Signatures(), 2, `there should be two signatures`) {
+			return
+		}
+
+		cosigned, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		verified, err := jws.Verify(cosigned, jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(2)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payload should match`) {
+			return
+		}
+	})
+	t.Run("Append to unencoded payload", func(t *testing.T) {
+		hdrs := jws.NewHeaders()
+		if !assert.NoError(t, hdrs.Set("b64", false), `hdrs.Set should succeed`) {
+			return
+		}
+		if !assert.NoError(t, hdrs.Set(jws.CriticalKey, []string{"b64"}), `hdrs.Set should succeed`) {
+			return
+		}
+		signed, err := jws.Sign(payload, jws.WithJSON(), jws.WithKey(jwa.ES256, keys[0], jws.WithProtectedHeaders(hdrs)))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		verified, err := jws.Verify(signed, jws.WithKeySet(set))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payload should match`) {
+			return
+		}
+
+		msg, err := jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.NoError(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1])), `msg.Sign should succeed`) {
+			return
+		}
+		protected := msg.Signatures()[1].ProtectedHeaders()
+		if !assert.Equal(t, []string{"b64"}, protected.Critical(), `"crit" should be set`) {
+			return
+		}
+
+		cosigned, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		verified, err = jws.Verify(cosigned, jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(2)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, payload, verified, `payload should match`) {
+			return
+		}
+	})
+	t.Run("Mismatched b64", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jws.WithJSON(), jws.WithKey(jwa.ES256, keys[0]))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		msg, err := jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+
+		hdrs := jws.NewHeaders()
+		if !assert.NoError(t, hdrs.Set("b64", false), `hdrs.Set should succeed`) {
+			return
+		}
+		if !assert.Error(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1], jws.WithProtectedHeaders(hdrs))), `msg.Sign should fail`) {
+			return
+		}
+		if !assert.Len(t, msg.Signatures(), 1, `signatures should not be modified`) {
+			return
+		}
+	})
+	t.Run("Detached payload", func(t *testing.T) {
+		signed, err := jws.Sign(nil, jws.WithKey(jwa.ES256, keys[0]), jws.WithDetachedPayload(payload))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		msg, err := jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.NoError(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1]), jws.WithDetachedPayload(payload)), `msg.Sign should succeed`) {
+			return
+		}
+		if !assert.Len(t, msg.Payload(), 0, `payload should not be stored in the message`) {
+			return
+		}
+
+		cosigned, err := json.Marshal(msg.SetPayload(payload))
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		_, err = jws.Verify(cosigned, jws.WithKeySet(set), jws.WithVerifyPolicy(jws.RequireThreshold(2)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+
+		msg, err = jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.Error(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1])), `msg.Sign should fail without the detached payload`) {
+			return
+		}
+	})
+	t.Run("Detached unencoded payload containing a period", func(t *testing.T) {
+		// RFC7797 only forbids "." in unencoded payloads for the compact
+		// serialization, so this must be allowed for JSON messages
+		detached := []byte(`x.y`)
+		hdrs := jws.NewHeaders()
+		if !assert.NoError(t, hdrs.Set("b64", false), `hdrs.Set should succeed`) {
+			return
+		}
+		if !assert.NoError(t, hdrs.Set(jws.CriticalKey, []string{"b64"}), `hdrs.Set should succeed`) {
+			return
+		}
+		signed, err := jws.Sign(nil, jws.WithJSON(), jws.WithKey(jwa.ES256, keys[0], jws.WithProtectedHeaders(hdrs)), jws.WithDetachedPayload(detached))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		msg, err := jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		// jws.Sign embeds the detached payload in JSON serialization, so
+		// remove it from the message to make it truly detached
+		msg.SetPayload(nil)
+
+		if !assert.NoError(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1]), jws.WithDetachedPayload(detached)), `msg.Sign should succeed`) {
+			return
+		}
+
+		cosigned, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		_, err = jws.Verify(cosigned, jws.WithKeySet(set), jws.WithDetachedPayload(detached), jws.WithVerifyPolicy(jws.RequireThreshold(2)))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+	t.Run("Unsupported options", func(t *testing.T) {
+		signed, err := jws.Sign(payload, jws.WithJSON(), jws.WithKey(jwa.ES256, keys[0]))
+		if !assert.NoError(t, err, `jws.Sign should succeed`) {
+			return
+		}
+		msg, err := jws.Parse(signed)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+
+		for _, option := range []jws.SignOption{jws.WithJSON(), jws.WithDetachedPayloadReader(bytes.NewReader(payload))} {
+			if !assert.Error(t, msg.Sign(jws.WithKey(jwa.ES256, keys[1]), option), `msg.Sign should fail with %s`, option.Ident()) {
+				return
+			}
+		}
+		if !assert.Len(t, msg.Signatures(), 1, `signatures should not be modified`) {
+			return
+		}
+	})
+}
+
+func TestRawProtectedHeaders(t *testing.T) {
+	key, err := jwk.ParseKey([]byte(`{
+    "kty": "oct",
+    "k": "AyM1SysPpbyDfgZld3umj1qzKObwVMkoqQ-EstJQLr_T-1qS0gZH75aKtMN3Yj0iPS4hcgUuTwjAzZr1Z9CAow"
+  }`))
+	if !assert.NoError(t, err, `jwk.ParseKey should succeed`) {
+		return
+	}
+	const rawProtected = `eyJ0eXAiOiJKV1QiLA0KICJhbGciOiJIUzI1NiJ9`
+
+	msg, err := jws.Parse([]byte(exampleCompactSerialization))
+	if !assert.NoError(t, err, `jws.Parse should succeed`) {
+		return
+	}
+
+	t.Run("JSON serialization", func(t *testing.T) {
+		serialized, err := json.Marshal(msg)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		if !assert.Contains(t, string(serialized), `"protected":"`+rawProtected+`"`, `original protected header should be used`) {
+			return
+		}
+		payload, err := jws.Verify(serialized, jws.WithKey(jwa.HS256, key))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, examplePayload, string(payload), `payload should match`) {
+			return
+		}
+
+		// parse the JSON serialization, and convert it back to compact form
+		parsed, err := jws.Parse(serialized)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		compact, err := jws.Compact(parsed)
+		if !assert.NoError(t, err, `jws.Compact should succeed`) {
+			return
+		}
+		if !assert.Equal(t, exampleCompactSerialization, string(compact), `compact serialization should match`) {
+			return
+		}
+	})
+	t.Run("Multiple signatures", func(t *testing.T) {
+		cosigner, err := jwxtest.GenerateEcdsaJwk()
+		if !assert.NoError(t, err, `jwxtest.GenerateEcdsaJwk should succeed`) {
+			return
+		}
+		parsed, err := jws.Parse([]byte(exampleCompactSerialization))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.NoError(t, parsed.Sign(jws.WithKey(jwa.ES256, cosigner)), `parsed.Sign should succeed`) {
+			return
+		}
+
+		serialized, err := json.Marshal(parsed)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		reparsed, err := jws.Parse(serialized)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		serialized, err = json.Marshal(reparsed)
+		if !assert.NoError(t, err, `json.Marshal should succeed`) {
+			return
+		}
+		_, err = jws.Verify(serialized, jws.WithKey(jwa.HS256, key))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+	})
+	t.Run("Modified protected headers", func(t *testing.T) {
+		parsed, err := jws.Parse([]byte(exampleCompactSerialization))
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		if !assert.NoError(t, parsed.Signatures()[0].ProtectedHeaders().Set(jws.KeyIDKey, `my-key`), `Set should succeed`) {
+			return
+		}
+
+		compact, err := jws.Compact(parsed)
+		if !assert.NoError(t, err, `jws.Compact should succeed`) {
+			return
+		}
+		if !assert.False(t, strings.HasPrefix(string(compact), rawProtected+`.`), `original protected header should not be used`) {
+			return
+		}
+		_, err = jws.Verify(compact, jws.WithKey(jwa.HS256, key))
+		if !assert.Error(t, err, `jws.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Header that does not survive a round trip", func(t *testing.T) {
+		// 1.0 is serialized as 1, so the header can't be reproduced
+		// from the parsed values: jws.Verify must use the original
+		hdr := base64.EncodeToString([]byte(`{"alg":"HS256","x":1.0}`))
+		input := hdr + `.` + base64.EncodeToString([]byte(`Lorem ipsum`))
+
+		signer, err := jws.NewSigner(jwa.HS256)
+		if !assert.NoError(t, err, `jws.NewSigner should succeed`) {
+			return
+		}
+		var raw []byte
+		if !assert.NoError(t, key.Raw(&raw), `key.Raw should succeed`) {
+			return
+		}
+		signature, err := signer.Sign([]byte(input), raw)
+		if !assert.NoError(t, err, `signer.Sign should succeed`) {
+			return
+		}
+
+		payload, err := jws.Verify([]byte(input+`.`+base64.EncodeToString(signature)), jws.WithKey(jwa.HS256, key))
+		if !assert.NoError(t, err, `jws.Verify should succeed`) {
+			return
+		}
+		if !assert.Equal(t, []byte(`Lorem ipsum`), payload, `payload should match`) {
+			return
+		}
+	})
+}
@@ -2,10 +2,13 @@ package jws
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
 
+	"github.com/lestrrat-go/jwx/v2/cert"
 	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 )
@@ -158,9 +161,9 @@ func (kp *keySetProvider) FetchKeys(_ context.Context, sink KeySink, sig *Signat
 			// If the kid is NOT specified... kp.useDefault needs to be true, and the
 			// JWKs must have exactly one key in it
 			if !kp.useDefault {
-				return fmt.Errorf(`failed to find matching key: no key ID ("kid") specified in token`)
+				return fmt.Errorf(`failed to find matching key: no key ID ("kid") specified in token: %w`, errKeyNotFound)
 			} else if kp.useDefault && kp.set.Len() > 1 {
-				return fmt.Errorf(`failed to find matching key: no key ID ("kid") specified in token but multiple keys available in key set`)
+				return fmt.Errorf(`failed to find matching key: no key ID ("kid") specified in token but multiple keys available in key set: %w`, errKeyNotFound)
 			}
 
 			// if we got here, then useDefault == true AND there is exactly
@@ -170,7 +173,7 @@ func (kp *keySetProvider) FetchKeys(_ context.Context, sink KeySink, sig *Signat
 			// Otherwise we better be able to look up the key, baby.
 			v, ok := kp.set.LookupKeyID(wantedKid)
 			if !ok {
-				return fmt.Errorf(`failed to find key with key ID %q in key set`, wantedKid)
+				return fmt.Errorf(`failed to find key with key ID %q in key set: %w`, wantedKid, errKeyNotFound)
 			}
 			key = v
 		}
@@ -195,7 +198,7 @@ type jkuProvider struct {
 func (kp jkuProvider) FetchKeys(ctx context.Context, sink KeySink, sig *Signature, _ *Message) error {
 	kid := sig.ProtectedHeaders().KeyID()
 	if kid == "" {
-		return fmt.Errorf(`use of "jku" requires that the payload contain a "kid" field in the protected header`)
+		return fmt.Errorf(`use of "jku" requires that the payload contain a "kid" field in the protected header: %w`, errKeyNotFound)
 	}
 
 	// errors here can't be reliablly passed to the consumers.
@@ -203,7 +206,7 @@ func (kp jkuProvider) FetchKeys(ctx context.Context, sink KeySink, sig *Signatur
 	// going to have to write your own fetcher
 	u := sig.ProtectedHeaders().JWKSetURL()
 	if u == "" {
-		return fmt.Errorf(`use of "jku" field specified, but the field is empty`)
+		return fmt.Errorf(`use of "jku" field specified, but the field is empty: %w`, errKeyNotFound)
 	}
 	uo, err := url.Parse(u)
 	if err != nil {
@@ -243,6 +246,163 @@ func (kp jkuProvider) FetchKeys(ctx context.Context, sink KeySink, sig *Signatur
 	return nil
 }
 
+const defaultMinRefreshInterval = 5 * time.Minute
+
+type cachedKeyProvider struct {
+	cache          *jwk.Cache
+	url            string
+	minInterval    time.Duration
+	keySetProvider keySetProvider
+}
+
+// NewCachedKeyProvider creates a KeyProvider that provides keys from
+// the JWKS stored in `cache` under the URL `u`. The URL must be registered
+// in the cache before the provider is used.
+//
+// When a message refers to a key ID (`kid`) that is not in the JWKS, the
+// JWKS is refreshed before giving up, so that newly added keys can be used
+// as soon as the issuer starts using them. Concurrent refreshes are coalesced
+// into a single request, and refreshes are performed at most once every
+// interval specified by `jws.WithMinRefreshInterval()`, so that messages with
+// random key IDs cannot be used to flood the JWKS URL with requests. See
+// `(jwk.Cache).RefreshWithMinInterval()` for details. As the refreshes are
+// tracked by the cache for each URL, the limit applies to all providers
+// that use the same cache and URL.
+//
+// It can be passed to `jws.Verify()` using `jws.WithKeyProvider()`, and
+// to `jwt.Parse()` using `jwt.WithKeyProvider()`.
+//
+// Keys are selected in the same manner as `jws.WithKeySet()`, and the
+// suboptions for `jws.WithKeySet()` can be used to control the behavior.
+func NewCachedKeyProvider(cache *jwk.Cache, u string, options ...CachedKeyProviderOption) KeyProvider {
+	minInterval := defaultMinRefreshInterval
+	requireKid := true
+	var useDefault, inferAlgorithm bool
+	for _, option := range options {
+		//nolint:forcetypeassert
+		switch option.Ident() {
+		case identMinRefreshInterval{}:
+			minInterval = option.Value().(time.Duration)
+		case identRequireKid{}:
+			requireKid = option.Value().(bool)
+		case identUseDefault{}:
+			useDefault = option.Value().(bool)
+		case identInferAlgorithmFromKey{}:
+			inferAlgorithm = option.Value().(bool)
+		}
+	}
+
+	return &cachedKeyProvider{
+		cache:       cache,
+		url:         u,
+		minInterval: minInterval,
+		keySetProvider: keySetProvider{
+			requireKid:     requireKid,
+			useDefault:     useDefault,
+			inferAlgorithm: inferAlgorithm,
+		},
+	}
+}
+
+func (kp *cachedKeyProvider) FetchKeys(ctx context.Context, sink KeySink, sig *Signature, msg *Message) error {
+	set, err := kp.cache.Get(ctx, kp.url)
+	if err != nil {
+		return fmt.Errorf(`failed to fetch %q: %w`, kp.url, err)
+	}
+
+	if kid := sig.ProtectedHeaders().KeyID(); kid != "" {
+		if _, ok := set.LookupKeyID(kid); !ok {
+			refreshed, err := kp.cache.RefreshWithMinInterval(ctx, kp.url, kp.minInterval)
+			if err != nil {
+				return fmt.Errorf(`failed to refresh %q: %w`, kp.url, err)
+			}
+			set = refreshed
+		}
+	}
+
+	ksp := kp.keySetProvider
+	ksp.set = set
+	return ksp.FetchKeys(ctx, sink, sig, msg)
+}
+
+type x509KeyProvider struct {
+	roots   *x509.CertPool
+	options []jwk.ValidateX509Option
+}
+
+// NewX509KeyProvider creates a KeyProvider that verifies signatures using
+// the public key of the leaf certificate in the "x5c" field of the protected
+// header. The certificate chain is validated against `roots` using
+// `jwk.ValidateX509()` before the key is used, and the "x5t" and "x5t#S256"
+// fields of the protected header, if present, must match the leaf certificate.
+//
+// `roots` must not be nil. The options are passed to `jwk.ValidateX509()`,
+// which requires that the extended key usages are specified using
+// `jwk.WithX509ExtKeyUsage()`
+func NewX509KeyProvider(roots *x509.CertPool, options ...jwk.ValidateX509Option) (KeyProvider, error) {
+	if roots == nil {
+		return nil, fmt.Errorf(`jws.NewX509KeyProvider: roots must not be nil`)
+	}
+	return &x509KeyProvider{
+		roots:   roots,
+		options: options,
+	}, nil
+}
+
+func (kp *x509KeyProvider) FetchKeys(_ context.Context, sink KeySink, sig *Signature, _ *Message) error {
+	hdrs := sig.ProtectedHeaders()
+	chain := hdrs.X509CertChain()
+	if chain == nil || chain.Len() == 0 {
+		return fmt.Errorf(`use of "x5c" requires that the protected header contain a "x5c" field: %w`, errKeyNotFound)
+	}
+
+	der, _ := chain.Get(0)
+	leaf, err := cert.Parse(der)
+	if err != nil {
+		return fmt.Errorf(`failed to parse leaf certificate in "x5c": %w`, err)
+	}
+
+	key, err := jwk.FromRaw(leaf.PublicKey)
+	if err != nil {
+		return fmt.Errorf(`failed to create key from leaf certificate in "x5c": %w`, err)
+	}
+	if err := key.Set(jwk.X509CertChainKey, chain); err != nil {
+		return fmt.Errorf(`failed to set %q: %w`, jwk.X509CertChainKey, err)
+	}
+	if v := hdrs.X509CertThumbprint(); v != "" {
+		if err := key.Set(jwk.X509CertThumbprintKey, v); err != nil {
+			return fmt.Errorf(`failed to set %q: %w`, jwk.X509CertThumbprintKey, err)
+		}
+	}
+	if v := hdrs.X509CertThumbprintS256(); v != "" {
+		if err := key.Set(jwk.X509CertThumbprintS256Key, v); err != nil {
+			return fmt.Errorf(`failed to set %q: %w`, jwk.X509CertThumbprintS256Key, err)
+		}
+	}
+
+	if _, err := jwk.ValidateX509(key, kp.roots, kp.options...); err != nil {
+		return fmt.Errorf(`failed to validate "x5c": %w`, err)
+	}
+
+	algs, err := AlgorithmsForKey(key)
+	if err != nil {
+		return fmt.Errorf(`failed to get a list of signature methods for key type %s: %w`, key.KeyType(), err)
+	}
+
+	hdrAlg := hdrs.Algorithm()
+	for _, alg := range algs {
+		// if we have a "alg" field in the JWS, we can only proceed if
+		// the inferred algorithm matches
+		if hdrAlg != "" && hdrAlg != alg {
+			continue
+		}
+
+		sink.Key(alg, leaf.PublicKey)
+		break
+	}
+	return nil
+}
+
 // KeyProviderFunc is a type of KeyProvider that is implemented by
 // a single function. You can use this to create ad-hoc `KeyProvider`
 // instances.
@@ -4,10 +4,14 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
 
 	"github.com/lestrrat-go/jwx/v2/internal/base64"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
 	"github.com/lestrrat-go/jwx/v2/internal/pool"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 )
 
@@ -71,6 +75,7 @@ func (s *Signature) UnmarshalJSON(data []byte) error {
 			if err != nil {
 				return fmt.Errorf(`failed to base64 decode protected headers: %w`, err)
 			}
+			s.rawProtected = src
 			src = decoded
 		}
 
@@ -100,30 +105,9 @@ func (s *Signature) UnmarshalJSON(data []byte) error {
 // The second return value s the full three-segment signature
 // (e.g. "eyXXXX.XXXXX.XXXX")
 func (s *Signature) Sign(payload []byte, signer Signer, key interface{}) ([]byte, []byte, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	hdrs, err := mergeHeaders(ctx, s.headers, s.protected)
-	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to merge headers: %w`, err)
-	}
-
-	if err := hdrs.Set(AlgorithmKey, signer.Algorithm()); err != nil {
-		return nil, nil, fmt.Errorf(`failed to set "alg": %w`, err)
-	}
-
-	// If the key is a jwk.Key instance, obtain the raw key
-	if jwkKey, ok := key.(jwk.Key); ok {
-		// If we have a key ID specified by this jwk.Key, use that in the header
-		if kid := jwkKey.KeyID(); kid != "" {
-			if err := hdrs.Set(jwk.KeyIDKey, kid); err != nil {
-				return nil, nil, fmt.Errorf(`set key ID from jwk.Key: %w`, err)
-			}
-		}
-	}
-	hdrbuf, err := json.Marshal(hdrs)
+	hdrs, hdrbuf, err := s.signingHeaders(signer, key)
 	if err != nil {
-		return nil, nil, fmt.Errorf(`failed to marshal headers: %w`, err)
+		return nil, nil, err
 	}
 
 	buf := pool.GetBytesBuffer()
@@ -167,6 +151,37 @@ func (s *Signature) Sign(payload []byte, signer Signer, key interface{}) ([]byte
 	return signature, ret, nil
 }
 
+// signingHeaders returns the headers that are used to create the
+// signing input, along with their JSON representation
+func (s *Signature) signingHeaders(signer Signer, key interface{}) (Headers, []byte, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hdrs, err := mergeHeaders(ctx, s.headers, s.protected)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to merge headers: %w`, err)
+	}
+
+	if err := hdrs.Set(AlgorithmKey, signer.Algorithm()); err != nil {
+		return nil, nil, fmt.Errorf(`failed to set "alg": %w`, err)
+	}
+
+	// If the key is a jwk.Key instance, obtain the raw key
+	if jwkKey, ok := key.(jwk.Key); ok {
+		// If we have a key ID specified by this jwk.Key, use that in the header
+		if kid := jwkKey.KeyID(); kid != "" {
+			if err := hdrs.Set(jwk.KeyIDKey, kid); err != nil {
+				return nil, nil, fmt.Errorf(`set key ID from jwk.Key: %w`, err)
+			}
+		}
+	}
+	hdrbuf, err := json.Marshal(hdrs)
+	if err != nil {
+		return nil, nil, fmt.Errorf(`failed to marshal headers: %w`, err)
+	}
+	return hdrs, hdrbuf, nil
+}
+
 func NewMessage() *Message {
 	return &Message{}
 }
@@ -215,6 +230,115 @@ func (m *Message) ClearSignatures() *Message {
 	return m
 }
 
+// Sign appends new signatures to the message, one for each `jws.WithKey()`
+// option. The existing signatures are not verified, nor modified. This
+// allows multiple parties to sign the same payload independently: each
+// party parses the message using `jws.Parse()`, calls `Sign()`, and
+// serializes the message using `json.Marshal()`.
+//
+// The new signatures are computed over the payload of the message, using
+// the same "b64" mode as the existing signatures. If the message does not
+// contain the payload, it must be specified using `jws.WithDetachedPayload()`.
+//
+// `jws.WithKeyUsageCheck()` is honored in the same way as `jws.Sign()`.
+// Other options, such as `jws.WithJSON()`, are rejected.
+func (m *Message) Sign(options ...SignOption) error {
+	var signers []*payloadSigner
+	var detachedPayload []byte
+	checkUsage := atomic.LoadUint32(&keyUsageCheck) == 1
+	for _, option := range options {
+		//nolint:forcetypeassert
+		switch option.Ident() {
+		case identKey{}:
+			data := option.Value().(*withKey)
+
+			alg, ok := data.alg.(jwa.SignatureAlgorithm)
+			if !ok {
+				return fmt.Errorf(`jws.Message.Sign: expected algorithm to be of type jwa.SignatureAlgorithm but got (%[1]q, %[1]T)`, data.alg)
+			}
+			signer, err := makeSigner(alg, data.key, data.public, data.protected)
+			if err != nil {
+				return fmt.Errorf(`jws.Message.Sign: failed to create signer: %w`, err)
+			}
+			signers = append(signers, signer)
+		case identDetachedPayload{}:
+			detachedPayload = option.Value().([]byte)
+		case identKeyUsageCheck{}:
+			checkUsage = option.Value().(bool)
+		default:
+			return fmt.Errorf(`jws.Message.Sign: invalid jws.SignOption %q passed`, `With`+strings.TrimPrefix(fmt.Sprintf(`%T`, option.Ident()), `jws.ident`))
+		}
+	}
+
+	if len(signers) == 0 {
+		return fmt.Errorf(`jws.Message.Sign: no signers available. Specify an algorithm and a key using jws.WithKey()`)
+	}
+
+	payload := m.payload
+	if detachedPayload != nil {
+		if len(payload) != 0 {
+			return fmt.Errorf(`jws.Message.Sign: can't specify detached payload for JWS with payload`)
+		}
+		payload = detachedPayload
+	} else if len(payload) == 0 {
+		return fmt.Errorf(`jws.Message.Sign: message does not contain a payload. Specify the detached payload using jws.WithDetachedPayload()`)
+	}
+
+	if checkUsage {
+		for i, signer := range signers {
+			if err := checkKeyUsage(signer.key, signer.Algorithm(), jwk.KeyOpSign); err != nil {
+				return fmt.Errorf(`jws.Message.Sign: key for signer #%d cannot be used: %w`, i, err)
+			}
+		}
+	}
+
+	b64 := m.payloadB64()
+	sigs := make([]*Signature, 0, len(signers))
+	for i, signer := range signers {
+		sig, err := signer.newSignature(detachedPayload != nil)
+		if err != nil {
+			return fmt.Errorf(`jws.Message.Sign: %w`, err)
+		}
+
+		if _, ok := sig.protected.Get("b64"); ok {
+			if getB64Value(sig.protected) != b64 {
+				return fmt.Errorf(`jws.Message.Sign: b64 value must be the same for all signatures`)
+			}
+		} else if !b64 {
+			if err := setUnencodedPayload(sig.protected); err != nil {
+				return fmt.Errorf(`jws.Message.Sign: %w`, err)
+			}
+		}
+
+		if _, _, err := sig.Sign(payload, signer.signer, signer.key); err != nil {
+			return fmt.Errorf(`jws.Message.Sign: failed to generate signature for signer #%d (alg=%s): %w`, i, signer.Algorithm(), err)
+		}
+		sigs = append(sigs, sig)
+	}
+
+	m.signatures = append(m.signatures, sigs...)
+	return nil
+}
+
+// setUnencodedPayload sets "b64": false in the protected headers, and
+// adds "b64" to the "crit" header as required by RFC7797
+func setUnencodedPayload(hdrs Headers) error {
+	if err := hdrs.Set("b64", false); err != nil {
+		return fmt.Errorf(`failed to set "b64" header: %w`, err)
+	}
+
+	critical := hdrs.Critical()
+	for _, name := range critical {
+		if name == "b64" {
+			return nil
+		}
+	}
+	if err := hdrs.Set(CriticalKey, append(append([]string(nil), critical...), "b64")); err != nil {
+		return fmt.Errorf(`failed to set "crit" header: %w`, err)
+	}
+	return nil
+}
+
 // LookupSignature looks up a particular signature entry using
 // the `kid` value
 func (m Message) LookupSignature(kid string) []*Signature {
@@ -309,6 +433,7 @@ func (m *Message) UnmarshalJSON(buf []byte) error {
 			//nolint:forcetypeassert
 			prt.(*stdHeaders).SetDecodeCtx(nil)
 			sig.protected = prt
+			sig.rawProtected = []byte(*src)
 		}
 
 		decoded, err := base64.DecodeString(*mup.Signature)
@@ -343,6 +468,38 @@ func (m Message) MarshalJSON() ([]byte, error) {
 	return m.marshalFull()
 }
 
+// writePayload writes the value of the "payload" member. The payload
+// is base64 encoded, unless the signatures specify "b64": false
+func (m Message) writePayload(buf *bytes.Buffer) error {
+	if m.payloadB64() {
+		buf.WriteRune('"')
+		buf.WriteString(base64.EncodeToString(m.payload))
+		buf.WriteRune('"')
+		return nil
+	}
+
+	// A JSON string can only hold valid UTF-8: anything else would be
+	// replaced, and the payload would no longer match the signatures
+	if !utf8.Valid(m.payload) {
+		return fmt.Errorf(`unencoded "payload" must be valid UTF-8 in JSON serialization`)
+	}
+	encoded, err := json.Marshal(string(m.payload))
+	if err != nil {
+		return fmt.Errorf(`failed to marshal "payload": %w`, err)
+	}
+	buf.Write(encoded)
+	return nil
+}
+
+// payloadB64 returns the "b64" value of the signatures. All signatures
+// in a message must have the same value
+func (m Message) payloadB64() bool {
+	if len(m.signatures) == 0 || m.signatures[0].protected == nil {
+		return true
+	}
+	return getB64Value(m.signatures[0].protected)
+}
+
 func (m Message) marshalFlattened() ([]byte, error) {
 	buf := pool.GetBytesBuffer()
 	defer pool.ReleaseBytesBuffer(buf)
@@ -365,17 +522,18 @@ func (m Message) marshalFlattened() ([]byte, error) {
 	if wrote {
 		buf.WriteRune(',')
 	}
-	buf.WriteString(`"payload":"`)
-	buf.WriteString(base64.EncodeToString(m.payload))
-	buf.WriteRune('"')
+	buf.WriteString(`"payload":`)
+	if err := m.writePayload(buf); err != nil {
+		return nil, err
+	}
 
-	if protected := sig.protected; protected != nil {
-		protectedbuf, err := protected.MarshalJSON()
+	if sig.protected != nil {
+		protected, err := encodeProtectedHeader(sig)
 		if err != nil {
 			return nil, fmt.Errorf(`failed to marshal "protected" (flattened format): %w`, err)
 		}
 		buf.WriteString(`,"protected":"`)
-		buf.WriteString(base64.EncodeToString(protectedbuf))
+		buf.WriteString(protected)
 		buf.WriteRune('"')
 	}
 
@@ -393,9 +551,11 @@ func (m Message) marshalFull() ([]byte, error) {
 	buf := pool.GetBytesBuffer()
 	defer pool.ReleaseBytesBuffer(buf)
 
-	buf.WriteString(`{"payload":"`)
-	buf.WriteString(base64.EncodeToString(m.payload))
-	buf.WriteString(`","signatures":[`)
+	buf.WriteString(`{"payload":`)
+	if err := m.writePayload(buf); err != nil {
+		return nil, err
+	}
+	buf.WriteString(`,"signatures":[`)
 	for i, sig := range m.signatures {
 		if i > 0 {
 			buf.WriteRune(',')
@@ -413,8 +573,8 @@ func (m Message) marshalFull() ([]byte, error) {
 			wrote = true
 		}
 
-		if protected := sig.protected; protected != nil {
-			protectedbuf, err := protected.MarshalJSON()
+		if sig.protected != nil {
+			protected, err := encodeProtectedHeader(sig)
 			if err != nil {
 				return nil, fmt.Errorf(`failed to marshal "protected" for signature #%d: %w`, i+1, err)
 			}
@@ -422,7 +582,7 @@ func (m Message) marshalFull() ([]byte, error) {
 				buf.WriteRune(',')
 			}
 			buf.WriteString(`"protected":"`)
-			buf.WriteString(base64.EncodeToString(protectedbuf))
+			buf.WriteString(protected)
 			buf.WriteRune('"')
 			wrote = true
 		}
@@ -466,7 +626,7 @@ func Compact(msg *Message, options ...CompactOption) ([]byte, error) {
 	// XXX check if this is correct
 	hdrs := s.ProtectedHeaders()
 
-	hdrbuf, err := json.Marshal(hdrs)
+	hdrbuf, err := encodeProtectedHeader(s)
 	if err != nil {
 		return nil, fmt.Errorf(`jws.Compress: failed to marshal headers: %w`, err)
 	}
@@ -474,7 +634,7 @@ func Compact(msg *Message, options ...CompactOption) ([]byte, error) {
 	buf := pool.GetBytesBuffer()
 	defer pool.ReleaseBytesBuffer(buf)
 
-	buf.WriteString(base64.EncodeToString(hdrbuf))
+	buf.WriteString(hdrbuf)
 	buf.WriteByte('.')
 
 	if !detached {
@@ -72,6 +72,8 @@ func (w *withKey) Protected(v Headers) Headers {
 // `crypto.Signer` is currently supported for RSA, ECDSA, and EdDSA
 // family of algorithms. You may consider using `github.com/jwx-go/crypto-signer`
 // if you would like to use keys stored in GCP/AWS KMS services.
+// The value returned by the `crypto.Signer`'s `Public()` method must
+// match the algorithm (e.g. `*rsa.PublicKey` for `jwa.RS256`)
 //
 // If the key is a jwk.Key and the key contains a key ID (`kid` field),
 // then it is added to the protected header generated by the signature.
@@ -154,3 +156,36 @@ func WithVerifyAuto(f jwk.Fetcher, options ...jwk.FetchOption) VerifyOption {
 		options: options,
 	})
 }
+
+// WithCriticalExtensions specifies the names of the header parameters
+// listed in the "crit" header that the caller understands and processes.
+//
+// By default `jws.Verify()` rejects signatures whose "crit" header
+// contains extensions other than those processed by this package
+// (currently only "b64"). Specifying names via this option tells
+// `jws.Verify()` that the application will handle those extensions
+// on its own, and that it is safe to accept them.
+//
+// This option may be specified multiple times, in which case the
+// names are accumulated.
+func WithCriticalExtensions(names ...string) VerifyOption {
+	return &verifyOption{option.New(identCriticalExtensions{}, names)}
+}
+
+// WithAllowedAlgorithms specifies the signature algorithms that are
+// accepted by `jws.Verify()`. Signatures whose "alg" header is not
+// listed are rejected before any keys are looked up, so keys that
+// support multiple algorithms (e.g. when `jws.WithInferAlgorithmFromKey()`
+// or `jws.WithVerifyAuto()` is used) cannot be used with algorithms
+// that the application did not expect.
+//
+// When passed to `jws.Settings()`, the list replaces the global list
+// that applies to all subsequent calls to `jws.Verify()`. When passed
+// to `jws.Verify()`, it replaces the global list for that call, and
+// may be specified multiple times, in which case the algorithms are
+// accumulated. An empty list passed to `jws.Settings()` allows all
+// algorithms, which is the default. An empty list passed to `jws.Verify()`
+// is an error.
+func WithAllowedAlgorithms(algs ...jwa.SignatureAlgorithm) GlobalVerifyOption {
+	return &globalVerifyOption{option.New(identAllowedAlgorithms{}, algs)}
+}
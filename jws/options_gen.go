@@ -4,13 +4,27 @@ package jws
 
 import (
 	"context"
+	"io"
 	"io/fs"
+	"time"
 
 	"github.com/lestrrat-go/option"
 )
 
 type Option = option.Interface
 
+// CachedKeyProviderOption describes options that can be passed to `jws.NewCachedKeyProvider()`
+type CachedKeyProviderOption interface {
+	Option
+	cachedKeyProviderOption()
+}
+
+type cachedKeyProviderOption struct {
+	Option
+}
+
+func (*cachedKeyProviderOption) cachedKeyProviderOption() {}
+
 // CompactOption describes options that can be passed to `jws.Compact`
 type CompactOption interface {
 	Option
@@ -23,6 +37,53 @@ type compactOption struct {
 
 func (*compactOption) compactOption() {}
 
+// GlobalOption describes options that can be passed to `jws.Settings()`
+type GlobalOption interface {
+	Option
+	globalOption()
+}
+
+type globalOption struct {
+	Option
+}
+
+func (*globalOption) globalOption() {}
+
+// GlobalSignVerifyOption describes options that can be passed to `jws.Settings()`,
+// as well as to `jws.Sign()` and `jws.Verify()`
+type GlobalSignVerifyOption interface {
+	Option
+	globalOption()
+	signOption()
+	verifyOption()
+}
+
+type globalSignVerifyOption struct {
+	Option
+}
+
+func (*globalSignVerifyOption) globalOption() {}
+
+func (*globalSignVerifyOption) signOption() {}
+
+func (*globalSignVerifyOption) verifyOption() {}
+
+// GlobalVerifyOption describes options that can be passed to `jws.Settings()`,
+// as well as to `jws.Verify()`
+type GlobalVerifyOption interface {
+	Option
+	globalOption()
+	verifyOption()
+}
+
+type globalVerifyOption struct {
+	Option
+}
+
+func (*globalVerifyOption) globalOption() {}
+
+func (*globalVerifyOption) verifyOption() {}
+
 // ReadFileOption is a type of `Option` that can be passed to `jwe.Parse`
 type ParseOption interface {
 	Option
@@ -98,10 +159,13 @@ type withJSONSuboption struct {
 
 func (*withJSONSuboption) withJSONSuboption() {}
 
-// WithKeySetSuboption is a suboption passed to the `jws.WithKeySet()` option
+// WithKeySetSuboption is a suboption passed to the `jws.WithKeySet()` option.
+// WithKeySetSuboption also implements CachedKeyProviderOption, therefore
+// it may be safely passed to `jws.NewCachedKeyProvider()`
 type WithKeySetSuboption interface {
 	Option
 	withKeySetSuboption()
+	cachedKeyProviderOption()
 }
 
 type withKeySetSuboption struct {
@@ -110,6 +174,8 @@ type withKeySetSuboption struct {
 
 func (*withKeySetSuboption) withKeySetSuboption() {}
 
+func (*withKeySetSuboption) cachedKeyProviderOption() {}
+
 // WithKeySuboption describes option types that can be passed to the `jws.WithKey()`
 // option.
 type WithKeySuboption interface {
@@ -123,26 +189,41 @@ type withKeySuboption struct {
 
 func (*withKeySuboption) withKeySuboption() {}
 
+type identAllowedAlgorithms struct{}
 type identContext struct{}
+type identCriticalExtensions struct{}
 type identDetached struct{}
 type identDetachedPayload struct{}
+type identDetachedPayloadReader struct{}
 type identFS struct{}
 type identInferAlgorithmFromKey struct{}
 type identKey struct{}
 type identKeyProvider struct{}
+type identKeyUsageCheck struct{}
 type identKeyUsed struct{}
 type identMessage struct{}
+type identMinRefreshInterval struct{}
 type identPretty struct{}
 type identProtectedHeaders struct{}
 type identPublicHeaders struct{}
 type identRequireKid struct{}
 type identSerialization struct{}
 type identUseDefault struct{}
+type identVerifyPolicy struct{}
+type identVerifyResult struct{}
+
+func (identAllowedAlgorithms) String() string {
+	return "WithAllowedAlgorithms"
+}
 
 func (identContext) String() string {
 	return "WithContext"
 }
 
+func (identCriticalExtensions) String() string {
+	return "WithCriticalExtensions"
+}
+
 func (identDetached) String() string {
 	return "WithDetached"
 }
@@ -151,6 +232,10 @@ func (identDetachedPayload) String() string {
 	return "WithDetachedPayload"
 }
 
+func (identDetachedPayloadReader) String() string {
+	return "WithDetachedPayloadReader"
+}
+
 func (identFS) String() string {
 	return "WithFS"
 }
@@ -167,6 +252,10 @@ func (identKeyProvider) String() string {
 	return "WithKeyProvider"
 }
 
+func (identKeyUsageCheck) String() string {
+	return "WithKeyUsageCheck"
+}
+
 func (identKeyUsed) String() string {
 	return "WithKeyUsed"
 }
@@ -175,6 +264,10 @@ func (identMessage) String() string {
 	return "WithMessage"
 }
 
+func (identMinRefreshInterval) String() string {
+	return "WithMinRefreshInterval"
+}
+
 func (identPretty) String() string {
 	return "WithPretty"
 }
@@ -192,13 +285,21 @@ func (identRequireKid) String() string {
 }
 
 func (identSerialization) String() string {
-	return "WithSerialization"
+	return "WithCompact"
 }
 
 func (identUseDefault) String() string {
 	return "WithUseDefault"
 }
 
+func (identVerifyPolicy) String() string {
+	return "WithVerifyPolicy"
+}
+
+func (identVerifyResult) String() string {
+	return "WithVerifyResult"
+}
+
 func WithContext(v context.Context) VerifyOption {
 	return &verifyOption{option.New(identContext{}, v)}
 }
@@ -221,6 +322,23 @@ func WithDetachedPayload(v []byte) SignVerifyOption {
 	return &signVerifyOption{option.New(identDetachedPayload{}, v)}
 }
 
+// WithDetachedPayloadReader is the same as WithDetachedPayload, but reads the
+// detached payload from an io.Reader. The payload is processed incrementally,
+// and is never held in memory as a whole, which makes this option suitable
+// for signing and verifying large payloads.
+//
+// Only algorithms that sign a digest of the signing input (HMAC, RSA, and
+// ECDSA family of algorithms) can be used with this option. EdDSA and
+// algorithms registered via `jws.RegisterSigner()` or `jws.RegisterVerifier()`
+// require the entire payload, and will cause an error.
+//
+// The reader is consumed exactly once, even when multiple signatures or keys
+// are involved. When this option is used with `jws.Verify()`, the returned
+// payload is always nil.
+func WithDetachedPayloadReader(v io.Reader) SignVerifyOption {
+	return &signVerifyOption{option.New(identDetachedPayloadReader{}, v)}
+}
+
 // WithFS specifies the source `fs.FS` object to read the file from.
 func WithFS(v fs.FS) ReadFileOption {
 	return &readFileOption{option.New(identFS{}, v)}
@@ -248,6 +366,20 @@ func WithKeyProvider(v KeyProvider) VerifyOption {
 	return &verifyOption{option.New(identKeyProvider{}, v)}
 }
 
+// WithKeyUsageCheck specifies whether the "use", "key_ops" and "alg" fields
+// of keys of type `jwk.Key` are enforced by `jws.Sign()` and `jws.Verify()`.
+// When enabled, the signing key must allow "sign", and the verification key must allow "verify".
+// Keys that are not allowed are skipped during verification.
+// See `jwk.CheckKeyUsage()` for details. Checks are not performed
+// against raw keys (e.g. *rsa.PrivateKey), as they do not carry such metadata.
+//
+// When passed to `jws.Settings()`, the setting applies to all subsequent
+// calls. When passed directly to `jws.Sign()` or `jws.Verify()`, it overrides
+// the global setting for that call. The default is false.
+func WithKeyUsageCheck(v bool) GlobalSignVerifyOption {
+	return &globalSignVerifyOption{option.New(identKeyUsageCheck{}, v)}
+}
+
 // WithKeyUsed allows you to specify the `jws.Verify()` function to
 // return the key used for verification. This may be useful when
 // you specify multiple key sources or if you pass a `jwk.Set`
@@ -268,6 +400,16 @@ func WithMessage(v *Message) VerifyOption {
 	return &verifyOption{option.New(identMessage{}, v)}
 }
 
+// WithMinRefreshInterval specifies the minimum interval between refreshes
+// of the JWKS that are triggered by `jws.NewCachedKeyProvider()` upon
+// encountering an unknown key ID. Messages with unknown key IDs that
+// arrive during this interval are rejected without refreshing the JWKS.
+//
+// The default value is 5 minutes.
+func WithMinRefreshInterval(v time.Duration) CachedKeyProviderOption {
+	return &cachedKeyProviderOption{option.New(identMinRefreshInterval{}, v)}
+}
+
 // WithPretty specifies whether the JSON output should be formatted and
 // indented
 func WithPretty(v bool) WithJSONSuboption {
@@ -315,3 +457,28 @@ func WithCompact() SignOption {
 func WithUseDefault(v bool) WithKeySetSuboption {
 	return &withKeySetSuboption{option.New(identUseDefault{}, v)}
 }
+
+// WithVerifyPolicy specifies the number of signatures in a message that
+// must be verified by `jws.Verify()`. By default, `jws.Verify()` succeeds
+// as soon as any one of the signatures is verified (`jws.RequireAny()`).
+//
+// Use `jws.RequireThreshold()` to require multiple signatures, such as
+// when m-of-n approval is required. In this case each signature must be
+// verified using a different key, and keys are compared using their JWK
+// thumbprints. Keys whose thumbprint cannot be computed are not used.
+// Signatures that the key providers do not have keys for (see
+// `jws.ErrKeyNotFound()`) are not counted, instead of causing
+// `jws.Verify()` to fail.
+func WithVerifyPolicy(v VerifyPolicy) VerifyOption {
+	return &verifyOption{option.New(identVerifyPolicy{}, v)}
+}
+
+// WithVerifyResult can be passed to `jws.Verify()` to obtain the details
+// of the verification, such as the index of the signature that was
+// verified, the key that was used and its thumbprint, and the reasons
+// that other signatures and keys were rejected. See `jws.VerifyResult`.
+//
+// `v` is populated even when the verification fails.
+func WithVerifyResult(v *VerifyResult) VerifyOption {
+	return &verifyOption{option.New(identVerifyResult{}, v)}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
+	"hash"
 
 	"github.com/lestrrat-go/jwx/v2/internal/keyconv"
 	"github.com/lestrrat-go/jwx/v2/jwa"
@@ -72,12 +73,30 @@ func (rs *rsaSigner) Algorithm() jwa.SignatureAlgorithm {
 }
 
 func (rs *rsaSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
+	h := rs.hash.New()
+	if _, err := h.Write(payload); err != nil {
+		return nil, fmt.Errorf(`failed to write payload to hash: %w`, err)
+	}
+	return rs.signHash(h, key)
+}
+
+func (rs *rsaSigner) newHash(_ interface{}) (hash.Hash, error) {
+	return rs.hash.New(), nil
+}
+
+func (rs *rsaSigner) signHash(h hash.Hash, key interface{}) ([]byte, error) {
 	if key == nil {
 		return nil, fmt.Errorf(`missing private key while signing payload`)
 	}
 
 	signer, ok := key.(crypto.Signer)
-	if !ok {
+	if ok {
+		// Opaque signers (e.g. keys stored in a KMS) may be backed by
+		// any type of key, so make sure that it's an RSA key
+		if _, ok := signer.Public().(*rsa.PublicKey); !ok {
+			return nil, fmt.Errorf(`expected crypto.Signer.Public() to return *rsa.PublicKey for %s, but got %T`, rs.alg, signer.Public())
+		}
+	} else {
 		var privkey rsa.PrivateKey
 		if err := keyconv.RSAPrivateKey(&privkey, key); err != nil {
 			return nil, fmt.Errorf(`failed to retrieve rsa.PrivateKey out of %T: %w`, key, err)
@@ -85,10 +104,6 @@ func (rs *rsaSigner) Sign(payload []byte, key interface{}) ([]byte, error) {
 		signer = &privkey
 	}
 
-	h := rs.hash.New()
-	if _, err := h.Write(payload); err != nil {
-		return nil, fmt.Errorf(`failed to write payload to hash: %w`, err)
-	}
 	if rs.pss {
 		return signer.Sign(rand.Reader, h.Sum(nil), &rsa.PSSOptions{
 			Hash:       rs.hash,
@@ -109,6 +124,18 @@ func newRSAVerifier(alg jwa.SignatureAlgorithm) Verifier {
 }
 
 func (rv *rsaVerifier) Verify(payload, signature []byte, key interface{}) error {
+	h := rv.hash.New()
+	if _, err := h.Write(payload); err != nil {
+		return fmt.Errorf(`failed to write payload to hash: %w`, err)
+	}
+	return rv.verifyHash(h, signature, key)
+}
+
+func (rv *rsaVerifier) newHash(_ interface{}) (hash.Hash, error) {
+	return rv.hash.New(), nil
+}
+
+func (rv *rsaVerifier) verifyHash(h hash.Hash, signature []byte, key interface{}) error {
 	if key == nil {
 		return fmt.Errorf(`missing public key while verifying payload`)
 	}
@@ -130,11 +157,6 @@ func (rv *rsaVerifier) Verify(payload, signature []byte, key interface{}) error
 		}
 	}
 
-	h := rv.hash.New()
-	if _, err := h.Write(payload); err != nil {
-		return fmt.Errorf(`failed to write payload to hash: %w`, err)
-	}
-
 	if rv.pss {
 		return rsa.VerifyPSS(&pubkey, rv.hash, h.Sum(nil), signature, nil)
 	}
@@ -0,0 +1,196 @@
+package jws
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+)
+
+// signingInputWriter returns an io.Writer that feeds the payload portion
+// of the signing input to h, after the protected header has been written.
+// The returned io.Closer must be closed after the payload has been written
+func signingInputWriter(h hash.Hash, encodedProtectedHeader string, b64 bool) (io.Writer, io.Closer, error) {
+	if _, err := io.WriteString(h, encodedProtectedHeader); err != nil {
+		return nil, nil, fmt.Errorf(`failed to write protected header to hash: %w`, err)
+	}
+	if _, err := h.Write([]byte{'.'}); err != nil {
+		return nil, nil, fmt.Errorf(`failed to write protected header to hash: %w`, err)
+	}
+
+	if !b64 {
+		return h, nil, nil
+	}
+	enc := base64.NewEncoder(base64.RawURLEncoding, h)
+	return enc, enc, nil
+}
+
+// signReader generates the signatures for the payload read from src.
+// All signatures are computed in a single pass over src.
+func signReader(src io.Reader, sigs []*Signature, signers []*payloadSigner) error {
+	hashes := make([]hash.Hash, len(sigs))
+	writers := make([]io.Writer, len(sigs))
+	var closers []io.Closer
+	for i, sig := range sigs {
+		signer := signers[i]
+		hs, ok := signer.signer.(hashSigner)
+		if !ok {
+			return fmt.Errorf(`algorithm %s does not support reading the payload from an io.Reader`, signer.Algorithm())
+		}
+
+		hdrs, hdrbuf, err := sig.signingHeaders(signer.signer, signer.key)
+		if err != nil {
+			return fmt.Errorf(`failed to create headers for signer #%d: %w`, i, err)
+		}
+
+		h, err := hs.newHash(signer.key)
+		if err != nil {
+			return fmt.Errorf(`failed to create hash for signer #%d (alg=%s): %w`, i, signer.Algorithm(), err)
+		}
+
+		w, closer, err := signingInputWriter(h, base64.RawURLEncoding.EncodeToString(hdrbuf), getB64Value(hdrs))
+		if err != nil {
+			return err
+		}
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+		hashes[i] = h
+		writers[i] = w
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), src); err != nil {
+		return fmt.Errorf(`failed to read payload: %w`, err)
+	}
+	for _, closer := range closers {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf(`failed to flush payload: %w`, err)
+		}
+	}
+
+	for i, sig := range sigs {
+		signer := signers[i]
+		//nolint:forcetypeassert
+		signature, err := signer.signer.(hashSigner).signHash(hashes[i], signer.key)
+		if err != nil {
+			return fmt.Errorf(`failed to generate signature for signer #%d (alg=%s): %w`, i, signer.Algorithm(), err)
+		}
+		sig.signature = signature
+	}
+	return nil
+}
+
+type verifyCandidate struct {
+	index    int
+	sig      *Signature
+	alg      jwa.SignatureAlgorithm
+	key      interface{}
+	verifier hashVerifier
+	hash     hash.Hash
+}
+
+// verifyReader verifies msg against the payload read from src, until the
+// verification policy in vctx is satisfied. All candidate signature/key
+// pairs are collected before src is read, so that src is only read once
+func verifyReader(ctx context.Context, vctx *verifyCtx, msg *Message, src io.Reader) error {
+	var candidates []*verifyCandidate
+	var writers []io.Writer
+	var closers []io.Closer
+	for i, sig := range msg.signatures {
+		if !vctx.acceptSignature(i, sig) {
+			continue
+		}
+
+		encodedProtectedHeader, err := signingInputHeader(sig)
+		if err != nil {
+			return fmt.Errorf(`failed to marshal "protected" for signature #%d: %w`, i+1, err)
+		}
+
+		for j, kp := range vctx.keyProviders {
+			var sink algKeySink
+			if err := kp.FetchKeys(ctx, &sink, sig, msg); err != nil {
+				if err := vctx.fetchError(i, j, err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			for _, pair := range sink.list {
+				//nolint:forcetypeassert
+				alg := pair.alg.(jwa.SignatureAlgorithm)
+				if !vctx.acceptKey(i, alg, pair.key) {
+					continue
+				}
+
+				verifier, err := NewVerifier(alg)
+				if err != nil {
+					return fmt.Errorf(`failed to create verifier for algorithm %q: %w`, alg, err)
+				}
+
+				hv, ok := verifier.(hashVerifier)
+				if !ok {
+					return fmt.Errorf(`algorithm %s does not support reading the payload from an io.Reader`, alg)
+				}
+
+				h, err := hv.newHash(pair.key)
+				if err != nil {
+					// the key is not usable for this algorithm
+					vctx.result.addFailure(i, alg, pair.key, err)
+					continue
+				}
+
+				w, closer, err := signingInputWriter(h, encodedProtectedHeader, msg.b64)
+				if err != nil {
+					return err
+				}
+				if closer != nil {
+					closers = append(closers, closer)
+				}
+				writers = append(writers, w)
+				candidates = append(candidates, &verifyCandidate{
+					index:    i,
+					sig:      sig,
+					alg:      alg,
+					key:      pair.key,
+					verifier: hv,
+					hash:     h,
+				})
+			}
+		}
+	}
+
+	if len(candidates) > 0 {
+		if _, err := io.Copy(io.MultiWriter(writers...), src); err != nil {
+			return fmt.Errorf(`failed to read payload: %w`, err)
+		}
+		for _, closer := range closers {
+			if err := closer.Close(); err != nil {
+				return fmt.Errorf(`failed to flush payload: %w`, err)
+			}
+		}
+
+		verified := make(map[int]struct{})
+		for _, c := range candidates {
+			if _, ok := verified[c.index]; ok {
+				continue
+			}
+			if !vctx.acceptDistinctKey(c.index, c.alg, c.key) {
+				continue
+			}
+
+			if err := c.verifier.verifyHash(c.hash, c.sig.signature, c.key); err != nil {
+				vctx.result.addFailure(c.index, c.alg, c.key, err)
+				continue
+			}
+
+			verified[c.index] = struct{}{}
+			if vctx.addVerified(c.index, c.sig, c.alg, c.key) {
+				return nil
+			}
+		}
+	}
+	return vctx.verifyError()
+}
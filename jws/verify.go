@@ -0,0 +1,444 @@
+package jws
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+)
+
+// VerifyPolicy specifies the number of signatures in a message that must
+// be verified by `jws.Verify()`. Use `jws.RequireAny()` or
+// `jws.RequireThreshold()` to create one, and pass it via
+// `jws.WithVerifyPolicy()`.
+type VerifyPolicy interface {
+	// required returns the number of signatures that must be verified,
+	// given the number of signatures in the message
+	required(int) int
+}
+
+type requireAny struct{}
+
+func (requireAny) required(int) int {
+	return 1
+}
+
+// RequireAny returns a VerifyPolicy that is satisfied when any one of the
+// signatures is verified. This is the default.
+func RequireAny() VerifyPolicy {
+	return requireAny{}
+}
+
+type requireThreshold int
+
+func (v requireThreshold) required(int) int {
+	return int(v)
+}
+
+// RequireThreshold returns a VerifyPolicy that is satisfied when at least
+// `n` of the signatures are verified, each using a different key.
+//
+// This is how m-of-n approval is expressed: `n` is the number of signers
+// that must approve, and the keys of all acceptable signers are given to
+// `jws.Verify()` (e.g. via `jws.WithKeySet()`). Note that `n` must come
+// from the application, and never from the message itself, as anybody
+// can remove signatures from a message.
+func RequireThreshold(n int) VerifyPolicy {
+	return requireThreshold(n)
+}
+
+// VerifyResult holds the details of a call to `jws.Verify()`.
+// Pass a pointer to a VerifyResult via `jws.WithVerifyResult()` to
+// obtain it.
+//
+// The result is populated even when the verification fails, in which
+// case `SignatureIndex()` returns -1 and `Failures()` describes why each
+// of the candidates were rejected.
+//
+// The methods that describe a single signature (e.g. `SignatureIndex()`
+// and `Key()`) refer to the first signature that was verified. When
+// `jws.WithVerifyPolicy()` requires multiple signatures, use
+// `VerifiedSignatures()` to obtain all of them.
+type VerifyResult struct {
+	verified []*VerifiedSignature
+	failures []*VerifyFailure
+}
+
+func (r *VerifyResult) first() *VerifiedSignature {
+	if len(r.verified) == 0 {
+		return nil
+	}
+	return r.verified[0]
+}
+
+// SignatureIndex returns the index of the signature that was verified.
+// Messages in compact serialization have exactly one signature, at index 0.
+// If no signature could be verified, -1 is returned.
+func (r *VerifyResult) SignatureIndex() int {
+	if v := r.first(); v != nil {
+		return v.SignatureIndex()
+	}
+	return -1
+}
+
+// Signature returns the signature that was verified.
+func (r *VerifyResult) Signature() *Signature {
+	if v := r.first(); v != nil {
+		return v.Signature()
+	}
+	return nil
+}
+
+// ProtectedHeaders returns the protected headers of the signature that
+// was verified.
+func (r *VerifyResult) ProtectedHeaders() Headers {
+	if v := r.first(); v != nil {
+		return v.ProtectedHeaders()
+	}
+	return nil
+}
+
+// Algorithm returns the algorithm that was used to verify the signature.
+func (r *VerifyResult) Algorithm() jwa.SignatureAlgorithm {
+	if v := r.first(); v != nil {
+		return v.Algorithm()
+	}
+	return ""
+}
+
+// KeyID returns the "kid" of the key that was used to verify the signature.
+// See `(*jws.VerifiedSignature).KeyID()` for details.
+func (r *VerifyResult) KeyID() string {
+	if v := r.first(); v != nil {
+		return v.KeyID()
+	}
+	return ""
+}
+
+// Key returns the key that was used to verify the signature. It is either
+// a `jwk.Key` or a raw key, depending on how the key was provided.
+func (r *VerifyResult) Key() interface{} {
+	if v := r.first(); v != nil {
+		return v.Key()
+	}
+	return nil
+}
+
+// Thumbprint returns the SHA-256 JWK thumbprint (RFC7638) of the key that
+// was used to verify the signature. See `(*jws.VerifiedSignature).Thumbprint()`
+// for details.
+func (r *VerifyResult) Thumbprint() []byte {
+	if v := r.first(); v != nil {
+		return v.Thumbprint()
+	}
+	return nil
+}
+
+// VerifiedSignatures returns the list of signatures that were verified,
+// in the order that they appear in the message.
+func (r *VerifyResult) VerifiedSignatures() []*VerifiedSignature {
+	return r.verified
+}
+
+// Failures returns the list of signature and key pairs that were tried
+// and rejected before the verification succeeded or failed.
+func (r *VerifyResult) Failures() []*VerifyFailure {
+	return r.failures
+}
+
+func (r *VerifyResult) addFailure(index int, alg jwa.SignatureAlgorithm, key interface{}, err error) {
+	if r == nil {
+		return
+	}
+	r.failures = append(r.failures, &VerifyFailure{
+		index:     index,
+		algorithm: alg,
+		key:       key,
+		err:       err,
+	})
+}
+
+// VerifiedSignature describes a signature that was verified by `jws.Verify()`
+type VerifiedSignature struct {
+	index      int
+	signature  *Signature
+	algorithm  jwa.SignatureAlgorithm
+	key        interface{}
+	thumbprint []byte
+}
+
+// SignatureIndex returns the index of the signature in the message.
+func (v *VerifiedSignature) SignatureIndex() int {
+	return v.index
+}
+
+// Signature returns the signature that was verified.
+func (v *VerifiedSignature) Signature() *Signature {
+	return v.signature
+}
+
+// ProtectedHeaders returns the protected headers of the signature.
+func (v *VerifiedSignature) ProtectedHeaders() Headers {
+	return v.signature.ProtectedHeaders()
+}
+
+// Algorithm returns the algorithm that was used to verify the signature.
+func (v *VerifiedSignature) Algorithm() jwa.SignatureAlgorithm {
+	return v.algorithm
+}
+
+// KeyID returns the "kid" of the key that was used to verify the signature.
+// If the key is not a `jwk.Key` or it does not have a "kid", the "kid" in
+// the protected headers of the signature is returned.
+func (v *VerifiedSignature) KeyID() string {
+	if key, ok := v.key.(jwk.Key); ok {
+		if kid := key.KeyID(); kid != "" {
+			return kid
+		}
+	}
+	if hdrs := v.ProtectedHeaders(); hdrs != nil {
+		return hdrs.KeyID()
+	}
+	return ""
+}
+
+// Key returns the key that was used to verify the signature. It is either
+// a `jwk.Key` or a raw key, depending on how the key was provided.
+func (v *VerifiedSignature) Key() interface{} {
+	return v.key
+}
+
+// Thumbprint returns the SHA-256 JWK thumbprint (RFC7638) of the key that
+// was used to verify the signature. It is nil if the thumbprint could not
+// be computed, for example, for keys that cannot be converted to a `jwk.Key`.
+func (v *VerifiedSignature) Thumbprint() []byte {
+	return v.thumbprint
+}
+
+// keyThumbprint computes the SHA-256 JWK thumbprint of `key`, which may
+// be a `jwk.Key` or a raw key
+func keyThumbprint(key interface{}) ([]byte, error) {
+	jwkKey, ok := key.(jwk.Key)
+	if !ok {
+		v, err := jwk.FromRaw(key)
+		if err != nil {
+			return nil, fmt.Errorf(`failed to create jwk.Key from %T: %w`, key, err)
+		}
+		jwkKey = v
+	}
+	return jwkKey.Thumbprint(crypto.SHA256)
+}
+
+// VerifyFailure describes why a signature, or a signature and key pair,
+// was rejected by `jws.Verify()`.
+type VerifyFailure struct {
+	index     int
+	algorithm jwa.SignatureAlgorithm
+	key       interface{}
+	err       error
+}
+
+// SignatureIndex returns the index of the signature that was rejected.
+func (f *VerifyFailure) SignatureIndex() int {
+	return f.index
+}
+
+// Algorithm returns the algorithm that was tried. It may be empty if
+// the signature was rejected before any keys were looked up.
+func (f *VerifyFailure) Algorithm() jwa.SignatureAlgorithm {
+	return f.algorithm
+}
+
+// Key returns the key that was tried. It is nil if the signature was
+// rejected before any keys were looked up.
+func (f *VerifyFailure) Key() interface{} {
+	return f.key
+}
+
+func (f *VerifyFailure) Error() string {
+	return fmt.Sprintf(`signature #%d: %s`, f.index+1, f.err)
+}
+
+func (f *VerifyFailure) Unwrap() error {
+	return f.err
+}
+
+// verifyCtx holds the settings for a single call to `jws.Verify()`,
+// and keeps track of the signatures that were verified, and the
+// reasons that candidates were rejected
+type verifyCtx struct {
+	keyProviders  []KeyProvider
+	critical      []string
+	keyUsageCheck bool
+	allowedAlgs   []jwa.SignatureAlgorithm
+	policy        VerifyPolicy
+	result        *VerifyResult
+
+	// required is the number of signatures that must be verified
+	required int
+	verified []*VerifiedSignature
+	// usedKeys holds the thumbprints of the keys that verified a signature,
+	// so that each signature is verified using a different key
+	usedKeys map[string]struct{}
+
+	critErr  error
+	algErr   error
+	usageErr error
+}
+
+// init computes the number of signatures that must be verified for msg
+func (vctx *verifyCtx) init(msg *Message) error {
+	policy := vctx.policy
+	if policy == nil {
+		policy = RequireAny()
+	}
+
+	n := len(msg.signatures)
+	vctx.required = policy.required(n)
+	if vctx.required < 1 {
+		return fmt.Errorf(`jws.Verify: invalid verification policy: at least one signature must be required (got %d)`, vctx.required)
+	}
+	if vctx.required > n {
+		return fmt.Errorf(`jws.Verify: verification policy requires %d signatures, but the message has %d`, vctx.required, n)
+	}
+	if vctx.result != nil {
+		*(vctx.result) = VerifyResult{}
+	}
+	return nil
+}
+
+// acceptSignature returns false if the signature must be rejected
+// before any keys are looked up
+func (vctx *verifyCtx) acceptSignature(i int, sig *Signature) bool {
+	// Signatures carrying critical extensions that we do not
+	// understand can never be considered valid
+	if err := verifyCritical(sig, vctx.critical); err != nil {
+		vctx.critErr = fmt.Errorf(`signature #%d: %w`, i+1, err)
+		vctx.result.addFailure(i, "", nil, err)
+		return false
+	}
+
+	if err := checkAllowedAlgorithm(sig, vctx.allowedAlgs); err != nil {
+		vctx.algErr = fmt.Errorf(`signature #%d: %w`, i+1, err)
+		vctx.result.addFailure(i, "", nil, err)
+		return false
+	}
+	return true
+}
+
+// acceptKey returns false if the key must not be used to verify
+// the signature
+func (vctx *verifyCtx) acceptKey(i int, alg jwa.SignatureAlgorithm, key interface{}) bool {
+	if !isAllowedAlgorithm(vctx.allowedAlgs, alg) {
+		vctx.result.addFailure(i, alg, key, fmt.Errorf(`algorithm %q is not allowed`, alg))
+		return false
+	}
+
+	if vctx.keyUsageCheck {
+		if err := checkKeyUsage(key, alg, jwk.KeyOpVerify); err != nil {
+			vctx.usageErr = err
+			vctx.result.addFailure(i, alg, key, err)
+			return false
+		}
+	}
+
+	return vctx.acceptDistinctKey(i, alg, key)
+}
+
+// acceptDistinctKey returns false if the verification policy requires
+// multiple signatures, and key has already been used to verify another
+// signature
+func (vctx *verifyCtx) acceptDistinctKey(i int, alg jwa.SignatureAlgorithm, key interface{}) bool {
+	if vctx.required < 2 {
+		return true
+	}
+
+	tp, err := keyThumbprint(key)
+	if err != nil {
+		// we can't tell if this key has already been used
+		vctx.result.addFailure(i, alg, key, fmt.Errorf(`failed to compute thumbprint of key: %w`, err))
+		return false
+	}
+	if _, ok := vctx.usedKeys[string(tp)]; ok {
+		vctx.result.addFailure(i, alg, key, fmt.Errorf(`key has already been used to verify another signature`))
+		return false
+	}
+	return true
+}
+
+// addVerified records that the signature at index i was verified
+// using key, and returns true if the verification policy has been satisfied
+func (vctx *verifyCtx) addVerified(i int, sig *Signature, alg jwa.SignatureAlgorithm, key interface{}) bool {
+	v := &VerifiedSignature{
+		index:     i,
+		signature: sig,
+		algorithm: alg,
+		key:       key,
+	}
+
+	if vctx.required > 1 || vctx.result != nil {
+		// acceptKey has already made sure that this succeeds
+		// if the thumbprint is required
+		if tp, err := keyThumbprint(key); err == nil {
+			v.thumbprint = tp
+			if vctx.usedKeys == nil {
+				vctx.usedKeys = make(map[string]struct{})
+			}
+			vctx.usedKeys[string(tp)] = struct{}{}
+		}
+	}
+
+	vctx.verified = append(vctx.verified, v)
+	if vctx.result != nil {
+		vctx.result.verified = vctx.verified
+	}
+	return len(vctx.verified) >= vctx.required
+}
+
+var errKeyNotFound = errors.New(`key not found`)
+
+// ErrKeyNotFound returns the immutable error that key providers return
+// (possibly wrapped) when they do not have a key for the signature.
+//
+// When `jws.WithVerifyPolicy()` requires multiple signatures, signatures
+// for which a key provider returns this error are not counted, instead
+// of causing `jws.Verify()` to fail. Custom key providers should return
+// this error, or simply not send any keys to the sink, in this case.
+func ErrKeyNotFound() error {
+	return errKeyNotFound
+}
+
+// fetchError handles the error returned by the key provider at index j
+// for the signature at index i. Unless multiple signatures are required,
+// the error aborts the verification. Otherwise, signatures made using keys
+// that are unknown to the key provider are simply not counted, and nil is
+// returned. Any other error, such as a failure to fetch a remote key set,
+// still aborts the verification
+func (vctx *verifyCtx) fetchError(i, j int, err error) error {
+	err = fmt.Errorf(`key provider %d failed: %w`, j, err)
+	if vctx.required < 2 || !errors.Is(err, errKeyNotFound) {
+		return err
+	}
+	vctx.result.addFailure(i, "", nil, err)
+	return nil
+}
+
+// verifyError returns the error to be reported when the verification
+// policy could not be satisfied
+func (vctx *verifyCtx) verifyError() error {
+	if l := len(vctx.verified); l > 0 {
+		return fmt.Errorf(`could not verify enough signatures: %d signatures verified, but %d are required`, l, vctx.required)
+	}
+	if vctx.critErr != nil {
+		return fmt.Errorf(`could not verify message using any of the signatures or keys: %w`, vctx.critErr)
+	}
+	if vctx.algErr != nil {
+		return fmt.Errorf(`could not verify message using any of the signatures or keys: %w`, vctx.algErr)
+	}
+	if vctx.usageErr != nil {
+		return fmt.Errorf(`could not verify message using any of the signatures or keys (last key usage error = %w)`, vctx.usageErr)
+	}
+	return fmt.Errorf(`could not verify message using any of the signatures or keys`)
+}
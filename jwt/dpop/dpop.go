@@ -0,0 +1,469 @@
+// Package dpop implements creation and verification of DPoP proofs,
+// as described in RFC9449 (OAuth 2.0 Demonstrating Proof of Possession).
+//
+// A DPoP proof is a JWT that is signed by a key held by the client, and whose
+// public key is embedded in the "jwk" header. The proof is bound to a single
+// HTTP request through the "htm" and "htu" claims, and optionally to an
+// access token through the "ath" claim.
+package dpop
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/blackmagic"
+	"github.com/lestrrat-go/jwx/v2/internal/base64"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+)
+
+// Type is the value of the "typ" header of DPoP proofs
+const Type = `dpop+jwt`
+
+const (
+	HTTPMethodKey      = `htm`
+	HTTPURIKey         = `htu`
+	AccessTokenHashKey = `ath`
+	NonceKey           = `nonce`
+	ConfirmationKey    = `cnf`
+	ThumbprintKey      = `jkt`
+)
+
+const defaultMaxAge = 5 * time.Minute
+
+// Builder is used to create DPoP proofs. The "jti" and "iat" claims
+// are populated automatically unless they are explicitly specified.
+type Builder struct {
+	builder *jwt.Builder
+	claims  map[string]struct{}
+}
+
+// NewBuilder creates a new Builder
+func NewBuilder() *Builder {
+	return &Builder{
+		builder: jwt.NewBuilder(),
+		claims:  make(map[string]struct{}),
+	}
+}
+
+// Claim sets an arbitrary claim in the proof
+func (b *Builder) Claim(name string, value interface{}) *Builder {
+	b.claims[name] = struct{}{}
+	b.builder.Claim(name, value)
+	return b
+}
+
+// Method sets the "htm" claim, the HTTP method of the request
+func (b *Builder) Method(v string) *Builder {
+	return b.Claim(HTTPMethodKey, v)
+}
+
+// URI sets the "htu" claim, the HTTP URI of the request. Query and
+// fragment parts are removed when the proof is built.
+func (b *Builder) URI(v string) *Builder {
+	return b.Claim(HTTPURIKey, v)
+}
+
+// AccessToken sets the "ath" claim to the hash of the given access token
+func (b *Builder) AccessToken(v string) *Builder {
+	return b.Claim(AccessTokenHashKey, AccessTokenHash(v))
+}
+
+// Nonce sets the "nonce" claim to the value provided by the server
+func (b *Builder) Nonce(v string) *Builder {
+	return b.Claim(NonceKey, v)
+}
+
+// JwtID sets the "jti" claim. If not specified, a random value is used
+func (b *Builder) JwtID(v string) *Builder {
+	return b.Claim(jwt.JwtIDKey, v)
+}
+
+// IssuedAt sets the "iat" claim. If not specified, the current time is used
+func (b *Builder) IssuedAt(v time.Time) *Builder {
+	return b.Claim(jwt.IssuedAtKey, v)
+}
+
+// Build creates the proof's claims as a jwt.Token
+func (b *Builder) Build() (jwt.Token, error) {
+	if _, ok := b.claims[HTTPMethodKey]; !ok {
+		return nil, fmt.Errorf(`required claim %q is missing`, HTTPMethodKey)
+	}
+	if _, ok := b.claims[HTTPURIKey]; !ok {
+		return nil, fmt.Errorf(`required claim %q is missing`, HTTPURIKey)
+	}
+
+	tok, err := b.builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf(`failed to build proof: %w`, err)
+	}
+
+	if _, ok := b.claims[jwt.JwtIDKey]; !ok {
+		var buf [16]byte
+		if _, err := rand.Read(buf[:]); err != nil {
+			return nil, fmt.Errorf(`failed to generate "jti": %w`, err)
+		}
+		if err := tok.Set(jwt.JwtIDKey, base64.EncodeToString(buf[:])); err != nil {
+			return nil, fmt.Errorf(`failed to set claim %q: %w`, jwt.JwtIDKey, err)
+		}
+	}
+
+	if _, ok := b.claims[jwt.IssuedAtKey]; !ok {
+		if err := tok.Set(jwt.IssuedAtKey, time.Now()); err != nil {
+			return nil, fmt.Errorf(`failed to set claim %q: %w`, jwt.IssuedAtKey, err)
+		}
+	}
+
+	v, _ := tok.Get(HTTPURIKey)
+	htu, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf(`claim %q must be a string (got %T)`, HTTPURIKey, v)
+	}
+	htu, err = stripURI(htu)
+	if err != nil {
+		return nil, fmt.Errorf(`invalid %q claim: %w`, HTTPURIKey, err)
+	}
+	if err := tok.Set(HTTPURIKey, htu); err != nil {
+		return nil, fmt.Errorf(`failed to set claim %q: %w`, HTTPURIKey, err)
+	}
+	return tok, nil
+}
+
+// Sign builds the proof, and signs it using the private key `key`.
+// The public key corresponding to `key` is embedded in the "jwk" header.
+//
+// `key` can be a raw private key, a jwk.Key, or a crypto.Signer.
+func (b *Builder) Sign(alg jwa.SignatureAlgorithm, key interface{}) ([]byte, error) {
+	if !isAsymmetric(alg) {
+		return nil, fmt.Errorf(`algorithm %q cannot be used for DPoP proofs`, alg)
+	}
+
+	tok, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	pubkey, err := publicKeyOf(key)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to obtain public key: %w`, err)
+	}
+
+	hdrs := jws.NewHeaders()
+	if err := hdrs.Set(jws.TypeKey, Type); err != nil {
+		return nil, fmt.Errorf(`failed to set %q header: %w`, jws.TypeKey, err)
+	}
+	if err := hdrs.Set(jws.JWKKey, pubkey); err != nil {
+		return nil, fmt.Errorf(`failed to set %q header: %w`, jws.JWKKey, err)
+	}
+
+	signed, err := jwt.Sign(tok, jwt.WithKey(alg, key, jws.WithProtectedHeaders(hdrs)))
+	if err != nil {
+		return nil, fmt.Errorf(`failed to sign proof: %w`, err)
+	}
+	return signed, nil
+}
+
+func publicKeyOf(key interface{}) (jwk.Key, error) {
+	pubkey, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, err
+		}
+		pubkey, err = jwk.PublicKeyOf(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+	}
+	if isPrivate(pubkey) {
+		return nil, fmt.Errorf(`key of type %s cannot be used for DPoP proofs`, pubkey.KeyType())
+	}
+	return pubkey, nil
+}
+
+// AccessTokenHash computes the value of the "ath" claim for the given
+// access token: the base64url encoded SHA-256 hash of the token
+func AccessTokenHash(accessToken string) string {
+	h := sha256.Sum256([]byte(accessToken))
+	return base64.EncodeToString(h[:])
+}
+
+// Thumbprint computes the base64url encoded SHA-256 JWK thumbprint of `key`,
+// which is the value used in the "jkt" member of the "cnf" claim of
+// DPoP-bound access tokens
+func Thumbprint(key jwk.Key) (string, error) {
+	tp, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf(`failed to compute thumbprint: %w`, err)
+	}
+	return base64.EncodeToString(tp), nil
+}
+
+// Verify verifies the DPoP proof `proof`, and returns the claims contained in it.
+//
+// The signature is verified using the key embedded in the "jwk" header,
+// after checking that the header describes a public key and that an
+// asymmetric algorithm is used. The "htm" and "htu" claims must match the
+// values given by `dpop.WithMethod()` and `dpop.WithURI()`, which are required.
+// The "iat" claim must not be older than the value of `dpop.WithMaxAge()`.
+//
+// In order to check the binding to an access token, use `dpop.WithAccessToken()`,
+// and `dpop.WithBoundToken()` or `dpop.WithKeyThumbprint()`. Reused proofs
+// can be detected by specifying `dpop.WithReplayCache()`.
+func Verify(proof []byte, options ...VerifyOption) (jwt.Token, error) {
+	var method, uri, accessToken, nonce, jkt string
+	var hasAccessToken, hasNonce bool
+	var boundToken jwt.Token
+	var clock jwt.Clock = jwt.ClockFunc(time.Now)
+	var skew time.Duration
+	var keyUsed interface{}
+	var replayCache jwt.ReplayCache
+	maxAge := defaultMaxAge
+	//nolint:forcetypeassert
+	for _, option := range options {
+		switch option.Ident() {
+		case identMethod{}:
+			method = option.Value().(string)
+		case identURI{}:
+			uri = option.Value().(string)
+		case identAccessToken{}:
+			accessToken = option.Value().(string)
+			hasAccessToken = true
+		case identNonce{}:
+			nonce = option.Value().(string)
+			hasNonce = true
+		case identKeyThumbprint{}:
+			jkt = option.Value().(string)
+		case identBoundToken{}:
+			boundToken = option.Value().(jwt.Token)
+		case identClock{}:
+			clock = option.Value().(jwt.Clock)
+		case identAcceptableSkew{}:
+			skew = option.Value().(time.Duration)
+		case identMaxAge{}:
+			maxAge = option.Value().(time.Duration)
+		case identReplayCache{}:
+			replayCache = option.Value().(jwt.ReplayCache)
+		case identKeyUsed{}:
+			keyUsed = option.Value()
+		}
+	}
+
+	if method == "" {
+		return nil, fmt.Errorf(`dpop.WithMethod() must be specified`)
+	}
+	if uri == "" {
+		return nil, fmt.Errorf(`dpop.WithURI() must be specified`)
+	}
+
+	if boundToken != nil {
+		v, err := confirmationThumbprint(boundToken)
+		if err != nil {
+			return nil, err
+		}
+		if jkt != "" && jkt != v {
+			return nil, fmt.Errorf(`thumbprint given by dpop.WithKeyThumbprint() does not match the bound token`)
+		}
+		jkt = v
+	}
+
+	msg, err := jws.Parse(proof)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to parse proof: %w`, err)
+	}
+	if len(msg.Signatures()) != 1 {
+		return nil, fmt.Errorf(`proof must have exactly one signature`)
+	}
+	hdrs := msg.Signatures()[0].ProtectedHeaders()
+
+	if typ := hdrs.Type(); typ != Type {
+		return nil, fmt.Errorf(`invalid %q header: expected %q, got %q`, jws.TypeKey, Type, typ)
+	}
+
+	alg := hdrs.Algorithm()
+	if !isAsymmetric(alg) {
+		return nil, fmt.Errorf(`algorithm %q cannot be used for DPoP proofs`, alg)
+	}
+
+	key := hdrs.JWK()
+	if key == nil {
+		return nil, fmt.Errorf(`required header %q is missing`, jws.JWKKey)
+	}
+	if isPrivate(key) {
+		return nil, fmt.Errorf(`%q header must not contain a private key`, jws.JWKKey)
+	}
+
+	tok, err := jwt.Parse(proof,
+		jwt.WithKey(alg, key),
+		jwt.WithClock(clock),
+		jwt.WithAcceptableSkew(skew),
+		jwt.WithRequiredClaim(jwt.JwtIDKey),
+		jwt.WithRequiredClaim(jwt.IssuedAtKey),
+		jwt.WithRequiredClaim(HTTPMethodKey),
+		jwt.WithRequiredClaim(HTTPURIKey),
+		jwt.WithClaimValue(HTTPMethodKey, method),
+		jwt.WithMaxDelta(maxAge, "", jwt.IssuedAtKey),
+	)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to verify proof: %w`, err)
+	}
+
+	if err := verifyURI(tok, uri); err != nil {
+		return nil, err
+	}
+
+	if hasAccessToken {
+		if err := verifyStringClaim(tok, AccessTokenHashKey, AccessTokenHash(accessToken)); err != nil {
+			return nil, err
+		}
+	}
+
+	if hasNonce {
+		if err := verifyStringClaim(tok, NonceKey, nonce); err != nil {
+			return nil, err
+		}
+	}
+
+	var tp string
+	if jkt != "" || replayCache != nil {
+		tp, err = Thumbprint(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if jkt != "" && jkt != tp {
+		return nil, fmt.Errorf(`proof key does not match thumbprint %q`, jkt)
+	}
+
+	// This must be the last check, as the proof is recorded in the cache
+	if replayCache != nil {
+		ctx := jwt.SetValidationCtxClock(context.Background(), clock)
+		added, err := replayCache.Add(ctx, tp, tok.JwtID(), tok.IssuedAt().Add(maxAge+skew))
+		if err != nil {
+			return nil, fmt.Errorf(`failed to record "jti" in replay cache: %w`, err)
+		}
+		if !added {
+			return nil, jwt.ErrTokenReplayed()
+		}
+	}
+
+	if keyUsed != nil {
+		if err := blackmagic.AssignIfCompatible(keyUsed, key); err != nil {
+			return nil, fmt.Errorf(`failed to assign used key (%T) to %T: %w`, key, keyUsed, err)
+		}
+	}
+	return tok, nil
+}
+
+func verifyStringClaim(tok jwt.Token, name, expected string) error {
+	v, ok := tok.Get(name)
+	if !ok {
+		return fmt.Errorf(`required claim %q is missing`, name)
+	}
+	if s, _ := v.(string); s != expected {
+		return fmt.Errorf(`%q not satisfied: values do not match`, name)
+	}
+	return nil
+}
+
+func verifyURI(tok jwt.Token, uri string) error {
+	v, _ := tok.Get(HTTPURIKey)
+	htu, ok := v.(string)
+	if !ok {
+		return fmt.Errorf(`claim %q must be a string (got %T)`, HTTPURIKey, v)
+	}
+
+	expected, err := normalizeURI(uri)
+	if err != nil {
+		return fmt.Errorf(`invalid URI given by dpop.WithURI(): %w`, err)
+	}
+	actual, err := normalizeURI(htu)
+	if err != nil {
+		return fmt.Errorf(`invalid %q claim: %w`, HTTPURIKey, err)
+	}
+	if expected != actual {
+		return fmt.Errorf(`%q not satisfied: values do not match`, HTTPURIKey)
+	}
+	return nil
+}
+
+func confirmationThumbprint(tok jwt.Token) (string, error) {
+	v, ok := tok.Get(ConfirmationKey)
+	if !ok {
+		return "", fmt.Errorf(`bound token does not have a %q claim`, ConfirmationKey)
+	}
+	cnf, ok := v.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf(`%q claim of bound token must be an object (got %T)`, ConfirmationKey, v)
+	}
+	jkt, _ := cnf[ThumbprintKey].(string)
+	if jkt == "" {
+		return "", fmt.Errorf(`%q claim of bound token does not have a %q member`, ConfirmationKey, ThumbprintKey)
+	}
+	return jkt, nil
+}
+
+// stripURI removes the query and fragment parts from s
+func stripURI(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf(`URI must be absolute`)
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+// normalizeURI applies syntax-based and scheme-based normalization
+// (RFC3986 section 6) to s, after stripping its query and fragment parts
+func normalizeURI(s string) (string, error) {
+	stripped, err := stripURI(s)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(stripped)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String(), nil
+}
+
+func isAsymmetric(alg jwa.SignatureAlgorithm) bool {
+	switch alg {
+	case jwa.NoSignature, jwa.HS256, jwa.HS384, jwa.HS512, "":
+		return false
+	default:
+		return true
+	}
+}
+
+func isPrivate(key jwk.Key) bool {
+	switch key.(type) {
+	case jwk.RSAPrivateKey, jwk.ECDSAPrivateKey, jwk.OKPPrivateKey, jwk.SymmetricKey:
+		return true
+	default:
+		return false
+	}
+}
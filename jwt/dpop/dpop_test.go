@@ -0,0 +1,196 @@
+package dpop_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/lestrrat-go/jwx/v2/jwt/dpop"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDPoP(t *testing.T) {
+	t.Parallel()
+
+	const method = `POST`
+	const uri = `https://server.example.com/token`
+	const accessToken = `Kz~8mXK1EalYznwH-LC-1fBAo.4Ljp~zsPE_NeO.gxU`
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+		return
+	}
+
+	pubkey, err := jwk.PublicKeyOf(key)
+	if !assert.NoError(t, err, `jwk.PublicKeyOf should succeed`) {
+		return
+	}
+	jkt, err := dpop.Thumbprint(pubkey)
+	if !assert.NoError(t, err, `dpop.Thumbprint should succeed`) {
+		return
+	}
+
+	proof, err := dpop.NewBuilder().
+		Method(method).
+		URI(uri+`?foo=bar#baz`).
+		AccessToken(accessToken).
+		Nonce(`eyJ7S_zG.eyJH0-Z.HX4w-7v`).
+		Sign(jwa.ES256, key)
+	if !assert.NoError(t, err, `dpop.Sign should succeed`) {
+		return
+	}
+
+	t.Run("Headers", func(t *testing.T) {
+		t.Parallel()
+		msg, err := jws.Parse(proof)
+		if !assert.NoError(t, err, `jws.Parse should succeed`) {
+			return
+		}
+		hdrs := msg.Signatures()[0].ProtectedHeaders()
+		if !assert.Equal(t, dpop.Type, hdrs.Type(), `"typ" should match`) {
+			return
+		}
+		if !assert.NotNil(t, hdrs.JWK(), `"jwk" should be set`) {
+			return
+		}
+		if !assert.Equal(t, jwa.EC, hdrs.JWK().KeyType(), `"jwk" should be an EC key`) {
+			return
+		}
+		if _, ok := hdrs.JWK().(jwk.ECDSAPrivateKey); !assert.False(t, ok, `"jwk" should not be a private key`) {
+			return
+		}
+	})
+	t.Run("Verify", func(t *testing.T) {
+		t.Parallel()
+		bound := jwt.New()
+		_ = bound.Set(dpop.ConfirmationKey, map[string]interface{}{dpop.ThumbprintKey: jkt})
+
+		var keyUsed jwk.Key
+		tok, err := dpop.Verify(proof,
+			dpop.WithMethod(method),
+			dpop.WithURI(`HTTPS://Server.Example.COM:443/token`),
+			dpop.WithAccessToken(accessToken),
+			dpop.WithNonce(`eyJ7S_zG.eyJH0-Z.HX4w-7v`),
+			dpop.WithBoundToken(bound),
+			dpop.WithKeyUsed(&keyUsed),
+		)
+		if !assert.NoError(t, err, `dpop.Verify should succeed`) {
+			return
+		}
+		v, _ := tok.Get(dpop.HTTPURIKey)
+		if !assert.Equal(t, uri, v, `"htu" should not contain query or fragment`) {
+			return
+		}
+		if !assert.NotEmpty(t, tok.JwtID(), `"jti" should be populated`) {
+			return
+		}
+		tp, err := dpop.Thumbprint(keyUsed)
+		if !assert.NoError(t, err, `dpop.Thumbprint should succeed`) {
+			return
+		}
+		if !assert.Equal(t, jkt, tp, `key used should match`) {
+			return
+		}
+	})
+	t.Run("Verification failures", func(t *testing.T) {
+		t.Parallel()
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+			return
+		}
+		otherPubkey, err := jwk.PublicKeyOf(otherKey)
+		if !assert.NoError(t, err, `jwk.PublicKeyOf should succeed`) {
+			return
+		}
+		otherJkt, err := dpop.Thumbprint(otherPubkey)
+		if !assert.NoError(t, err, `dpop.Thumbprint should succeed`) {
+			return
+		}
+
+		testcases := []struct {
+			Name    string
+			Options []dpop.VerifyOption
+		}{
+			{Name: "Missing method", Options: []dpop.VerifyOption{dpop.WithURI(uri)}},
+			{Name: "Wrong method", Options: []dpop.VerifyOption{dpop.WithMethod(`GET`), dpop.WithURI(uri)}},
+			{Name: "Wrong URI", Options: []dpop.VerifyOption{dpop.WithMethod(method), dpop.WithURI(`https://server.example.com/resource`)}},
+			{Name: "Wrong access token", Options: []dpop.VerifyOption{dpop.WithMethod(method), dpop.WithURI(uri), dpop.WithAccessToken(`foo`)}},
+			{Name: "Wrong nonce", Options: []dpop.VerifyOption{dpop.WithMethod(method), dpop.WithURI(uri), dpop.WithNonce(`foo`)}},
+			{Name: "Wrong thumbprint", Options: []dpop.VerifyOption{dpop.WithMethod(method), dpop.WithURI(uri), dpop.WithKeyThumbprint(otherJkt)}},
+			{Name: "Expired", Options: []dpop.VerifyOption{dpop.WithMethod(method), dpop.WithURI(uri), dpop.WithClock(jwt.ClockFunc(func() time.Time { return time.Now().Add(time.Hour) }))}},
+		}
+		for _, tc := range testcases {
+			tc := tc
+			t.Run(tc.Name, func(t *testing.T) {
+				t.Parallel()
+				_, err := dpop.Verify(proof, tc.Options...)
+				if !assert.Error(t, err, `dpop.Verify should fail`) {
+					return
+				}
+			})
+		}
+	})
+	t.Run("Replay", func(t *testing.T) {
+		t.Parallel()
+		cache := jwt.NewMemoryReplayCache(10)
+		_, err := dpop.Verify(proof, dpop.WithMethod(method), dpop.WithURI(uri), dpop.WithReplayCache(cache))
+		if !assert.NoError(t, err, `first dpop.Verify should succeed`) {
+			return
+		}
+		_, err = dpop.Verify(proof, dpop.WithMethod(method), dpop.WithURI(uri), dpop.WithReplayCache(cache))
+		if !assert.ErrorIs(t, err, jwt.ErrTokenReplayed(), `second dpop.Verify should fail`) {
+			return
+		}
+	})
+	t.Run("Invalid proofs", func(t *testing.T) {
+		t.Parallel()
+
+		// regular JWT without "typ" dpop+jwt
+		tok, err := jwt.NewBuilder().
+			JwtID(`foo`).
+			IssuedAt(time.Now()).
+			Claim(dpop.HTTPMethodKey, method).
+			Claim(dpop.HTTPURIKey, uri).
+			Build()
+		if !assert.NoError(t, err, `jwt.Builder should succeed`) {
+			return
+		}
+		signed, err := jwt.Sign(tok, jwt.WithKey(jwa.ES256, key))
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			return
+		}
+		_, err = dpop.Verify(signed, dpop.WithMethod(method), dpop.WithURI(uri))
+		if !assert.Error(t, err, `dpop.Verify should fail`) {
+			return
+		}
+
+		// symmetric keys are not allowed
+		_, err = dpop.NewBuilder().Method(method).URI(uri).Sign(jwa.HS256, []byte(`secret`))
+		if !assert.Error(t, err, `dpop.Sign should fail`) {
+			return
+		}
+
+		// proof signed by a different key than the embedded one
+		hdrs := jws.NewHeaders()
+		_ = hdrs.Set(jws.TypeKey, dpop.Type)
+		_ = hdrs.Set(jws.JWKKey, pubkey)
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if !assert.NoError(t, err, `ecdsa.GenerateKey should succeed`) {
+			return
+		}
+		signed, err = jwt.Sign(tok, jwt.WithKey(jwa.ES256, otherKey, jws.WithProtectedHeaders(hdrs)))
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			return
+		}
+		_, err = dpop.Verify(signed, dpop.WithMethod(method), dpop.WithURI(uri))
+		if !assert.Error(t, err, `dpop.Verify should fail`) {
+			return
+		}
+	})
+}
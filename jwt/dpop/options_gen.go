@@ -0,0 +1,161 @@
+// This file is auto-generated by internal/cmd/genoptions/main.go. DO NOT EDIT
+
+package dpop
+
+import (
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/lestrrat-go/option"
+)
+
+type Option = option.Interface
+
+// VerifyOption describes an Option that can be passed to `dpop.Verify()`
+type VerifyOption interface {
+	Option
+	verifyOption()
+}
+
+type verifyOption struct {
+	Option
+}
+
+func (*verifyOption) verifyOption() {}
+
+type identAcceptableSkew struct{}
+type identAccessToken struct{}
+type identBoundToken struct{}
+type identClock struct{}
+type identKeyThumbprint struct{}
+type identKeyUsed struct{}
+type identMaxAge struct{}
+type identMethod struct{}
+type identNonce struct{}
+type identReplayCache struct{}
+type identURI struct{}
+
+func (identAcceptableSkew) String() string {
+	return "WithAcceptableSkew"
+}
+
+func (identAccessToken) String() string {
+	return "WithAccessToken"
+}
+
+func (identBoundToken) String() string {
+	return "WithBoundToken"
+}
+
+func (identClock) String() string {
+	return "WithClock"
+}
+
+func (identKeyThumbprint) String() string {
+	return "WithKeyThumbprint"
+}
+
+func (identKeyUsed) String() string {
+	return "WithKeyUsed"
+}
+
+func (identMaxAge) String() string {
+	return "WithMaxAge"
+}
+
+func (identMethod) String() string {
+	return "WithMethod"
+}
+
+func (identNonce) String() string {
+	return "WithNonce"
+}
+
+func (identReplayCache) String() string {
+	return "WithReplayCache"
+}
+
+func (identURI) String() string {
+	return "WithURI"
+}
+
+// WithAcceptableSkew specifies the duration by which the clocks of the
+// client and the server may differ. This value should be positive
+func WithAcceptableSkew(v time.Duration) VerifyOption {
+	return &verifyOption{option.New(identAcceptableSkew{}, v)}
+}
+
+// WithAccessToken specifies the access token that was presented
+// along with the proof. When specified, the proof must contain an "ath"
+// claim holding the hash of the access token.
+func WithAccessToken(v string) VerifyOption {
+	return &verifyOption{option.New(identAccessToken{}, v)}
+}
+
+// WithBoundToken specifies the DPoP-bound access token that was
+// presented along with the proof. The proof key must match the
+// thumbprint stored in the "jkt" member of the "cnf" claim of the token.
+//
+// This option only checks the key binding. Use `dpop.WithAccessToken()`
+// to check the "ath" claim as well.
+func WithBoundToken(v jwt.Token) VerifyOption {
+	return &verifyOption{option.New(identBoundToken{}, v)}
+}
+
+// WithClock specifies the `jwt.Clock` to be used when checking
+// the "iat" claim.
+func WithClock(v jwt.Clock) VerifyOption {
+	return &verifyOption{option.New(identClock{}, v)}
+}
+
+// WithKeyThumbprint specifies the base64url encoded SHA-256 JWK thumbprint
+// that the proof key must match, such as the "jkt" member of the "cnf"
+// claim in a DPoP-bound access token. See also `dpop.WithBoundToken()`
+func WithKeyThumbprint(v string) VerifyOption {
+	return &verifyOption{option.New(identKeyThumbprint{}, v)}
+}
+
+// WithKeyUsed allows you to specify a pointer to a variable to store the
+// `jwk.Key` that was embedded in the proof and used to verify it. This
+// is useful when issuing DPoP-bound tokens, as the key's thumbprint must be
+// recorded in the token.
+func WithKeyUsed(v interface{}) VerifyOption {
+	return &verifyOption{option.New(identKeyUsed{}, v)}
+}
+
+// WithMaxAge specifies how old a proof may be, based on its "iat" claim.
+// The default value is 5 minutes.
+func WithMaxAge(v time.Duration) VerifyOption {
+	return &verifyOption{option.New(identMaxAge{}, v)}
+}
+
+// WithMethod specifies the HTTP method of the request that the proof
+// was sent with. The value is compared against the "htm" claim.
+//
+// This option is required.
+func WithMethod(v string) VerifyOption {
+	return &verifyOption{option.New(identMethod{}, v)}
+}
+
+// WithNonce specifies the nonce that the server provided to the client.
+// When specified, the proof must contain a matching "nonce" claim.
+func WithNonce(v string) VerifyOption {
+	return &verifyOption{option.New(identNonce{}, v)}
+}
+
+// WithReplayCache specifies a `jwt.ReplayCache` that is used to reject
+// proofs that are being reused. Proofs do not have "iss" claims, so
+// the JWK thumbprint of the proof key is used in its place. Entries
+// are kept until the proof becomes too old to be accepted.
+func WithReplayCache(v jwt.ReplayCache) VerifyOption {
+	return &verifyOption{option.New(identReplayCache{}, v)}
+}
+
+// WithURI specifies the HTTP URI of the request that the proof
+// was sent with. The value is compared against the "htu" claim,
+// ignoring the query and fragment parts.
+//
+// This option is required.
+func WithURI(v string) VerifyOption {
+	return &verifyOption{option.New(identURI{}, v)}
+}
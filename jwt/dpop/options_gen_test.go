@@ -0,0 +1,23 @@
+// This file is auto-generated by internal/cmd/genoptions/main.go. DO NOT EDIT
+
+package dpop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptionIdent(t *testing.T) {
+	require.Equal(t, "WithAcceptableSkew", identAcceptableSkew{}.String())
+	require.Equal(t, "WithAccessToken", identAccessToken{}.String())
+	require.Equal(t, "WithBoundToken", identBoundToken{}.String())
+	require.Equal(t, "WithClock", identClock{}.String())
+	require.Equal(t, "WithKeyThumbprint", identKeyThumbprint{}.String())
+	require.Equal(t, "WithKeyUsed", identKeyUsed{}.String())
+	require.Equal(t, "WithMaxAge", identMaxAge{}.String())
+	require.Equal(t, "WithMethod", identMethod{}.String())
+	require.Equal(t, "WithNonce", identNonce{}.String())
+	require.Equal(t, "WithReplayCache", identReplayCache{}.String())
+	require.Equal(t, "WithURI", identURI{}.String())
+}
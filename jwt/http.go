@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -82,6 +83,10 @@ func ParseRequest(req *http.Request, options ...ParseOption) (Token, error) {
 	mfrms := pool.GetKeyToErrorMap()
 	defer pool.ReleaseKeyToErrorMap(mfrms)
 
+	// errs keeps the errors in the order they were encountered, so that
+	// they can be inspected using errors.Is and errors.As
+	var errs []error
+
 	for _, hdrkey := range hdrkeys {
 		// Check presence via a direct map lookup
 		if _, ok := req.Header[http.CanonicalHeaderKey(hdrkey)]; !ok {
@@ -92,6 +97,7 @@ func ParseRequest(req *http.Request, options ...ParseOption) (Token, error) {
 		tok, err := ParseHeader(req.Header, hdrkey, parseOptions...)
 		if err != nil {
 			mhdrs[hdrkey] = err
+			errs = append(errs, err)
 			continue
 		}
 		return tok, nil
@@ -113,6 +119,7 @@ func ParseRequest(req *http.Request, options ...ParseOption) (Token, error) {
 		tok, err := ParseForm(req.Form, formkey, parseOptions...)
 		if err != nil {
 			mfrms[formkey] = err
+			errs = append(errs, err)
 			continue
 		}
 		return tok, nil
@@ -184,5 +191,35 @@ func ParseRequest(req *http.Request, options ...ParseOption) (Token, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf(b.String())
+	return nil, &parseRequestError{msg: b.String(), errs: errs}
+}
+
+// parseRequestError is returned by ParseRequest when no valid token
+// could be found. If tokens were found but failed to be parsed, the
+// resulting errors can be examined using errors.Is and errors.As
+type parseRequestError struct {
+	msg  string
+	errs []error
+}
+
+func (e *parseRequestError) Error() string {
+	return e.msg
+}
+
+func (e *parseRequestError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *parseRequestError) As(target interface{}) bool {
+	for _, err := range e.errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
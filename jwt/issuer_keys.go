@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+)
+
+// IssuerKeys maps issuers to the key sources that are used to verify
+// the tokens that they issue. It is used with `jwt.WithIssuerKeys()`
+// when tokens from multiple issuers, each with their own keys, are
+// accepted.
+//
+// The "iss" claim of the token is read before the signature is verified,
+// and the token is only verified using the key source associated with
+// that issuer. Tokens from issuers that have not been added are rejected
+// before any keys are fetched. Once verified, the "iss" claim of the
+// resulting token is checked against the issuer whose keys were used.
+//
+//  keys := jwt.NewIssuerKeys().
+//    KeySet(`https://tenant1.example.com`, set).
+//    Cache(`https://tenant2.example.com`, cache, `https://tenant2.example.com/jwks.json`)
+//  tok, err := jwt.Parse(data, jwt.WithIssuerKeys(keys))
+//
+// The methods to add issuers are not safe for concurrent use. Once
+// populated, the object may be shared by multiple goroutines.
+type IssuerKeys struct {
+	sources map[string]jws.VerifyOption
+}
+
+// NewIssuerKeys creates a new empty `jwt.IssuerKeys` object
+func NewIssuerKeys() *IssuerKeys {
+	return &IssuerKeys{
+		sources: make(map[string]jws.VerifyOption),
+	}
+}
+
+// KeySet specifies that tokens from `iss` are verified using one of the
+// keys in `set`. The options are passed to `jws.WithKeySet()`
+func (ik *IssuerKeys) KeySet(iss string, set jwk.Set, options ...jws.WithKeySetSuboption) *IssuerKeys {
+	ik.sources[iss] = jws.WithKeySet(set, options...)
+	return ik
+}
+
+// Cache specifies that tokens from `iss` are verified using one of the
+// keys in the set registered in `cache` under `u`. The key set is
+// refreshed when a token is signed using an unknown key. The options
+// are passed to `jws.NewCachedKeyProvider()`
+//
+// The URL must already be registered in the cache.
+func (ik *IssuerKeys) Cache(iss string, cache *jwk.Cache, u string, options ...jws.CachedKeyProviderOption) *IssuerKeys {
+	return ik.KeyProvider(iss, jws.NewCachedKeyProvider(cache, u, options...))
+}
+
+// KeyProvider specifies that tokens from `iss` are verified using the
+// keys provided by `kp`
+func (ik *IssuerKeys) KeyProvider(iss string, kp jws.KeyProvider) *IssuerKeys {
+	ik.sources[iss] = jws.WithKeyProvider(kp)
+	return ik
+}
+
+// lookup returns the issuer of the token in the JWS message `data`, and
+// the option to verify the message with
+func (ik *IssuerKeys) lookup(data []byte) (string, jws.VerifyOption, error) {
+	msg, err := jws.Parse(data)
+	if err != nil {
+		return "", nil, fmt.Errorf(`failed to parse jws message: %w`, err)
+	}
+
+	var claims struct {
+		Issuer *string `json:"iss"`
+	}
+	if err := json.Unmarshal(msg.Payload(), &claims); err != nil {
+		return "", nil, fmt.Errorf(`failed to parse %q claim from unverified token: %w`, IssuerKey, err)
+	}
+	if claims.Issuer == nil {
+		return "", nil, fmt.Errorf(`%q claim is required to look up keys`, IssuerKey)
+	}
+
+	iss := *claims.Issuer
+	source, ok := ik.sources[iss]
+	if !ok {
+		return "", nil, fmt.Errorf(`issuer %q is not allowed`, iss)
+	}
+	return iss, source, nil
+}
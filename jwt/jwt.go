@@ -12,6 +12,7 @@ import (
 
 	"github.com/lestrrat-go/jwx/v2"
 	"github.com/lestrrat-go/jwx/v2/internal/json"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jws"
 )
 
@@ -105,6 +106,8 @@ type parseCtx struct {
 	token            Token
 	validateOpts     []ValidateOption
 	verifyOpts       []jws.VerifyOption
+	issuerKeys       *IssuerKeys
+	issuer           string
 	localReg         *json.Registry
 	pedantic         bool
 	skipVerification bool
@@ -124,6 +127,9 @@ func parseBytes(data []byte, options ...ParseOption) (Token, error) {
 	verification := true
 
 	var verifyOpts []Option
+	var critical []string
+	var allowedAlgs []jwa.SignatureAlgorithm
+	var localAllowedAlgs bool
 	for _, o := range options {
 		if v, ok := o.(ValidateOption); ok {
 			ctx.validateOpts = append(ctx.validateOpts, v)
@@ -134,6 +140,17 @@ func parseBytes(data []byte, options ...ParseOption) (Token, error) {
 		switch o.Ident() {
 		case identKey{}, identKeySet{}, identVerifyAuto{}, identKeyProvider{}:
 			verifyOpts = append(verifyOpts, o)
+		case identIssuerKeys{}:
+			ctx.issuerKeys = o.Value().(*IssuerKeys)
+		case identCriticalExtensions{}:
+			critical = append(critical, o.Value().([]string)...)
+		case identAllowedAlgorithms{}:
+			algs := o.Value().([]jwa.SignatureAlgorithm)
+			if len(algs) == 0 {
+				return nil, fmt.Errorf(`jwt.WithAllowedAlgorithms() must be given at least one algorithm`)
+			}
+			allowedAlgs = append(allowedAlgs, algs...)
+			localAllowedAlgs = true
 		case identToken{}:
 			token, ok := o.Value().(Token)
 			if !ok {
@@ -156,15 +173,26 @@ func parseBytes(data []byte, options ...ParseOption) (Token, error) {
 	}
 
 	lvo := len(verifyOpts)
-	if lvo == 0 && verification {
+	if ctx.issuerKeys != nil {
+		// keys must only be chosen based on the issuer
+		if lvo > 0 {
+			return nil, fmt.Errorf(`jwt.Parse: jwt.WithIssuerKeys() may not be combined with other key sources`)
+		}
+	} else if lvo == 0 && verification {
 		return nil, fmt.Errorf(`jwt.Parse: no keys for verification are provided (use jwt.WithVerify(false) to explicitly skip)`)
 	}
 
-	if lvo > 0 {
+	if lvo > 0 || ctx.issuerKeys != nil {
 		converted, err := toVerifyOptions(verifyOpts...)
 		if err != nil {
 			return nil, fmt.Errorf(`jwt.Parse: failed to convert options into jws.VerifyOption: %w`, err)
 		}
+		if len(critical) > 0 {
+			converted = append(converted, jws.WithCriticalExtensions(critical...))
+		}
+		if localAllowedAlgs {
+			converted = append(converted, jws.WithAllowedAlgorithms(allowedAlgs...))
+		}
 		ctx.verifyOpts = converted
 	}
 
@@ -182,6 +210,20 @@ const (
 var _ = _JwsVerifyInvalid
 
 func verifyJWS(ctx *parseCtx, payload []byte) ([]byte, int, error) {
+	if ik := ctx.issuerKeys; ik != nil {
+		iss, source, err := ik.lookup(payload)
+		if err != nil {
+			return nil, _JwsVerifyInvalid, fmt.Errorf(`jwt.Parse: %w`, err)
+		}
+		ctx.issuer = iss
+
+		options := make([]jws.VerifyOption, 0, len(ctx.verifyOpts)+1)
+		options = append(options, ctx.verifyOpts...)
+		options = append(options, source)
+		verified, err := jws.Verify(payload, options...)
+		return verified, _JwsVerifyDone, err
+	}
+
 	if len(ctx.verifyOpts) == 0 {
 		return nil, _JwsVerifySkipped, nil
 	}
@@ -299,6 +341,12 @@ OUTER:
 		return nil, fmt.Errorf(`failed to parse token: %w`, err)
 	}
 
+	// the keys were chosen based on the unverified "iss" claim, so
+	// make sure that the token actually contains the same value
+	if ctx.issuerKeys != nil && ctx.token.Issuer() != ctx.issuer {
+		return nil, fmt.Errorf(`jwt.Parse: %q claim does not match the issuer whose keys were used (%q)`, IssuerKey, ctx.issuer)
+	}
+
 	if ctx.validate {
 		if err := Validate(ctx.token, ctx.validateOpts...); err != nil {
 			return nil, err
@@ -3,12 +3,14 @@ package jwt_test
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -669,6 +671,67 @@ func TestSignJWK(t *testing.T) {
 	assert.Len(t, signatures, 1)
 }
 
+// opaqueSigner emulates a key that is stored in a KMS, which is only
+// available as a crypto.Signer
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s *opaqueSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestSignCryptoSigner(t *testing.T) {
+	t.Parallel()
+	rsakey, err := jwxtest.GenerateRsaKey()
+	if !assert.NoError(t, err, `jwxtest.GenerateRsaKey should succeed`) {
+		return
+	}
+	ecdsakey, err := jwxtest.GenerateEcdsaKey(jwa.P256)
+	if !assert.NoError(t, err, `jwxtest.GenerateEcdsaKey should succeed`) {
+		return
+	}
+	ed25519key, err := jwxtest.GenerateEd25519Key()
+	if !assert.NoError(t, err, `jwxtest.GenerateEd25519Key should succeed`) {
+		return
+	}
+
+	testcases := []struct {
+		Alg jwa.SignatureAlgorithm
+		Key crypto.Signer
+	}{
+		{Alg: jwa.RS256, Key: rsakey},
+		{Alg: jwa.PS384, Key: rsakey},
+		{Alg: jwa.ES256, Key: ecdsakey},
+		{Alg: jwa.EdDSA, Key: ed25519key},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Alg.String(), func(t *testing.T) {
+			t.Parallel()
+			tok := jwt.New()
+			_ = tok.Set(jwt.SubjectKey, `jwx`)
+
+			signed, err := jwt.Sign(tok, jwt.WithKey(tc.Alg, &opaqueSigner{signer: tc.Key}))
+			if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+				return
+			}
+
+			parsed, err := jwt.Parse(signed, jwt.WithKey(tc.Alg, tc.Key.Public()))
+			if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+				return
+			}
+			if !assert.Equal(t, `jwx`, parsed.Subject(), `subject should match`) {
+				return
+			}
+		})
+	}
+}
+
 func getJWTHeaders(jwt []byte) (jws.Headers, error) {
 	msg, err := jws.Parse(jwt)
 	if err != nil {
@@ -969,6 +1032,104 @@ func TestParseRequest(t *testing.T) {
 	}
 }
 
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	privkey, _ := jwxtest.GenerateEcdsaJwk()
+	privkey.Set(jwk.AlgorithmKey, jwa.ES256)
+	privkey.Set(jwk.KeyIDKey, `my-awesome-key`)
+	pubkey, _ := jwk.PublicKeyOf(privkey)
+
+	set := jwk.NewSet()
+	set.Add(pubkey)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(`Content-Type`, `application/json`)
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := jwk.NewCache(ctx)
+	if !assert.NoError(t, cache.Register(srv.URL), `cache.Register should succeed`) {
+		return
+	}
+
+	sign := func(exp time.Time) string {
+		tok := jwt.New()
+		tok.Set(jwt.IssuerKey, `https://github.com/lestrrat-go/jwx`)
+		tok.Set(jwt.ExpirationKey, exp)
+		signed, _ := jwt.Sign(tok, jwt.WithKey(jwa.ES256, privkey))
+		return string(signed)
+	}
+
+	handler := jwt.Middleware(
+		jwt.WithRealm(`example`),
+		jwt.WithCachedKeySet(cache, srv.URL),
+		jwt.WithIssuer(`https://github.com/lestrrat-go/jwx`),
+	)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tok, ok := jwt.TokenFromContext(req.Context())
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, tok.Issuer())
+	}))
+
+	testcases := []struct {
+		Name          string
+		Authorization string
+		Status        int
+		Challenge     string
+	}{
+		{
+			Name:          "Valid token",
+			Authorization: `Bearer ` + sign(time.Now().Add(time.Hour)),
+			Status:        http.StatusOK,
+		},
+		{
+			Name:      "Missing token",
+			Status:    http.StatusUnauthorized,
+			Challenge: `Bearer realm="example"`,
+		},
+		{
+			Name:          "Expired token",
+			Authorization: `Bearer ` + sign(time.Now().Add(-time.Hour)),
+			Status:        http.StatusUnauthorized,
+			Challenge:     `Bearer realm="example", error="invalid_token", error_description="The access token expired"`,
+		},
+		{
+			Name:          "Invalid token",
+			Authorization: `Bearer foo.bar.baz`,
+			Status:        http.StatusUnauthorized,
+			Challenge:     `Bearer realm="example", error="invalid_token", error_description="The access token is invalid"`,
+		},
+	}
+	for _, tc := range testcases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, `https://example.com`, nil)
+			if tc.Authorization != "" {
+				req.Header.Set(`Authorization`, tc.Authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if !assert.Equal(t, tc.Status, rec.Code, `status should match`) {
+				return
+			}
+			if !assert.Equal(t, tc.Challenge, rec.Header().Get(`WWW-Authenticate`), `WWW-Authenticate should match`) {
+				return
+			}
+			if tc.Status == http.StatusOK {
+				if !assert.Equal(t, `https://github.com/lestrrat-go/jwx`, rec.Body.String(), `body should match`) {
+					return
+				}
+			}
+		})
+	}
+}
+
 func TestGHIssue368(t *testing.T) {
 	// DO NOT RUN THIS IN PARALLEL
 	for _, flatten := range []bool{true, false} {
@@ -1472,3 +1633,152 @@ func TestSerializer(t *testing.T) {
 		}
 	})
 }
+
+func TestCriticalExtensions(t *testing.T) {
+	key := []byte("secret")
+
+	hdrs := jws.NewHeaders()
+	if !assert.NoError(t, hdrs.Set(jws.CriticalKey, []string{"exp"}), `hdrs.Set should succeed`) {
+		return
+	}
+	if !assert.NoError(t, hdrs.Set("exp", 1363284000), `hdrs.Set should succeed`) {
+		return
+	}
+
+	signed, err := jwt.Sign(jwt.New(), jwt.WithKey(jwa.HS256, key, jws.WithProtectedHeaders(hdrs)))
+	if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+		return
+	}
+
+	if _, err = jwt.Parse(signed, jwt.WithKey(jwa.HS256, key)); !assert.Error(t, err, `jwt.Parse should fail`) {
+		return
+	}
+
+	if _, err = jwt.Parse(signed, jwt.WithKey(jwa.HS256, key), jwt.WithCriticalExtensions("exp")); !assert.NoError(t, err, `jwt.Parse should succeed`) {
+		return
+	}
+}
+
+func TestAllowedAlgorithms(t *testing.T) {
+	key := []byte("secret")
+
+	signed, err := jwt.Sign(jwt.New(), jwt.WithKey(jwa.HS256, key))
+	if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+		return
+	}
+
+	if _, err = jwt.Parse(signed, jwt.WithKey(jwa.HS256, key), jwt.WithAllowedAlgorithms(jwa.HS384, jwa.HS512)); !assert.Error(t, err, `jwt.Parse should fail`) {
+		return
+	}
+
+	if _, err = jwt.Parse(signed, jwt.WithKey(jwa.HS256, key), jwt.WithAllowedAlgorithms(jwa.HS256)); !assert.NoError(t, err, `jwt.Parse should succeed`) {
+		return
+	}
+
+	jws.Settings(jws.WithAllowedAlgorithms(jwa.HS512))
+	defer jws.Settings(jws.WithAllowedAlgorithms())
+	if _, err = jwt.Parse(signed, jwt.WithKey(jwa.HS256, key), jwt.WithAllowedAlgorithms()); !assert.Error(t, err, `jwt.Parse should fail with an empty list`) {
+		return
+	}
+}
+
+func TestIssuerKeys(t *testing.T) {
+	t.Parallel()
+
+	const iss1 = `https://tenant1.example.com`
+	const iss2 = `https://tenant2.example.com`
+
+	newKey := func(kid string) (jwk.Key, jwk.Key) {
+		key, err := jwxtest.GenerateEcdsaJwk()
+		if !assert.NoError(t, err, `jwxtest.GenerateEcdsaJwk should succeed`) {
+			t.FailNow()
+		}
+		_ = key.Set(jwk.KeyIDKey, kid)
+		_ = key.Set(jwk.AlgorithmKey, jwa.ES256)
+		pubkey, err := jwk.PublicKeyOf(key)
+		if !assert.NoError(t, err, `jwk.PublicKeyOf should succeed`) {
+			t.FailNow()
+		}
+		return key, pubkey
+	}
+
+	key1, pubkey1 := newKey(`tenant1`)
+	key2, pubkey2 := newKey(`tenant2`)
+
+	set1 := jwk.NewSet()
+	_ = set1.Add(pubkey1)
+
+	var mu sync.Mutex
+	var fetchCount int
+	kp2 := jws.KeyProviderFunc(func(_ context.Context, sink jws.KeySink, _ *jws.Signature, _ *jws.Message) error {
+		mu.Lock()
+		fetchCount++
+		mu.Unlock()
+		sink.Key(jwa.ES256, pubkey2)
+		return nil
+	})
+	getFetchCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetchCount
+	}
+
+	keys := jwt.NewIssuerKeys().
+		KeySet(iss1, set1).
+		KeyProvider(iss2, kp2)
+
+	sign := func(iss string, key jwk.Key) []byte {
+		tok := jwt.New()
+		if iss != "" {
+			_ = tok.Set(jwt.IssuerKey, iss)
+		}
+		signed, err := jwt.Sign(tok, jwt.WithKey(jwa.ES256, key))
+		if !assert.NoError(t, err, `jwt.Sign should succeed`) {
+			t.FailNow()
+		}
+		return signed
+	}
+
+	t.Run("Keys are chosen by issuer", func(t *testing.T) {
+		tok, err := jwt.Parse(sign(iss1, key1), jwt.WithIssuerKeys(keys))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, iss1, tok.Issuer(), `issuer should match`) {
+			return
+		}
+
+		tok, err = jwt.Parse(sign(iss2, key2), jwt.WithIssuerKeys(keys))
+		if !assert.NoError(t, err, `jwt.Parse should succeed`) {
+			return
+		}
+		if !assert.Equal(t, iss2, tok.Issuer(), `issuer should match`) {
+			return
+		}
+	})
+	t.Run("Keys of other issuers are not used", func(t *testing.T) {
+		// signed by tenant2, but claims to be from tenant1
+		_, err := jwt.Parse(sign(iss1, key2), jwt.WithIssuerKeys(keys))
+		if !assert.Error(t, err, `jwt.Parse should fail`) {
+			return
+		}
+	})
+	t.Run("Unknown issuers are rejected before fetching keys", func(t *testing.T) {
+		count := getFetchCount()
+		for _, iss := range []string{`https://unknown.example.com`, ``} {
+			_, err := jwt.Parse(sign(iss, key2), jwt.WithIssuerKeys(keys))
+			if !assert.Error(t, err, `jwt.Parse should fail`) {
+				return
+			}
+		}
+		if !assert.Equal(t, count, getFetchCount(), `keys should not be fetched`) {
+			return
+		}
+	})
+	t.Run("Other key sources are not allowed", func(t *testing.T) {
+		_, err := jwt.Parse(sign(iss1, key1), jwt.WithIssuerKeys(keys), jwt.WithKey(jwa.ES256, pubkey1))
+		if !assert.Error(t, err, `jwt.Parse should fail`) {
+			return
+		}
+	})
+}
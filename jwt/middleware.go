@@ -0,0 +1,164 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/option"
+)
+
+type identTokenCtx struct{}
+
+// TokenFromContext returns the Token that was stored in the context
+// by the handler created by `jwt.Middleware()`
+func TokenFromContext(ctx context.Context) (Token, bool) {
+	tok, ok := ctx.Value(identTokenCtx{}).(Token)
+	return tok, ok
+}
+
+type withCachedKeySet struct {
+	cache   *jwk.Cache
+	url     string
+	options []interface{}
+}
+
+// WithCachedKeySet specifies that the token should be verified using the
+// key set registered in `cache` under `u`. The key set is retrieved from the
+// cache upon each request, so that updates to the key set are picked up
+// without having to recreate the middleware.
+//
+// The `options` are passed to `jwt.WithKeySet()`. The URL must already be
+// registered in the cache.
+func WithCachedKeySet(cache *jwk.Cache, u string, options ...interface{}) MiddlewareOption {
+	return &middlewareOption{option.New(identCachedKeySet{}, &withCachedKeySet{
+		cache:   cache,
+		url:     u,
+		options: options,
+	})}
+}
+
+type middleware struct {
+	next    http.Handler
+	realm   string
+	keySet  *withCachedKeySet
+	options []ParseOption
+}
+
+// Middleware creates a function that wraps an http.Handler to require
+// a valid JWT in requests. The token is searched for and verified using
+// `jwt.ParseRequest()` with the given ParseOptions, and once verified, it
+// is stored in the request context. Use `jwt.TokenFromContext()` to retrieve it.
+//
+// Requests without valid tokens are rejected with responses described in
+// RFC6750. That is, a `WWW-Authenticate` header using the "Bearer" scheme
+// is returned along with status 401, and the "error" attribute is set to
+// "invalid_token" if a token was present but was invalid or expired.
+func Middleware(options ...MiddlewareOption) func(http.Handler) http.Handler {
+	var realm string
+	var keySet *withCachedKeySet
+	var parseOptions []ParseOption
+	for _, option := range options {
+		//nolint:forcetypeassert
+		switch option.Ident() {
+		case identRealm{}:
+			realm = option.Value().(string)
+		case identCachedKeySet{}:
+			keySet = option.Value().(*withCachedKeySet)
+		default:
+			if po, ok := option.(ParseOption); ok {
+				parseOptions = append(parseOptions, po)
+			}
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return &middleware{
+			next:    next,
+			realm:   realm,
+			keySet:  keySet,
+			options: parseOptions,
+		}
+	}
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+
+	// request context comes first, so that it may be overridden
+	options := make([]ParseOption, 0, len(m.options)+2)
+	options = append(options, WithContext(ctx))
+	options = append(options, m.options...)
+	if ks := m.keySet; ks != nil {
+		set, err := ks.cache.Get(ctx, ks.url)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		options = append(options, WithKeySet(set, ks.options...))
+	}
+
+	tok, err := ParseRequest(req, options...)
+	if err != nil {
+		m.error(w, err)
+		return
+	}
+
+	m.next.ServeHTTP(w, req.WithContext(context.WithValue(ctx, identTokenCtx{}, tok)))
+}
+
+func (m *middleware) error(w http.ResponseWriter, err error) {
+	var pre *parseRequestError
+	if !errors.As(err, &pre) {
+		// the request itself could not be processed
+		m.challenge(w, http.StatusBadRequest, `invalid_request`, `The request could not be parsed`)
+		return
+	}
+
+	switch {
+	case len(pre.errs) == 0:
+		// RFC6750 section 3.1: if the request lacks any authentication
+		// information, the error code should not be included
+		m.challenge(w, http.StatusUnauthorized, ``, ``)
+	case errors.Is(err, ErrTokenExpired()):
+		m.challenge(w, http.StatusUnauthorized, `invalid_token`, `The access token expired`)
+	default:
+		m.challenge(w, http.StatusUnauthorized, `invalid_token`, `The access token is invalid`)
+	}
+}
+
+func (m *middleware) challenge(w http.ResponseWriter, status int, code, description string) {
+	var params []string
+	if m.realm != "" {
+		params = append(params, `realm=`+quoteAuthParam(m.realm))
+	}
+	if code != "" {
+		params = append(params, `error=`+quoteAuthParam(code))
+	}
+	if description != "" {
+		params = append(params, `error_description=`+quoteAuthParam(description))
+	}
+
+	challenge := `Bearer`
+	if len(params) > 0 {
+		challenge += ` ` + strings.Join(params, `, `)
+	}
+	w.Header().Set(`WWW-Authenticate`, challenge)
+	http.Error(w, http.StatusText(status), status)
+}
+
+// quoteAuthParam quotes s as a quoted-string (RFC7230 section 3.2.6)
+func quoteAuthParam(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range []byte(s) {
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/lestrrat-go/option"
 )
 
+type identAllowedAlgorithms struct{}
+type identCriticalExtensions struct{}
 type identKey struct{}
 type identKeySet struct{}
 type identTypedClaim struct{}
@@ -295,3 +297,25 @@ func WithMinDelta(dur time.Duration, c1, c2 string) ValidateOption {
 func WithVerifyAuto(f jwk.Fetcher, options ...jwk.FetchOption) ParseOption {
 	return &parseOption{option.New(identVerifyAuto{}, jws.WithVerifyAuto(f, options...))}
 }
+
+// WithCriticalExtensions specifies the names of the JWS header parameters
+// listed in the "crit" header that the caller understands and processes.
+// The names are passed to `jws.Verify()` via `jws.WithCriticalExtensions()`
+// when the token is verified.
+//
+// By default tokens whose "crit" header contains extensions that are
+// not processed by this library are rejected.
+func WithCriticalExtensions(names ...string) ParseOption {
+	return &parseOption{option.New(identCriticalExtensions{}, names)}
+}
+
+// WithAllowedAlgorithms specifies the signature algorithms that are
+// accepted when the token is verified. The algorithms are passed to
+// `jws.Verify()` via `jws.WithAllowedAlgorithms()`, which means that tokens
+// signed using other algorithms are rejected before any keys are looked up.
+//
+// If this option is not specified, the global list configured via
+// `jws.Settings()` is used. Passing an empty list is an error.
+func WithAllowedAlgorithms(algs ...jwa.SignatureAlgorithm) ParseOption {
+	return &parseOption{option.New(identAllowedAlgorithms{}, algs)}
+}
@@ -38,13 +38,26 @@ type globalOption struct {
 
 func (*globalOption) globalOption() {}
 
+// MiddlewareOption describes an Option that can be passed to `jwt.Middleware()`.
+type MiddlewareOption interface {
+	Option
+	middlewareOption()
+}
+
+type middlewareOption struct {
+	Option
+}
+
+func (*middlewareOption) middlewareOption() {}
+
 // ParseOption describes an Option that can be passed to `jwt.Parse()`.
-// ParseOption also implements ReadFileOption, therefore it may be
-// safely pass them to `jwt.ReadFile()`
+// ParseOption also implements ReadFileOption and MiddlewareOption, therefore
+// it may be safely passed to `jwt.ReadFile()` and `jwt.Middleware()`
 type ParseOption interface {
 	Option
 	parseOption()
 	readFileOption()
+	middlewareOption()
 }
 
 type parseOption struct {
@@ -55,6 +68,8 @@ func (*parseOption) parseOption() {}
 
 func (*parseOption) readFileOption() {}
 
+func (*parseOption) middlewareOption() {}
+
 // ReadFileOption is a type of `Option` that can be passed to `jws.ReadFile`
 type ReadFileOption interface {
 	Option
@@ -74,6 +89,7 @@ type SignEncryptParseOption interface {
 	parseOption()
 	encryptOption()
 	readFileOption()
+	middlewareOption()
 	signOption()
 }
 
@@ -87,6 +103,8 @@ func (*signEncryptParseOption) encryptOption() {}
 
 func (*signEncryptParseOption) readFileOption() {}
 
+func (*signEncryptParseOption) middlewareOption() {}
+
 func (*signEncryptParseOption) signOption() {}
 
 // SignOption describes an Option that can be passed to `jwt.Sign()` or
@@ -109,6 +127,7 @@ type ValidateOption interface {
 	Option
 	parseOption()
 	readFileOption()
+	middlewareOption()
 	validateOption()
 }
 
@@ -120,9 +139,12 @@ func (*validateOption) parseOption() {}
 
 func (*validateOption) readFileOption() {}
 
+func (*validateOption) middlewareOption() {}
+
 func (*validateOption) validateOption() {}
 
 type identAcceptableSkew struct{}
+type identCachedKeySet struct{}
 type identClock struct{}
 type identContext struct{}
 type identEncryptOption struct{}
@@ -130,8 +152,11 @@ type identFS struct{}
 type identFlattenAudience struct{}
 type identFormKey struct{}
 type identHeaderKey struct{}
+type identIssuerKeys struct{}
 type identKeyProvider struct{}
 type identPedantic struct{}
+type identRealm struct{}
+type identReplayCache struct{}
 type identSignOption struct{}
 type identToken struct{}
 type identValidate struct{}
@@ -142,6 +167,10 @@ func (identAcceptableSkew) String() string {
 	return "WithAcceptableSkew"
 }
 
+func (identCachedKeySet) String() string {
+	return "WithCachedKeySet"
+}
+
 func (identClock) String() string {
 	return "WithClock"
 }
@@ -170,6 +199,10 @@ func (identHeaderKey) String() string {
 	return "WithHeaderKey"
 }
 
+func (identIssuerKeys) String() string {
+	return "WithIssuerKeys"
+}
+
 func (identKeyProvider) String() string {
 	return "WithKeyProvider"
 }
@@ -178,6 +211,14 @@ func (identPedantic) String() string {
 	return "WithPedantic"
 }
 
+func (identRealm) String() string {
+	return "WithRealm"
+}
+
+func (identReplayCache) String() string {
+	return "WithReplayCache"
+}
+
 func (identSignOption) String() string {
 	return "WithSignOption"
 }
@@ -261,6 +302,16 @@ func WithHeaderKey(v string) ParseOption {
 	return &parseOption{option.New(identHeaderKey{}, v)}
 }
 
+// WithIssuerKeys specifies that the token should be verified using the
+// key source associated with the issuer in the "iss" claim of the token.
+// Please read the documentation for `jwt.IssuerKeys` for details.
+//
+// This option may not be combined with other options that specify keys,
+// such as `jwt.WithKey()`, `jwt.WithKeySet()` and `jwt.WithKeyProvider()`.
+func WithIssuerKeys(v *IssuerKeys) ParseOption {
+	return &parseOption{option.New(identIssuerKeys{}, v)}
+}
+
 // WithKeyProvider allows users to specify an object to provide keys to
 // sign/verify tokens using arbitrary code. Please read the documentation
 // for `jws.KeyProvider` in the `jws` package for details on how this works.
@@ -274,6 +325,27 @@ func WithPedantic(v bool) ParseOption {
 	return &parseOption{option.New(identPedantic{}, v)}
 }
 
+// WithRealm specifies the value of the "realm" attribute in the
+// `WWW-Authenticate` header returned by `jwt.Middleware()`
+func WithRealm(v string) MiddlewareOption {
+	return &middlewareOption{option.New(identRealm{}, v)}
+}
+
+// WithReplayCache specifies a `jwt.ReplayCache` that is used to detect
+// tokens that are being reused. The pair of "iss" and "jti" claims is
+// recorded in the cache until the token expires, and subsequent
+// validations of a token with the same pair will fail with
+// `jwt.ErrTokenReplayed()`.
+//
+// Tokens without a "jti" claim are rejected when this option is specified.
+//
+// The check is performed after all other validations have succeeded,
+// so that tokens that fail validation for other reasons are not recorded.
+// See `jwt.NewMemoryReplayCache()` for an in-memory implementation.
+func WithReplayCache(v ReplayCache) ValidateOption {
+	return &validateOption{option.New(identReplayCache{}, v)}
+}
+
 // WithSignOption provides an escape hatch for cases where extra options to
 // `jws.Sign()` must be specified when usng `jwt.Sign()`. Normally you do not
 // need to use this.
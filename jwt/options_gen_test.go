@@ -10,6 +10,7 @@ import (
 
 func TestOptionIdent(t *testing.T) {
 	require.Equal(t, "WithAcceptableSkew", identAcceptableSkew{}.String())
+	require.Equal(t, "WithCachedKeySet", identCachedKeySet{}.String())
 	require.Equal(t, "WithClock", identClock{}.String())
 	require.Equal(t, "WithContext", identContext{}.String())
 	require.Equal(t, "WithEncryptOption", identEncryptOption{}.String())
@@ -17,8 +18,11 @@ func TestOptionIdent(t *testing.T) {
 	require.Equal(t, "WithFlattenAudience", identFlattenAudience{}.String())
 	require.Equal(t, "WithFormKey", identFormKey{}.String())
 	require.Equal(t, "WithHeaderKey", identHeaderKey{}.String())
+	require.Equal(t, "WithIssuerKeys", identIssuerKeys{}.String())
 	require.Equal(t, "WithKeyProvider", identKeyProvider{}.String())
 	require.Equal(t, "WithPedantic", identPedantic{}.String())
+	require.Equal(t, "WithRealm", identRealm{}.String())
+	require.Equal(t, "WithReplayCache", identReplayCache{}.String())
 	require.Equal(t, "WithSignOption", identSignOption{}.String())
 	require.Equal(t, "WithToken", identToken{}.String())
 	require.Equal(t, "WithValidate", identValidate{}.String())
@@ -0,0 +1,177 @@
+package jwt
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ReplayCache records tokens that have already been seen, so that
+// one-time-use tokens can be rejected when they are presented again.
+// Tokens are identified by the pair of their "iss" and "jti" claims.
+//
+// Implementations must be safe for concurrent use. They may be backed
+// by shared storage such as Redis, in which case the check and the
+// recording of the pair should be done atomically.
+type ReplayCache interface {
+	// Add records the pair `iss` and `jti` until `exp`, and reports
+	// whether it was newly recorded. If the pair has already been
+	// recorded and has not expired yet, Add must return false.
+	//
+	// `exp` may be the zero value, in which case the token does not
+	// expire, and the pair should be kept for as long as possible.
+	Add(ctx context.Context, iss, jti string, exp time.Time) (bool, error)
+}
+
+var errTokenReplayed = NewValidationError(fmt.Errorf(`"jti" has already been used`))
+
+// ErrTokenReplayed returns the immutable error used when a token
+// has already been recorded in the `jwt.ReplayCache` specified
+// by `jwt.WithReplayCache()`
+func ErrTokenReplayed() error {
+	return errTokenReplayed
+}
+
+type replayCacheValidator struct {
+	cache ReplayCache
+}
+
+func (v *replayCacheValidator) Validate(ctx context.Context, t Token) error {
+	jti := t.JwtID()
+	if jti == "" {
+		return NewValidationError(fmt.Errorf(`%q not satisfied: required claim not found`, JwtIDKey))
+	}
+
+	exp := t.Expiration()
+	if !exp.IsZero() {
+		// The token is valid until exp + skew, so it has to be
+		// remembered for just as long
+		exp = exp.Add(ValidationCtxSkew(ctx))
+	}
+
+	added, err := v.cache.Add(ctx, t.Issuer(), jti, exp)
+	if err != nil {
+		return NewValidationError(fmt.Errorf(`failed to record "jti" in replay cache: %w`, err))
+	}
+	if !added {
+		return ErrTokenReplayed()
+	}
+	return nil
+}
+
+type replayCacheKey struct {
+	iss string
+	jti string
+}
+
+type replayCacheEntry struct {
+	key replayCacheKey
+	exp time.Time
+}
+
+// MemoryReplayCache is an in-memory implementation of `jwt.ReplayCache`.
+// It keeps at most a fixed number of entries, and evicts the least
+// recently used entries when the limit is reached.
+//
+// Because evicted tokens can be replayed, the size of the cache should
+// be large enough to hold all tokens that may be valid at the same time.
+// This cache is not shared between processes.
+type MemoryReplayCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[replayCacheKey]*list.Element
+	lru     *list.List
+}
+
+// NewMemoryReplayCache creates a new `jwt.MemoryReplayCache` that holds
+// at most `size` entries. If `size` is less than 1, the number of
+// entries is not limited. Expired entries are removed lazily.
+//
+// When used through `jwt.WithReplayCache()`, the clock specified by
+// `jwt.WithClock()` is used to determine if entries have expired.
+// Otherwise the current system time is used.
+func NewMemoryReplayCache(size int) *MemoryReplayCache {
+	return &MemoryReplayCache{
+		size:    size,
+		entries: make(map[replayCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Len returns the number of entries currently held in the cache,
+// including those that have expired but have not been removed yet
+func (c *MemoryReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Add implements `jwt.ReplayCache`. Looking up a pair marks it as the
+// most recently used, and a pair that has expired is recorded again
+// with the new expiration time.
+//
+// Expired entries are not removed until a new pair is added, at which
+// point expired entries at the least recently used end of the cache are
+// removed. If the cache still holds more than the maximum number of
+// entries, the least recently used entries are evicted.
+//
+// The current time is read from the clock stored in the validation
+// context (see `jwt.SetValidationCtxClock()`), which is the clock
+// specified by `jwt.WithClock()` when called from `jwt.Validate()`.
+// If `ctx` does not carry a clock, the current system time is used.
+func (c *MemoryReplayCache) Add(ctx context.Context, iss, jti string, exp time.Time) (bool, error) {
+	var clock Clock = ClockFunc(time.Now)
+	if v, ok := ctx.Value(identValidationCtxClock{}).(Clock); ok {
+		clock = v
+	}
+	now := clock.Now()
+	key := replayCacheKey{iss: iss, jti: jti}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*replayCacheEntry) //nolint:forcetypeassert
+		if entry.exp.IsZero() || now.Before(entry.exp) {
+			c.lru.MoveToFront(elem)
+			return false, nil
+		}
+
+		// the previous token has expired, so this one is allowed
+		entry.exp = exp
+		c.lru.MoveToFront(elem)
+		return true, nil
+	}
+
+	c.entries[key] = c.lru.PushFront(&replayCacheEntry{key: key, exp: exp})
+	c.purge(now)
+	return true, nil
+}
+
+// purge removes expired entries from the tail of the list, and if the
+// cache is still over capacity, the least recently used entries.
+// Must be called while holding the lock
+func (c *MemoryReplayCache) purge(now time.Time) {
+	for elem := c.lru.Back(); elem != nil; elem = c.lru.Back() {
+		entry := elem.Value.(*replayCacheEntry) //nolint:forcetypeassert
+		if entry.exp.IsZero() || now.Before(entry.exp) {
+			break
+		}
+		c.remove(elem)
+	}
+
+	if c.size < 1 {
+		return
+	}
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *MemoryReplayCache) remove(elem *list.Element) {
+	entry := elem.Value.(*replayCacheEntry) //nolint:forcetypeassert
+	delete(c.entries, entry.key)
+	c.lru.Remove(elem)
+}
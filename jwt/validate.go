@@ -46,6 +46,7 @@ func Validate(t Token, options ...ValidateOption) error {
 	ctx := context.Background()
 	var clock Clock = ClockFunc(time.Now)
 	var skew time.Duration
+	var replayCache ReplayCache
 	var validators = []Validator{
 		IsIssuedAtValid(),
 		IsExpirationValid(),
@@ -60,6 +61,8 @@ func Validate(t Token, options ...ValidateOption) error {
 			skew = o.Value().(time.Duration)
 		case identContext{}:
 			ctx = o.Value().(context.Context)
+		case identReplayCache{}:
+			replayCache = o.Value().(ReplayCache)
 		case identValidator{}:
 			v := o.Value().(Validator)
 			switch v := v.(type) {
@@ -81,6 +84,12 @@ func Validate(t Token, options ...ValidateOption) error {
 		}
 	}
 
+	// The replay cache records the token, so it must be consulted
+	// only after all other validations have passed
+	if replayCache != nil {
+		validators = append(validators, &replayCacheValidator{cache: replayCache})
+	}
+
 	ctx = SetValidationCtxSkew(ctx, skew)
 	ctx = SetValidationCtxClock(ctx, clock)
 	for _, v := range validators {
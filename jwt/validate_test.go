@@ -446,3 +446,97 @@ func TestClaimValidator(t *testing.T) {
 		})
 	}
 }
+
+func TestReplayCache(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1600000000, 0)
+	clock := jwt.ClockFunc(func() time.Time { return now })
+	newToken := func(iss, jti string, exp time.Time) jwt.Token {
+		tok := jwt.New()
+		_ = tok.Set(jwt.IssuerKey, iss)
+		if jti != "" {
+			_ = tok.Set(jwt.JwtIDKey, jti)
+		}
+		if !exp.IsZero() {
+			_ = tok.Set(jwt.ExpirationKey, exp)
+		}
+		return tok
+	}
+
+	t.Run("Reject reused tokens", func(t *testing.T) {
+		t.Parallel()
+		cache := jwt.NewMemoryReplayCache(10)
+		tok := newToken("https://example.com", "token-1", now.Add(time.Hour))
+		if !assert.NoError(t, jwt.Validate(tok, jwt.WithClock(clock), jwt.WithReplayCache(cache)), `first validation should succeed`) {
+			return
+		}
+		err := jwt.Validate(tok, jwt.WithClock(clock), jwt.WithReplayCache(cache))
+		if !assert.ErrorIs(t, err, jwt.ErrTokenReplayed(), `second validation should fail`) {
+			return
+		}
+		if !assert.True(t, jwt.IsValidationError(err), `error should be a validation error`) {
+			return
+		}
+
+		// same jti from a different issuer is a different token
+		if !assert.NoError(t, jwt.Validate(newToken("https://example.org", "token-1", now.Add(time.Hour)), jwt.WithClock(clock), jwt.WithReplayCache(cache)), `validation for different issuer should succeed`) {
+			return
+		}
+	})
+	t.Run("Missing jti", func(t *testing.T) {
+		t.Parallel()
+		cache := jwt.NewMemoryReplayCache(10)
+		if !assert.Error(t, jwt.Validate(newToken("https://example.com", "", time.Time{}), jwt.WithReplayCache(cache)), `validation should fail`) {
+			return
+		}
+	})
+	t.Run("Invalid tokens are not recorded", func(t *testing.T) {
+		t.Parallel()
+		cache := jwt.NewMemoryReplayCache(10)
+		tok := newToken("https://example.com", "token-1", now.Add(time.Hour))
+		if !assert.Error(t, jwt.Validate(tok, jwt.WithClock(clock), jwt.WithIssuer("https://example.org"), jwt.WithReplayCache(cache)), `validation should fail`) {
+			return
+		}
+		if !assert.Equal(t, 0, cache.Len(), `cache should be empty`) {
+			return
+		}
+	})
+	t.Run("Entries expire with the token", func(t *testing.T) {
+		t.Parallel()
+		cache := jwt.NewMemoryReplayCache(10)
+		tok := newToken("https://example.com", "token-1", now.Add(time.Minute))
+		if !assert.NoError(t, jwt.Validate(tok, jwt.WithClock(clock), jwt.WithReplayCache(cache)), `first validation should succeed`) {
+			return
+		}
+
+		// the token itself is expired at this point, so the cache is
+		// asked directly
+		later := jwt.SetValidationCtxClock(context.Background(), jwt.ClockFunc(func() time.Time { return now.Add(2 * time.Minute) }))
+		added, err := cache.Add(later, "https://example.com", "token-1", now.Add(time.Hour))
+		if !assert.NoError(t, err, `cache.Add should succeed`) {
+			return
+		}
+		if !assert.True(t, added, `expired entry should be replaced`) {
+			return
+		}
+	})
+	t.Run("Least recently used entries are evicted", func(t *testing.T) {
+		t.Parallel()
+		cache := jwt.NewMemoryReplayCache(2)
+		for _, jti := range []string{"a", "b", "c"} {
+			if !assert.NoError(t, jwt.Validate(newToken("", jti, time.Time{}), jwt.WithReplayCache(cache)), `validation should succeed`) {
+				return
+			}
+		}
+		if !assert.Equal(t, 2, cache.Len(), `cache should be capped`) {
+			return
+		}
+		if !assert.NoError(t, jwt.Validate(newToken("", "a", time.Time{}), jwt.WithReplayCache(cache)), `evicted token should be accepted`) {
+			return
+		}
+		if !assert.ErrorIs(t, jwt.Validate(newToken("", "c", time.Time{}), jwt.WithReplayCache(cache)), jwt.ErrTokenReplayed(), `recent token should be rejected`) {
+			return
+		}
+	})
+}
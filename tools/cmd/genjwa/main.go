@@ -408,11 +408,27 @@ func (t typ) Generate() error {
 	}
 	o.L("}")
 
-	o.LL("var list%sOnce sync.Once", t.name)
+	o.LL("var mu%[1]ss sync.RWMutex", t.name)
 	o.L("var list%[1]s []%[1]s", t.name)
-	o.LL("// %[1]ss returns a list of all available values for %[1]s", t.name)
-	o.L("func %[1]ss() []%[1]s {", t.name)
-	o.L("list%sOnce.Do(func() {", t.name)
+
+	o.LL("func init() {")
+	o.L("mu%ss.Lock()", t.name)
+	o.L("defer mu%ss.Unlock()", t.name)
+	o.L("rebuild%s()", t.name)
+	o.L("}")
+
+	o.LL("// Register%[1]s registers a new %[1]s so that the jwx can properly handle the new value.", t.name)
+	o.L("// Duplicates will silently be ignored")
+	o.L("func Register%[1]s(v %[1]s) {", t.name)
+	o.L("mu%ss.Lock()", t.name)
+	o.L("defer mu%ss.Unlock()", t.name)
+	o.L("if _, ok := all%ss[v]; !ok {", t.name)
+	o.L("all%ss[v] = struct{}{}", t.name)
+	o.L("rebuild%s()", t.name)
+	o.L("}")
+	o.L("}")
+
+	o.LL("func rebuild%s() {", t.name)
 	o.L("list%[1]s = make([]%[1]s, 0, len(all%[1]ss))", t.name)
 	o.L("for v := range all%ss {", t.name)
 	o.L("list%[1]s = append(list%[1]s, v)", t.name)
@@ -420,7 +436,12 @@ func (t typ) Generate() error {
 	o.L("sort.Slice(list%s, func(i, j int) bool {", t.name)
 	o.L("return string(list%[1]s[i]) < string(list%[1]s[j])", t.name)
 	o.L("})")
-	o.L("})")
+	o.L("}")
+
+	o.LL("// %[1]ss returns a list of all available values for %[1]s", t.name)
+	o.L("func %[1]ss() []%[1]s {", t.name)
+	o.L("mu%ss.RLock()", t.name)
+	o.L("defer mu%ss.RUnlock()", t.name)
 	o.L("return list%s", t.name)
 	o.L("}")
 
@@ -443,7 +464,10 @@ func (t typ) Generate() error {
 	o.L("tmp = %s(s)", t.name)
 	o.L("}")
 
-	o.L("if _, ok := all%ss[tmp]; !ok {", t.name)
+	o.L("mu%ss.RLock()", t.name)
+	o.L("_, ok := all%ss[tmp]", t.name)
+	o.L("mu%ss.RUnlock()", t.name)
+	o.L("if !ok {")
 	o.L("return fmt.Errorf(`invalid jwa.%s value`)", t.name)
 	o.L("}")
 
@@ -627,6 +651,21 @@ func (t typ) GenerateTest() error {
 	o.L("if !assert.Len(t, expected, 0) {")
 	o.L("return")
 	o.L("}")
+
+	o.LL("// Registering a new value must be done after the list of")
+	o.L("// elements has been checked, or else it would show up in the list")
+	o.L("const value = `custom-%s-value`", t.name)
+	o.L("var dst jwa.%s", t.name)
+	o.L("if !assert.Error(t, dst.Accept(value), `accept should fail before registration`) {")
+	o.L("return")
+	o.L("}")
+	o.L("jwa.Register%[1]s(jwa.%[1]s(value))", t.name)
+	o.L("if !assert.NoError(t, dst.Accept(value), `accept should succeed after registration`) {")
+	o.L("return")
+	o.L("}")
+	o.L("if !assert.Contains(t, jwa.%[1]ss(), jwa.%[1]s(value), `registered value should be listed`) {", t.name)
+	o.L("return")
+	o.L("}")
 	o.L("})")
 
 	o.L("}")
@@ -758,6 +758,14 @@ func generateGenericHeaders(fields codegen.FieldList) error {
 	o.L("// All fields are copied onto the new public key, except for those that are not allowed.")
 	o.L("//\n// If the key is already a public key, it returns a new copy minus the disallowed fields as above.")
 	o.L("PublicKey() (Key, error)")
+	o.LL("// Validate checks the structural and mathematical consistency of the key,")
+	o.L("// such as whether the EC point is on the curve, or the CRT values of an RSA")
+	o.L("// private key match its modulus. It also checks that the key is not smaller")
+	o.L("// than the minimum size configured via `jwk.Settings()`, and that the \"use\",")
+	o.L("// \"key_ops\" and \"alg\" fields do not contradict each other.")
+	o.L("//")
+	o.L("// The returned error is a `jwk.ValidationError`.")
+	o.L("Validate() error")
 	o.LL("// KeyType returns the `kid` of a JWK")
 	o.L("KeyType() jwa.KeyType")
 	for _, f := range fields {
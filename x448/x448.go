@@ -0,0 +1,152 @@
+package x448
+
+import (
+	"bytes"
+	"crypto"
+	cryptorand "crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/cloudflare/circl/dh/x448"
+)
+
+// This mirrors the x25519 package's structure for private/public "keys".
+// jwx requires dedicated types for these as they drive
+// serialization/deserialization logic, as well as encryption types.
+//
+// Note that with the x448 scheme, the private key is a sequence of
+// 56 bytes, while the public key is the result of X448(private,
+// basepoint).
+//
+// The scalar multiplication is provided by github.com/cloudflare/circl,
+// which runs in constant time.
+
+const (
+	// PublicKeySize is the size, in bytes, of public keys as used in this package.
+	PublicKeySize = 56
+	// PrivateKeySize is the size, in bytes, of private keys as used in this package.
+	PrivateKeySize = 112
+	// SeedSize is the size, in bytes, of private key seeds. These are the private key representations used by RFC 7748.
+	SeedSize = 56
+	// PointSize is the size, in bytes, of the input and output of the X448 function.
+	PointSize = 56
+)
+
+// Basepoint is the canonical curve448 generator (u = 5)
+var Basepoint []byte
+
+func init() {
+	Basepoint = make([]byte, PointSize)
+	Basepoint[0] = 5
+}
+
+// PublicKey is the type of X448 public keys
+type PublicKey []byte
+
+// Any methods implemented on PublicKey might need to also be implemented on
+// PrivateKey, as the latter embeds the former and will expose its methods.
+
+// Equal reports whether pub and x have the same value.
+func (pub PublicKey) Equal(x crypto.PublicKey) bool {
+	xx, ok := x.(PublicKey)
+	if !ok {
+		return false
+	}
+	return bytes.Equal(pub, xx)
+}
+
+// PrivateKey is the type of X448 private key
+type PrivateKey []byte
+
+// Public returns the PublicKey corresponding to priv.
+func (priv PrivateKey) Public() crypto.PublicKey {
+	publicKey := make([]byte, PublicKeySize)
+	copy(publicKey, priv[SeedSize:])
+	return PublicKey(publicKey)
+}
+
+// Equal reports whether priv and x have the same value.
+func (priv PrivateKey) Equal(x crypto.PrivateKey) bool {
+	xx, ok := x.(PrivateKey)
+	if !ok {
+		return false
+	}
+	return bytes.Equal(priv, xx)
+}
+
+// Seed returns the private key seed corresponding to priv. It is provided for
+// interoperability with RFC 7748. RFC 7748's private keys correspond to seeds
+// in this package.
+func (priv PrivateKey) Seed() []byte {
+	seed := make([]byte, SeedSize)
+	copy(seed, priv[:SeedSize])
+	return seed
+}
+
+// NewKeyFromSeed calculates a private key from a seed. It will return
+// an error if len(seed) is not SeedSize. This function is provided
+// for interoperability with RFC 7748. RFC 7748's private keys
+// correspond to seeds in this package.
+func NewKeyFromSeed(seed []byte) (PrivateKey, error) {
+	privateKey := make([]byte, PrivateKeySize)
+	if len(seed) != SeedSize {
+		return nil, fmt.Errorf("unexpected seed size: %d", len(seed))
+	}
+	copy(privateKey, seed)
+
+	var public, secret x448.Key
+	copy(secret[:], seed)
+	x448.KeyGen(&public, &secret)
+	copy(privateKey[SeedSize:], public[:])
+
+	return privateKey, nil
+}
+
+// GenerateKey generates a public/private key pair using entropy from rand.
+// If rand is nil, crypto/rand.Reader will be used.
+func GenerateKey(rand io.Reader) (PublicKey, PrivateKey, error) {
+	if rand == nil {
+		rand = cryptorand.Reader
+	}
+
+	seed := make([]byte, SeedSize)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return nil, nil, err
+	}
+
+	privateKey, err := NewKeyFromSeed(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey := make([]byte, PublicKeySize)
+	copy(publicKey, privateKey[SeedSize:])
+
+	return publicKey, privateKey, nil
+}
+
+// X448 returns the result of the scalar multiplication (scalar * point),
+// according to RFC 7748, Section 5. scalar and point must both be
+// 56 bytes long.
+//
+// If point is Basepoint, the result is the public key corresponding to
+// scalar. An error is returned if point is a low order point, as the
+// result would be the all-zero value.
+func X448(scalar, point []byte) ([]byte, error) {
+	if l := len(scalar); l != PointSize {
+		return nil, fmt.Errorf(`bad scalar length: %d, expected %d`, l, PointSize)
+	}
+	if l := len(point); l != PointSize {
+		return nil, fmt.Errorf(`bad point length: %d, expected %d`, l, PointSize)
+	}
+
+	var shared, secret, public x448.Key
+	copy(secret[:], scalar)
+	copy(public[:], point)
+	if !x448.Shared(&shared, &secret, &public) {
+		return nil, fmt.Errorf(`bad input point: low order point`)
+	}
+
+	out := make([]byte, PointSize)
+	copy(out, shared[:])
+	return out, nil
+}